@@ -0,0 +1,294 @@
+package tachibana
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultBacktestSessions - 東証の前場と後場
+var defaultBacktestSessions = []BacktestSession{
+	{Open: 9 * time.Hour, Close: 11*time.Hour + 30*time.Minute},
+	{Open: 12*time.Hour + 30*time.Minute, Close: 15*time.Hour + 30*time.Minute},
+}
+
+// BacktestTick - バックテストに流す時価情報
+type BacktestTick struct {
+	Time      time.Time                 // 受信日時 この時刻に時計を進める
+	IssueCode string                    // 銘柄コード
+	Board     MarketPriceStreamResponse // その時点の板 差分ではなく、BoardStateなどで組み立てた状態
+}
+
+// BacktestSession - 立会時間 その日の0時からの経過時間で、OpenからCloseの直前まで
+type BacktestSession struct {
+	Open  time.Duration // 寄付
+	Close time.Duration // 引け
+}
+
+// BacktestConfig - バックテストの設定
+type BacktestConfig struct {
+	PaperClientConfig                   // 模擬売買の設定 営業日は時価情報の日付を使う
+	Sessions          []BacktestSession // 立会時間 空なら東証の前場と後場
+	Client            Client            // 時価やマスタを取得するクライアント nilなら注文と余力、建玉、注文一覧以外はClientUnavailableErrを返す
+}
+
+// BacktestResult - バックテストの結果
+type BacktestResult struct {
+	Trades         []PaperTrade // 約定した順の約定
+	StartTime      time.Time    // 最初の時価情報の日時
+	EndTime        time.Time    // 最後の時価情報の日時
+	StartEquity    float64      // 開始時の評価額
+	EndEquity      float64      // 終了時の評価額
+	Profit         float64      // 評価額の増減
+	RealizedProfit float64      // 実現損益
+	ExitCount      int          // 保有や建玉を減らした約定の数
+	WinCount       int          // 実現損益が正の約定の数
+	LossCount      int          // 実現損益が負の約定の数
+	WinRate        float64      // WinCount / ExitCount
+	GrossProfit    float64      // 実現損益が正の約定の損益の合計
+	GrossLoss      float64      // 実現損益が負の約定の損益の合計 0以下
+	ProfitFactor   float64      // GrossProfit / -GrossLoss 損失がなく利益があれば+Inf
+	MaxDrawdown    float64      // 評価額の最大値からの最大の下落幅
+}
+
+// LoadBacktestTicks - StreamRecorderで記録したファイルから時価情報を読み込む
+// reqは記録したときのリクエストで、行番号から銘柄コードを引くのに使う 差分配信はBoardStateで組み立てる
+func LoadBacktestTicks(files []string, req StreamRequest) ([]BacktestTick, error) {
+	issueCodes := map[int]string{}
+	for i, column := range req.ColumnNumber {
+		if i < len(req.IssueCodes) {
+			issueCodes[column] = req.IssueCodes[i]
+		}
+	}
+
+	var ticks []BacktestTick
+	var frame streamFrame
+	state := NewBoardState()
+	replay := &StreamReplay{}
+	for _, name := range files {
+		err := replay.readFile(name, func(receivedAt time.Time, b []byte) bool {
+			frame.reset(b)
+			res, ok := decodeStreamFrame(&frame).(*MarketPriceStreamResponse)
+			if !ok {
+				return true
+			}
+			if issueCode, ok := issueCodes[res.ColumnNumber]; ok {
+				ticks = append(ticks, BacktestTick{Time: receivedAt, IssueCode: issueCode, Board: state.Apply(res)})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ticks, nil
+}
+
+// NewBacktest - バックテストを生成する ticksは時刻順に並べ替えて使う
+func NewBacktest(ticks []BacktestTick, config BacktestConfig) *Backtest {
+	sorted := append([]BacktestTick{}, ticks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	if len(config.Sessions) == 0 {
+		config.Sessions = defaultBacktestSessions
+	}
+	config.ExecutionDate = time.Time{}
+
+	clock := &backtestClock{}
+	if len(sorted) > 0 {
+		clock.now = sorted[0].Time
+	}
+	paper := NewPaperClient(config.Client, config.PaperClientConfig)
+	paper.clock = clock
+	paper.auctions = true
+
+	return &Backtest{ticks: sorted, config: config, clock: clock, paper: paper}
+}
+
+// Backtest - 記録した時価情報を流し、戦略の注文を模擬売買で約定させるバックテスト
+// 時計は時価情報の時刻で進み、注文は立会時間の中でだけ約定する
+// 寄付の注文は立会の最初の時価情報の始値(なければ現在値)で、引けと不成の注文は立会の最後の現在値で、板の数量によらずすべて約定する
+// 逆指値とOCOは現在値で判定し、呼値の単位はPaperClientConfig.TickSizeで確認する
+type Backtest struct {
+	ticks  []BacktestTick
+	config BacktestConfig
+	clock  *backtestClock
+	paper  *PaperClient
+}
+
+// Client - 戦略に渡すクライアント Runのハンドラの中で注文する
+// イベントはRunのハンドラに渡されるので、Streamは使わない
+func (b *Backtest) Client() *PaperClient {
+	return b.paper
+}
+
+// backtestSession - 立会時間の日時
+type backtestSession struct {
+	open  time.Time
+	close time.Time
+}
+
+// session - tの属する立会時間 立会時間外ならfalse
+func (b *Backtest) session(t time.Time) (backtestSession, bool) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for _, s := range b.config.Sessions {
+		open, close := day.Add(s.Open), day.Add(s.Close)
+		if !t.Before(open) && t.Before(close) {
+			return backtestSession{open: open, close: close}, true
+		}
+	}
+	return backtestSession{}, false
+}
+
+// Run - 時価情報を時刻順に流し、時価情報と模擬売買の約定通知をハンドラに渡す
+// ハンドラは1つずつ呼ばれ、panicしてもOnPanicに通知して続ける ctxが終了したらctxのエラーを返す
+// 1つのBacktestでRunを呼べるのは1回だけ
+func (b *Backtest) Run(ctx context.Context, handlers *StreamHandlers) (*BacktestResult, error) {
+	if handlers == nil {
+		handlers = &StreamHandlers{}
+	}
+
+	sub := &paperSubscriber{notify: make(chan struct{}, 1)}
+	b.paper.mtx.Lock()
+	b.paper.subscribers[sub] = struct{}{}
+	b.paper.mtx.Unlock()
+	defer func() {
+		b.paper.mtx.Lock()
+		delete(b.paper.subscribers, sub)
+		b.paper.mtx.Unlock()
+	}()
+
+	// ハンドラが注文すると約定通知が増えるので、なくなるまで渡す
+	dispatch := func() {
+		for events := sub.take(); len(events) > 0; events = sub.take() {
+			for _, res := range events {
+				if err := handlers.Dispatch(res); err != nil {
+					handlers.panicked(res, err)
+				}
+			}
+		}
+	}
+
+	result := &BacktestResult{StartEquity: b.paper.Equity()}
+	peak := result.StartEquity
+	record := func() {
+		equity := b.paper.Equity()
+		peak = math.Max(peak, equity)
+		result.MaxDrawdown = math.Max(result.MaxDrawdown, peak-equity)
+	}
+
+	var current *backtestSession
+	opened := map[string]bool{}                    // 今の立会で寄り付いた銘柄
+	last := map[string]MarketPriceStreamResponse{} // 銘柄ごとの最後の板
+	closeSession := func() {
+		issueCodes := make([]string, 0, len(opened))
+		for issueCode := range opened {
+			issueCodes = append(issueCodes, issueCode)
+		}
+		sort.Strings(issueCodes)
+		for _, issueCode := range issueCodes {
+			b.paper.auction(issueCode, last[issueCode].CurrentPrice, true)
+			b.paper.closeBoard(issueCode)
+		}
+		current, opened = nil, map[string]bool{}
+		dispatch()
+		record()
+	}
+
+	var prev time.Time
+	for i, tick := range b.ticks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			result.StartTime = tick.Time
+		}
+		result.EndTime = tick.Time
+
+		if current != nil && !tick.Time.Before(current.close) {
+			b.clock.set(current.close)
+			closeSession()
+		}
+		b.clock.set(tick.Time)
+		if !prev.IsZero() && (tick.Time.Year() != prev.Year() || tick.Time.YearDay() != prev.YearDay()) {
+			b.paper.expireBefore(time.Date(tick.Time.Year(), tick.Time.Month(), tick.Time.Day(), 0, 0, 0, 0, tick.Time.Location()))
+			dispatch()
+		}
+		prev = tick.Time
+
+		if s, ok := b.session(tick.Time); ok {
+			current = &s
+			last[tick.IssueCode] = tick.Board
+			if !opened[tick.IssueCode] && tick.Board.CurrentPrice > 0 {
+				opened[tick.IssueCode] = true
+				price := tick.Board.OpenPrice
+				if price <= 0 {
+					price = tick.Board.CurrentPrice
+				}
+				b.paper.auction(tick.IssueCode, price, false)
+			}
+			if opened[tick.IssueCode] {
+				b.paper.UpdateBoard(tick.IssueCode, tick.Board)
+			}
+		}
+
+		board := tick.Board
+		if err := handlers.Dispatch(&board); err != nil {
+			handlers.panicked(&board, err)
+		}
+		dispatch()
+		record()
+	}
+	if current != nil {
+		b.clock.set(current.close)
+		closeSession()
+	}
+
+	result.Trades = b.paper.Trades()
+	result.EndEquity = b.paper.Equity()
+	result.Profit = result.EndEquity - result.StartEquity
+	for _, trade := range result.Trades {
+		if !trade.Exit {
+			continue
+		}
+		result.ExitCount++
+		result.RealizedProfit += trade.Profit
+		switch {
+		case trade.Profit > 0:
+			result.WinCount++
+			result.GrossProfit += trade.Profit
+		case trade.Profit < 0:
+			result.LossCount++
+			result.GrossLoss += trade.Profit
+		}
+	}
+	if result.ExitCount > 0 {
+		result.WinRate = float64(result.WinCount) / float64(result.ExitCount)
+	}
+	switch {
+	case result.GrossLoss < 0:
+		result.ProfitFactor = result.GrossProfit / -result.GrossLoss
+	case result.GrossProfit > 0:
+		result.ProfitFactor = math.Inf(1)
+	}
+	return result, nil
+}
+
+// backtestClock - 時価情報の時刻で進む時計
+type backtestClock struct {
+	now time.Time
+	mtx sync.Mutex
+}
+
+func (c *backtestClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *backtestClock) set(now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = now
+}
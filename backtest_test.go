@@ -0,0 +1,257 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testBacktestTick - 売気配と買気配を現在値の1円上下に100株ずつ置いた時価情報
+func testBacktestTick(t time.Time, openPrice, currentPrice float64) BacktestTick {
+	return BacktestTick{Time: t, IssueCode: "1475", Board: MarketPriceStreamResponse{
+		ColumnNumber: 1, OpenPrice: openPrice, CurrentPrice: currentPrice,
+		AskPrice1: currentPrice + 1, AskQuantity1: 100, BidPrice1: currentPrice - 1, BidQuantity1: 100,
+	}}
+}
+
+// testBacktestTicks - 2022/07/26の前場と後場、翌日の寄付の時価情報
+func testBacktestTicks() []BacktestTick {
+	day := time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local)
+	return []BacktestTick{
+		testBacktestTick(day.Add(8*time.Hour+59*time.Minute), 0, 0), // 寄付前
+		testBacktestTick(day.Add(9*time.Hour), 1000, 1000),
+		testBacktestTick(day.Add(10*time.Hour), 1000, 1010),
+		testBacktestTick(day.Add(11*time.Hour+29*time.Minute), 1000, 1020),
+		testBacktestTick(day.Add(12*time.Hour+30*time.Minute), 1000, 1015),
+		testBacktestTick(day.Add(14*time.Hour), 1000, 1000),
+		testBacktestTick(day.Add(33*time.Hour), 990, 990), // 翌日の寄付
+	}
+}
+
+func Test_Backtest_Run_order(t *testing.T) {
+	t.Parallel()
+	day := time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local)
+	type trade struct {
+		DateTime time.Time
+		Price    float64
+	}
+	tests := []struct {
+		name       string
+		arg        NewOrderRequest
+		wantTrades []trade
+		wantStatus OrderStatus
+	}{
+		{name: "寄付前の指定なしの成行は寄付で約定する",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingNormal},
+			wantTrades: []trade{{DateTime: day.Add(9 * time.Hour), Price: 1000}},
+			wantStatus: OrderStatusDone},
+		{name: "寄付の成行は始値で約定する",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingOpening},
+			wantTrades: []trade{{DateTime: day.Add(9 * time.Hour), Price: 1000}},
+			wantStatus: OrderStatusDone},
+		{name: "寄付の指値が始値に届かなければ寄付で失効する",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingOpening, OrderPrice: 990},
+			wantStatus: OrderStatusExpired},
+		{name: "引けの成行は前場の最後の現在値で約定する",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingClosing},
+			wantTrades: []trade{{DateTime: day.Add(11*time.Hour + 30*time.Minute), Price: 1020}},
+			wantStatus: OrderStatusDone},
+		{name: "不成はザラバで約定しなければ引けで成行になる",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingFunari, OrderPrice: 995},
+			wantTrades: []trade{{DateTime: day.Add(11*time.Hour + 30*time.Minute), Price: 1020}},
+			wantStatus: OrderStatusDone},
+		{name: "逆指値は現在値が条件に達したら売気配で約定する",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingNormal, StopOrderType: StopOrderTypeStop, TriggerPrice: 1010},
+			wantTrades: []trade{{DateTime: day.Add(10 * time.Hour), Price: 1011}},
+			wantStatus: OrderStatusDone},
+		{name: "OCOは指値で約定しなければ逆指値で約定する",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingNormal, OrderPrice: 900, StopOrderType: StopOrderTypeOCO, TriggerPrice: 1020, StopOrderPrice: 1021},
+			wantTrades: []trade{{DateTime: day.Add(11*time.Hour + 29*time.Minute), Price: 1021}},
+			wantStatus: OrderStatusDone},
+		{name: "当日限りの指値は翌日に失効する",
+			arg:        NewOrderRequest{ExecutionTiming: ExecutionTimingNormal, OrderPrice: 900},
+			wantStatus: OrderStatusExpired},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			backtest := NewBacktest(testBacktestTicks(), BacktestConfig{PaperClientConfig: PaperClientConfig{StockWallet: 1_000_000}})
+			client := backtest.Client()
+			req := test.arg
+			req.IssueCode, req.Side, req.TradeType, req.OrderQuantity = "1475", SideBuy, TradeTypeStock, 100
+			var orderNumber string
+			_, err := backtest.Run(context.Background(), &StreamHandlers{
+				OnMarketPrice: func(*MarketPriceStreamResponse) {
+					if orderNumber == "" {
+						res, err := client.NewOrder(context.Background(), &Session{}, req)
+						if err != nil {
+							t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+						}
+						orderNumber = res.OrderNumber
+					}
+				},
+			})
+
+			var got []trade
+			for _, tr := range client.Trades() {
+				got = append(got, trade{DateTime: tr.DateTime, Price: tr.Price})
+			}
+			detail, _ := client.OrderDetail(context.Background(), &Session{}, OrderDetailRequest{OrderNumber: orderNumber})
+			if !reflect.DeepEqual(test.wantTrades, got) || test.wantStatus != detail.OrderStatus || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantTrades, test.wantStatus, nil, got, detail.OrderStatus, err)
+			}
+		})
+	}
+}
+
+// Test_Backtest_Run_result - 約定から損益と統計を集計する
+func Test_Backtest_Run_result(t *testing.T) {
+	t.Parallel()
+	backtest := NewBacktest(testBacktestTicks(), BacktestConfig{PaperClientConfig: PaperClientConfig{StockWallet: 1_000_000}})
+	client := backtest.Client()
+	ctx, session := context.Background(), &Session{}
+	order := func(side Side, timing ExecutionTiming) {
+		_, err := client.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: side, TradeType: TradeTypeStock, OrderQuantity: 100, ExecutionTiming: timing})
+		if err != nil {
+			t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+		}
+	}
+
+	// 寄付で買って前場引けで売り、後場の寄りで買って14時に売る
+	var contracts []string
+	res, err := backtest.Run(ctx, &StreamHandlers{
+		OnMarketPrice: func(res *MarketPriceStreamResponse) {
+			switch client.clock.Now().Format("15:04") {
+			case "08:59":
+				order(SideBuy, ExecutionTimingOpening)
+			case "12:30":
+				order(SideBuy, ExecutionTimingNormal)
+			case "14:00":
+				order(SideSell, ExecutionTimingNormal)
+			}
+		},
+		OnContract: func(res *ContractStreamResponse) {
+			if res.StreamOrderType != StreamOrderTypeContract {
+				return
+			}
+			contracts = append(contracts, res.OrderNumber)
+			if res.OrderNumber == "1" {
+				order(SideSell, ExecutionTimingClosing)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+
+	day := time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local)
+	wantContracts := []string{"1", "2", "3", "4"}
+	want := BacktestResult{
+		StartTime:      day.Add(8*time.Hour + 59*time.Minute),
+		EndTime:        day.Add(33 * time.Hour),
+		StartEquity:    1_000_000,
+		EndEquity:      1_000_300,
+		Profit:         300,
+		RealizedProfit: 300,
+		ExitCount:      2,
+		WinCount:       1,
+		LossCount:      1,
+		WinRate:        0.5,
+		GrossProfit:    2_000,
+		GrossLoss:      -1_700,
+		ProfitFactor:   2_000.0 / 1_700,
+		MaxDrawdown:    1_700,
+	}
+	res.Trades = nil
+	if !reflect.DeepEqual(want, *res) || !reflect.DeepEqual(wantContracts, contracts) {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, wantContracts, *res, contracts)
+	}
+}
+
+func Test_Backtest_Run_profitFactor(t *testing.T) {
+	t.Parallel()
+	backtest := NewBacktest(testBacktestTicks()[:4], BacktestConfig{PaperClientConfig: PaperClientConfig{StockWallet: 1_000_000}})
+	client := backtest.Client()
+	res, _ := backtest.Run(context.Background(), &StreamHandlers{
+		OnMarketPrice: func(*MarketPriceStreamResponse) {
+			switch client.clock.Now().Format("15:04") {
+			case "08:59":
+				_, _ = client.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100})
+			case "11:29":
+				_, _ = client.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, OrderQuantity: 100})
+			}
+		},
+	})
+	if !math.IsInf(res.ProfitFactor, 1) || res.GrossProfit != 1_900 {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), math.Inf(1), 1_900, res.ProfitFactor, res.GrossProfit)
+	}
+}
+
+func Test_Backtest_Run_tickSize(t *testing.T) {
+	t.Parallel()
+	config := BacktestConfig{PaperClientConfig: PaperClientConfig{
+		StockWallet: 1_000_000,
+		TickSize:    func(string, Exchange, float64) float64 { return 5 },
+	}}
+	client := NewBacktest(testBacktestTicks(), config).Client()
+	_, err1 := client.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderPrice: 1003})
+	_, err2 := client.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderPrice: 1005})
+	if !errors.Is(err1, PaperOrderRejectedErr) || err2 != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), PaperOrderRejectedErr, nil, err1, err2)
+	}
+}
+
+// Test_Backtest_Client_nil - 時価やマスタを取得するクライアントがなければ、パニックせずにエラーを返す
+func Test_Backtest_Client_nil(t *testing.T) {
+	t.Parallel()
+	ctx, session := context.Background(), &Session{}
+	client := NewBacktest(testBacktestTicks(), BacktestConfig{}).Client()
+
+	_, err1 := client.MarketPrice(ctx, session, MarketPriceRequest{IssueCodes: []string{"1475"}})
+	_, err2 := client.StockMaster(ctx, session, StockMasterRequest{})
+	_, errCh := client.Stream(ctx, session, StreamRequest{})
+	var err3 error
+	select {
+	case err3 = <-errCh:
+	case <-time.After(time.Second):
+	}
+	if !errors.Is(err1, ClientUnavailableErr) || !errors.Is(err2, ClientUnavailableErr) || !errors.Is(err3, ClientUnavailableErr) {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(),
+			ClientUnavailableErr, ClientUnavailableErr, ClientUnavailableErr, err1, err2, err3)
+	}
+}
+
+func Test_Backtest_Run_canceled(t *testing.T) {
+	t.Parallel()
+	ctx, cf := context.WithCancel(context.Background())
+	cf()
+	_, err := NewBacktest(testBacktestTicks(), BacktestConfig{}).Run(ctx, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), context.Canceled, err)
+	}
+}
+
+// Test_LoadBacktestTicks - 記録した差分配信から板を組み立て、行番号を銘柄コードにする
+func Test_LoadBacktestTicks(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)
+	files := testRecordFrames(t, StreamRecorderConfig{Dir: t.TempDir()}, start, time.Second,
+		testStreamFrame("p_no", "1", "p_cmd", "KP"),
+		testStreamFrame("p_no", "2", "p_cmd", "FD", "p_1_DPP", "1000", "p_1_GAP1", "1001"),
+		testStreamFrame("p_no", "3", "p_cmd", "FD", "p_2_DPP", "2000"),
+		testStreamFrame("p_no", "4", "p_cmd", "FD", "p_1_DPP", "1002"),
+	)
+
+	got, err := LoadBacktestTicks(files, StreamRequest{ColumnNumber: []int{1}, IssueCodes: []string{"1475"}})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), 2, nil, got, err)
+	}
+	if got[1].IssueCode != "1475" || !got[1].Time.Equal(start.Add(3*time.Second)) || got[1].Board.CurrentPrice != 1002 || got[1].Board.AskPrice1 != 1001 {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v\ngot: %+v\n", t.Name(), "1475", start.Add(3*time.Second), 1002, 1001, got[1])
+	}
+}
@@ -0,0 +1,205 @@
+package tachibana
+
+import (
+	"sync"
+)
+
+// NewBoardState - 株価ボードの最新状態を生成する
+func NewBoardState() *BoardState {
+	return &BoardState{boards: make(map[int]*MarketPriceStreamResponse)}
+}
+
+// BoardState - 株価ボードの最新状態
+// 時価情報は変化した項目だけが配信されるので、行番号ごとにフレームに含まれていた項目だけを上書きして最新の状態を作る
+// 行番号を別の銘柄に使いまわす場合は、Clearしてから使う
+type BoardState struct {
+	boards map[int]*MarketPriceStreamResponse
+	mtx    sync.Mutex
+}
+
+// Apply - 差分を反映し、反映後の状態を返す
+// 共通項目は最新のフレームのものになり、PresentFieldsはこれまでに1度でも受け取った項目になる
+func (s *BoardState) Apply(res *MarketPriceStreamResponse) MarketPriceStreamResponse {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	board, ok := s.boards[res.ColumnNumber]
+	if !ok {
+		board = &MarketPriceStreamResponse{ColumnNumber: res.ColumnNumber}
+		s.boards[res.ColumnNumber] = board
+	}
+
+	board.CommonStreamResponse = res.CommonStreamResponse
+	for _, f := range res.PresentFields.Fields() {
+		board.copyField(res, f)
+		board.PresentFields.add(f)
+	}
+
+	return *board
+}
+
+// Get - 行番号の最新状態
+func (s *BoardState) Get(columnNumber int) (MarketPriceStreamResponse, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	board, ok := s.boards[columnNumber]
+	if !ok {
+		return MarketPriceStreamResponse{}, false
+	}
+	return *board, true
+}
+
+// Clear - 行番号の状態を破棄する
+func (s *BoardState) Clear(columnNumber int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.boards, columnNumber)
+}
+
+// copyField - 項目の値をsrcからコピーする
+func (r *MarketPriceStreamResponse) copyField(src *MarketPriceStreamResponse, f MarketPriceField) {
+	switch f {
+	case MarketPriceFieldAskQuantityMarket:
+		r.AskQuantityMarket = src.AskQuantityMarket
+	case MarketPriceFieldBidQuantityMarket:
+		r.BidQuantityMarket = src.BidQuantityMarket
+	case MarketPriceFieldAskQuantity:
+		r.AskQuantity = src.AskQuantity
+	case MarketPriceFieldBidQuantity:
+		r.BidQuantity = src.BidQuantity
+	case MarketPriceFieldDiscontinuityType:
+		r.DiscontinuityType = src.DiscontinuityType
+	case MarketPriceFieldStopHigh:
+		r.StopHigh = src.StopHigh
+	case MarketPriceFieldHighPrice:
+		r.HighPrice = src.HighPrice
+	case MarketPriceFieldHighPriceTime:
+		r.HighPriceTime = src.HighPriceTime
+	case MarketPriceFieldTradingAmount:
+		r.TradingAmount = src.TradingAmount
+	case MarketPriceFieldStopLow:
+		r.StopLow = src.StopLow
+	case MarketPriceFieldLowPrice:
+		r.LowPrice = src.LowPrice
+	case MarketPriceFieldLowPriceTime:
+		r.LowPriceTime = src.LowPriceTime
+	case MarketPriceFieldOpenPrice:
+		r.OpenPrice = src.OpenPrice
+	case MarketPriceFieldOpenPriceTime:
+		r.OpenPriceTime = src.OpenPriceTime
+	case MarketPriceFieldChangePriceType:
+		r.ChangePriceType = src.ChangePriceType
+	case MarketPriceFieldCurrentPrice:
+		r.CurrentPrice = src.CurrentPrice
+	case MarketPriceFieldCurrentPriceTime:
+		r.CurrentPriceTime = src.CurrentPriceTime
+	case MarketPriceFieldVolume:
+		r.Volume = src.Volume
+	case MarketPriceFieldExRightType:
+		r.ExRightType = src.ExRightType
+	case MarketPriceFieldPrevDayPercent:
+		r.PrevDayPercent = src.PrevDayPercent
+	case MarketPriceFieldPrevDayRatio:
+		r.PrevDayRatio = src.PrevDayRatio
+	case MarketPriceFieldAskQuantity10:
+		r.AskQuantity10 = src.AskQuantity10
+	case MarketPriceFieldAskPrice10:
+		r.AskPrice10 = src.AskPrice10
+	case MarketPriceFieldAskQuantity9:
+		r.AskQuantity9 = src.AskQuantity9
+	case MarketPriceFieldAskPrice9:
+		r.AskPrice9 = src.AskPrice9
+	case MarketPriceFieldAskQuantity8:
+		r.AskQuantity8 = src.AskQuantity8
+	case MarketPriceFieldAskPrice8:
+		r.AskPrice8 = src.AskPrice8
+	case MarketPriceFieldAskQuantity7:
+		r.AskQuantity7 = src.AskQuantity7
+	case MarketPriceFieldAskPrice7:
+		r.AskPrice7 = src.AskPrice7
+	case MarketPriceFieldAskQuantity6:
+		r.AskQuantity6 = src.AskQuantity6
+	case MarketPriceFieldAskPrice6:
+		r.AskPrice6 = src.AskPrice6
+	case MarketPriceFieldAskQuantity5:
+		r.AskQuantity5 = src.AskQuantity5
+	case MarketPriceFieldAskPrice5:
+		r.AskPrice5 = src.AskPrice5
+	case MarketPriceFieldAskQuantity4:
+		r.AskQuantity4 = src.AskQuantity4
+	case MarketPriceFieldAskPrice4:
+		r.AskPrice4 = src.AskPrice4
+	case MarketPriceFieldAskQuantity3:
+		r.AskQuantity3 = src.AskQuantity3
+	case MarketPriceFieldAskPrice3:
+		r.AskPrice3 = src.AskPrice3
+	case MarketPriceFieldAskQuantity2:
+		r.AskQuantity2 = src.AskQuantity2
+	case MarketPriceFieldAskPrice2:
+		r.AskPrice2 = src.AskPrice2
+	case MarketPriceFieldAskQuantity1:
+		r.AskQuantity1 = src.AskQuantity1
+	case MarketPriceFieldAskPrice1:
+		r.AskPrice1 = src.AskPrice1
+	case MarketPriceFieldBidQuantity1:
+		r.BidQuantity1 = src.BidQuantity1
+	case MarketPriceFieldBidPrice1:
+		r.BidPrice1 = src.BidPrice1
+	case MarketPriceFieldBidQuantity2:
+		r.BidQuantity2 = src.BidQuantity2
+	case MarketPriceFieldBidPrice2:
+		r.BidPrice2 = src.BidPrice2
+	case MarketPriceFieldBidQuantity3:
+		r.BidQuantity3 = src.BidQuantity3
+	case MarketPriceFieldBidPrice3:
+		r.BidPrice3 = src.BidPrice3
+	case MarketPriceFieldBidQuantity4:
+		r.BidQuantity4 = src.BidQuantity4
+	case MarketPriceFieldBidPrice4:
+		r.BidPrice4 = src.BidPrice4
+	case MarketPriceFieldBidQuantity5:
+		r.BidQuantity5 = src.BidQuantity5
+	case MarketPriceFieldBidPrice5:
+		r.BidPrice5 = src.BidPrice5
+	case MarketPriceFieldBidQuantity6:
+		r.BidQuantity6 = src.BidQuantity6
+	case MarketPriceFieldBidPrice6:
+		r.BidPrice6 = src.BidPrice6
+	case MarketPriceFieldBidQuantity7:
+		r.BidQuantity7 = src.BidQuantity7
+	case MarketPriceFieldBidPrice7:
+		r.BidPrice7 = src.BidPrice7
+	case MarketPriceFieldBidQuantity8:
+		r.BidQuantity8 = src.BidQuantity8
+	case MarketPriceFieldBidPrice8:
+		r.BidPrice8 = src.BidPrice8
+	case MarketPriceFieldBidQuantity9:
+		r.BidQuantity9 = src.BidQuantity9
+	case MarketPriceFieldBidPrice9:
+		r.BidPrice9 = src.BidPrice9
+	case MarketPriceFieldBidQuantity10:
+		r.BidQuantity10 = src.BidQuantity10
+	case MarketPriceFieldBidPrice10:
+		r.BidPrice10 = src.BidPrice10
+	case MarketPriceFieldSection:
+		r.Section = src.Section
+	case MarketPriceFieldPRP:
+		r.PRP = src.PRP
+	case MarketPriceFieldAskPrice:
+		r.AskPrice = src.AskPrice
+	case MarketPriceFieldAskSign:
+		r.AskSign = src.AskSign
+	case MarketPriceFieldBidPrice:
+		r.BidPrice = src.BidPrice
+	case MarketPriceFieldBidSign:
+		r.BidSign = src.BidSign
+	case MarketPriceFieldAskQuantityOver:
+		r.AskQuantityOver = src.AskQuantityOver
+	case MarketPriceFieldBidQuantityUnder:
+		r.BidQuantityUnder = src.BidQuantityUnder
+	case MarketPriceFieldVWAP:
+		r.VWAP = src.VWAP
+	}
+}
@@ -0,0 +1,152 @@
+package tachibana
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_BoardState_Apply(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		boards map[int]*MarketPriceStreamResponse
+		arg    *MarketPriceStreamResponse
+		want   MarketPriceStreamResponse
+	}{
+		{name: "初めての行番号ならフレームの内容がそのまま状態になる",
+			boards: map[int]*MarketPriceStreamResponse{},
+			arg: &MarketPriceStreamResponse{
+				CommonStreamResponse: CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 1},
+				ColumnNumber:         1,
+				CurrentPrice:         378.6,
+				Volume:               3120080,
+				PresentFields:        marketPriceFieldSetOf(MarketPriceFieldCurrentPrice, MarketPriceFieldVolume),
+			},
+			want: MarketPriceStreamResponse{
+				CommonStreamResponse: CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 1},
+				ColumnNumber:         1,
+				CurrentPrice:         378.6,
+				Volume:               3120080,
+				PresentFields:        marketPriceFieldSetOf(MarketPriceFieldCurrentPrice, MarketPriceFieldVolume),
+			}},
+		{name: "含まれていた項目だけを上書きし、含まれていない項目は前の値を残す",
+			boards: map[int]*MarketPriceStreamResponse{
+				1: {
+					CommonStreamResponse: CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 1},
+					ColumnNumber:         1,
+					CurrentPrice:         378.6,
+					CurrentPriceTime:     time.Date(0, 1, 1, 14, 59, 0, 0, time.Local),
+					Volume:               3120080,
+					BidPrice:             378.3,
+					PresentFields:        marketPriceFieldSetOf(MarketPriceFieldCurrentPrice, MarketPriceFieldCurrentPriceTime, MarketPriceFieldVolume, MarketPriceFieldBidPrice),
+				},
+			},
+			arg: &MarketPriceStreamResponse{
+				CommonStreamResponse: CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 2},
+				ColumnNumber:         1,
+				Volume:               3120180,
+				BidPrice:             0,
+				AskPrice:             378.7,
+				PresentFields:        marketPriceFieldSetOf(MarketPriceFieldVolume, MarketPriceFieldBidPrice, MarketPriceFieldAskPrice),
+			},
+			want: MarketPriceStreamResponse{
+				CommonStreamResponse: CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 2},
+				ColumnNumber:         1,
+				CurrentPrice:         378.6,
+				CurrentPriceTime:     time.Date(0, 1, 1, 14, 59, 0, 0, time.Local),
+				Volume:               3120180,
+				BidPrice:             0,
+				AskPrice:             378.7,
+				PresentFields:        marketPriceFieldSetOf(MarketPriceFieldCurrentPrice, MarketPriceFieldCurrentPriceTime, MarketPriceFieldVolume, MarketPriceFieldBidPrice, MarketPriceFieldAskPrice),
+			}},
+		{name: "他の行番号の状態には影響しない",
+			boards: map[int]*MarketPriceStreamResponse{
+				2: {ColumnNumber: 2, CurrentPrice: 1000, PresentFields: marketPriceFieldSetOf(MarketPriceFieldCurrentPrice)},
+			},
+			arg: &MarketPriceStreamResponse{
+				ColumnNumber:  1,
+				Volume:        100,
+				PresentFields: marketPriceFieldSetOf(MarketPriceFieldVolume),
+			},
+			want: MarketPriceStreamResponse{
+				ColumnNumber:  1,
+				Volume:        100,
+				PresentFields: marketPriceFieldSetOf(MarketPriceFieldVolume),
+			}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			state := NewBoardState()
+			state.boards = test.boards
+			got := state.Apply(test.arg)
+			got2, ok := state.Get(test.arg.ColumnNumber)
+			if !reflect.DeepEqual(test.want, got) || !reflect.DeepEqual(test.want, got2) || !ok {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.want, got, got2, ok)
+			}
+		})
+	}
+}
+
+func Test_BoardState_Apply_parsed(t *testing.T) {
+	t.Parallel()
+	c := &client{}
+	state := NewBoardState()
+
+	for _, b := range [][]byte{
+		[]byte("p_no\x021\x01p_date\x022022.07.26-09:00:00.000\x01p_errno\x020\x01p_err\x02\x01p_cmd\x02FD\x01p_1_DPP\x02378.6\x01p_1_DV\x023120080\x01p_1_QBP\x02378.3"),
+		[]byte("p_no\x022\x01p_date\x022022.07.26-09:00:01.000\x01p_errno\x020\x01p_err\x02\x01p_cmd\x02FD\x01p_1_DV\x023120180"),
+	} {
+		var res MarketPriceStreamResponse
+		res.parse(c.streamResponseToMap(b), b)
+		state.Apply(&res)
+	}
+
+	got, _ := state.Get(1)
+	if got.StreamNumber != 2 || got.CurrentPrice != 378.6 || got.Volume != 3120180 || got.BidPrice != 378.3 || !got.Has(MarketPriceFieldCurrentPrice) || got.Has(MarketPriceFieldAskPrice) {
+		t.Errorf("%s error\ngot: %+v\n", t.Name(), got)
+	}
+}
+
+// Test_MarketPriceStreamResponse_copyField - すべての項目をコピーできる
+func Test_MarketPriceStreamResponse_copyField(t *testing.T) {
+	t.Parallel()
+	src := MarketPriceStreamResponse{}
+	v := reflect.ValueOf(&src).Elem()
+	for f := MarketPriceField(0); f < marketPriceFieldLen; f++ {
+		field := v.FieldByName(f.String())
+		switch field.Kind() {
+		case reflect.Float64:
+			field.SetFloat(float64(f) + 1)
+		case reflect.String:
+			field.SetString(f.String())
+		case reflect.Struct:
+			field.Set(reflect.ValueOf(time.Date(2022, 7, 26, 9, 0, int(f), 0, time.Local)))
+		default:
+			t.Fatalf("%s error\nunexpected kind: %s %s\n", t.Name(), f, field.Kind())
+		}
+	}
+
+	got := MarketPriceStreamResponse{}
+	for f := MarketPriceField(0); f < marketPriceFieldLen; f++ {
+		got.copyField(&src, f)
+	}
+	if !reflect.DeepEqual(src, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), src, got)
+	}
+}
+
+func Test_BoardState_Clear(t *testing.T) {
+	t.Parallel()
+	state := NewBoardState()
+	state.Apply(&MarketPriceStreamResponse{ColumnNumber: 1, CurrentPrice: 100, PresentFields: marketPriceFieldSetOf(MarketPriceFieldCurrentPrice)})
+	state.Clear(1)
+
+	got, ok := state.Get(1)
+	if ok || !reflect.DeepEqual(MarketPriceStreamResponse{}, got) {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), MarketPriceStreamResponse{}, false, got, ok)
+	}
+}
@@ -0,0 +1,538 @@
+package tachibana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BracketExitConfig - 新規注文が約定したら出す返済注文の値段
+// 利確と損切の両方を指定すればIFDOCO、どちらかだけならIFD
+type BracketExitConfig struct {
+	TakeProfitPrice      float64 `json:"take_profit_price"`       // 利確の指値 0なら指定しない
+	StopLossTriggerPrice float64 `json:"stop_loss_trigger_price"` // 損切の逆指値条件 0なら指定しない
+	StopLossOrderPrice   float64 `json:"stop_loss_order_price"`   // 損切の逆指値値段 0なら成行
+}
+
+// BracketExit - 約定した数量に対して出した返済注文
+type BracketExit struct {
+	OrderNumber   string    `json:"order_number"`   // 注文番号 送る前に保存したときは空
+	ExecutionDate time.Time `json:"execution_date"` // 営業日
+	Quantity      float64   `json:"quantity"`       // 注文数量
+	RequestedAt   time.Time `json:"requested_at"`   // 注文を送った日時
+	Done          bool      `json:"done"`           // 返済注文が終わったか
+}
+
+// Bracket - 1つのIFD、IFDOCO注文の状態 BracketStoreに保存して、再起動したら再開する
+type Bracket struct {
+	ID                 string            `json:"id"`                   // 識別子 新規注文の注文番号 送る前に保存したときはpending-で始まる仮の識別子
+	Entry              NewOrderRequest   `json:"entry"`                // 新規注文 第二パスワードは保存しない
+	EntryExecutionDate time.Time         `json:"entry_execution_date"` // 新規注文の営業日
+	Exit               BracketExitConfig `json:"exit"`                 // 返済注文の値段
+	ContractQuantity   float64           `json:"contract_quantity"`    // 新規注文の約定済数量
+	Exits              []BracketExit     `json:"exits"`                // 出した返済注文
+	EntryDone          bool              `json:"entry_done"`           // 新規注文が終わったか
+	Done               bool              `json:"done"`                 // 新規注文と返済注文がすべて終わったか
+	RequestedAt        time.Time         `json:"requested_at"`         // 新規注文を送った日時
+}
+
+// exitQuantity - 返済注文を出した数量
+func (b *Bracket) exitQuantity() float64 {
+	var quantity float64
+	for _, e := range b.Exits {
+		quantity += e.Quantity
+	}
+	return quantity
+}
+
+// updateDone - 新規注文と返済注文がすべて終わったかを更新する
+func (b *Bracket) updateDone() {
+	if !b.EntryDone || b.exitQuantity() < b.ContractQuantity {
+		return
+	}
+	for _, e := range b.Exits {
+		if !e.Done {
+			return
+		}
+	}
+	b.Done = true
+}
+
+// BracketStore - IFD、IFDOCO注文の状態の保存先
+type BracketStore interface {
+	Load() ([]Bracket, error)
+	Save(brackets []Bracket) error
+}
+
+// NewFileBracketStore - IFD、IFDOCO注文の状態をJSONファイルに保存する保存先を生成する
+func NewFileBracketStore(path string) *FileBracketStore {
+	return &FileBracketStore{path: path}
+}
+
+// FileBracketStore - IFD、IFDOCO注文の状態を保存するJSONファイル 一時ファイルに書いてから置き換える
+type FileBracketStore struct {
+	path string
+}
+
+// Load - ファイルから読み込む ファイルがなければ空
+func (s *FileBracketStore) Load() ([]Bracket, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var brackets []Bracket
+	if err := json.Unmarshal(b, &brackets); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, UnmarshalFailedErr)
+	}
+	return brackets, nil
+}
+
+// Save - ファイルに書き込む
+func (s *FileBracketStore) Save(brackets []Bracket) error {
+	b, err := json.MarshalIndent(brackets, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// bracketAdoptTolerance - 送ったかわからない返済注文を注文一覧から探すとき、送った日時より前の注文日時をどこまで許すか
+// サーバの注文日時は秒単位で、端末の時計もずれるので、同じ秒や少し前の注文日時でも送った注文とみなす
+const bracketAdoptTolerance = time.Minute
+
+// pendingBracketIDPrefix - 送ったかわからない新規注文の仮の識別子の接頭辞 注文番号がわかったら置き換える
+const pendingBracketIDPrefix = "pending-"
+
+// isPendingBracketID - 送ったかわからない新規注文の識別子か 空は以前の形式で保存した仮の識別子
+func isPendingBracketID(id string) bool {
+	return id == "" || strings.HasPrefix(id, pendingBracketIDPrefix)
+}
+
+// NewBracketManager - IFD、IFDOCO注文の管理を生成する 第二パスワードは返済注文と訂正注文に使う
+func NewBracketManager(client Client, session *Session, store BracketStore, secondPassword string) *BracketManager {
+	return &BracketManager{
+		clock:          newClock(),
+		client:         client,
+		session:        session,
+		store:          store,
+		secondPassword: secondPassword,
+		brackets:       map[string]*Bracket{},
+	}
+}
+
+// BracketManager - 新規注文が約定したら、約定した数量ずつ利確と損切の返済注文を出すIFD、IFDOCO注文の管理
+// 約定通知をApplyに渡し、再起動したらResumeで保存した状態から再開する
+// 信用の返済注文は建日順で返済するので、同じ銘柄の建玉を別に持っているとそちらを返済することがある
+type BracketManager struct {
+	clock          iClock
+	client         Client
+	session        *Session
+	store          BracketStore
+	secondPassword string
+	brackets       map[string]*Bracket
+	pendingSeq     int
+	mtx            sync.Mutex
+}
+
+// bracketExitRequest - 新規注文に対する返済注文
+func bracketExitRequest(entry NewOrderRequest, exit BracketExitConfig, quantity float64, secondPassword string) (NewOrderRequest, error) {
+	var b *OrderBuilder
+	switch {
+	case entry.TradeType == TradeTypeStock && entry.Side == SideBuy:
+		b = CashSell(entry.IssueCode, quantity)
+	case entry.TradeType == TradeTypeStandardEntry && entry.Side == SideBuy:
+		b = MarginExit(entry.IssueCode, SideSell, MarginTradeTypeStandard, quantity)
+	case entry.TradeType == TradeTypeStandardEntry && entry.Side == SideSell:
+		b = MarginExit(entry.IssueCode, SideBuy, MarginTradeTypeStandard, quantity)
+	case entry.TradeType == TradeTypeNegotiateEntry && entry.Side == SideBuy:
+		b = MarginExit(entry.IssueCode, SideSell, MarginTradeTypeNegotiate, quantity)
+	case entry.TradeType == TradeTypeNegotiateEntry && entry.Side == SideSell:
+		b = MarginExit(entry.IssueCode, SideBuy, MarginTradeTypeNegotiate, quantity)
+	default:
+		return NewOrderRequest{}, fmt.Errorf("entry must be cash buy or margin entry: %w", OrderBuildErr)
+	}
+
+	b.AccountType(entry.AccountType).Exchange(entry.Exchange).SecondPassword(secondPassword)
+	if !entry.ExpireDateIsToday && !entry.ExpireDate.IsZero() {
+		b.ExpireOn(entry.ExpireDate)
+	}
+	switch {
+	case exit.TakeProfitPrice > 0 && exit.StopLossTriggerPrice > 0:
+		b.Limit(exit.TakeProfitPrice).OCO(exit.StopLossTriggerPrice, exit.StopLossOrderPrice)
+	case exit.TakeProfitPrice > 0:
+		b.Limit(exit.TakeProfitPrice)
+	case exit.StopLossTriggerPrice > 0:
+		b.Stop(exit.StopLossTriggerPrice, exit.StopLossOrderPrice)
+	default:
+		return NewOrderRequest{}, fmt.Errorf("take profit price or stop loss trigger price is required: %w", OrderBuildErr)
+	}
+	return b.Build()
+}
+
+// Place - 新規注文を送り、IFD、IFDOCO注文として管理する 返済注文の値段は送る前に確認する
+// 送る前に仮の識別子で保存するので、送ったあとに止まったりエラーになったりしても、Resumeで注文一覧から探して再開する
+// レスポンスを受け取って管理に加えるまでロックを持つので、先に届いた約定通知もApplyで取りこぼさない
+func (m *BracketManager) Place(ctx context.Context, entry NewOrderRequest, exit BracketExitConfig) (*Bracket, error) {
+	if _, err := bracketExitRequest(entry, exit, entry.OrderQuantity, m.secondPassword); err != nil {
+		return nil, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	stored := entry
+	stored.SecondPassword = ""
+	b := &Bracket{ID: m.pendingID(), Entry: stored, Exit: exit, Exits: []BracketExit{}, RequestedAt: m.clock.Now()}
+	pendingID := b.ID
+	m.brackets[pendingID] = b
+	if err := m.save(); err != nil {
+		delete(m.brackets, pendingID)
+		return nil, err
+	}
+
+	res, err := m.client.NewOrder(ctx, m.session, entry)
+	if err != nil {
+		// 受け付けられたかわからないので、Resumeで注文一覧から探せるように残す
+		return nil, err
+	}
+	delete(m.brackets, pendingID)
+	if res.ResultCode != "0" {
+		if err := m.save(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s(%s): %w", res.ResultText, res.ResultCode, OrderRejectedErr)
+	}
+
+	b.ID, b.EntryExecutionDate = res.OrderNumber, res.ExecutionDate
+	m.brackets[b.ID] = b
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	copied := *b
+	return &copied, nil
+}
+
+// pendingID - 管理しているどの識別子とも重ならない仮の識別子 ロックを取ってから呼ぶ
+func (m *BracketManager) pendingID() string {
+	for {
+		m.pendingSeq++
+		id := pendingBracketIDPrefix + strconv.Itoa(m.pendingSeq)
+		if _, ok := m.brackets[id]; !ok {
+			return id
+		}
+	}
+}
+
+// save - 状態を保存する ロックを取ってから呼ぶ
+func (m *BracketManager) save() error {
+	if m.store == nil {
+		return nil
+	}
+	brackets := make([]Bracket, 0, len(m.brackets))
+	for _, b := range m.brackets {
+		brackets = append(brackets, *b)
+	}
+	sort.Slice(brackets, func(i, j int) bool { return brackets[i].ID < brackets[j].ID })
+	return m.store.Save(brackets)
+}
+
+// placeExit - 約定したのにまだ返済注文を出していない数量の返済注文を出す ロックを取ってから呼ぶ
+// 送る前に注文番号のない返済注文として保存するので、送ったあとに止まってもResumeで二重に注文しない
+func (m *BracketManager) placeExit(ctx context.Context, b *Bracket) error {
+	quantity := b.ContractQuantity - b.exitQuantity()
+	if quantity <= 0 {
+		return nil
+	}
+	req, err := bracketExitRequest(b.Entry, b.Exit, quantity, m.secondPassword)
+	if err != nil {
+		return err
+	}
+
+	b.Exits = append(b.Exits, BracketExit{Quantity: quantity, RequestedAt: m.clock.Now()})
+	exit := &b.Exits[len(b.Exits)-1]
+	if err := m.save(); err != nil {
+		return err
+	}
+	return m.sendExit(ctx, exit, req)
+}
+
+// sendExit - 注文番号のない返済注文を送る ロックを取ってから呼ぶ
+func (m *BracketManager) sendExit(ctx context.Context, exit *BracketExit, req NewOrderRequest) error {
+	res, err := m.client.NewOrder(ctx, m.session, req)
+	if err != nil {
+		return err
+	}
+	if res.ResultCode != "0" {
+		return fmt.Errorf("%s(%s): %w", res.ResultText, res.ResultCode, OrderRejectedErr)
+	}
+	exit.OrderNumber, exit.ExecutionDate = res.OrderNumber, res.ExecutionDate
+	return m.save()
+}
+
+// Apply - 約定通知で状態を進める 新規注文が約定したら、その数量の返済注文を出す
+// 返済注文を送るので、StreamHandlers.OnContractから呼ぶときはエラーの扱いを決めておく
+func (m *BracketManager) Apply(ctx context.Context, res *ContractStreamResponse) error {
+	if res == nil || res.OrderNumber == "" {
+		return nil
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if b, ok := m.brackets[res.OrderNumber]; ok && !b.Done {
+		if res.ContractQuantity > b.ContractQuantity {
+			b.ContractQuantity = res.ContractQuantity
+		}
+		if streamOrderState(res).Done() {
+			b.EntryDone = true
+		}
+		if err := m.placeExit(ctx, b); err != nil {
+			return err
+		}
+		b.updateDone()
+		return m.save()
+	}
+
+	for _, b := range m.brackets {
+		for i := range b.Exits {
+			if b.Exits[i].OrderNumber == res.OrderNumber && streamOrderState(res).Done() {
+				b.Exits[i].Done = true
+				b.updateDone()
+				return m.save()
+			}
+		}
+	}
+	return nil
+}
+
+// Resume - 保存した状態を読み込み、止まっていたあいだの約定を注文詳細で確認して再開する
+// 送ったかわからない返済注文は、注文一覧に同じ内容の注文があればそれとみなし、なければ送りなおす
+// 送ったかわからない新規注文は送った順に、注文一覧に同じ内容の注文があればそれとみなし、なければ送りなおさずに捨てる
+func (m *BracketManager) Resume(ctx context.Context) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.store != nil {
+		brackets, err := m.store.Load()
+		if err != nil {
+			return err
+		}
+		for i := range brackets {
+			b := brackets[i]
+			m.brackets[b.ID] = &b
+		}
+	}
+	var pending []*Bracket
+	for id, b := range m.brackets {
+		if isPendingBracketID(id) {
+			pending = append(pending, b)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].RequestedAt.Equal(pending[j].RequestedAt) {
+			return pending[i].RequestedAt.Before(pending[j].RequestedAt)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+	for _, b := range pending {
+		if err := m.adoptEntry(ctx, b); err != nil {
+			return err
+		}
+	}
+
+	ids := make([]string, 0, len(m.brackets))
+	for id, b := range m.brackets {
+		if !b.Done {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if err := m.resume(ctx, m.brackets[id]); err != nil {
+			return err
+		}
+	}
+	return m.save()
+}
+
+// resume - 1つのIFD、IFDOCO注文を再開する ロックを取ってから呼ぶ
+func (m *BracketManager) resume(ctx context.Context, b *Bracket) error {
+	if !b.EntryDone {
+		detail, err := m.client.OrderDetail(ctx, m.session, OrderDetailRequest{OrderNumber: b.ID, ExecutionDate: b.EntryExecutionDate})
+		if err != nil {
+			return err
+		}
+		if detail.ContractQuantity > b.ContractQuantity {
+			b.ContractQuantity = detail.ContractQuantity
+		}
+		b.EntryDone = snapshotOrderState(detail.OrderStatus, detail.ContractQuantity).Done()
+	}
+
+	for i := range b.Exits {
+		exit := &b.Exits[i]
+		if exit.OrderNumber == "" {
+			if err := m.adoptExit(ctx, b, exit); err != nil {
+				return err
+			}
+		}
+		if exit.OrderNumber == "" || exit.Done {
+			continue
+		}
+		detail, err := m.client.OrderDetail(ctx, m.session, OrderDetailRequest{OrderNumber: exit.OrderNumber, ExecutionDate: exit.ExecutionDate})
+		if err != nil {
+			return err
+		}
+		exit.Done = snapshotOrderState(detail.OrderStatus, detail.ContractQuantity).Done()
+	}
+
+	if err := m.placeExit(ctx, b); err != nil {
+		return err
+	}
+	b.updateDone()
+	return nil
+}
+
+// adoptEntry - 送ったかわからない新規注文を注文一覧から探し、あればその注文番号で再開する ロックを取ってから呼ぶ
+// なければ受け付けられていないので、送りなおさずに捨てる
+func (m *BracketManager) adoptEntry(ctx context.Context, b *Bracket) error {
+	list, err := m.client.OrderList(ctx, m.session, OrderListRequest{IssueCode: b.Entry.IssueCode})
+	if err != nil {
+		return err
+	}
+	delete(m.brackets, b.ID)
+
+	known := m.knownOrderNumbers()
+	since := b.RequestedAt.Truncate(time.Second).Add(-bracketAdoptTolerance)
+	for _, o := range list.Orders {
+		if known[o.OrderNumber] || o.Side != b.Entry.Side || o.TradeType != b.Entry.TradeType || o.OrderQuantity != b.Entry.OrderQuantity || o.OrderDateTime.Before(since) {
+			continue
+		}
+		b.ID, b.EntryExecutionDate = o.OrderNumber, o.ExecutionDate
+		m.brackets[b.ID] = b
+		break
+	}
+	return m.save()
+}
+
+// knownOrderNumbers - 管理している新規注文と返済注文の注文番号 ロックを取ってから呼ぶ
+func (m *BracketManager) knownOrderNumbers() map[string]bool {
+	known := map[string]bool{}
+	for _, b := range m.brackets {
+		if !isPendingBracketID(b.ID) {
+			known[b.ID] = true
+		}
+		for _, e := range b.Exits {
+			known[e.OrderNumber] = true
+		}
+	}
+	return known
+}
+
+// adoptExit - 送ったかわからない返済注文を注文一覧から探し、なければ送りなおす ロックを取ってから呼ぶ
+func (m *BracketManager) adoptExit(ctx context.Context, b *Bracket, exit *BracketExit) error {
+	req, err := bracketExitRequest(b.Entry, b.Exit, exit.Quantity, m.secondPassword)
+	if err != nil {
+		return err
+	}
+
+	list, err := m.client.OrderList(ctx, m.session, OrderListRequest{IssueCode: b.Entry.IssueCode})
+	if err != nil {
+		return err
+	}
+	known := m.knownOrderNumbers()
+	since := exit.RequestedAt.Truncate(time.Second).Add(-bracketAdoptTolerance)
+	for _, o := range list.Orders {
+		if known[o.OrderNumber] || o.Side != req.Side || o.TradeType != req.TradeType || o.OrderQuantity != req.OrderQuantity || o.OrderDateTime.Before(since) {
+			continue
+		}
+		exit.OrderNumber, exit.ExecutionDate = o.OrderNumber, o.ExecutionDate
+		return m.save()
+	}
+	return m.sendExit(ctx, exit, req)
+}
+
+// Amend - 返済注文の値段を変え、終わっていない返済注文を訂正する 0は変更しない
+// 利確と損切のうち、IFD、IFDOCO注文を出したときに指定しなかったほうは追加できない
+func (m *BracketManager) Amend(ctx context.Context, id string, takeProfitPrice float64, stopLossTriggerPrice float64) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	b, ok := m.brackets[id]
+	if !ok || isPendingBracketID(id) {
+		return fmt.Errorf("bracket %s is not found: %w", id, BracketNotFoundErr)
+	}
+
+	exit := b.Exit
+	orderPrice, triggerPrice := NoChangeFloat, NoChangeFloat
+	if takeProfitPrice > 0 {
+		if exit.TakeProfitPrice <= 0 {
+			return fmt.Errorf("bracket %s has no take profit: %w", id, OrderBuildErr)
+		}
+		exit.TakeProfitPrice, orderPrice = takeProfitPrice, takeProfitPrice
+	}
+	if stopLossTriggerPrice > 0 {
+		if exit.StopLossTriggerPrice <= 0 {
+			return fmt.Errorf("bracket %s has no stop loss: %w", id, OrderBuildErr)
+		}
+		exit.StopLossTriggerPrice, triggerPrice = stopLossTriggerPrice, stopLossTriggerPrice
+	}
+	if _, err := bracketExitRequest(b.Entry, exit, 1, m.secondPassword); err != nil {
+		return err
+	}
+	b.Exit = exit
+
+	for _, e := range b.Exits {
+		if e.OrderNumber == "" || e.Done {
+			continue
+		}
+		res, err := m.client.CorrectOrder(ctx, m.session, CorrectOrderRequest{
+			OrderNumber:        e.OrderNumber,
+			ExecutionDate:      e.ExecutionDate,
+			ExecutionTiming:    ExecutionTimingNoChange,
+			OrderPrice:         orderPrice,
+			OrderQuantity:      NoChangeFloat,
+			ExpireDateNoChange: true,
+			TriggerPrice:       triggerPrice,
+			StopOrderPrice:     NoChangeFloat,
+			SecondPassword:     m.secondPassword,
+		})
+		if err != nil {
+			return err
+		}
+		if res.ResultCode != "0" {
+			return fmt.Errorf("%s(%s): %w", res.ResultText, res.ResultCode, OrderRejectedErr)
+		}
+	}
+	return m.save()
+}
+
+// Brackets - 管理しているIFD、IFDOCO注文 識別子順
+func (m *BracketManager) Brackets() []Bracket {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	brackets := make([]Bracket, 0, len(m.brackets))
+	for _, b := range m.brackets {
+		copied := *b
+		copied.Exits = append([]BracketExit{}, b.Exits...)
+		brackets = append(brackets, copied)
+	}
+	sort.Slice(brackets, func(i, j int) bool { return brackets[i].ID < brackets[j].ID })
+	return brackets
+}
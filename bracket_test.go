@@ -0,0 +1,425 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestBracketManager - テスト用のIFD、IFDOCO注文の管理 一時ディレクトリのファイルに保存する
+func newTestBracketManager(t *testing.T, client Client) (*BracketManager, *FileBracketStore) {
+	store := NewFileBracketStore(filepath.Join(t.TempDir(), "brackets.json"))
+	m := NewBracketManager(client, &Session{}, store, "second")
+	m.clock = &testClock{Now1: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}
+	return m, store
+}
+
+func Test_bracketExitRequest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		entry   NewOrderRequest
+		exit    BracketExitConfig
+		want    NewOrderRequest
+		wantErr error
+	}{
+		{name: "現物買いに利確と損切を指定したら、現物売りのOCO注文",
+			entry: NewOrderRequest{AccountType: AccountTypeSpecific, IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock, ExpireDateIsToday: true},
+			exit:  BracketExitConfig{TakeProfitPrice: 2100, StopLossTriggerPrice: 1950},
+			want: NewOrderRequest{AccountType: AccountTypeSpecific, DeliveryAccountType: DeliveryAccountTypeUnused, IssueCode: "1475", Exchange: ExchangeToushou,
+				Side: SideSell, ExecutionTiming: ExecutionTimingNormal, OrderPrice: 2100, OrderQuantity: 100, TradeType: TradeTypeStock, ExpireDateIsToday: true,
+				StopOrderType: StopOrderTypeOCO, TriggerPrice: 1950, ExitPositionType: ExitPositionTypeUnused, ExitPositions: []ExitPosition{}, SecondPassword: "second"}},
+		{name: "信用新規売りに利確だけを指定したら、買いの指値返済",
+			entry: NewOrderRequest{AccountType: AccountTypeSpecific, IssueCode: "1475", Exchange: ExchangeToushou, Side: SideSell, TradeType: TradeTypeNegotiateEntry, ExpireDateIsToday: true},
+			exit:  BracketExitConfig{TakeProfitPrice: 1900},
+			want: NewOrderRequest{AccountType: AccountTypeSpecific, DeliveryAccountType: DeliveryAccountTypeUnused, IssueCode: "1475", Exchange: ExchangeToushou,
+				Side: SideBuy, ExecutionTiming: ExecutionTimingNormal, OrderPrice: 1900, OrderQuantity: 100, TradeType: TradeTypeNegotiateExit, ExpireDateIsToday: true,
+				StopOrderType: StopOrderTypeNormal, ExitPositionType: ExitPositionTypeDayAsc, ExitPositions: []ExitPosition{}, SecondPassword: "second"}},
+		{name: "信用新規買いに損切だけを指定したら、売りの逆指値返済",
+			entry: NewOrderRequest{AccountType: AccountTypeSpecific, IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStandardEntry, ExpireDateIsToday: true},
+			exit:  BracketExitConfig{StopLossTriggerPrice: 1950, StopLossOrderPrice: 1940},
+			want: NewOrderRequest{AccountType: AccountTypeSpecific, DeliveryAccountType: DeliveryAccountTypeUnused, IssueCode: "1475", Exchange: ExchangeToushou,
+				Side: SideSell, ExecutionTiming: ExecutionTimingNormal, OrderQuantity: 100, TradeType: TradeTypeStandardExit, ExpireDateIsToday: true,
+				StopOrderType: StopOrderTypeStop, TriggerPrice: 1950, StopOrderPrice: 1940, ExitPositionType: ExitPositionTypeDayAsc, ExitPositions: []ExitPosition{}, SecondPassword: "second"}},
+		{name: "現物売りは新規注文にできない",
+			entry:   NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock},
+			exit:    BracketExitConfig{TakeProfitPrice: 2100},
+			want:    NewOrderRequest{},
+			wantErr: OrderBuildErr},
+		{name: "利確も損切もなければエラー",
+			entry:   NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock},
+			want:    NewOrderRequest{},
+			wantErr: OrderBuildErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := bracketExitRequest(test.entry, test.exit, 100, "second")
+			if !reflect.DeepEqual(test.want, got) || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErr, got, err)
+			}
+		})
+	}
+}
+
+func Test_FileBracketStore(t *testing.T) {
+	t.Parallel()
+	store := NewFileBracketStore(filepath.Join(t.TempDir(), "brackets.json"))
+
+	got, err := store.Load()
+	if got != nil || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), nil, nil, got, err)
+	}
+
+	want := []Bracket{{ID: "1", Entry: NewOrderRequest{IssueCode: "1475"}, Exit: BracketExitConfig{TakeProfitPrice: 2100}, ContractQuantity: 100,
+		Exits: []BracketExit{{OrderNumber: "2", Quantity: 100}}}}
+	if err := store.Save(want); err != nil {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+	got, err = store.Load()
+	if !reflect.DeepEqual(want, got) || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, nil, got, err)
+	}
+}
+
+func Test_BracketManager_Place(t *testing.T) {
+	t.Parallel()
+	orderErr := errors.New("order error")
+	entry := NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 300, SecondPassword: "second"}
+	requestedAt := time.Date(2022, 7, 26, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		client        *testClient
+		entry         NewOrderRequest
+		exit          BracketExitConfig
+		want          []Bracket
+		wantErr       error
+		wantNewOrders int
+	}{
+		{name: "新規注文を送って保存する 第二パスワードは保存しない",
+			client: &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1", ExecutionDate: time.Date(2022, 7, 26, 0, 0, 0, 0, time.UTC)}},
+			entry:  entry, exit: BracketExitConfig{TakeProfitPrice: 2100},
+			want: []Bracket{{ID: "1", Entry: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 300},
+				EntryExecutionDate: time.Date(2022, 7, 26, 0, 0, 0, 0, time.UTC), Exit: BracketExitConfig{TakeProfitPrice: 2100}, Exits: []BracketExit{}, RequestedAt: requestedAt}},
+			wantNewOrders: 1},
+		{name: "返済注文を作れなければ新規注文を送らない",
+			client: &testClient{}, entry: entry, wantErr: OrderBuildErr},
+		{name: "新規注文が受け付けられなければ、送る前に保存したものを消してエラー",
+			client: &testClient{newOrder1: &NewOrderResponse{ResultCode: "11104"}}, entry: entry, exit: BracketExitConfig{TakeProfitPrice: 2100},
+			want: []Bracket{}, wantErr: OrderRejectedErr, wantNewOrders: 1},
+		{name: "新規注文のエラーはそのまま返し、受け付けられたかわからないので送る前に保存したものを残す",
+			client: &testClient{newOrder2: orderErr}, entry: entry, exit: BracketExitConfig{TakeProfitPrice: 2100},
+			want: []Bracket{{ID: "pending-1", Entry: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 300},
+				Exit: BracketExitConfig{TakeProfitPrice: 2100}, Exits: []BracketExit{}, RequestedAt: requestedAt}},
+			wantErr: orderErr, wantNewOrders: 1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			m, store := newTestBracketManager(t, test.client)
+			_, err := m.Place(context.Background(), test.entry, test.exit)
+			got, _ := store.Load()
+			if !reflect.DeepEqual(test.want, got) || !errors.Is(err, test.wantErr) || test.wantNewOrders != test.client.newOrderCount {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.want, test.wantErr, test.wantNewOrders, got, err, test.client.newOrderCount)
+			}
+		})
+	}
+}
+
+// Test_BracketManager_Place_afterError - 受け付けられたかわからない新規注文は、次の新規注文を送っても残り、Resumeで注文一覧から探せる
+func Test_BracketManager_Place_afterError(t *testing.T) {
+	t.Parallel()
+	orderErr := errors.New("order error")
+	client := &testClient{newOrder2: orderErr}
+	m, store := newTestBracketManager(t, client)
+	ctx := context.Background()
+	entry := NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100}
+	exit := BracketExitConfig{TakeProfitPrice: 2100}
+
+	_, err1 := m.Place(ctx, entry, exit)
+	_, err2 := m.Place(ctx, entry, exit)
+	client.newOrder1, client.newOrder2 = &NewOrderResponse{ResultCode: "0", OrderNumber: "3"}, nil
+	_, err3 := m.Place(ctx, entry, exit)
+	saved, _ := store.Load()
+	gotSaved := []string{}
+	for _, b := range saved {
+		gotSaved = append(gotSaved, b.ID)
+	}
+	wantSaved := []string{"3", "pending-1", "pending-2"}
+	if !errors.Is(err1, orderErr) || !errors.Is(err2, orderErr) || err3 != nil || !reflect.DeepEqual(wantSaved, gotSaved) {
+		t.Fatalf("%s error\nwant: %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(), orderErr, orderErr, nil, wantSaved, err1, err2, err3, gotSaved)
+	}
+
+	// 再起動したら、送ったかわからない新規注文をそれぞれ別の注文とみなして再開する
+	requestedAt := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	client.orderList1 = &OrderListResponse{Orders: []Order{
+		{OrderNumber: "1", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderDateTime: requestedAt},
+		{OrderNumber: "2", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderDateTime: requestedAt},
+		{OrderNumber: "3", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderDateTime: requestedAt}}}
+	client.orderDetail1 = &OrderDetailResponse{OrderQuantity: 100, OrderStatus: OrderStatusInOrder}
+	resumed := NewBracketManager(client, &Session{}, store, "")
+	err := resumed.Resume(ctx)
+	got := []string{}
+	for _, b := range resumed.Brackets() {
+		got = append(got, b.ID)
+	}
+	want := []string{"1", "2", "3"}
+	if !reflect.DeepEqual(want, got) || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, nil, got, err)
+	}
+}
+
+// hookNewOrderClient - 新規注文のレスポンスを返す前に処理を挟むクライアント
+type hookNewOrderClient struct {
+	*testClient
+	hook func()
+}
+
+func (c *hookNewOrderClient) NewOrder(ctx context.Context, session *Session, req NewOrderRequest) (*NewOrderResponse, error) {
+	res, err := c.testClient.NewOrder(ctx, session, req)
+	if hook := c.hook; hook != nil {
+		c.hook = nil
+		hook()
+	}
+	return res, err
+}
+
+// Test_BracketManager_Place_inFlight - 新規注文を送る前に保存し、レスポンスより先に届いた約定通知も取りこぼさない
+func Test_BracketManager_Place_inFlight(t *testing.T) {
+	t.Parallel()
+	client := &hookNewOrderClient{testClient: &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1"}}}
+	m, store := newTestBracketManager(t, client)
+	ctx := context.Background()
+
+	var inFlight []Bracket
+	applied := make(chan error, 1)
+	client.hook = func() {
+		inFlight, _ = store.Load()
+		client.newOrder1 = &NewOrderResponse{ResultCode: "0", OrderNumber: "2"}
+		go func() {
+			applied <- m.Apply(ctx, &ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", Quantity: 100, ContractQuantity: 100, ContractStatus: ContractStatusDone})
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := m.Place(ctx, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100}, BracketExitConfig{TakeProfitPrice: 2100}); err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+	if err := <-applied; err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+
+	if len(inFlight) != 1 || !isPendingBracketID(inFlight[0].ID) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), "pending bracket", inFlight)
+	}
+	want := []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}}
+	got := m.Brackets()
+	if len(got) != 1 || got[0].ID != "1" || !got[0].EntryDone || !reflect.DeepEqual(want, got[0].Exits) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+// Test_BracketManager_Apply - 一部約定ごとに約定した数量の返済注文を出し、返済注文が全部終わったら終わる
+func Test_BracketManager_Apply(t *testing.T) {
+	t.Parallel()
+	client := &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1"}}
+	m, store := newTestBracketManager(t, client)
+	ctx := context.Background()
+	if _, err := m.Place(ctx, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 300},
+		BracketExitConfig{TakeProfitPrice: 2100, StopLossTriggerPrice: 1950}); err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+
+	steps := []struct {
+		res       *ContractStreamResponse
+		newOrder  string
+		wantExits []BracketExit
+		wantDone  bool
+	}{
+		{res: &ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeReceiveOrder, OrderNumber: "1", Quantity: 300},
+			wantExits: []BracketExit{}},
+		{res: &ContractStreamResponse{EventNo: 2, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", Quantity: 300, ContractQuantity: 100, ContractStatus: ContractStatusPart},
+			newOrder:  "2",
+			wantExits: []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}}},
+		{res: &ContractStreamResponse{EventNo: 3, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", Quantity: 300, ContractQuantity: 300, ContractStatus: ContractStatusDone},
+			newOrder: "3",
+			wantExits: []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)},
+				{OrderNumber: "3", Quantity: 200, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}}},
+		{res: &ContractStreamResponse{EventNo: 4, StreamOrderType: StreamOrderTypeContract, OrderNumber: "2", Quantity: 100, ContractQuantity: 100, ContractStatus: ContractStatusDone},
+			wantExits: []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local), Done: true},
+				{OrderNumber: "3", Quantity: 200, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}}},
+		{res: &ContractStreamResponse{EventNo: 5, StreamOrderType: StreamOrderTypeContract, OrderNumber: "3", Quantity: 200, ContractQuantity: 200, ContractStatus: ContractStatusDone},
+			wantExits: []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local), Done: true},
+				{OrderNumber: "3", Quantity: 200, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local), Done: true}},
+			wantDone: true},
+	}
+
+	for i, step := range steps {
+		client.newOrder1 = &NewOrderResponse{ResultCode: "0", OrderNumber: step.newOrder}
+		if err := m.Apply(ctx, step.res); err != nil {
+			t.Fatalf("%s error step %d\nwant: %+v\ngot: %+v\n", t.Name(), i, nil, err)
+		}
+		got := m.Brackets()
+		saved, _ := store.Load()
+		if len(got) != 1 || !reflect.DeepEqual(step.wantExits, got[0].Exits) || step.wantDone != got[0].Done || len(saved) != 1 || len(saved[0].Exits) != len(step.wantExits) {
+			t.Errorf("%s error step %d\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), i, step.wantExits, step.wantDone, got, saved)
+		}
+	}
+	if client.newOrderCount != 3 {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), 3, client.newOrderCount)
+	}
+}
+
+func Test_BracketManager_Resume(t *testing.T) {
+	t.Parallel()
+	requestedAt := time.Date(2022, 7, 26, 9, 30, 0, 500000000, time.UTC)
+	saved := Bracket{ID: "1", Entry: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 300},
+		Exit: BracketExitConfig{TakeProfitPrice: 2100}, ContractQuantity: 100, Exits: []BracketExit{{Quantity: 100, RequestedAt: requestedAt}}}
+	tests := []struct {
+		name          string
+		client        *testClient
+		wantExits     []BracketExit
+		wantNewOrders int
+	}{
+		{name: "送ったかわからない返済注文が注文一覧にあればそれとみなし、止まっていたあいだに約定した数量の返済注文を出す 終わった返済注文は終わりにする",
+			client: &testClient{
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 300, ContractQuantity: 300, OrderStatus: OrderStatusDone},
+				orderList1: &OrderListResponse{Orders: []Order{
+					{OrderNumber: "1", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 300, OrderDateTime: requestedAt.Add(-time.Minute)},
+					{OrderNumber: "2", Side: SideSell, TradeType: TradeTypeStock, OrderQuantity: 100, OrderDateTime: requestedAt.Truncate(time.Second)}}},
+				newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "3"}},
+			wantExits: []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: requestedAt, Done: true},
+				{OrderNumber: "3", Quantity: 200, RequestedAt: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}},
+			wantNewOrders: 1},
+		{name: "端末の時計が進んでいて、注文日時が送った日時より前でも、許す範囲ならそれとみなす",
+			client: &testClient{
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 300, ContractQuantity: 100, OrderStatus: OrderStatusPart},
+				orderList1: &OrderListResponse{Orders: []Order{
+					{OrderNumber: "2", Side: SideSell, TradeType: TradeTypeStock, OrderQuantity: 100, OrderDateTime: requestedAt.Add(-10 * time.Second)}}}},
+			wantExits:     []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: requestedAt}},
+			wantNewOrders: 0},
+		{name: "許す範囲より前の注文は別の注文なので送りなおす",
+			client: &testClient{
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 300, ContractQuantity: 100, OrderStatus: OrderStatusPart},
+				orderList1: &OrderListResponse{Orders: []Order{
+					{OrderNumber: "2", Side: SideSell, TradeType: TradeTypeStock, OrderQuantity: 100, OrderDateTime: requestedAt.Add(-time.Hour)}}},
+				newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "3"}},
+			wantExits:     []BracketExit{{OrderNumber: "3", Quantity: 100, RequestedAt: requestedAt}},
+			wantNewOrders: 1},
+		{name: "送ったかわからない返済注文が注文一覧になければ送りなおす",
+			client: &testClient{
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 300, ContractQuantity: 100, OrderStatus: OrderStatusPart},
+				orderList1:   &OrderListResponse{},
+				newOrder1:    &NewOrderResponse{ResultCode: "0", OrderNumber: "2"}},
+			wantExits:     []BracketExit{{OrderNumber: "2", Quantity: 100, RequestedAt: requestedAt}},
+			wantNewOrders: 1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			m, store := newTestBracketManager(t, test.client)
+			if err := store.Save([]Bracket{saved}); err != nil {
+				t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+			}
+			err := m.Resume(context.Background())
+			got := m.Brackets()
+			if len(got) != 1 || !reflect.DeepEqual(test.wantExits, got[0].Exits) || test.wantNewOrders != test.client.newOrderCount || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantExits, test.wantNewOrders, nil, got, test.client.newOrderCount, err)
+			}
+		})
+	}
+}
+
+func Test_BracketManager_Resume_pendingEntry(t *testing.T) {
+	t.Parallel()
+	requestedAt := time.Date(2022, 7, 26, 9, 30, 0, 500000000, time.UTC)
+	saved := Bracket{ID: "pending-1", Entry: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100},
+		Exit: BracketExitConfig{TakeProfitPrice: 2100}, Exits: []BracketExit{}, RequestedAt: requestedAt}
+	tests := []struct {
+		name   string
+		client *testClient
+		want   []string
+	}{
+		{name: "送ったかわからない新規注文が注文一覧にあれば、その注文番号で再開する",
+			client: &testClient{
+				orderList1: &OrderListResponse{Orders: []Order{
+					{OrderNumber: "1", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderDateTime: requestedAt.Truncate(time.Second)}}},
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 100, OrderStatus: OrderStatusInOrder}},
+			want: []string{"1"}},
+		{name: "送ったかわからない新規注文が注文一覧になければ、受け付けられていないので捨てる",
+			client: &testClient{orderList1: &OrderListResponse{}},
+			want:   []string{}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			m, store := newTestBracketManager(t, test.client)
+			if err := store.Save([]Bracket{saved}); err != nil {
+				t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+			}
+			err := m.Resume(context.Background())
+			got := []string{}
+			for _, b := range m.Brackets() {
+				got = append(got, b.ID)
+			}
+			if !reflect.DeepEqual(test.want, got) || test.client.newOrderCount != 0 || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.want, 0, nil, got, test.client.newOrderCount, err)
+			}
+		})
+	}
+}
+
+func Test_BracketManager_Amend(t *testing.T) {
+	t.Parallel()
+	saved := Bracket{ID: "1", Entry: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 300},
+		Exit: BracketExitConfig{TakeProfitPrice: 2100, StopLossTriggerPrice: 1950}, ContractQuantity: 300,
+		Exits: []BracketExit{{OrderNumber: "2", Quantity: 100, Done: true}, {OrderNumber: "3", Quantity: 200}}}
+	tests := []struct {
+		name         string
+		client       *testClient
+		id           string
+		takeProfit   float64
+		stopLoss     float64
+		wantExit     BracketExitConfig
+		wantCorrects int
+		wantErr      error
+	}{
+		{name: "終わっていない返済注文だけを訂正する",
+			client: &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "0"}}, id: "1", stopLoss: 2000,
+			wantExit: BracketExitConfig{TakeProfitPrice: 2100, StopLossTriggerPrice: 2000}, wantCorrects: 1},
+		{name: "なければエラー",
+			client: &testClient{}, id: "9", stopLoss: 2000,
+			wantExit: BracketExitConfig{TakeProfitPrice: 2100, StopLossTriggerPrice: 1950}, wantErr: BracketNotFoundErr},
+		{name: "訂正が受け付けられなければエラー",
+			client: &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "11111"}}, id: "1", takeProfit: 2200,
+			wantExit: BracketExitConfig{TakeProfitPrice: 2200, StopLossTriggerPrice: 1950}, wantCorrects: 1, wantErr: OrderRejectedErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			m, _ := newTestBracketManager(t, test.client)
+			b := saved
+			b.Exits = append([]BracketExit{}, saved.Exits...)
+			m.brackets[b.ID] = &b
+
+			err := m.Amend(context.Background(), test.id, test.takeProfit, test.stopLoss)
+			got := m.Brackets()[0].Exit
+			if !reflect.DeepEqual(test.wantExit, got) || test.wantCorrects != test.client.correctCount || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantExit, test.wantCorrects, test.wantErr, got, test.client.correctCount, err)
+			}
+		})
+	}
+}
@@ -94,6 +94,12 @@ func (c *client) CancelOrder(ctx context.Context, session *Session, req CancelOr
 	if session == nil {
 		return nil, NilArgumentErr
 	}
+	if c.dryRun != nil {
+		return c.dryRun.cancelOrder(req)
+	}
+	if err := c.orderAllowed(); err != nil {
+		return nil, err
+	}
 	session.mtx.Lock()
 	defer session.mtx.Unlock()
 
@@ -101,7 +101,7 @@ func Test_client_CancelOrder(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			client := &client{clock: test.clock, requester: test.requester}
+			client := &client{clock: test.clock, env: EnvironmentDemo, requester: test.requester}
 			got1, got2 := client.CancelOrder(test.arg1, test.arg2, test.arg3)
 
 			if !reflect.DeepEqual(test.want1, got1) || !errors.Is(got2, test.want2) {
@@ -117,7 +117,7 @@ func Test_client_CancelOrder_Execute(t *testing.T) {
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	client := NewClient(EnvironmentProduction, ApiVersionLatest)
+	client := NewClient(EnvironmentProduction, ApiVersionLatest, WithProductionOrders())
 	got1, got2 := client.Login(context.Background(), LoginRequest{
 		UserId:   userId,
 		Password: password,
@@ -0,0 +1,384 @@
+package tachibana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+const (
+	cassetteMethodGet    = "get"                       // Transport.Get
+	cassetteMethodStream = "stream"                    // Transport.Stream
+	cassetteRedacted     = "***"                       // 伏せた値
+	cassetteRedactedURL  = "https://redacted.invalid/" // 伏せた仮想URL
+)
+
+// cassetteRedactKeys - 記録しないリクエストの項目
+var cassetteRedactKeys = []string{"sPassword", "sSecondPassword"}
+
+// cassetteURLKeys - ログインのレスポンスに含まれる仮想URLの項目 セッションの認証情報になるので記録しない
+var cassetteURLKeys = []string{"sUrlRequest", "sUrlMaster", "sUrlPrice", "sUrlEvent"}
+
+// cassetteVolatileKeys - 送るたびに変わるので、照合に使わないリクエストの項目
+var cassetteVolatileKeys = []string{"p_no", "p_sd_date"}
+
+// CassetteMatch - 再生するときに、リクエストに対してどの記録を返すか
+type CassetteMatch string
+
+const (
+	CassetteMatchUnspecified CassetteMatch = ""          // 未指定(Order)
+	CassetteMatchOrder       CassetteMatch = "order"     // リクエストの内容によらず、記録した順に返す
+	CassetteMatchSignature   CassetteMatch = "signature" // 機能IDやパラメータが同じ記録を、記録した順に返す 使い切ったら最後のものを返し続ける
+)
+
+// Cassette - 記録した通信
+type Cassette struct {
+	Interactions []*CassetteInteraction `json:"interactions"`
+}
+
+// CassetteInteraction - 1回分の通信の記録
+type CassetteInteraction struct {
+	Method    string          `json:"method"`          // get or stream
+	URI       string          `json:"uri"`             // 送信先
+	Signature string          `json:"signature"`       // 照合に使う値 パスワードを伏せ、送信通番と送信日時を除いたリクエスト
+	Request   json.RawMessage `json:"request"`         // パスワードを伏せたリクエスト
+	Responses []string        `json:"responses"`       // UTF-8に変換したレスポンス streamなら受信した行ごと
+	Error     string          `json:"error,omitempty"` // 通信で発生したエラー
+}
+
+// LoadCassette - 記録した通信をファイルから読み込む
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(b, &cassette); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, UnmarshalFailedErr)
+	}
+	return &cassette, nil
+}
+
+// Save - 記録した通信をファイルに書き出す
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// cassetteRequest - リクエストをパスワードを伏せたJSONと、照合に使う値に変換する
+func cassetteRequest(request interface{}) (json.RawMessage, string, error) {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var m map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		return nil, "", err
+	}
+	for _, k := range cassetteRedactKeys {
+		if _, ok := m[k]; ok {
+			m[k] = cassetteRedacted
+		}
+	}
+	redacted, err := json.Marshal(m)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, k := range cassetteVolatileKeys {
+		delete(m, k)
+	}
+	signature, err := json.Marshal(m)
+	if err != nil {
+		return nil, "", err
+	}
+	return redacted, string(signature), nil
+}
+
+// NewCassetteRecorder - transportで通信し、その内容を記録するTransportを生成する
+func NewCassetteRecorder(transport Transport) *CassetteRecorder {
+	return &CassetteRecorder{transport: transport, cassette: &Cassette{}}
+}
+
+// CassetteRecorder - 通信しながら、リクエストとレスポンスを記録するTransport
+type CassetteRecorder struct {
+	transport Transport
+	cassette  *Cassette
+	mtx       sync.Mutex
+}
+
+// record - 通信の記録を追加する
+func (r *CassetteRecorder) record(method string, uri string, request interface{}) (*CassetteInteraction, error) {
+	req, signature, err := cassetteRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &CassetteInteraction{Method: method, URI: uri, Signature: signature, Request: req, Responses: []string{}}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	return interaction, nil
+}
+
+func (r *CassetteRecorder) Get(ctx context.Context, uri string, request interface{}) ([]byte, error) {
+	interaction, err := r.record(cassetteMethodGet, uri, request)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := r.transport.Get(ctx, uri, request)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if err != nil {
+		interaction.Error = err.Error()
+	} else {
+		interaction.Responses = append(interaction.Responses, string(b))
+	}
+	return b, err
+}
+
+func (r *CassetteRecorder) Stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) {
+	interaction, err := r.record(cassetteMethodStream, uri, request)
+	if err != nil {
+		return cassetteStreamError(ctx, err)
+	}
+
+	ch, errCh := r.transport.Stream(ctx, uri, request)
+	rCh := make(chan []byte)
+	rErrCh := make(chan error)
+	go func() {
+		defer close(rCh)
+		defer close(rErrCh)
+
+		for ch != nil || errCh != nil {
+			select {
+			case b, ok := <-ch:
+				if !ok {
+					ch = nil
+					continue
+				}
+				r.mtx.Lock()
+				interaction.Responses = append(interaction.Responses, string(b))
+				r.mtx.Unlock()
+				select {
+				case <-ctx.Done():
+				case rCh <- b:
+				}
+			case err, ok := <-errCh:
+				if !ok {
+					errCh = nil
+					continue
+				}
+				if err == nil {
+					continue
+				}
+				r.mtx.Lock()
+				interaction.Error = err.Error()
+				r.mtx.Unlock()
+				select {
+				case <-ctx.Done():
+				case rErrCh <- err:
+				}
+			}
+		}
+	}()
+	return rCh, rErrCh
+}
+
+// Cassette - ここまでに記録した通信 通信中のstreamは受信したところまで
+// ログインのレスポンスの仮想URLと、ログイン以外の送信先は伏せる
+func (r *CassetteRecorder) Cassette() *Cassette {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	cassette := &Cassette{Interactions: make([]*CassetteInteraction, len(r.cassette.Interactions))}
+	for i, interaction := range r.cassette.Interactions {
+		copied := *interaction
+		copied.Responses = append([]string{}, interaction.Responses...)
+		cassette.Interactions[i] = &copied
+	}
+	cassetteRedactURLs(cassette.Interactions)
+	return cassette
+}
+
+// cassetteRedactURLs - ログインのレスポンスにある仮想URLを、項目ごとの伏せたURLに置き換える
+// ログイン以外の送信先は仮想URLなので、ログインのレスポンスになくても伏せる 再生では送信先を使わない
+func cassetteRedactURLs(interactions []*CassetteInteraction) {
+	var pairs []string
+	for _, interaction := range interactions {
+		for _, res := range interaction.Responses {
+			var m map[string]interface{}
+			if err := json.Unmarshal([]byte(res), &m); err != nil {
+				continue
+			}
+			for _, k := range cassetteURLKeys {
+				if u, ok := m[k].(string); ok && u != "" {
+					redacted := cassetteRedactedURL + k + "/"
+					pairs = append(pairs, u, redacted, strings.ReplaceAll(u, "/", `\/`), strings.ReplaceAll(redacted, "/", `\/`))
+				}
+			}
+		}
+	}
+
+	replacer := strings.NewReplacer(pairs...)
+	for _, interaction := range interactions {
+		for i, res := range interaction.Responses {
+			interaction.Responses[i] = replacer.Replace(res)
+		}
+		interaction.URI = replacer.Replace(interaction.URI)
+		if !strings.HasPrefix(interaction.URI, cassetteRedactedURL) && !strings.HasSuffix(interaction.URI, "/auth/") {
+			interaction.URI = cassetteRedactedURL + "session/"
+		}
+	}
+}
+
+// Save - ここまでに記録した通信をファイルに書き出す
+func (r *CassetteRecorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// NewCassettePlayer - 記録した通信を再生するTransportを生成する
+func NewCassettePlayer(cassette *Cassette, match CassetteMatch) *CassettePlayer {
+	if match == CassetteMatchUnspecified {
+		match = CassetteMatchOrder
+	}
+	return &CassettePlayer{cassette: cassette, match: match, signatures: map[string]int{}}
+}
+
+// CassettePlayer - サーバと通信せずに、記録した通信を返すTransport
+// 返す記録が見つからなければCassetteNotFoundErrを返す
+type CassettePlayer struct {
+	cassette   *Cassette
+	match      CassetteMatch
+	next       int            // Orderで次に返す記録
+	signatures map[string]int // Signatureで照合値ごとに返した回数
+	mtx        sync.Mutex
+}
+
+// find - リクエストに対して返す記録を探す
+func (p *CassettePlayer) find(method string, request interface{}) (*CassetteInteraction, error) {
+	_, signature, err := cassetteRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	switch p.match {
+	case CassetteMatchSignature:
+		var found []*CassetteInteraction
+		for _, interaction := range p.cassette.Interactions {
+			if interaction.Method == method && interaction.Signature == signature {
+				found = append(found, interaction)
+			}
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%s %s: %w", method, signature, CassetteNotFoundErr)
+		}
+		i := p.signatures[signature]
+		if i >= len(found) {
+			i = len(found) - 1
+		}
+		p.signatures[signature]++
+		return found[i], nil
+	default:
+		if p.next >= len(p.cassette.Interactions) {
+			return nil, fmt.Errorf("%s %s: all %d interactions are used: %w", method, signature, len(p.cassette.Interactions), CassetteNotFoundErr)
+		}
+		interaction := p.cassette.Interactions[p.next]
+		if interaction.Method != method {
+			return nil, fmt.Errorf("%s %s: interaction %d is %s: %w", method, signature, p.next, interaction.Method, CassetteNotFoundErr)
+		}
+		p.next++
+		return interaction, nil
+	}
+}
+
+func (p *CassettePlayer) Get(_ context.Context, _ string, request interface{}) ([]byte, error) {
+	interaction, err := p.find(cassetteMethodGet, request)
+	if err != nil {
+		return nil, err
+	}
+	if interaction.Error != "" {
+		return nil, cassetteError(interaction.Error)
+	}
+	if len(interaction.Responses) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(interaction.Responses[0]), nil
+}
+
+func (p *CassettePlayer) Stream(ctx context.Context, _ string, request interface{}) (<-chan []byte, <-chan error) {
+	interaction, err := p.find(cassetteMethodStream, request)
+	if err != nil {
+		return cassetteStreamError(ctx, err)
+	}
+
+	ch := make(chan []byte)
+	errCh := make(chan error)
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+
+		for _, res := range interaction.Responses {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- []byte(res):
+			}
+		}
+		if interaction.Error != "" {
+			select {
+			case <-ctx.Done():
+			case errCh <- cassetteError(interaction.Error):
+			}
+		}
+	}()
+	return ch, errCh
+}
+
+// cassetteErrors - 再生したエラーでもerrors.Isで判定できるようにするエラー
+var cassetteErrors = []error{StatusNotOkErr, EncodeErr, UnmarshalFailedErr, StreamError}
+
+// cassetteError - 記録したエラーの文言からエラーを作る 文言がライブラリのエラーで終わっていれば、そのエラーを包む
+func cassetteError(text string) error {
+	for _, e := range cassetteErrors {
+		if text == e.Error() {
+			return e
+		}
+		if strings.HasSuffix(text, ": "+e.Error()) {
+			return fmt.Errorf("%s: %w", strings.TrimSuffix(text, ": "+e.Error()), e)
+		}
+	}
+	return errors.New(text)
+}
+
+// cassetteStreamError - エラーを1つ流して閉じるstreamのチャネル
+func cassetteStreamError(ctx context.Context, err error) (<-chan []byte, <-chan error) {
+	ch := make(chan []byte)
+	errCh := make(chan error)
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+		select {
+		case <-ctx.Done():
+		case errCh <- err:
+		}
+	}()
+	return ch, errCh
+}
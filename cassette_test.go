@@ -0,0 +1,308 @@
+package tachibana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_cassetteRequest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		arg   interface{}
+		want1 json.RawMessage
+		want2 string
+	}{
+		{name: "パスワードを伏せ、照合値からは送信通番と送信日時を除く",
+			arg:   (&LoginRequest{UserId: "user-id", Password: "password"}).request(1, time.Date(2022, 3, 11, 10, 43, 0, 0, time.Local)),
+			want1: json.RawMessage(`{"p_no":"1","p_sd_date":"2022.03.11-10:43:00.000","sCLMID":"CLMAuthLoginRequest","sJsonOfmt":"6","sPassword":"***","sUserId":"user-id"}`),
+			want2: `{"sCLMID":"CLMAuthLoginRequest","sJsonOfmt":"6","sPassword":"***","sUserId":"user-id"}`},
+		{name: "第二パスワードも伏せる",
+			arg:   map[string]string{"sCLMID": "CLMKabuCancelOrder", "sOrderNumber": "1", "sSecondPassword": "password"},
+			want1: json.RawMessage(`{"sCLMID":"CLMKabuCancelOrder","sOrderNumber":"1","sSecondPassword":"***"}`),
+			want2: `{"sCLMID":"CLMKabuCancelOrder","sOrderNumber":"1","sSecondPassword":"***"}`},
+		{name: "送信日時が違っても照合値は同じ",
+			arg:   (&LoginRequest{UserId: "user-id", Password: "other"}).request(5, time.Date(2022, 3, 12, 9, 0, 0, 0, time.Local)),
+			want1: json.RawMessage(`{"p_no":"5","p_sd_date":"2022.03.12-09:00:00.000","sCLMID":"CLMAuthLoginRequest","sJsonOfmt":"6","sPassword":"***","sUserId":"user-id"}`),
+			want2: `{"sCLMID":"CLMAuthLoginRequest","sJsonOfmt":"6","sPassword":"***","sUserId":"user-id"}`},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got1, got2, err := cassetteRequest(test.arg)
+			if string(test.want1) != string(got1) || test.want2 != got2 || err != nil {
+				t.Errorf("%s error\nwant: %s, %+v, %+v\ngot: %s, %+v, %+v\n", t.Name(), test.want1, test.want2, nil, got1, got2, err)
+			}
+		})
+	}
+}
+
+func Test_cassetteRequest_error(t *testing.T) {
+	t.Parallel()
+	_, _, err := cassetteRequest(make(chan int))
+	if err == nil {
+		t.Errorf("%s error\nwant: error\ngot: %+v\n", t.Name(), err)
+	}
+}
+
+// Test_CassetteRecorder - 記録した通信をファイルに書き出し、読み込んで再生すると同じ結果になること
+func Test_CassetteRecorder(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 3, 21, 5, 33, 27, 0, time.Local)
+	session := &Session{RequestURL: "https://example.com/request/", MasterURL: "https://example.com/master/"}
+	transport := &testTransport{
+		get1: []byte(`{"p_no":"1","p_errno":"0","sCLMID":"CLMZanKaiKanougaku","sResultCode":"0","sIssueCode":"1475","sSummaryGenkabuKaituke":"1000011"}`),
+		stream1: [][]byte{
+			[]byte(`{"sCLMID":"CLMDateZyouhou","sDayKey":"001","sTheDay":"20220322"}`),
+			[]byte(`{"p_no":"2","p_errno":"0","sCLMID":"CLMEventDownloadComplete"}`),
+		},
+	}
+	recorder := NewCassetteRecorder(transport)
+	c := NewClient(EnvironmentDemo, ApiVersionLatest, WithTransport(recorder)).(*client)
+	c.clock = &testClock{Now1: now}
+
+	want1, err := c.StockWallet(context.Background(), session, StockWalletRequest{IssueCode: "1475"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want2, err := c.BusinessDay(context.Background(), session, BusinessDayRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cassette.Interactions) != 2 || cassette.Interactions[0].Method != cassetteMethodGet || cassette.Interactions[1].Method != cassetteMethodStream ||
+		!reflect.DeepEqual(transport.stream1, [][]byte{[]byte(cassette.Interactions[1].Responses[0]), []byte(cassette.Interactions[1].Responses[1])}) {
+		t.Fatalf("%s error\ngot: %+v\n", t.Name(), cassette.Interactions)
+	}
+
+	// 再生はサーバに接続しない 送信通番や送信日時が違っても照合できる
+	player := NewCassettePlayer(cassette, CassetteMatchSignature)
+	c2 := NewClient(EnvironmentDemo, ApiVersionLatest, WithTransport(player)).(*client)
+	c2.clock = &testClock{Now1: now.Add(time.Hour)}
+	session2 := &Session{lastRequestNo: 10}
+	got2, err2 := c2.BusinessDay(context.Background(), session2, BusinessDayRequest{})
+	got1, err1 := c2.StockWallet(context.Background(), session2, StockWalletRequest{IssueCode: "1475"})
+	if !reflect.DeepEqual(want1, got1) || !reflect.DeepEqual(want2, got2) || err1 != nil || err2 != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(), want1, want2, got1, got2, err1, err2)
+	}
+}
+
+func Test_CassetteRecorder_Get_password(t *testing.T) {
+	t.Parallel()
+	recorder := NewCassetteRecorder(&testTransport{get2: StatusNotOkErr})
+	c := NewClient(EnvironmentDemo, ApiVersionLatest, WithTransport(recorder))
+	_, _ = c.Login(context.Background(), LoginRequest{UserId: "user-id", Password: "secret-password"})
+
+	b, err := json.Marshal(recorder.Cassette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := recorder.Cassette().Interactions[0]
+	if strings.Contains(string(b), "secret-password") || got.Error != StatusNotOkErr.Error() || len(got.Responses) != 0 {
+		t.Errorf("%s error\ngot: %s\n", t.Name(), b)
+	}
+}
+
+// Test_CassetteRecorder_Cassette_url - ログインのレスポンスの仮想URLと、それを使った送信先を伏せる
+func Test_CassetteRecorder_Cassette_url(t *testing.T) {
+	t.Parallel()
+	login := `{"p_no":"1","p_errno":"0","sCLMID":"CLMAuthLoginAck","sResultCode":"0",` +
+		`"sUrlRequest":"https:\/\/example.com\/request\/secret-token\/","sUrlMaster":"https://example.com/master/secret-token/",` +
+		`"sUrlPrice":"https://example.com/price/secret-token/","sUrlEvent":"https://example.com/event/secret-token/"}`
+	recorder := NewCassetteRecorder(&testTransport{})
+	interaction, _ := recorder.record(cassetteMethodGet, "https://example.com/auth/", map[string]string{"sCLMID": "CLMAuthLoginRequest"})
+	interaction.Responses = append(interaction.Responses, login)
+	recorder.record(cassetteMethodGet, "https://example.com/master/secret-token/", map[string]string{"sCLMID": "CLMMfdsGetMasterData"})
+	recorder.record(cassetteMethodStream, "https://example.com/event/secret-token/", map[string]string{})
+	recorder.record(cassetteMethodGet, "https://example.com/request/other-token/", map[string]string{"sCLMID": "CLMZanKaiKanougaku"})
+
+	b, err := json.Marshal(recorder.Cassette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotURIs := []string{}
+	for _, interaction := range recorder.Cassette().Interactions {
+		gotURIs = append(gotURIs, interaction.URI)
+	}
+	wantURIs := []string{"https://example.com/auth/", "https://redacted.invalid/sUrlMaster/", "https://redacted.invalid/sUrlEvent/", "https://redacted.invalid/session/"}
+	if strings.Contains(string(b), "token") || !reflect.DeepEqual(wantURIs, gotURIs) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v, %s\n", t.Name(), wantURIs, gotURIs, b)
+	}
+	if !strings.Contains(recorder.cassette.Interactions[1].URI, "secret-token") {
+		t.Errorf("%s error\nrecording must not be modified: %+v\n", t.Name(), recorder.cassette.Interactions[1])
+	}
+}
+
+func Test_CassetteRecorder_Stream_error(t *testing.T) {
+	t.Parallel()
+	recorder := NewCassetteRecorder(&testTransport{stream1: [][]byte{[]byte("a")}, stream2: StatusNotOkErr})
+	ch, errCh := recorder.Stream(context.Background(), "https://example.com/", BusinessDayRequest{})
+	var gotErr error
+	for ch != nil || errCh != nil {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				ch = nil
+			}
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			gotErr = err
+		}
+	}
+
+	got := recorder.Cassette().Interactions[0]
+	if !errors.Is(gotErr, StatusNotOkErr) || !reflect.DeepEqual([]string{"a"}, got.Responses) || got.Error != StatusNotOkErr.Error() {
+		t.Errorf("%s error\ngot: %+v, %+v\n", t.Name(), gotErr, got)
+	}
+}
+
+func Test_CassettePlayer_Get(t *testing.T) {
+	t.Parallel()
+	req := func(issueCode string) interface{} {
+		return (&StockWalletRequest{IssueCode: issueCode}).request(1, time.Time{})
+	}
+	signature := func(issueCode string) string {
+		_, s, _ := cassetteRequest(req(issueCode))
+		return s
+	}
+	cassette := &Cassette{Interactions: []*CassetteInteraction{
+		{Method: cassetteMethodGet, Signature: signature("1475"), Responses: []string{"1475-1"}},
+		{Method: cassetteMethodGet, Signature: signature("1476"), Responses: []string{"1476-1"}},
+		{Method: cassetteMethodGet, Signature: signature("1475"), Responses: []string{"1475-2"}},
+		{Method: cassetteMethodGet, Signature: signature("1477"), Error: "status not ok"},
+	}}
+
+	tests := []struct {
+		name     string
+		match    CassetteMatch
+		args     []string
+		want     []string
+		wantErrs []error
+	}{
+		{name: "未指定なら記録した順に返す",
+			match:    CassetteMatchUnspecified,
+			args:     []string{"9999", "9999", "9999", "9999", "9999"},
+			want:     []string{"1475-1", "1476-1", "1475-2", "", ""},
+			wantErrs: []error{nil, nil, nil, errors.New("status not ok"), CassetteNotFoundErr}},
+		{name: "照合値が同じものを記録した順に返し、使い切ったら最後のものを返す",
+			match:    CassetteMatchSignature,
+			args:     []string{"1476", "1475", "1475", "1475", "1477", "9999"},
+			want:     []string{"1476-1", "1475-1", "1475-2", "1475-2", "", ""},
+			wantErrs: []error{nil, nil, nil, nil, errors.New("status not ok"), CassetteNotFoundErr}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			player := NewCassettePlayer(cassette, test.match)
+			var got []string
+			var gotErrs []error
+			for _, arg := range test.args {
+				b, err := player.Get(context.Background(), "", req(arg))
+				got = append(got, string(b))
+				gotErrs = append(gotErrs, err)
+			}
+
+			matched := len(test.wantErrs) == len(gotErrs)
+			for i := 0; matched && i < len(gotErrs); i++ {
+				switch {
+				case test.wantErrs[i] == nil:
+					matched = gotErrs[i] == nil
+				case errors.Is(test.wantErrs[i], CassetteNotFoundErr):
+					matched = errors.Is(gotErrs[i], CassetteNotFoundErr)
+				default:
+					matched = gotErrs[i] != nil && test.wantErrs[i].Error() == gotErrs[i].Error()
+				}
+			}
+			if !reflect.DeepEqual(test.want, got) || !matched {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErrs, got, gotErrs)
+			}
+		})
+	}
+}
+
+func Test_cassetteError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		arg      string
+		wantText string
+		wantIs   error
+	}{
+		{name: "ライブラリのエラーならそのエラー", arg: "status not ok", wantText: "status not ok", wantIs: StatusNotOkErr},
+		{name: "ライブラリのエラーで終わっていれば包む", arg: "status is 500(body: ): status not ok", wantText: "status is 500(body: ): status not ok", wantIs: StatusNotOkErr},
+		{name: "それ以外は文言だけ再現する", arg: "connection reset by peer", wantText: "connection reset by peer", wantIs: nil},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := cassetteError(test.arg)
+			if test.wantText != got.Error() || (test.wantIs != nil && !errors.Is(got, test.wantIs)) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v\n", t.Name(), test.wantText, test.wantIs, got)
+			}
+		})
+	}
+}
+
+func Test_CassettePlayer_Stream_methodMismatch(t *testing.T) {
+	t.Parallel()
+	player := NewCassettePlayer(&Cassette{Interactions: []*CassetteInteraction{{Method: cassetteMethodGet}}}, CassetteMatchOrder)
+	ch, errCh := player.Stream(context.Background(), "", BusinessDayRequest{})
+	got := <-errCh
+	for range ch {
+	}
+	if !errors.Is(got, CassetteNotFoundErr) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), CassetteNotFoundErr, got)
+	}
+}
+
+func Test_LoadCassette_error(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		arg  string
+		want error
+	}{
+		{name: "ファイルがなければエラー", arg: filepath.Join(dir, "none.json"), want: os.ErrNotExist},
+		{name: "壊れていればUnmarshalFailedErr", arg: broken, want: UnmarshalFailedErr},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, got := LoadCassette(test.arg)
+			if !errors.Is(got, test.want) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
@@ -147,6 +147,12 @@ func (c *client) CorrectOrder(ctx context.Context, session *Session, req Correct
 	if session == nil {
 		return nil, NilArgumentErr
 	}
+	if c.dryRun != nil {
+		return c.dryRunCorrectOrder(ctx, session, req)
+	}
+	if err := c.orderAllowed(); err != nil {
+		return nil, err
+	}
 	session.mtx.Lock()
 	defer session.mtx.Unlock()
 
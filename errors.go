@@ -1,6 +1,9 @@
 package tachibana
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	NilArgumentErr         = errors.New("nil argument")
@@ -9,4 +12,29 @@ var (
 	CanNotCreateSessionErr = errors.New("cannot create session")
 	UnmarshalFailedErr     = errors.New("unmarshal failed")
 	StreamError            = errors.New("stream error")
+	UnreadDocumentErr      = fmt.Errorf("unread document: %w", CanNotCreateSessionErr)
+	LoginLockedErr         = errors.New("login locked")
+	LoginBackoffErr        = errors.New("login backoff")
+	StreamClosedErr        = errors.New("stream closed")
+	StreamRetryExceededErr = errors.New("stream retry exceeded")
+	StreamStalledErr       = errors.New("stream stalled")
+	StreamOverflowErr      = errors.New("stream consumer overflow")
+	StreamBoardFullErr     = errors.New("stream board full")
+	StreamHandlerPanicErr  = errors.New("stream handler panic")
+	StreamRecordErr        = errors.New("stream record error")
+	CassetteNotFoundErr    = errors.New("cassette interaction not found")
+	FaultInjectedErr       = errors.New("fault injected")
+	PaperOrderRejectedErr  = errors.New("paper order rejected")
+	TickGroupNotFoundErr   = errors.New("tick group not found")
+	InvalidPriceErr        = errors.New("invalid price")
+	OrderViolationErr      = errors.New("order violation")
+	OrderBuildErr          = errors.New("order build error")
+	OrderRejectedErr       = errors.New("order rejected")
+	BracketNotFoundErr     = errors.New("bracket not found")
+	TrailingStopErr        = errors.New("trailing stop error")
+	RiskLimitErr           = errors.New("risk limit exceeded")
+	EnvUnspecifiedErr      = errors.New("environment unspecified")
+	ProductionOrderErr     = errors.New("production order not allowed")
+	DryRunInvalidErr       = errors.New("dry run invalid request")
+	ClientUnavailableErr   = errors.New("client unavailable")
 )
@@ -0,0 +1,278 @@
+package tachibana
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// FaultKind - 注入する障害の種類
+type FaultKind string
+
+const (
+	FaultKindLatency   FaultKind = "latency"   // 遅延
+	FaultKindNetwork   FaultKind = "network"   // 通信エラー
+	FaultKindStatus    FaultKind = "status"    // HTTPステータス5xx
+	FaultKindPartial   FaultKind = "partial"   // レスポンスが途中で切れる
+	FaultKindMalformed FaultKind = "malformed" // JSONとして読めないレスポンス
+	FaultKindErrorNo   FaultKind = "error_no"  // エラー番号(p_errno)の書き換え
+	FaultKindDrop      FaultKind = "drop"      // ストリームの切断
+)
+
+// faultStatusCodes - 注入するHTTPステータス
+var faultStatusCodes = []int{500, 502, 503, 504}
+
+// faultMalformedBody - JSONとして読めないレスポンス 途中のプロキシが返すエラーページを想定
+const faultMalformedBody = "<html><body><h1>503 Service Temporarily Unavailable</h1></body></html>"
+
+var (
+	faultJSONErrorNoPattern  = regexp.MustCompile(`"p_errno":"[^"]*"`)
+	faultEventErrorNoPattern = regexp.MustCompile("p_errno\x02[^\x01]*")
+)
+
+// FaultConfig - 障害の注入の設定
+// 各Rateは0~1の確率で、Getでは1回のリクエストごと、Streamでは接続ごとと受信した1行ごとに判定する
+type FaultConfig struct {
+	Seed int64 // 乱数のシード 同じシードで同じ順にリクエストすれば、同じ障害が同じ順に起こる
+
+	LatencyRate float64       // 遅延させる確率
+	MinLatency  time.Duration // 遅延の最小
+	MaxLatency  time.Duration // 遅延の最大
+
+	NetworkErrorRate  float64   // 通信エラーにする確率 ストリームでは接続時
+	StatusErrorRate   float64   // HTTPステータス5xxにする確率 ストリームでは接続時
+	PartialBodyRate   float64   // レスポンスを途中で切る確率 ストリームでは行の途中で切って切断する
+	MalformedJSONRate float64   // JSONとして読めないレスポンスにする確率 イベントストリームには注入しない
+	ErrorNoRate       float64   // エラー番号を書き換える確率
+	ErrorNos          []ErrorNo // 書き換えるエラー番号 空ならErrorSystemOffline
+	DropRate          float64   // 受信した行を流さずにストリームを切断する確率
+}
+
+// NewFaultTransport - transportの通信に障害を注入するTransportを生成する
+func NewFaultTransport(transport Transport, config FaultConfig) *FaultTransport {
+	if len(config.ErrorNos) == 0 {
+		config.ErrorNos = []ErrorNo{ErrorSystemOffline}
+	}
+	if config.MaxLatency < config.MinLatency {
+		config.MaxLatency = config.MinLatency
+	}
+
+	return &FaultTransport{
+		transport: transport,
+		config:    config,
+		rand:      rand.New(rand.NewSource(config.Seed)),
+		counts:    map[FaultKind]int{},
+	}
+}
+
+// FaultTransport - 通信に障害を注入するTransport ボットが障害から復旧できることの確認に使う
+// 注入した通信エラーはFaultInjectedErrを包む HTTPステータスのエラーは実際の通信と同じくStatusNotOkErrを包む
+type FaultTransport struct {
+	transport Transport
+	config    FaultConfig
+	rand      *rand.Rand
+	counts    map[FaultKind]int
+	mtx       sync.Mutex
+}
+
+// roll - rateの確率でtrueを返す rateによらず乱数を1つ使うので、設定を変えても他の判定の順番は変わらない
+func (t *FaultTransport) roll(kind FaultKind, rate float64) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.rand.Float64() >= rate {
+		return false
+	}
+	t.counts[kind]++
+	return true
+}
+
+// intn - 0~n-1の乱数
+func (t *FaultTransport) intn(n int) int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if n <= 0 {
+		return 0
+	}
+	return t.rand.Intn(n)
+}
+
+// delay - LatencyRateの確率で遅延させる
+func (t *FaultTransport) delay(ctx context.Context) error {
+	if !t.roll(FaultKindLatency, t.config.LatencyRate) {
+		return nil
+	}
+
+	d := t.config.MinLatency + time.Duration(t.intn(int(t.config.MaxLatency-t.config.MinLatency)+1))
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// connectErr - 接続時の障害
+func (t *FaultTransport) connectErr() error {
+	if t.roll(FaultKindNetwork, t.config.NetworkErrorRate) {
+		return fmt.Errorf("connection reset by peer: %w", FaultInjectedErr)
+	}
+	if t.roll(FaultKindStatus, t.config.StatusErrorRate) {
+		return fmt.Errorf("status is %d(body: ): %w", faultStatusCodes[t.intn(len(faultStatusCodes))], StatusNotOkErr)
+	}
+	return nil
+}
+
+// errorNo - ErrorNoRateの確率でエラー番号を書き換える
+func (t *FaultTransport) errorNo(b []byte, event bool) []byte {
+	if !t.roll(FaultKindErrorNo, t.config.ErrorNoRate) {
+		return b
+	}
+
+	errorNo := t.config.ErrorNos[t.intn(len(t.config.ErrorNos))]
+	if event {
+		return faultEventErrorNoPattern.ReplaceAll(b, []byte("p_errno\x02"+string(errorNo)))
+	}
+	return faultJSONErrorNoPattern.ReplaceAll(b, []byte(`"p_errno":"`+string(errorNo)+`"`))
+}
+
+// partial - 途中で切ったレスポンス
+func (t *FaultTransport) partial(b []byte) []byte {
+	return append([]byte{}, b[:t.intn(len(b))]...)
+}
+
+func (t *FaultTransport) Get(ctx context.Context, uri string, request interface{}) ([]byte, error) {
+	if err := t.delay(ctx); err != nil {
+		return nil, err
+	}
+	if err := t.connectErr(); err != nil {
+		return nil, err
+	}
+
+	b, err := t.transport.Get(ctx, uri, request)
+	if err != nil {
+		return b, err
+	}
+
+	b = t.errorNo(b, false)
+	if t.roll(FaultKindPartial, t.config.PartialBodyRate) {
+		b = t.partial(b)
+	}
+	if t.roll(FaultKindMalformed, t.config.MalformedJSONRate) {
+		b = []byte(faultMalformedBody)
+	}
+	return b, nil
+}
+
+func (t *FaultTransport) Stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) {
+	_, event := request.(StreamRequest)
+	ch := make(chan []byte)
+	errCh := make(chan error)
+
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+
+		sendErr := func(err error) {
+			select {
+			case <-ctx.Done():
+			case errCh <- err:
+			}
+		}
+		send := func(b []byte) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- b:
+				return true
+			}
+		}
+
+		if err := t.delay(ctx); err != nil {
+			return
+		}
+		if err := t.connectErr(); err != nil {
+			sendErr(err)
+			return
+		}
+
+		// 抜けるときは元のストリームを止め、チャネルが閉じられるまで待つ
+		cCtx, cf := context.WithCancel(ctx)
+		sCh, sErrCh := t.transport.Stream(cCtx, uri, request)
+		defer func() {
+			cf()
+			for sCh != nil || sErrCh != nil {
+				select {
+				case _, ok := <-sCh:
+					if !ok {
+						sCh = nil
+					}
+				case _, ok := <-sErrCh:
+					if !ok {
+						sErrCh = nil
+					}
+				}
+			}
+		}()
+
+		for sCh != nil || sErrCh != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-sErrCh:
+				if !ok {
+					sErrCh = nil
+					continue
+				}
+				sendErr(err)
+				return
+			case b, ok := <-sCh:
+				if !ok {
+					sCh = nil
+					continue
+				}
+
+				if err := t.delay(ctx); err != nil {
+					return
+				}
+				if t.roll(FaultKindDrop, t.config.DropRate) {
+					sendErr(fmt.Errorf("connection dropped: %w", FaultInjectedErr))
+					return
+				}
+				b = t.errorNo(b, event)
+				if t.roll(FaultKindPartial, t.config.PartialBodyRate) {
+					if send(t.partial(b)) {
+						sendErr(fmt.Errorf("unexpected EOF: %w", FaultInjectedErr))
+					}
+					return
+				}
+				if !event && t.roll(FaultKindMalformed, t.config.MalformedJSONRate) {
+					b = []byte(faultMalformedBody)
+				}
+				if !send(b) {
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, errCh
+}
+
+// Counts - 注入した障害の種類ごとの回数
+func (t *FaultTransport) Counts() map[FaultKind]int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	counts := make(map[FaultKind]int, len(t.counts))
+	for k, v := range t.counts {
+		counts[k] = v
+	}
+	return counts
+}
@@ -0,0 +1,257 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFaultStream - ストリームを最後まで読み、受信した行とエラーを返す
+func testFaultStream(ch <-chan []byte, errCh <-chan error) ([]string, error) {
+	var lines []string
+	var err error
+	for ch != nil || errCh != nil {
+		select {
+		case b, ok := <-ch:
+			if !ok {
+				ch = nil
+				continue
+			}
+			lines = append(lines, string(b))
+		case e, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			err = e
+		}
+	}
+	return lines, err
+}
+
+func Test_NewFaultTransport(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  FaultConfig
+		want FaultConfig
+	}{
+		{name: "エラー番号が未指定ならシステム停止中",
+			arg:  FaultConfig{},
+			want: FaultConfig{ErrorNos: []ErrorNo{ErrorSystemOffline}}},
+		{name: "遅延の最大が最小より小さければ最小にそろえる",
+			arg:  FaultConfig{MinLatency: time.Second, MaxLatency: time.Millisecond, ErrorNos: []ErrorNo{ErrorServiceOffline}},
+			want: FaultConfig{MinLatency: time.Second, MaxLatency: time.Second, ErrorNos: []ErrorNo{ErrorServiceOffline}}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := NewFaultTransport(&testTransport{}, test.arg)
+			if !reflect.DeepEqual(test.want, got.config) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got.config)
+			}
+		})
+	}
+}
+
+func Test_FaultTransport_Get(t *testing.T) {
+	t.Parallel()
+	body := `{"p_no":"2","p_errno":"0","p_err":"","sCLMID":"CLMZanKaiKanougaku"}`
+	tests := []struct {
+		name       string
+		config     FaultConfig
+		want       string
+		wantErr    error
+		wantCounts map[FaultKind]int
+	}{
+		{name: "確率が0なら障害を注入しない",
+			config:     FaultConfig{},
+			want:       body,
+			wantCounts: map[FaultKind]int{}},
+		{name: "通信エラー",
+			config:     FaultConfig{NetworkErrorRate: 1},
+			wantErr:    FaultInjectedErr,
+			wantCounts: map[FaultKind]int{FaultKindNetwork: 1}},
+		{name: "HTTPステータスのエラー",
+			config:     FaultConfig{StatusErrorRate: 1},
+			wantErr:    StatusNotOkErr,
+			wantCounts: map[FaultKind]int{FaultKindStatus: 1}},
+		{name: "エラー番号の書き換え",
+			config:     FaultConfig{ErrorNoRate: 1},
+			want:       `{"p_no":"2","p_errno":"-12","p_err":"","sCLMID":"CLMZanKaiKanougaku"}`,
+			wantCounts: map[FaultKind]int{FaultKindErrorNo: 1}},
+		{name: "JSONとして読めないレスポンス",
+			config:     FaultConfig{MalformedJSONRate: 1},
+			want:       faultMalformedBody,
+			wantCounts: map[FaultKind]int{FaultKindMalformed: 1}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			transport := NewFaultTransport(&testTransport{get1: []byte(body)}, test.config)
+			got, err := transport.Get(context.Background(), "", nil)
+			if test.want != string(got) || !errors.Is(err, test.wantErr) || !reflect.DeepEqual(test.wantCounts, transport.Counts()) {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.want, test.wantErr, test.wantCounts, string(got), err, transport.Counts())
+			}
+		})
+	}
+}
+
+func Test_FaultTransport_Get_partial(t *testing.T) {
+	t.Parallel()
+	body := `{"p_no":"2","p_errno":"0","p_err":"","sCLMID":"CLMZanKaiKanougaku"}`
+	transport := NewFaultTransport(&testTransport{get1: []byte(body)}, FaultConfig{PartialBodyRate: 1})
+	got, err := transport.Get(context.Background(), "", nil)
+	if len(got) >= len(body) || !strings.HasPrefix(body, string(got)) || err != nil {
+		t.Errorf("%s error\nwant: prefix of %s\ngot: %s, %+v\n", t.Name(), body, got, err)
+	}
+}
+
+func Test_FaultTransport_Get_latency(t *testing.T) {
+	t.Parallel()
+	config := FaultConfig{LatencyRate: 1, MinLatency: 30 * time.Millisecond, MaxLatency: 30 * time.Millisecond}
+
+	begin := time.Now()
+	_, err := NewFaultTransport(&testTransport{}, config).Get(context.Background(), "", nil)
+	if got := time.Since(begin); got < 30*time.Millisecond || err != nil {
+		t.Errorf("%s error\nwant: >= %+v, %+v\ngot: %+v, %+v\n", t.Name(), 30*time.Millisecond, nil, got, err)
+	}
+
+	// 遅延中にctxが終了したら抜ける
+	ctx, cf := context.WithCancel(context.Background())
+	cf()
+	config.MinLatency, config.MaxLatency = time.Hour, time.Hour
+	_, err = NewFaultTransport(&testTransport{}, config).Get(ctx, "", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), context.Canceled, err)
+	}
+}
+
+// Test_FaultTransport_Get_seed - 同じシードなら同じ順に障害が起こる
+func Test_FaultTransport_Get_seed(t *testing.T) {
+	t.Parallel()
+	config := FaultConfig{NetworkErrorRate: 0.2, StatusErrorRate: 0.2, PartialBodyRate: 0.2, MalformedJSONRate: 0.2, ErrorNoRate: 0.2,
+		ErrorNos: []ErrorNo{ErrorSystemOffline, ErrorServiceOffline, ErrorSessionInactive}}
+	run := func(seed int64) []string {
+		config := config
+		config.Seed = seed
+		transport := NewFaultTransport(&testTransport{get1: []byte(`{"p_no":"2","p_errno":"0","sCLMID":"CLMZanKaiKanougaku"}`)}, config)
+		var results []string
+		for i := 0; i < 50; i++ {
+			b, err := transport.Get(context.Background(), "", nil)
+			if err != nil {
+				results = append(results, err.Error())
+			} else {
+				results = append(results, string(b))
+			}
+		}
+		return results
+	}
+
+	got1, got2, got3 := run(1), run(1), run(2)
+	if !reflect.DeepEqual(got1, got2) || reflect.DeepEqual(got1, got3) {
+		t.Errorf("%s error\ngot: %+v\n%+v\n%+v\n", t.Name(), got1, got2, got3)
+	}
+}
+
+func Test_FaultTransport_Stream(t *testing.T) {
+	t.Parallel()
+	lines := [][]byte{[]byte(`{"sCLMID":"CLMDateZyouhou","sDayKey":"001"}`), []byte(`{"p_errno":"0","sCLMID":"CLMEventDownloadComplete"}`)}
+	tests := []struct {
+		name    string
+		config  FaultConfig
+		want    []string
+		wantErr error
+	}{
+		{name: "確率が0なら障害を注入しない",
+			config: FaultConfig{},
+			want:   []string{string(lines[0]), string(lines[1])}},
+		{name: "接続時の通信エラー",
+			config:  FaultConfig{NetworkErrorRate: 1},
+			wantErr: FaultInjectedErr},
+		{name: "接続時のHTTPステータスのエラー",
+			config:  FaultConfig{StatusErrorRate: 1},
+			wantErr: StatusNotOkErr},
+		{name: "切断",
+			config:  FaultConfig{DropRate: 1},
+			wantErr: FaultInjectedErr},
+		{name: "JSONとして読めない行",
+			config: FaultConfig{MalformedJSONRate: 1},
+			want:   []string{faultMalformedBody, faultMalformedBody}},
+		{name: "エラー番号の書き換え",
+			config: FaultConfig{ErrorNoRate: 1, ErrorNos: []ErrorNo{ErrorServiceOffline}},
+			want:   []string{string(lines[0]), `{"p_errno":"9","sCLMID":"CLMEventDownloadComplete"}`}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			transport := NewFaultTransport(&testTransport{stream1: lines}, test.config)
+			got, err := testFaultStream(transport.Stream(context.Background(), "", BusinessDayRequest{}))
+			if !reflect.DeepEqual(test.want, got) || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErr, got, err)
+			}
+		})
+	}
+}
+
+func Test_FaultTransport_Stream_partial(t *testing.T) {
+	t.Parallel()
+	line := `{"sCLMID":"CLMDateZyouhou","sDayKey":"001"}`
+	transport := NewFaultTransport(&testTransport{stream1: [][]byte{[]byte(line), []byte(line)}}, FaultConfig{PartialBodyRate: 1})
+	got, err := testFaultStream(transport.Stream(context.Background(), "", BusinessDayRequest{}))
+	if len(got) != 1 || len(got[0]) >= len(line) || !strings.HasPrefix(line, got[0]) || !errors.Is(err, FaultInjectedErr) {
+		t.Errorf("%s error\nwant: prefix of %s, %+v\ngot: %+v, %+v\n", t.Name(), line, FaultInjectedErr, got, err)
+	}
+}
+
+// Test_FaultTransport_client - 注入した障害がクライアントのエラーとして返される
+func Test_FaultTransport_client(t *testing.T) {
+	t.Parallel()
+	frames := [][]byte{
+		testStreamFrame("p_no", "1", "p_date", "2022.07.26-09:00:00.000", "p_errno", "0", "p_err", "", "p_cmd", "KP"),
+		testContractFrame,
+	}
+	transport := &testTransport{get1: []byte(`{"p_no":"2","p_errno":"0","sCLMID":"CLMZanKaiKanougaku"}`), stream1: frames}
+
+	c1 := NewClient(EnvironmentDemo, ApiVersionLatest, WithTransport(NewFaultTransport(transport, FaultConfig{MalformedJSONRate: 1})))
+	_, err1 := c1.StockWallet(context.Background(), &Session{}, StockWalletRequest{})
+
+	c2 := NewClient(EnvironmentDemo, ApiVersionLatest, WithTransport(NewFaultTransport(transport, FaultConfig{ErrorNoRate: 1})))
+	_, err2 := testFaultStreamEvents(c2.Stream(context.Background(), &Session{}, StreamRequest{}))
+
+	if !errors.Is(err1, UnmarshalFailedErr) || !errors.Is(err2, StreamError) || !strings.Contains(err2.Error(), string(ErrorSystemOffline)) {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), UnmarshalFailedErr, StreamError, err1, err2)
+	}
+}
+
+// testFaultStreamEvents - イベントストリームを最後まで読み、受信したイベントとエラーを返す
+func testFaultStreamEvents(ch <-chan StreamResponse, errCh <-chan error) ([]StreamResponse, error) {
+	var events []StreamResponse
+	var err error
+	for ch != nil || errCh != nil {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				ch = nil
+				continue
+			}
+			events = append(events, res)
+		case e, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			err = e
+		}
+	}
+	return events, err
+}
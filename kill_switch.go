@@ -0,0 +1,237 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKillSwitchConcurrency    = 4                // 同時に取消を待つ注文数
+	defaultKillSwitchConfirmTimeout = 30 * time.Second // 取消の確認を待つ時間
+)
+
+// KillSwitchConfig - キルスイッチの設定
+type KillSwitchConfig struct {
+	Flatten        bool          // 取消のあと、現物と信用建玉をすべて成行で返済するか
+	Concurrency    int           // 同時に取消を待つ注文数 0なら4
+	ConfirmTimeout time.Duration // 1つの注文の取消の確認を待つ時間 0なら30秒
+	SecondPassword string        // 取消注文と返済注文に使う第二パスワード
+}
+
+// KillSwitchOutcome - キルスイッチの注文、建玉ごとの結果
+type KillSwitchOutcome string
+
+const (
+	KillSwitchOutcomeUnspecified    KillSwitchOutcome = ""                // 未指定
+	KillSwitchOutcomeCanceled       KillSwitchOutcome = "canceled"        // 取消された
+	KillSwitchOutcomeAlreadyDone    KillSwitchOutcome = "already_done"    // 取消より先に約定、失効などで終わっていた
+	KillSwitchOutcomeRejected       KillSwitchOutcome = "rejected"        // 受け付けられなかった
+	KillSwitchOutcomeUnconfirmed    KillSwitchOutcome = "unconfirmed"     // 取消を送ったが、待つ時間内に終わったことを確認できなかった
+	KillSwitchOutcomeFailed         KillSwitchOutcome = "failed"          // 送れなかった
+	KillSwitchOutcomeFlattenOrdered KillSwitchOutcome = "flatten_ordered" // 返済の成行注文が受け付けられた
+	KillSwitchOutcomeSkipped        KillSwitchOutcome = "skipped"         // 返済できる数量がなかった
+)
+
+// KillSwitchOrderResult - 取消した注文の結果
+type KillSwitchOrderResult struct {
+	OrderNumber   string            // 注文番号
+	ExecutionDate time.Time         // 営業日
+	IssueCode     string            // 銘柄コード
+	Outcome       KillSwitchOutcome // 結果
+	State         OrderState        // 確認できた注文の状態
+	Err           error             // 取消できなかった理由
+}
+
+// KillSwitchPositionResult - 返済した現物、信用建玉の結果
+type KillSwitchPositionResult struct {
+	IssueCode      string            // 銘柄コード
+	PositionNumber string            // 建玉番号 現物なら空
+	AccountType    AccountType       // 口座
+	Side           Side              // 返済注文の売買区分
+	Quantity       float64           // 返済注文の数量
+	OrderNumber    string            // 返済注文の注文番号
+	Outcome        KillSwitchOutcome // 結果
+	Err            error             // 返済できなかった理由
+}
+
+// KillSwitchReport - キルスイッチの結果
+type KillSwitchReport struct {
+	Orders        []KillSwitchOrderResult    // 取消した注文の結果 注文一覧の順
+	Positions     []KillSwitchPositionResult // 返済した現物、信用建玉の結果 現物、信用建玉の順
+	StartDateTime time.Time                  // 開始日時
+	EndDateTime   time.Time                  // 終了日時
+}
+
+// NewKillSwitch - キルスイッチを生成する 取消の確認にtrackerを使うので、約定通知をtrackerに渡しておけば確認が早くなる
+func NewKillSwitch(client Client, session *Session, tracker *OrderTracker, config KillSwitchConfig) *KillSwitch {
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultKillSwitchConcurrency
+	}
+	if config.ConfirmTimeout <= 0 {
+		config.ConfirmTimeout = defaultKillSwitchConfirmTimeout
+	}
+	return &KillSwitch{
+		clock:   newClock(),
+		client:  client,
+		session: session,
+		tracker: tracker,
+		config:  config,
+	}
+}
+
+// KillSwitch - 訂正取消可能な注文をすべて取消し、必要なら現物と信用建玉をすべて成行で返済する
+// 何度実行しても、そのときに残っている注文と返済できる数量だけを対象にする 同時に実行したら順番に実行する
+type KillSwitch struct {
+	clock   iClock
+	client  Client
+	session *Session
+	tracker *OrderTracker
+	config  KillSwitchConfig
+	mtx     sync.Mutex
+}
+
+// Trigger - キルスイッチを実行する 注文一覧、建玉一覧が取れなければエラーを返し、注文、建玉ごとの失敗は結果に入れる
+func (k *KillSwitch) Trigger(ctx context.Context) (*KillSwitchReport, error) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	report := &KillSwitchReport{StartDateTime: k.clock.Now()}
+	orders, err := k.cancelAll(ctx)
+	report.Orders = orders
+	if err != nil {
+		return report, err
+	}
+
+	if k.config.Flatten {
+		positions, err := k.flattenAll(ctx)
+		report.Positions = positions
+		if err != nil {
+			return report, err
+		}
+	}
+	report.EndDateTime = k.clock.Now()
+	return report, nil
+}
+
+// cancelAll - 訂正取消可能な注文をすべて取消して、終わるまで待つ
+func (k *KillSwitch) cancelAll(ctx context.Context) ([]KillSwitchOrderResult, error) {
+	list, err := k.client.OrderList(ctx, k.session, OrderListRequest{OrderInquiryStatus: OrderInquiryStatusEditable})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]KillSwitchOrderResult, len(list.Orders))
+	sem := make(chan struct{}, k.config.Concurrency)
+	var wg sync.WaitGroup
+	for i, o := range list.Orders {
+		results[i] = KillSwitchOrderResult{OrderNumber: o.OrderNumber, ExecutionDate: o.ExecutionDate, IssueCode: o.IssueCode}
+		wg.Add(1)
+		go func(r *KillSwitchOrderResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			k.cancel(ctx, r)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// cancel - 1つの注文を取消して、ConfirmTimeoutまで終わるのを待つ
+func (k *KillSwitch) cancel(ctx context.Context, r *KillSwitchOrderResult) {
+	confirmCtx, cancel := context.WithTimeout(ctx, k.config.ConfirmTimeout)
+	defer cancel()
+
+	fill, err := k.tracker.WaitForCancel(confirmCtx, CancelOrderRequest{OrderNumber: r.OrderNumber, ExecutionDate: r.ExecutionDate, SecondPassword: k.config.SecondPassword})
+	switch {
+	case err == nil && fill.State == OrderStateCanceled:
+		r.Outcome, r.State = KillSwitchOutcomeCanceled, fill.State
+	case err == nil:
+		r.Outcome, r.State = KillSwitchOutcomeAlreadyDone, fill.State
+	case errors.Is(err, OrderRejectedErr):
+		r.Outcome, r.Err = KillSwitchOutcomeRejected, err
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		r.Outcome, r.Err = KillSwitchOutcomeUnconfirmed, err
+	default:
+		r.Outcome, r.Err = KillSwitchOutcomeFailed, err
+	}
+	if o, ok := k.tracker.Order(r.OrderNumber); ok && r.State == OrderStateUnspecified {
+		r.State = o.State
+	}
+}
+
+// flattenAll - 現物の売付可能株数と信用建玉の返済可能数量を成行で返済する
+func (k *KillSwitch) flattenAll(ctx context.Context) ([]KillSwitchPositionResult, error) {
+	stocks, err := k.client.StockPositionList(ctx, k.session, StockPositionListRequest{})
+	if err != nil {
+		return nil, err
+	}
+	margins, err := k.client.MarginPositionList(ctx, k.session, MarginPositionListRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]KillSwitchPositionResult, 0, len(stocks.Positions)+len(margins.Positions))
+	for _, p := range stocks.Positions {
+		r := KillSwitchPositionResult{IssueCode: p.IssueCode, AccountType: p.AccountType, Side: SideSell, Quantity: p.UnHoldQuantity}
+		k.flatten(ctx, &r, CashSell(p.IssueCode, p.UnHoldQuantity).AccountType(p.AccountType))
+		results = append(results, r)
+	}
+	for _, p := range margins.Positions {
+		side := SideSell
+		if p.Side == SideSell {
+			side = SideBuy
+		}
+		r := KillSwitchPositionResult{IssueCode: p.IssueCode, PositionNumber: p.PositionNumber, AccountType: p.AccountType, Side: side, Quantity: p.ReturnableQuantity}
+		marginTradeType, err := exitTermMarginTradeType(p.ExitTermType)
+		if err != nil {
+			r.Outcome, r.Err = KillSwitchOutcomeFailed, err
+			results = append(results, r)
+			continue
+		}
+		k.flatten(ctx, &r, MarginExit(p.IssueCode, side, marginTradeType, p.ReturnableQuantity).
+			AccountType(p.AccountType).
+			Exchange(p.Exchange).
+			ExitPositions(ExitPosition{PositionNumber: p.PositionNumber, OrderQuantity: p.ReturnableQuantity}))
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// flatten - 1つの現物、信用建玉を成行で返済する
+func (k *KillSwitch) flatten(ctx context.Context, r *KillSwitchPositionResult, b *OrderBuilder) {
+	if r.Quantity <= 0 {
+		r.Outcome = KillSwitchOutcomeSkipped
+		return
+	}
+	req, err := b.SecondPassword(k.config.SecondPassword).Build()
+	if err != nil {
+		r.Outcome, r.Err = KillSwitchOutcomeFailed, err
+		return
+	}
+
+	res, err := k.client.NewOrder(ctx, k.session, req)
+	if err != nil {
+		r.Outcome, r.Err = KillSwitchOutcomeFailed, err
+		return
+	}
+	if res.ResultCode != "0" {
+		r.Outcome, r.Err = KillSwitchOutcomeRejected, fmt.Errorf("%s(%s): %w", res.ResultText, res.ResultCode, OrderRejectedErr)
+		return
+	}
+	r.Outcome, r.OrderNumber = KillSwitchOutcomeFlattenOrdered, res.OrderNumber
+}
+
+// exitTermMarginTradeType - 弁済区分の信用区分
+func exitTermMarginTradeType(exitTermType ExitTermType) (MarginTradeType, error) {
+	switch exitTermType {
+	case ExitTermTypeStandardMargin6m, ExitTermTypeStandardMarginNoLimit:
+		return MarginTradeTypeStandard, nil
+	case ExitTermTypeNegotiateMargin6m, ExitTermTypeNegotiateMarginNoLimit:
+		return MarginTradeTypeNegotiate, nil
+	}
+	return MarginTradeTypeUnspecified, fmt.Errorf("unknown exit term type %q: %w", exitTermType, OrderBuildErr)
+}
@@ -0,0 +1,139 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestKillSwitch - テスト用のキルスイッチ 取消の確認は10msごとに注文一覧で行う
+func newTestKillSwitch(client *testClient, config KillSwitchConfig) *KillSwitch {
+	tracker := newTestOrderTracker(client)
+	tracker.pollInterval = 10 * time.Millisecond
+	k := NewKillSwitch(client, &Session{}, tracker, config)
+	k.clock = &testClock{Now1: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}
+	return k
+}
+
+func Test_KillSwitch_Trigger_cancel(t *testing.T) {
+	t.Parallel()
+	listErr := errors.New("list error")
+	tests := []struct {
+		name         string
+		client       *testClient
+		config       KillSwitchConfig
+		wantOutcomes []KillSwitchOutcome
+		wantStates   []OrderState
+		wantCancels  int
+		wantErr      error
+	}{
+		{name: "取消された注文と、先に終わっていた注文を分けて返す",
+			client: &testClient{
+				cancelOrder1: &CancelOrderResponse{ResultCode: "0"},
+				orderList1: &OrderListResponse{Orders: []Order{
+					{OrderNumber: "1", IssueCode: "1475", OrderQuantity: 100, OrderStatus: OrderStatusCanceled},
+					{OrderNumber: "2", IssueCode: "1476", OrderQuantity: 100, ContractQuantity: 100, OrderStatus: OrderStatusDone}}},
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 100}},
+			wantOutcomes: []KillSwitchOutcome{KillSwitchOutcomeCanceled, KillSwitchOutcomeAlreadyDone},
+			wantStates:   []OrderState{OrderStateCanceled, OrderStateFilled},
+			wantCancels:  2},
+		{name: "取消が受け付けられず、終わってもいなければ受付エラー",
+			client: &testClient{
+				cancelOrder1: &CancelOrderResponse{ResultCode: "11109"},
+				orderList1:   &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 100, OrderStatus: OrderStatusInOrder}}}},
+			wantOutcomes: []KillSwitchOutcome{KillSwitchOutcomeRejected},
+			wantStates:   []OrderState{OrderStateOpen},
+			wantCancels:  1},
+		{name: "待つ時間内に終わらなければ未確認",
+			client: &testClient{
+				cancelOrder1: &CancelOrderResponse{ResultCode: "0"},
+				orderList1:   &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 100, OrderStatus: OrderStatusInOrder}}},
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 100, OrderStatus: OrderStatusInOrder}},
+			config:       KillSwitchConfig{ConfirmTimeout: 50 * time.Millisecond},
+			wantOutcomes: []KillSwitchOutcome{KillSwitchOutcomeUnconfirmed},
+			wantStates:   []OrderState{OrderStateOpen},
+			wantCancels:  1},
+		{name: "注文一覧のエラーはそのまま返す",
+			client:       &testClient{orderList2: listErr},
+			wantOutcomes: []KillSwitchOutcome{},
+			wantStates:   []OrderState{},
+			wantErr:      listErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newTestKillSwitch(test.client, test.config).Trigger(context.Background())
+			gotOutcomes, gotStates := []KillSwitchOutcome{}, []OrderState{}
+			for _, o := range got.Orders {
+				gotOutcomes = append(gotOutcomes, o.Outcome)
+				gotStates = append(gotStates, o.State)
+			}
+			if !reflect.DeepEqual(test.wantOutcomes, gotOutcomes) || !reflect.DeepEqual(test.wantStates, gotStates) || test.wantCancels != test.client.cancelCount || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(),
+					test.wantOutcomes, test.wantStates, test.wantCancels, test.wantErr, gotOutcomes, gotStates, test.client.cancelCount, err)
+			}
+		})
+	}
+}
+
+func Test_KillSwitch_Trigger_flatten(t *testing.T) {
+	t.Parallel()
+	client := &testClient{
+		orderList1: &OrderListResponse{},
+		stockPositionList1: &StockPositionListResponse{Positions: []StockPosition{
+			{IssueCode: "1475", AccountType: AccountTypeSpecific, UnHoldQuantity: 100},
+			{IssueCode: "1476", AccountType: AccountTypeSpecific, UnHoldQuantity: 0}}},
+		marginPositionList1: &MarginPositionListResponse{Positions: []MarginPosition{
+			{PositionNumber: "P1", IssueCode: "1477", Exchange: ExchangeToushou, Side: SideBuy, ExitTermType: ExitTermTypeStandardMargin6m, AccountType: AccountTypeSpecific, ReturnableQuantity: 200},
+			{PositionNumber: "P2", IssueCode: "1478", Exchange: ExchangeToushou, Side: SideSell, ExitTermType: ExitTermTypeUnspecified, AccountType: AccountTypeSpecific, ReturnableQuantity: 300}}},
+		newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "10"},
+	}
+
+	got, err := newTestKillSwitch(client, KillSwitchConfig{Flatten: true}).Trigger(context.Background())
+	if err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+	for i := range got.Positions {
+		got.Positions[i].Err = nil
+	}
+	want := []KillSwitchPositionResult{
+		{IssueCode: "1475", AccountType: AccountTypeSpecific, Side: SideSell, Quantity: 100, OrderNumber: "10", Outcome: KillSwitchOutcomeFlattenOrdered},
+		{IssueCode: "1476", AccountType: AccountTypeSpecific, Side: SideSell, Quantity: 0, Outcome: KillSwitchOutcomeSkipped},
+		{IssueCode: "1477", PositionNumber: "P1", AccountType: AccountTypeSpecific, Side: SideSell, Quantity: 200, OrderNumber: "10", Outcome: KillSwitchOutcomeFlattenOrdered},
+		{IssueCode: "1478", PositionNumber: "P2", AccountType: AccountTypeSpecific, Side: SideBuy, Quantity: 300, Outcome: KillSwitchOutcomeFailed},
+	}
+	if !reflect.DeepEqual(want, got.Positions) || client.newOrderCount != 2 {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, 2, got.Positions, client.newOrderCount)
+	}
+}
+
+func Test_exitTermMarginTradeType(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		arg     ExitTermType
+		want    MarginTradeType
+		wantErr error
+	}{
+		{name: "制度信用6ヶ月は制度信用", arg: ExitTermTypeStandardMargin6m, want: MarginTradeTypeStandard},
+		{name: "制度信用無期限は制度信用", arg: ExitTermTypeStandardMarginNoLimit, want: MarginTradeTypeStandard},
+		{name: "一般信用6ヶ月は一般信用", arg: ExitTermTypeNegotiateMargin6m, want: MarginTradeTypeNegotiate},
+		{name: "一般信用無期限は一般信用", arg: ExitTermTypeNegotiateMarginNoLimit, want: MarginTradeTypeNegotiate},
+		{name: "期限なしはわからないのでエラー", arg: ExitTermTypeNoLimit, want: MarginTradeTypeUnspecified, wantErr: OrderBuildErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := exitTermMarginTradeType(test.arg)
+			if test.want != got || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErr, got, err)
+			}
+		})
+	}
+}
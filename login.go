@@ -131,10 +131,15 @@ type LoginResponse struct {
 
 // Session - ログインレスポンスからセッションを取り出す
 func (r *LoginResponse) Session() (*Session, error) {
-	if r.ErrorNo != ErrorNoProblem || r.MessageType != MessageTypeLoginResponse || r.ResultCode != "0" || r.UnreadDocument {
+	if r.ErrorNo != ErrorNoProblem || r.MessageType != MessageTypeLoginResponse || r.ResultCode != "0" {
 		return nil, CanNotCreateSessionErr
 	}
 
+	// 未読書面があるとリクエスト用のURLが発行されないため、区別できるエラーを返す
+	if r.UnreadDocument {
+		return nil, UnreadDocumentErr
+	}
+
 	return &Session{
 		lastRequestNo: r.No,
 		RequestURL:    r.RequestURL,
@@ -0,0 +1,141 @@
+package tachibana
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLoginGuardMaxFailures  = 3                // ロックするまでの失敗回数
+	defaultLoginGuardBaseInterval = 1 * time.Second  // 失敗後の待機時間の初期値
+	defaultLoginGuardMaxInterval  = 10 * time.Minute // 失敗後の待機時間の上限
+)
+
+// LoginGuardConfig - ログイン試行制限の設定
+type LoginGuardConfig struct {
+	MaxFailures  int           // ロックするまでの連続失敗回数 0なら3回
+	BaseInterval time.Duration // 1回失敗したあとの待機時間 失敗するごとに倍になる 0なら1秒
+	MaxInterval  time.Duration // 待機時間の上限 0なら10分
+}
+
+// NewLoginGuard - ログイン試行を制限するクライアントを生成する
+// Login以外の機能はそのまま渡されたクライアントに委譲する
+func NewLoginGuard(client Client, config LoginGuardConfig) *LoginGuard {
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = defaultLoginGuardMaxFailures
+	}
+	if config.BaseInterval <= 0 {
+		config.BaseInterval = defaultLoginGuardBaseInterval
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = defaultLoginGuardMaxInterval
+	}
+
+	return &LoginGuard{
+		Client: client,
+		clock:  newClock(),
+		config: config,
+	}
+}
+
+// LoginGuard - ログイン試行の制限
+// ログイン失敗(ResultCodeが0以外)を数え、失敗するごとに次の試行まで指数的に待たせる
+// 連続失敗回数が上限に達したらロックし、Resetされるまでログインリクエストを送らない
+type LoginGuard struct {
+	Client
+	clock       iClock
+	config      LoginGuardConfig
+	failures    int
+	lastAttempt time.Time
+	locked      bool
+	mtx         sync.Mutex
+}
+
+// Login - ログイン
+// ロック中はLoginLockedErr、待機時間中はLoginBackoffErrを返し、サーバにはリクエストを送らない
+// ログインに成功しても未読書面がある場合は、レスポンスとUnreadDocumentErrを返す
+func (g *LoginGuard) Login(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
+	// 同時に複数のログインを送らないよう、レスポンスが返るまでロックしておく
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if g.locked {
+		return nil, LoginLockedErr
+	}
+
+	now := g.clock.Now()
+	if g.failures > 0 {
+		if next := g.lastAttempt.Add(g.interval(g.failures)); now.Before(next) {
+			return nil, fmt.Errorf("retry after %s: %w", next.Sub(now), LoginBackoffErr)
+		}
+	}
+	g.lastAttempt = now
+
+	res, err := g.Client.Login(ctx, req)
+	if err != nil {
+		// 通信エラー等は認証の失敗ではないので数えない
+		return nil, err
+	}
+
+	// 引数エラー等も認証の失敗ではないので数えない
+	if res.ErrorNo != ErrorNoProblem {
+		return res, nil
+	}
+
+	if res.ResultCode != "0" {
+		g.failures++
+		if g.failures >= g.config.MaxFailures {
+			g.locked = true
+		}
+		return res, nil
+	}
+
+	g.failures = 0
+	if res.UnreadDocument {
+		return res, UnreadDocumentErr
+	}
+	return res, nil
+}
+
+// interval - 失敗回数に応じた待機時間
+func (g *LoginGuard) interval(failures int) time.Duration {
+	d := g.config.BaseInterval
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if d >= g.config.MaxInterval {
+			return g.config.MaxInterval
+		}
+	}
+	if d > g.config.MaxInterval {
+		return g.config.MaxInterval
+	}
+	return d
+}
+
+// Reset - 失敗回数とロックを解除する
+func (g *LoginGuard) Reset() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	g.failures = 0
+	g.locked = false
+	g.lastAttempt = time.Time{}
+}
+
+// Failures - 連続失敗回数
+func (g *LoginGuard) Failures() int {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	return g.failures
+}
+
+// Locked - ロックされているか
+func (g *LoginGuard) Locked() bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	return g.locked
+}
@@ -0,0 +1,170 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_NewLoginGuard(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		arg1  Client
+		arg2  LoginGuardConfig
+		want1 LoginGuardConfig
+	}{
+		{name: "設定がゼロ値ならデフォルト値で埋める",
+			arg1:  &testClient{},
+			arg2:  LoginGuardConfig{},
+			want1: LoginGuardConfig{MaxFailures: 3, BaseInterval: 1 * time.Second, MaxInterval: 10 * time.Minute}},
+		{name: "設定があればそのまま使う",
+			arg1:  &testClient{},
+			arg2:  LoginGuardConfig{MaxFailures: 5, BaseInterval: 2 * time.Second, MaxInterval: 1 * time.Minute},
+			want1: LoginGuardConfig{MaxFailures: 5, BaseInterval: 2 * time.Second, MaxInterval: 1 * time.Minute}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := NewLoginGuard(test.arg1, test.arg2)
+			if !reflect.DeepEqual(test.want1, got.config) || got.Client != test.arg1 {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want1, got.config)
+			}
+		})
+	}
+}
+
+func Test_LoginGuard_interval(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		arg1  int
+		want1 time.Duration
+	}{
+		{name: "1回目の失敗なら初期値", arg1: 1, want1: 1 * time.Second},
+		{name: "2回目の失敗なら倍", arg1: 2, want1: 2 * time.Second},
+		{name: "3回目の失敗なら4倍", arg1: 3, want1: 4 * time.Second},
+		{name: "上限を超えたら上限", arg1: 10, want1: 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			guard := &LoginGuard{config: LoginGuardConfig{MaxFailures: 3, BaseInterval: 1 * time.Second, MaxInterval: 10 * time.Second}}
+			got1 := guard.interval(test.arg1)
+			if !reflect.DeepEqual(test.want1, got1) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want1, got1)
+			}
+		})
+	}
+}
+
+func Test_LoginGuard_Login(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 3, 1, 9, 0, 0, 0, time.Local)
+	success := &LoginResponse{CommonResponse: CommonResponse{ErrorNo: ErrorNoProblem, MessageType: MessageTypeLoginResponse}, ResultCode: "0"}
+	failure := &LoginResponse{CommonResponse: CommonResponse{ErrorNo: ErrorNoProblem, MessageType: MessageTypeLoginResponse}, ResultCode: "10031"}
+	unread := &LoginResponse{CommonResponse: CommonResponse{ErrorNo: ErrorNoProblem, MessageType: MessageTypeLoginResponse}, ResultCode: "0", UnreadDocument: true}
+	badRequest := &LoginResponse{CommonResponse: CommonResponse{ErrorNo: ErrorBadRequest}}
+
+	tests := []struct {
+		name          string
+		client        *testClient
+		failures      int
+		lastAttempt   time.Time
+		locked        bool
+		want1         *LoginResponse
+		want2         error
+		wantFailures  int
+		wantLocked    bool
+		wantLoginCall int
+	}{
+		{name: "ロック中ならリクエストせずにエラー",
+			client:        &testClient{login1: success},
+			failures:      3,
+			locked:        true,
+			want2:         LoginLockedErr,
+			wantFailures:  3,
+			wantLocked:    true,
+			wantLoginCall: 0},
+		{name: "待機時間中ならリクエストせずにエラー",
+			client:        &testClient{login1: success},
+			failures:      2,
+			lastAttempt:   now.Add(-1 * time.Second),
+			want2:         LoginBackoffErr,
+			wantFailures:  2,
+			wantLoginCall: 0},
+		{name: "待機時間を過ぎていればリクエストする",
+			client:        &testClient{login1: success},
+			failures:      2,
+			lastAttempt:   now.Add(-2 * time.Second),
+			want1:         success,
+			wantFailures:  0,
+			wantLoginCall: 1},
+		{name: "通信エラーは失敗として数えない",
+			client:        &testClient{login2: StatusNotOkErr},
+			want2:         StatusNotOkErr,
+			wantFailures:  0,
+			wantLoginCall: 1},
+		{name: "引数エラーは失敗として数えない",
+			client:        &testClient{login1: badRequest},
+			want1:         badRequest,
+			wantFailures:  0,
+			wantLoginCall: 1},
+		{name: "ResultCodeが0以外なら失敗として数える",
+			client:        &testClient{login1: failure},
+			want1:         failure,
+			wantFailures:  1,
+			wantLoginCall: 1},
+		{name: "失敗回数が上限に達したらロックする",
+			client:        &testClient{login1: failure},
+			failures:      2,
+			lastAttempt:   now.Add(-1 * time.Hour),
+			want1:         failure,
+			wantFailures:  3,
+			wantLocked:    true,
+			wantLoginCall: 1},
+		{name: "未読書面があればUnreadDocumentErrを返す",
+			client:        &testClient{login1: unread},
+			want1:         unread,
+			want2:         UnreadDocumentErr,
+			wantFailures:  0,
+			wantLoginCall: 1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			guard := &LoginGuard{
+				Client:      test.client,
+				clock:       &testClock{Now1: now},
+				config:      LoginGuardConfig{MaxFailures: 3, BaseInterval: 1 * time.Second, MaxInterval: 10 * time.Second},
+				failures:    test.failures,
+				lastAttempt: test.lastAttempt,
+				locked:      test.locked,
+			}
+			got1, got2 := guard.Login(context.Background(), LoginRequest{})
+			if !reflect.DeepEqual(test.want1, got1) || !errors.Is(got2, test.want2) ||
+				test.wantFailures != guard.Failures() || test.wantLocked != guard.Locked() || test.wantLoginCall != test.client.loginCount {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v, %+v\n", t.Name(),
+					test.want1, test.want2, test.wantFailures, test.wantLocked, test.wantLoginCall,
+					got1, got2, guard.Failures(), guard.Locked(), test.client.loginCount)
+			}
+		})
+	}
+}
+
+func Test_LoginGuard_Reset(t *testing.T) {
+	t.Parallel()
+	guard := &LoginGuard{failures: 3, locked: true, lastAttempt: time.Date(2022, 3, 1, 9, 0, 0, 0, time.Local)}
+	guard.Reset()
+	if guard.Failures() != 0 || guard.Locked() || !guard.lastAttempt.IsZero() {
+		t.Errorf("%s error\ngot: %+v, %+v, %+v\n", t.Name(), guard.Failures(), guard.Locked(), guard.lastAttempt)
+	}
+}
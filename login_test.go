@@ -135,6 +135,18 @@ func Test_LoginResponse_Session(t *testing.T) {
 			},
 			want1: nil,
 			want2: CanNotCreateSessionErr},
+		{name: "未読書面があればUnreadDocumentErrを返す",
+			response: LoginResponse{
+				CommonResponse: CommonResponse{
+					No:          1,
+					ErrorNo:     ErrorNoProblem,
+					MessageType: MessageTypeLoginResponse,
+				},
+				ResultCode:     "0",
+				UnreadDocument: true,
+			},
+			want1: nil,
+			want2: UnreadDocumentErr},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,133 @@
+package tachibana
+
+import (
+	"sync"
+)
+
+const streamBoardMaxColumns = 120 // 株価ボードに登録できる行数
+
+// StreamBoardItem - 株価ボードに登録された銘柄
+type StreamBoardItem struct {
+	ColumnNumber int      // 行番号
+	IssueCode    string   // 銘柄コード
+	Exchange     Exchange // 市場コード
+}
+
+// NewManagedStream - 購読する銘柄を接続中に変更できるストリームを生成する
+// reqのColumnNumber, IssueCodes, MarketCodesは使わず、Subscribeで登録された銘柄から組み立てる
+func NewManagedStream(client Client, session *Session, req StreamRequest, config ResilientStreamConfig) *ManagedStream {
+	req.ColumnNumber = nil
+	req.IssueCodes = nil
+	req.MarketCodes = nil
+
+	return &ManagedStream{
+		ResilientStream: NewResilientStream(client, session, req, config),
+		board:           make([]StreamBoardItem, streamBoardMaxColumns),
+	}
+}
+
+// ManagedStream - 購読する銘柄を接続中に変更できるストリーム
+// 銘柄を追加・削除すると裏で新しい株価ボードで再接続し、最後に受け取ったイベント番号から配信を再開する
+// 銘柄の行番号は削除されるまで変わらない 空いた行は次に追加された銘柄に使う
+type ManagedStream struct {
+	*ResilientStream
+	board []StreamBoardItem // 行番号-1をindexにした株価ボード 未使用の行はIssueCodeが空
+	mtx   sync.Mutex
+}
+
+// Subscribe - 銘柄を株価ボードに追加し、割り当てた行番号を返す
+// すでに登録されている銘柄なら再接続せずに登録済みの行番号を返す
+func (s *ManagedStream) Subscribe(issueCode string, exchange Exchange) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if column, ok := s.column(issueCode, exchange); ok {
+		return column, nil
+	}
+
+	for i := range s.board {
+		if s.board[i].IssueCode == "" {
+			s.board[i] = StreamBoardItem{ColumnNumber: i + 1, IssueCode: issueCode, Exchange: exchange}
+			s.resubscribe()
+			return i + 1, nil
+		}
+	}
+	return 0, StreamBoardFullErr
+}
+
+// Unsubscribe - 銘柄を株価ボードから削除する 登録されていなければfalseを返す
+func (s *ManagedStream) Unsubscribe(issueCode string, exchange Exchange) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	column, ok := s.column(issueCode, exchange)
+	if !ok {
+		return false
+	}
+	s.board[column-1] = StreamBoardItem{}
+	s.resubscribe()
+	return true
+}
+
+// Column - 銘柄に割り当てた行番号
+func (s *ManagedStream) Column(issueCode string, exchange Exchange) (int, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.column(issueCode, exchange)
+}
+
+// Item - 行番号に登録されている銘柄 時価情報イベントのColumnNumberから銘柄を引くのに使う
+func (s *ManagedStream) Item(column int) (StreamBoardItem, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if column < 1 || column > len(s.board) || s.board[column-1].IssueCode == "" {
+		return StreamBoardItem{}, false
+	}
+	return s.board[column-1], true
+}
+
+// Board - 株価ボードに登録されている銘柄の一覧 行番号順
+func (s *ManagedStream) Board() []StreamBoardItem {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var items []StreamBoardItem
+	for _, item := range s.board {
+		if item.IssueCode != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *ManagedStream) column(issueCode string, exchange Exchange) (int, bool) {
+	for _, item := range s.board {
+		if item.IssueCode == issueCode && item.Exchange == exchange {
+			return item.ColumnNumber, true
+		}
+	}
+	return 0, false
+}
+
+// resubscribe - 現在の株価ボードでリクエストを組み立てなおし、再接続させる
+func (s *ManagedStream) resubscribe() {
+	var columns []int
+	var issueCodes []string
+	var exchanges []Exchange
+	for _, item := range s.board {
+		if item.IssueCode == "" {
+			continue
+		}
+		columns = append(columns, item.ColumnNumber)
+		issueCodes = append(issueCodes, item.IssueCode)
+		exchanges = append(exchanges, item.Exchange)
+	}
+
+	s.ResilientStream.resubscribe(func(req *StreamRequest) {
+		req.ColumnNumber = columns
+		req.IssueCodes = issueCodes
+		req.MarketCodes = exchanges
+	})
+}
@@ -0,0 +1,252 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_NewManagedStream(t *testing.T) {
+	t.Parallel()
+	client := &testClient{}
+	session := &Session{}
+	got := NewManagedStream(client, session, StreamRequest{
+		ColumnNumber:     []int{1},
+		IssueCodes:       []string{"1475"},
+		MarketCodes:      []Exchange{ExchangeToushou},
+		StreamEventTypes: []EventType{EventTypeMarketPrice, EventTypeContract},
+	}, ResilientStreamConfig{})
+
+	want := StreamRequest{StreamEventTypes: []EventType{EventTypeMarketPrice, EventTypeContract}}
+	if !reflect.DeepEqual(want, got.request()) || got.client != client || got.session != session || len(got.board) != streamBoardMaxColumns {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got.request())
+	}
+}
+
+func Test_ManagedStream_Subscribe(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		board       []StreamBoardItem
+		arg1        string
+		arg2        Exchange
+		want1       int
+		want2       error
+		wantRequest StreamRequest
+		wantSignal  bool
+	}{
+		{name: "空いている先頭の行に登録して再接続させる",
+			board: []StreamBoardItem{
+				{ColumnNumber: 1, IssueCode: "1475", Exchange: ExchangeToushou},
+				{},
+				{ColumnNumber: 3, IssueCode: "1476", Exchange: ExchangeToushou},
+			},
+			arg1:  "1477",
+			arg2:  ExchangeToushou,
+			want1: 2,
+			want2: nil,
+			wantRequest: StreamRequest{
+				ColumnNumber: []int{1, 2, 3},
+				IssueCodes:   []string{"1475", "1477", "1476"},
+				MarketCodes:  []Exchange{ExchangeToushou, ExchangeToushou, ExchangeToushou},
+			},
+			wantSignal: true},
+		{name: "登録済みなら同じ行番号を返して再接続しない",
+			board: []StreamBoardItem{
+				{ColumnNumber: 1, IssueCode: "1475", Exchange: ExchangeToushou},
+				{},
+			},
+			arg1:        "1475",
+			arg2:        ExchangeToushou,
+			want1:       1,
+			want2:       nil,
+			wantRequest: StreamRequest{},
+			wantSignal:  false},
+		{name: "空きがなければエラー",
+			board: []StreamBoardItem{
+				{ColumnNumber: 1, IssueCode: "1475", Exchange: ExchangeToushou},
+			},
+			arg1:        "1476",
+			arg2:        ExchangeToushou,
+			want1:       0,
+			want2:       StreamBoardFullErr,
+			wantRequest: StreamRequest{},
+			wantSignal:  false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			stream := NewManagedStream(&testClient{}, &Session{}, StreamRequest{}, ResilientStreamConfig{})
+			stream.board = test.board
+			got1, got2 := stream.Subscribe(test.arg1, test.arg2)
+
+			var gotSignal bool
+			select {
+			case <-stream.resubscribeCh:
+				gotSignal = true
+			default:
+			}
+
+			if !reflect.DeepEqual(test.want1, got1) || !errors.Is(got2, test.want2) || !reflect.DeepEqual(test.wantRequest, stream.request()) || test.wantSignal != gotSignal {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(), test.want1, test.want2, test.wantRequest, test.wantSignal, got1, got2, stream.request(), gotSignal)
+			}
+		})
+	}
+}
+
+func Test_ManagedStream_Unsubscribe(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		arg1        string
+		arg2        Exchange
+		want        bool
+		wantBoard   []StreamBoardItem
+		wantRequest StreamRequest
+	}{
+		{name: "登録されていれば削除して残りの銘柄で再接続させる",
+			arg1: "1475",
+			arg2: ExchangeToushou,
+			want: true,
+			wantBoard: []StreamBoardItem{
+				{ColumnNumber: 2, IssueCode: "1476", Exchange: ExchangeToushou},
+			},
+			wantRequest: StreamRequest{
+				ColumnNumber: []int{2},
+				IssueCodes:   []string{"1476"},
+				MarketCodes:  []Exchange{ExchangeToushou},
+			}},
+		{name: "市場が違えば削除しない",
+			arg1: "1475",
+			arg2: ExchangeMeishou,
+			want: false,
+			wantBoard: []StreamBoardItem{
+				{ColumnNumber: 1, IssueCode: "1475", Exchange: ExchangeToushou},
+				{ColumnNumber: 2, IssueCode: "1476", Exchange: ExchangeToushou},
+			},
+			wantRequest: StreamRequest{}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			stream := NewManagedStream(&testClient{}, &Session{}, StreamRequest{}, ResilientStreamConfig{})
+			stream.board = []StreamBoardItem{
+				{ColumnNumber: 1, IssueCode: "1475", Exchange: ExchangeToushou},
+				{ColumnNumber: 2, IssueCode: "1476", Exchange: ExchangeToushou},
+			}
+			got := stream.Unsubscribe(test.arg1, test.arg2)
+			if !reflect.DeepEqual(test.want, got) || !reflect.DeepEqual(test.wantBoard, stream.Board()) || !reflect.DeepEqual(test.wantRequest, stream.request()) {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.want, test.wantBoard, test.wantRequest, got, stream.Board(), stream.request())
+			}
+		})
+	}
+}
+
+func Test_ManagedStream_Item(t *testing.T) {
+	t.Parallel()
+	stream := NewManagedStream(&testClient{}, &Session{}, StreamRequest{}, ResilientStreamConfig{})
+	stream.board = []StreamBoardItem{
+		{ColumnNumber: 1, IssueCode: "1475", Exchange: ExchangeToushou},
+		{},
+	}
+
+	tests := []struct {
+		name  string
+		arg   int
+		want1 StreamBoardItem
+		want2 bool
+	}{
+		{name: "登録されている行なら銘柄を返す", arg: 1, want1: StreamBoardItem{ColumnNumber: 1, IssueCode: "1475", Exchange: ExchangeToushou}, want2: true},
+		{name: "空いている行ならfalse", arg: 2, want1: StreamBoardItem{}, want2: false},
+		{name: "範囲外ならfalse", arg: 3, want1: StreamBoardItem{}, want2: false},
+		{name: "0ならfalse", arg: 0, want1: StreamBoardItem{}, want2: false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got1, got2 := stream.Item(test.arg)
+			if !reflect.DeepEqual(test.want1, got1) || test.want2 != got2 {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want1, test.want2, got1, got2)
+			}
+		})
+	}
+}
+
+func Test_ManagedStream_Start_resubscribe(t *testing.T) {
+	t.Parallel()
+	subscribed := make(chan struct{})
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			ch <- &ContractStreamResponse{EventNo: 1}
+			ch <- &ContractStreamResponse{EventNo: 2}
+			<-subscribed
+			<-ctx.Done() // 購読の変更で切断されるまで待つ
+		},
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			ch <- &ContractStreamResponse{EventNo: 2}
+			ch <- &MarketPriceStreamResponse{ColumnNumber: 1}
+			ch <- &ContractStreamResponse{EventNo: 3}
+			errCh <- StreamError
+		},
+	}}
+	stream := NewManagedStream(client, &Session{}, StreamRequest{StreamEventTypes: []EventType{EventTypeMarketPrice, EventTypeContract}}, ResilientStreamConfig{
+		BaseInterval: 1 * time.Hour, // 購読の変更では待たずに再接続すること
+	})
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cf()
+	ch, statusCh, errCh := stream.Start(ctx)
+
+	var got []StreamResponse
+	var gotErr error
+	for ch != nil || errCh != nil {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				ch = nil
+				continue
+			}
+			got = append(got, res)
+			if len(got) == 2 {
+				if _, err := stream.Subscribe("1475", ExchangeToushou); err != nil {
+					t.Errorf("%s error\nsubscribe: %+v\n", t.Name(), err)
+				}
+				close(subscribed)
+			}
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			gotErr = err
+		}
+	}
+
+	var gotResubscribed bool
+	for status := range statusCh {
+		if status.Type == StreamStatusTypeResubscribing {
+			gotResubscribed = true
+		}
+	}
+
+	want := []StreamResponse{
+		&ContractStreamResponse{EventNo: 1},
+		&ContractStreamResponse{EventNo: 2},
+		&MarketPriceStreamResponse{ColumnNumber: 1},
+		&ContractStreamResponse{EventNo: 3},
+	}
+	wantHistory := []StreamRequest{
+		{StreamEventTypes: []EventType{EventTypeMarketPrice, EventTypeContract}, NotifyKeepAlive: true},
+		{ColumnNumber: []int{1}, IssueCodes: []string{"1475"}, MarketCodes: []Exchange{ExchangeToushou}, StartStreamNumber: 2, StreamEventTypes: []EventType{EventTypeMarketPrice, EventTypeContract}, NotifyKeepAlive: true},
+	}
+	if !reflect.DeepEqual(want, got) || !errors.Is(gotErr, StreamError) || !reflect.DeepEqual(wantHistory, client.getStreamHistory()) || !gotResubscribed {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(), want, StreamError, wantHistory, got, gotErr, client.getStreamHistory(), gotResubscribed)
+	}
+}
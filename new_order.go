@@ -185,6 +185,12 @@ func (c *client) NewOrder(ctx context.Context, session *Session, req NewOrderReq
 	if session == nil {
 		return nil, NilArgumentErr
 	}
+	if c.dryRun != nil {
+		return c.dryRun.newOrder(req, c.dryRunValidator)
+	}
+	if err := c.orderAllowed(); err != nil {
+		return nil, err
+	}
 	session.mtx.Lock()
 	defer session.mtx.Unlock()
 
@@ -622,7 +622,7 @@ func Test_client_NewOrder(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			client := &client{clock: test.clock, requester: test.requester}
+			client := &client{clock: test.clock, env: EnvironmentDemo, requester: test.requester}
 			got1, got2 := client.NewOrder(test.arg1, test.arg2, test.arg3)
 
 			if !reflect.DeepEqual(test.want1, got1) || !errors.Is(got2, test.want2) {
@@ -638,7 +638,7 @@ func Test_client_NewOrder_Execute_Stock_Entry(t *testing.T) {
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	client := NewClient(EnvironmentProduction, ApiVersionLatest)
+	client := NewClient(EnvironmentProduction, ApiVersionLatest, WithProductionOrders())
 	got1, got2 := client.Login(context.Background(), LoginRequest{
 		UserId:   userId,
 		Password: password,
@@ -678,7 +678,7 @@ func Test_client_NewOrder_Execute_Stock_Exit(t *testing.T) {
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	client := NewClient(EnvironmentProduction, ApiVersionLatest)
+	client := NewClient(EnvironmentProduction, ApiVersionLatest, WithProductionOrders())
 	got1, got2 := client.Login(context.Background(), LoginRequest{
 		UserId:   userId,
 		Password: password,
@@ -718,7 +718,7 @@ func Test_client_NewOrder_Execute_Stop(t *testing.T) {
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	client := NewClient(EnvironmentProduction, ApiVersionLatest)
+	client := NewClient(EnvironmentProduction, ApiVersionLatest, WithProductionOrders())
 	got1, got2 := client.Login(context.Background(), LoginRequest{
 		UserId:   userId,
 		Password: password,
@@ -758,7 +758,7 @@ func Test_client_NewOrder_Execute_Stock_OCO(t *testing.T) {
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	client := NewClient(EnvironmentProduction, ApiVersionLatest)
+	client := NewClient(EnvironmentProduction, ApiVersionLatest, WithProductionOrders())
 	got1, got2 := client.Login(context.Background(), LoginRequest{
 		UserId:   userId,
 		Password: password,
@@ -798,7 +798,7 @@ func Test_client_NewOrder_Execute_Margin(t *testing.T) {
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	client := NewClient(EnvironmentProduction, ApiVersionLatest)
+	client := NewClient(EnvironmentProduction, ApiVersionLatest, WithProductionOrders())
 	got1, got2 := client.Login(context.Background(), LoginRequest{
 		UserId:   userId,
 		Password: password,
@@ -838,7 +838,7 @@ func Test_client_NewOrder_Execute_Margin_Exit(t *testing.T) {
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	client := NewClient(EnvironmentProduction, ApiVersionLatest)
+	client := NewClient(EnvironmentProduction, ApiVersionLatest, WithProductionOrders())
 	got1, got2 := client.Login(context.Background(), LoginRequest{
 		UserId:   userId,
 		Password: password,
@@ -0,0 +1,298 @@
+package tachibana
+
+import (
+	"fmt"
+	"time"
+)
+
+// MarginTradeType - 信用取引の種類
+type MarginTradeType string
+
+const (
+	MarginTradeTypeUnspecified MarginTradeType = ""          // 未指定
+	MarginTradeTypeStandard    MarginTradeType = "standard"  // 制度信用
+	MarginTradeTypeNegotiate   MarginTradeType = "negotiate" // 一般信用
+)
+
+// entry - 新規の現金信用区分
+func (e MarginTradeType) entry() TradeType {
+	switch e {
+	case MarginTradeTypeStandard:
+		return TradeTypeStandardEntry
+	case MarginTradeTypeNegotiate:
+		return TradeTypeNegotiateEntry
+	}
+	return TradeTypeUnspecified
+}
+
+// exit - 返済の現金信用区分
+func (e MarginTradeType) exit() TradeType {
+	switch e {
+	case MarginTradeTypeStandard:
+		return TradeTypeStandardExit
+	case MarginTradeTypeNegotiate:
+		return TradeTypeNegotiateExit
+	}
+	return TradeTypeUnspecified
+}
+
+// orderIntent - 注文の意図
+type orderIntent int
+
+const (
+	orderIntentCash        orderIntent = iota // 現物の売買
+	orderIntentMarginEntry                    // 信用の新規
+	orderIntentMarginExit                     // 信用の返済
+	orderIntentSettlement                     // 現引、現渡
+)
+
+// newOrderBuilder - 特定口座、東証、成行、当日限りの注文
+func newOrderBuilder(intent orderIntent, issueCode string, side Side, tradeType TradeType, quantity float64) *OrderBuilder {
+	b := &OrderBuilder{
+		intent: intent,
+		req: NewOrderRequest{
+			AccountType:         AccountTypeSpecific,
+			DeliveryAccountType: DeliveryAccountTypeUnused,
+			IssueCode:           issueCode,
+			Exchange:            ExchangeToushou,
+			Side:                side,
+			ExecutionTiming:     ExecutionTimingNormal,
+			OrderQuantity:       quantity,
+			TradeType:           tradeType,
+			ExpireDateIsToday:   true,
+			StopOrderType:       StopOrderTypeNormal,
+			ExitPositionType:    ExitPositionTypeUnused,
+			ExitPositions:       []ExitPosition{},
+		},
+	}
+	if issueCode == "" {
+		b.fail("issue code is empty")
+	}
+	if quantity <= 0 {
+		b.fail("order quantity %v is not positive", quantity)
+	}
+	if side != SideBuy && side != SideSell && intent != orderIntentSettlement {
+		b.fail("side %s is neither buy nor sell", side)
+	}
+	if tradeType == TradeTypeUnspecified {
+		b.fail("margin trade type is unspecified")
+	}
+	return b
+}
+
+// CashBuy - 現物買いの注文
+func CashBuy(issueCode string, quantity float64) *OrderBuilder {
+	return newOrderBuilder(orderIntentCash, issueCode, SideBuy, TradeTypeStock, quantity)
+}
+
+// CashSell - 現物売りの注文
+func CashSell(issueCode string, quantity float64) *OrderBuilder {
+	return newOrderBuilder(orderIntentCash, issueCode, SideSell, TradeTypeStock, quantity)
+}
+
+// MarginEntry - 信用新規の注文 sideは買建ならSideBuy、売建ならSideSell
+func MarginEntry(issueCode string, side Side, marginTradeType MarginTradeType, quantity float64) *OrderBuilder {
+	return newOrderBuilder(orderIntentMarginEntry, issueCode, side, marginTradeType.entry(), quantity)
+}
+
+// MarginExit - 信用返済の注文 sideは買建の返済ならSideSell、売建の返済ならSideBuy
+// 返済する建玉は建日順で、ExitByやExitPositionsで変えられる
+func MarginExit(issueCode string, side Side, marginTradeType MarginTradeType, quantity float64) *OrderBuilder {
+	b := newOrderBuilder(orderIntentMarginExit, issueCode, side, marginTradeType.exit(), quantity)
+	b.req.ExitPositionType = ExitPositionTypeDayAsc
+	return b
+}
+
+// newSettlement - 現引、現渡 成行でしか注文できず、受け渡す口座は特定口座
+func newSettlement(issueCode string, side Side, marginTradeType MarginTradeType, quantity float64) *OrderBuilder {
+	b := newOrderBuilder(orderIntentSettlement, issueCode, side, marginTradeType.exit(), quantity)
+	b.req.DeliveryAccountType = DeliveryAccountTypeSpecific
+	b.req.ExitPositionType = ExitPositionTypeDayAsc
+	return b
+}
+
+// Receipt - 買建を現引する注文
+func Receipt(issueCode string, marginTradeType MarginTradeType, quantity float64) *OrderBuilder {
+	return newSettlement(issueCode, SideReceipt, marginTradeType, quantity)
+}
+
+// Delivery - 売建を現物で現渡する注文
+func Delivery(issueCode string, marginTradeType MarginTradeType, quantity float64) *OrderBuilder {
+	return newSettlement(issueCode, SideDelivery, marginTradeType, quantity)
+}
+
+// OrderBuilder - 意図ごとの生成関数から、特別な値を埋めたNewOrderRequestを組み立てる
+// 組み合わせられない指定をすると、Buildで最初の指定の誤りをOrderBuildErrで包んで返す
+type OrderBuilder struct {
+	intent orderIntent
+	req    NewOrderRequest
+	err    error
+}
+
+// fail - 最初の誤りを覚えておく
+func (b *OrderBuilder) fail(format string, a ...interface{}) *OrderBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("%s: %w", fmt.Sprintf(format, a...), OrderBuildErr)
+	}
+	return b
+}
+
+// AccountType - 譲渡益課税区分 未指定なら特定口座
+func (b *OrderBuilder) AccountType(accountType AccountType) *OrderBuilder {
+	b.req.AccountType = accountType
+	return b
+}
+
+// DeliveryAccountType - 現引、現渡で受け渡す口座 未指定なら特定口座
+func (b *OrderBuilder) DeliveryAccountType(deliveryAccountType DeliveryAccountType) *OrderBuilder {
+	if b.intent != orderIntentSettlement {
+		return b.fail("delivery account type is only for receipt or delivery")
+	}
+	if deliveryAccountType == DeliveryAccountTypeUnspecified || deliveryAccountType == DeliveryAccountTypeUnused {
+		return b.fail("delivery account type %q is not an account", deliveryAccountType)
+	}
+	b.req.DeliveryAccountType = deliveryAccountType
+	return b
+}
+
+// Exchange - 市場 未指定なら東証
+func (b *OrderBuilder) Exchange(exchange Exchange) *OrderBuilder {
+	b.req.Exchange = exchange
+	return b
+}
+
+// Limit - 指値
+func (b *OrderBuilder) Limit(price float64) *OrderBuilder {
+	if b.intent == orderIntentSettlement {
+		return b.fail("receipt or delivery has no order price")
+	}
+	if price <= 0 {
+		return b.fail("limit price %v is not positive", price)
+	}
+	b.req.OrderPrice = price
+	return b
+}
+
+// Market - 成行
+func (b *OrderBuilder) Market() *OrderBuilder {
+	b.req.OrderPrice = 0
+	return b
+}
+
+// ExecutionTiming - 執行条件 寄付、引け、不成
+func (b *OrderBuilder) ExecutionTiming(executionTiming ExecutionTiming) *OrderBuilder {
+	if b.intent == orderIntentSettlement {
+		return b.fail("receipt or delivery has no execution timing")
+	}
+	switch executionTiming {
+	case ExecutionTimingNormal, ExecutionTimingOpening, ExecutionTimingClosing, ExecutionTimingFunari:
+	default:
+		return b.fail("execution timing %q is not available for new order", executionTiming)
+	}
+	b.req.ExecutionTiming = executionTiming
+	return b
+}
+
+// ExpireOn - 注文期日 指定しなければ当日限り
+func (b *OrderBuilder) ExpireOn(date time.Time) *OrderBuilder {
+	if date.IsZero() {
+		return b.fail("expire date is zero")
+	}
+	b.req.ExpireDate = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	b.req.ExpireDateIsToday = false
+	return b
+}
+
+// Stop - 逆指値 現在値がtriggerPriceに達したらstopOrderPriceで注文し、stopOrderPriceが0なら成行
+func (b *OrderBuilder) Stop(triggerPrice float64, stopOrderPrice float64) *OrderBuilder {
+	return b.stop(StopOrderTypeStop, triggerPrice, stopOrderPrice)
+}
+
+// OCO - 指値と逆指値 Limitの指値とあわせて使い、現在値がtriggerPriceに達したらstopOrderPriceの注文に切り替える
+func (b *OrderBuilder) OCO(triggerPrice float64, stopOrderPrice float64) *OrderBuilder {
+	return b.stop(StopOrderTypeOCO, triggerPrice, stopOrderPrice)
+}
+
+func (b *OrderBuilder) stop(stopOrderType StopOrderType, triggerPrice float64, stopOrderPrice float64) *OrderBuilder {
+	if b.intent == orderIntentSettlement {
+		return b.fail("receipt or delivery cannot be a stop order")
+	}
+	if triggerPrice <= 0 {
+		return b.fail("trigger price %v is not positive", triggerPrice)
+	}
+	if stopOrderPrice < 0 {
+		return b.fail("stop order price %v is negative", stopOrderPrice)
+	}
+	b.req.StopOrderType = stopOrderType
+	b.req.TriggerPrice = triggerPrice
+	b.req.StopOrderPrice = stopOrderPrice
+	return b
+}
+
+// ExitBy - 返済する建玉の順番 建日順、単価益順、単価損順
+func (b *OrderBuilder) ExitBy(exitPositionType ExitPositionType) *OrderBuilder {
+	if b.intent != orderIntentMarginExit && b.intent != orderIntentSettlement {
+		return b.fail("exit position type is only for margin exit")
+	}
+	switch exitPositionType {
+	case ExitPositionTypeDayAsc, ExitPositionTypeProfitDesc, ExitPositionTypeProfitAsc:
+	default:
+		return b.fail("exit position type %q is not an order of positions", exitPositionType)
+	}
+	b.req.ExitPositionType = exitPositionType
+	b.req.ExitPositions = []ExitPosition{}
+	return b
+}
+
+// ExitPositions - 返済する建玉を個別に指定する 注文数量は建玉ごとの数量の合計にし、建日順位が0なら指定した順にする
+func (b *OrderBuilder) ExitPositions(positions ...ExitPosition) *OrderBuilder {
+	if b.intent != orderIntentMarginExit && b.intent != orderIntentSettlement {
+		return b.fail("exit positions are only for margin exit")
+	}
+	if len(positions) == 0 {
+		return b.fail("exit positions are empty")
+	}
+
+	var quantity float64
+	exitPositions := make([]ExitPosition, len(positions))
+	for i, p := range positions {
+		if p.PositionNumber == "" || p.OrderQuantity <= 0 {
+			return b.fail("exit position %+v needs position number and positive quantity", p)
+		}
+		if p.SequenceNumber == 0 {
+			p.SequenceNumber = i + 1
+		}
+		exitPositions[i] = p
+		quantity += p.OrderQuantity
+	}
+	b.req.ExitPositionType = ExitPositionTypePositionNumber
+	b.req.ExitPositions = exitPositions
+	b.req.OrderQuantity = quantity
+	return b
+}
+
+// SecondPassword - 第二パスワード
+func (b *OrderBuilder) SecondPassword(secondPassword string) *OrderBuilder {
+	b.req.SecondPassword = secondPassword
+	return b
+}
+
+// Build - 組み立てたNewOrderRequest 指定に誤りがあればOrderBuildErrで包んだエラー
+func (b *OrderBuilder) Build() (NewOrderRequest, error) {
+	if b.err != nil {
+		return NewOrderRequest{}, b.err
+	}
+
+	req := b.req
+	req.ExitPositions = append([]ExitPosition{}, b.req.ExitPositions...)
+	if req.StopOrderType == StopOrderTypeOCO && req.OrderPrice <= 0 {
+		return NewOrderRequest{}, fmt.Errorf("oco order requires limit price: %w", OrderBuildErr)
+	}
+	if req.ExecutionTiming == ExecutionTimingFunari && (req.OrderPrice <= 0 || req.StopOrderType != StopOrderTypeNormal) {
+		return NewOrderRequest{}, fmt.Errorf("funari order requires limit price without stop: %w", OrderBuildErr)
+	}
+	if req.StopOrderType == StopOrderTypeStop && req.OrderPrice > 0 {
+		return NewOrderRequest{}, fmt.Errorf("stop order uses stop order price instead of limit price: %w", OrderBuildErr)
+	}
+	return req, nil
+}
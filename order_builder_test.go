@@ -0,0 +1,185 @@
+package tachibana
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_OrderBuilder_Build(t *testing.T) {
+	t.Parallel()
+	// base - 各テストの期待値の元になる特定口座、東証、成行、当日限りの注文
+	base := func(side Side, tradeType TradeType, quantity float64, f func(r *NewOrderRequest)) NewOrderRequest {
+		r := NewOrderRequest{
+			AccountType:         AccountTypeSpecific,
+			DeliveryAccountType: DeliveryAccountTypeUnused,
+			IssueCode:           "1475",
+			Exchange:            ExchangeToushou,
+			Side:                side,
+			ExecutionTiming:     ExecutionTimingNormal,
+			OrderQuantity:       quantity,
+			TradeType:           tradeType,
+			ExpireDateIsToday:   true,
+			StopOrderType:       StopOrderTypeNormal,
+			ExitPositionType:    ExitPositionTypeUnused,
+			ExitPositions:       []ExitPosition{},
+		}
+		if f != nil {
+			f(&r)
+		}
+		return r
+	}
+	expire := time.Date(2022, 7, 29, 15, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		builder *OrderBuilder
+		want    NewOrderRequest
+		wantErr error
+	}{
+		{name: "現物買いの成行",
+			builder: CashBuy("1475", 10),
+			want:    base(SideBuy, TradeTypeStock, 10, nil)},
+		{name: "現物売りの指値",
+			builder: CashSell("1475", 10).Limit(2000.5),
+			want:    base(SideSell, TradeTypeStock, 10, func(r *NewOrderRequest) { r.OrderPrice = 2000.5 })},
+		{name: "現物買いの引け指値、一般口座、名証、期日指定、第二パスワード",
+			builder: CashBuy("1475", 10).Limit(2000).ExecutionTiming(ExecutionTimingClosing).AccountType(AccountTypeGeneral).Exchange(ExchangeMeishou).ExpireOn(expire).SecondPassword("second-password"),
+			want: base(SideBuy, TradeTypeStock, 10, func(r *NewOrderRequest) {
+				r.OrderPrice = 2000
+				r.ExecutionTiming = ExecutionTimingClosing
+				r.AccountType = AccountTypeGeneral
+				r.Exchange = ExchangeMeishou
+				r.ExpireDate = time.Date(2022, 7, 29, 0, 0, 0, 0, time.Local)
+				r.ExpireDateIsToday = false
+				r.SecondPassword = "second-password"
+			})},
+		{name: "現物売りの不成",
+			builder: CashSell("1475", 10).Limit(2000).ExecutionTiming(ExecutionTimingFunari),
+			want: base(SideSell, TradeTypeStock, 10, func(r *NewOrderRequest) {
+				r.OrderPrice = 2000
+				r.ExecutionTiming = ExecutionTimingFunari
+			})},
+		{name: "現物売りの逆指値",
+			builder: CashSell("1475", 10).Stop(1900, 1899),
+			want: base(SideSell, TradeTypeStock, 10, func(r *NewOrderRequest) {
+				r.StopOrderType = StopOrderTypeStop
+				r.TriggerPrice = 1900
+				r.StopOrderPrice = 1899
+			})},
+		{name: "現物売りのOCO",
+			builder: CashSell("1475", 10).Limit(2100).OCO(1900, 0),
+			want: base(SideSell, TradeTypeStock, 10, func(r *NewOrderRequest) {
+				r.OrderPrice = 2100
+				r.StopOrderType = StopOrderTypeOCO
+				r.TriggerPrice = 1900
+			})},
+		{name: "制度信用の買建",
+			builder: MarginEntry("1475", SideBuy, MarginTradeTypeStandard, 10),
+			want:    base(SideBuy, TradeTypeStandardEntry, 10, nil)},
+		{name: "一般信用の売建",
+			builder: MarginEntry("1475", SideSell, MarginTradeTypeNegotiate, 10).Limit(2000),
+			want:    base(SideSell, TradeTypeNegotiateEntry, 10, func(r *NewOrderRequest) { r.OrderPrice = 2000 })},
+		{name: "制度信用の買建の逆指値",
+			builder: MarginEntry("1475", SideBuy, MarginTradeTypeStandard, 10).Stop(2100, 0),
+			want: base(SideBuy, TradeTypeStandardEntry, 10, func(r *NewOrderRequest) {
+				r.StopOrderType = StopOrderTypeStop
+				r.TriggerPrice = 2100
+			})},
+		{name: "制度信用の返済は建日順",
+			builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 10),
+			want:    base(SideSell, TradeTypeStandardExit, 10, func(r *NewOrderRequest) { r.ExitPositionType = ExitPositionTypeDayAsc })},
+		{name: "一般信用の返済を単価益順",
+			builder: MarginExit("1475", SideBuy, MarginTradeTypeNegotiate, 10).ExitBy(ExitPositionTypeProfitDesc),
+			want:    base(SideBuy, TradeTypeNegotiateExit, 10, func(r *NewOrderRequest) { r.ExitPositionType = ExitPositionTypeProfitDesc })},
+		{name: "制度信用の返済を建玉の個別指定",
+			builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 1).ExitPositions(
+				ExitPosition{PositionNumber: "202207260000001", OrderQuantity: 10},
+				ExitPosition{PositionNumber: "202207260000002", SequenceNumber: 5, OrderQuantity: 20}),
+			want: base(SideSell, TradeTypeStandardExit, 30, func(r *NewOrderRequest) {
+				r.ExitPositionType = ExitPositionTypePositionNumber
+				r.ExitPositions = []ExitPosition{
+					{PositionNumber: "202207260000001", SequenceNumber: 1, OrderQuantity: 10},
+					{PositionNumber: "202207260000002", SequenceNumber: 5, OrderQuantity: 20},
+				}
+			})},
+		{name: "個別指定のあとに順番を指定したら個別指定を消す",
+			builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 10).ExitPositions(ExitPosition{PositionNumber: "202207260000001", OrderQuantity: 10}).ExitBy(ExitPositionTypeProfitAsc),
+			want:    base(SideSell, TradeTypeStandardExit, 10, func(r *NewOrderRequest) { r.ExitPositionType = ExitPositionTypeProfitAsc })},
+		{name: "制度信用の返済のOCO",
+			builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 10).Limit(2100).OCO(1900, 1899),
+			want: base(SideSell, TradeTypeStandardExit, 10, func(r *NewOrderRequest) {
+				r.ExitPositionType = ExitPositionTypeDayAsc
+				r.OrderPrice = 2100
+				r.StopOrderType = StopOrderTypeOCO
+				r.TriggerPrice = 1900
+				r.StopOrderPrice = 1899
+			})},
+		{name: "制度信用の現引",
+			builder: Receipt("1475", MarginTradeTypeStandard, 10),
+			want: base(SideReceipt, TradeTypeStandardExit, 10, func(r *NewOrderRequest) {
+				r.DeliveryAccountType = DeliveryAccountTypeSpecific
+				r.ExitPositionType = ExitPositionTypeDayAsc
+			})},
+		{name: "一般信用の現渡を一般口座で、建玉の個別指定",
+			builder: Delivery("1475", MarginTradeTypeNegotiate, 10).DeliveryAccountType(DeliveryAccountTypeGeneral).ExitPositions(ExitPosition{PositionNumber: "202207260000001", OrderQuantity: 10}),
+			want: base(SideDelivery, TradeTypeNegotiateExit, 10, func(r *NewOrderRequest) {
+				r.DeliveryAccountType = DeliveryAccountTypeGeneral
+				r.ExitPositionType = ExitPositionTypePositionNumber
+				r.ExitPositions = []ExitPosition{{PositionNumber: "202207260000001", SequenceNumber: 1, OrderQuantity: 10}}
+			})},
+		{name: "指値のあとに成行にできる",
+			builder: CashBuy("1475", 10).Limit(2000).Market(),
+			want:    base(SideBuy, TradeTypeStock, 10, nil)},
+
+		{name: "銘柄コードがなければエラー", builder: CashBuy("", 10), wantErr: OrderBuildErr},
+		{name: "数量が0ならエラー", builder: CashBuy("1475", 0), wantErr: OrderBuildErr},
+		{name: "信用の売買区分が売買でなければエラー", builder: MarginEntry("1475", SideReceipt, MarginTradeTypeStandard, 10), wantErr: OrderBuildErr},
+		{name: "信用取引の種類が未指定ならエラー", builder: MarginEntry("1475", SideBuy, MarginTradeTypeUnspecified, 10), wantErr: OrderBuildErr},
+		{name: "指値が0ならエラー", builder: CashBuy("1475", 10).Limit(0), wantErr: OrderBuildErr},
+		{name: "執行条件の変更なしは指定できない", builder: CashBuy("1475", 10).ExecutionTiming(ExecutionTimingNoChange), wantErr: OrderBuildErr},
+		{name: "不成は指値がなければエラー", builder: CashBuy("1475", 10).ExecutionTiming(ExecutionTimingFunari), wantErr: OrderBuildErr},
+		{name: "不成は逆指値にできない", builder: CashBuy("1475", 10).Limit(2000).ExecutionTiming(ExecutionTimingFunari).OCO(2100, 0), wantErr: OrderBuildErr},
+		{name: "OCOは指値がなければエラー", builder: CashSell("1475", 10).OCO(1900, 0), wantErr: OrderBuildErr},
+		{name: "逆指値に指値を指定したらエラー", builder: CashSell("1475", 10).Limit(2000).Stop(1900, 0), wantErr: OrderBuildErr},
+		{name: "逆指値条件が0ならエラー", builder: CashSell("1475", 10).Stop(0, 0), wantErr: OrderBuildErr},
+		{name: "逆指値値段が負ならエラー", builder: CashSell("1475", 10).Stop(1900, -1), wantErr: OrderBuildErr},
+		{name: "期日がゼロならエラー", builder: CashBuy("1475", 10).ExpireOn(time.Time{}), wantErr: OrderBuildErr},
+		{name: "現物に返済の順番は指定できない", builder: CashSell("1475", 10).ExitBy(ExitPositionTypeDayAsc), wantErr: OrderBuildErr},
+		{name: "新規に返済する建玉は指定できない", builder: MarginEntry("1475", SideBuy, MarginTradeTypeStandard, 10).ExitPositions(ExitPosition{PositionNumber: "1", OrderQuantity: 10}), wantErr: OrderBuildErr},
+		{name: "返済の順番に個別指定は指定できない", builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 10).ExitBy(ExitPositionTypePositionNumber), wantErr: OrderBuildErr},
+		{name: "返済の順番に未使用は指定できない", builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 10).ExitBy(ExitPositionTypeUnused), wantErr: OrderBuildErr},
+		{name: "返済する建玉が空ならエラー", builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 10).ExitPositions(), wantErr: OrderBuildErr},
+		{name: "返済する建玉の数量が0ならエラー", builder: MarginExit("1475", SideSell, MarginTradeTypeStandard, 10).ExitPositions(ExitPosition{PositionNumber: "1"}), wantErr: OrderBuildErr},
+		{name: "現物に受け渡す口座は指定できない", builder: CashBuy("1475", 10).DeliveryAccountType(DeliveryAccountTypeSpecific), wantErr: OrderBuildErr},
+		{name: "現引の受け渡す口座に未使用は指定できない", builder: Receipt("1475", MarginTradeTypeStandard, 10).DeliveryAccountType(DeliveryAccountTypeUnused), wantErr: OrderBuildErr},
+		{name: "現引に指値は指定できない", builder: Receipt("1475", MarginTradeTypeStandard, 10).Limit(2000), wantErr: OrderBuildErr},
+		{name: "現渡に執行条件は指定できない", builder: Delivery("1475", MarginTradeTypeStandard, 10).ExecutionTiming(ExecutionTimingClosing), wantErr: OrderBuildErr},
+		{name: "現渡に逆指値は指定できない", builder: Delivery("1475", MarginTradeTypeStandard, 10).Stop(1900, 0), wantErr: OrderBuildErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := test.builder.Build()
+			if !reflect.DeepEqual(test.want, got) || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErr, got, err)
+			}
+		})
+	}
+}
+
+// Test_OrderBuilder_Build_request - 組み立てたリクエストは逆指値値段と注文値段を*で送る
+func Test_OrderBuilder_Build_request(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	normal, _ := CashBuy("1475", 10).Limit(2000).Build()
+	stop, _ := CashSell("1475", 10).Stop(1900, 0).Build()
+	got := []string{normal.request(1, now).StopOrderPrice, stop.request(1, now).OrderPrice}
+	want := []string{"*", "*"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
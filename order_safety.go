@@ -0,0 +1,203 @@
+package tachibana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DryRunLogger - ドライランで送らなかった注文を出力する先 *log.Loggerをそのまま渡せる
+type DryRunLogger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithProductionOrders - 本番環境で新規注文、訂正注文、取消注文を送ることを許可する
+// 指定しなければ、本番環境の注文はサーバに送らずにProductionOrderErrを返す
+func WithProductionOrders() ClientOption {
+	return func(c *client) {
+		c.productionOrders = true
+	}
+}
+
+// WithDryRun - 新規注文、訂正注文、取消注文をサーバに送らず、検証してloggerに出力し、受け付けられたものとしてレスポンスを作って返す
+// 環境によらずサーバに送らない 注文以外のリクエストはそのままサーバに送る loggerがnilなら出力しない
+func WithDryRun(logger DryRunLogger) ClientOption {
+	return func(c *client) {
+		c.dryRun = &dryRun{clock: newClock(), logger: logger}
+	}
+}
+
+// WithDryRunValidator - ドライランの新規注文と訂正注文をvalidatorでも検証し、違反があればDryRunInvalidErrを包んだエラーを返す
+// WithDryRunと合わせて指定する 訂正注文は、ドライランで受け付けた注文でなければ注文詳細をサーバから取得して検証する
+func WithDryRunValidator(validator *Validator) ClientOption {
+	return func(c *client) {
+		c.dryRunValidator = validator
+	}
+}
+
+// orderAllowed - 注文をサーバに送ってよい環境か
+func (c *client) orderAllowed() error {
+	switch c.env {
+	case EnvironmentDemo:
+		return nil
+	case EnvironmentProduction:
+		if c.productionOrders {
+			return nil
+		}
+		return fmt.Errorf("use WithProductionOrders to send orders to production: %w", ProductionOrderErr)
+	}
+	return fmt.Errorf("environment %q: %w", c.env, EnvUnspecifiedErr)
+}
+
+// dryRun - サーバに送らない注文
+type dryRun struct {
+	clock         iClock
+	logger        DryRunLogger
+	lastRequestNo int64
+	lastOrderNo   int64
+	orders        map[string]*OrderDetailResponse // ドライランで受け付けた注文 訂正注文の検証に使う
+	mtx           sync.Mutex
+}
+
+// log - 送るはずだったリクエストを出力する 第二パスワードは伏せる
+func (d *dryRun) log(name string, request interface{}) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err, EncodeErr)
+	}
+	if d.logger != nil {
+		d.logger.Printf("dry run %s: %s\n", name, string(b))
+	}
+	return nil
+}
+
+// common - レスポンスの共通的な項目 ロックを取ってから呼ぶ
+func (d *dryRun) common(messageType MessageType, now time.Time) CommonResponse {
+	d.lastRequestNo++
+	return CommonResponse{No: d.lastRequestNo, SendDate: now, ReceiveDate: now, MessageType: messageType}
+}
+
+// maskedPassword - 出力用に伏せた第二パスワード
+func maskedPassword(password string) string {
+	if password == "" {
+		return ""
+	}
+	return "********"
+}
+
+// dryRunInvalidError - validatorの違反をまとめたドライランのエラー
+func dryRunInvalidError(violations []OrderViolation) error {
+	return fmt.Errorf("%s: %w", orderViolationMessage(violations), DryRunInvalidErr)
+}
+
+// order - ドライランで受け付けた注文
+func (d *dryRun) order(orderNumber string) (*OrderDetailResponse, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	o, ok := d.orders[orderNumber]
+	return o, ok
+}
+
+// newOrder - 新規注文を検証して、受け付けられたものとしてレスポンスを返す validatorがnilなら必須項目だけ確認する
+func (d *dryRun) newOrder(req NewOrderRequest, validator *Validator) (*NewOrderResponse, error) {
+	if req.IssueCode == "" || (req.Side != SideBuy && req.Side != SideSell) || req.TradeType == TradeTypeUnspecified || req.OrderQuantity <= 0 {
+		return nil, fmt.Errorf("issue code, side, trade type and order quantity are required: %w", DryRunInvalidErr)
+	}
+	if validator != nil {
+		if violations := validator.ValidateNewOrder(req); len(violations) > 0 {
+			return nil, dryRunInvalidError(violations)
+		}
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	now := d.clock.Now()
+	req.SecondPassword = maskedPassword(req.SecondPassword)
+	if err := d.log("NewOrder", req.request(d.lastRequestNo+1, now)); err != nil {
+		return nil, err
+	}
+
+	d.lastOrderNo++
+	orderNumber := fmt.Sprintf("DRY%d", d.lastOrderNo)
+	executionDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if d.orders == nil {
+		d.orders = map[string]*OrderDetailResponse{}
+	}
+	d.orders[orderNumber] = &OrderDetailResponse{OrderNumber: orderNumber, ExecutionDate: executionDate, IssueCode: req.IssueCode, Exchange: req.Exchange, StopOrderType: req.StopOrderType}
+	return &NewOrderResponse{
+		CommonResponse: d.common(MessageTypeNewOrder, now),
+		ResultCode:     "0",
+		ResultText:     "dry run",
+		OrderNumber:    orderNumber,
+		ExecutionDate:  executionDate,
+		OrderDateTime:  now,
+	}, nil
+}
+
+// dryRunCorrectOrder - ドライランの訂正注文 validatorがあれば、訂正する注文の詳細と合わせて検証する
+func (c *client) dryRunCorrectOrder(ctx context.Context, session *Session, req CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	if c.dryRunValidator != nil && req.OrderNumber != "" {
+		order, ok := c.dryRun.order(req.OrderNumber)
+		if !ok {
+			var err error
+			order, err = c.OrderDetail(ctx, session, OrderDetailRequest{OrderNumber: req.OrderNumber, ExecutionDate: req.ExecutionDate})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if violations := c.dryRunValidator.ValidateCorrectOrder(req, order); len(violations) > 0 {
+			return nil, dryRunInvalidError(violations)
+		}
+	}
+	return c.dryRun.correctOrder(req)
+}
+
+// correctOrder - 訂正注文を検証して、受け付けられたものとしてレスポンスを返す
+func (d *dryRun) correctOrder(req CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	if req.OrderNumber == "" {
+		return nil, fmt.Errorf("order number is required: %w", DryRunInvalidErr)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	now := d.clock.Now()
+	req.SecondPassword = maskedPassword(req.SecondPassword)
+	if err := d.log("CorrectOrder", req.request(d.lastRequestNo+1, now)); err != nil {
+		return nil, err
+	}
+
+	return &CorrectOrderResponse{
+		CommonResponse: d.common(MessageTypeCorrectOrder, now),
+		ResultCode:     "0",
+		ResultText:     "dry run",
+		OrderNumber:    req.OrderNumber,
+		ExecutionDate:  req.ExecutionDate,
+		OrderDateTime:  now,
+	}, nil
+}
+
+// cancelOrder - 取消注文を検証して、受け付けられたものとしてレスポンスを返す
+func (d *dryRun) cancelOrder(req CancelOrderRequest) (*CancelOrderResponse, error) {
+	if req.OrderNumber == "" {
+		return nil, fmt.Errorf("order number is required: %w", DryRunInvalidErr)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	now := d.clock.Now()
+	req.SecondPassword = maskedPassword(req.SecondPassword)
+	if err := d.log("CancelOrder", req.request(d.lastRequestNo+1, now)); err != nil {
+		return nil, err
+	}
+
+	return &CancelOrderResponse{
+		CommonResponse: d.common(MessageTypeCancelOrder, now),
+		ResultCode:     "0",
+		ResultText:     "dry run",
+		OrderNumber:    req.OrderNumber,
+		ExecutionDate:  req.ExecutionDate,
+		OrderDateTime:  now,
+	}, nil
+}
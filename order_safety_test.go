@@ -0,0 +1,169 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDryRunLogger - 出力を貯めるDryRunLogger
+type testDryRunLogger struct {
+	lines []string
+}
+
+func (l *testDryRunLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func Test_client_orderAllowed(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		env  Environment
+		opts []ClientOption
+		want error
+	}{
+		{name: "デモ環境なら送れる", env: EnvironmentDemo, want: nil},
+		{name: "本番環境は許可しなければ送れない", env: EnvironmentProduction, want: ProductionOrderErr},
+		{name: "本番環境も許可すれば送れる", env: EnvironmentProduction, opts: []ClientOption{WithProductionOrders()}, want: nil},
+		{name: "環境を指定しなければ送れない", env: EnvironmentUnspecified, opts: []ClientOption{WithProductionOrders()}, want: EnvUnspecifiedErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := NewClient(test.env, ApiVersionLatest, test.opts...).(*client).orderAllowed()
+			if !errors.Is(got, test.want) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+// Test_client_order_notAllowed - 送れない環境なら、新規注文、訂正注文、取消注文をサーバに送らない
+func Test_client_order_notAllowed(t *testing.T) {
+	t.Parallel()
+	requester := &testRequester{}
+	c := &client{clock: &testClock{}, env: EnvironmentProduction, requester: requester}
+	session := &Session{}
+
+	_, err1 := c.NewOrder(context.Background(), session, NewOrderRequest{})
+	_, err2 := c.CorrectOrder(context.Background(), session, CorrectOrderRequest{})
+	_, err3 := c.CancelOrder(context.Background(), session, CancelOrderRequest{})
+	if !errors.Is(err1, ProductionOrderErr) || !errors.Is(err2, ProductionOrderErr) || !errors.Is(err3, ProductionOrderErr) || requester.getCount != 0 || session.lastRequestNo != 0 {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v, %+v, %+v, %+v\n", t.Name(), ProductionOrderErr, 0, err1, err2, err3, requester.getCount, session.lastRequestNo)
+	}
+}
+
+func Test_client_NewOrder_dryRun(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		req      NewOrderRequest
+		want     *NewOrderResponse
+		wantErr  error
+		wantLogs int
+	}{
+		{name: "検証して、受け付けられたものとしてレスポンスを返す",
+			req: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, SecondPassword: "second"},
+			want: &NewOrderResponse{CommonResponse: CommonResponse{No: 1, SendDate: now, ReceiveDate: now, MessageType: MessageTypeNewOrder},
+				ResultCode: "0", ResultText: "dry run", OrderNumber: "DRY1", ExecutionDate: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), OrderDateTime: now},
+			wantLogs: 1},
+		{name: "必須項目がなければエラー", req: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock}, wantErr: DryRunInvalidErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			logger := &testDryRunLogger{}
+			requester := &testRequester{}
+			c := NewClient(EnvironmentProduction, ApiVersionLatest, WithDryRun(logger)).(*client)
+			c.requester = requester
+			c.dryRun.clock = &testClock{Now1: now}
+
+			got, err := c.NewOrder(context.Background(), &Session{}, test.req)
+			if !reflect.DeepEqual(test.want, got) || !errors.Is(err, test.wantErr) || test.wantLogs != len(logger.lines) || requester.getCount != 0 {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(), test.want, test.wantErr, test.wantLogs, got, err, logger.lines, requester.getCount)
+			}
+			for _, line := range logger.lines {
+				if strings.Contains(line, "second") || !strings.Contains(line, "dry run NewOrder") {
+					t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), "masked second password", line)
+				}
+			}
+		})
+	}
+}
+
+func Test_client_CorrectOrder_CancelOrder_dryRun(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	date := time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local)
+	logger := &testDryRunLogger{}
+	c := NewClient(EnvironmentUnspecified, ApiVersionLatest, WithDryRun(logger)).(*client)
+	c.requester = &testRequester{}
+	c.dryRun.clock = &testClock{Now1: now}
+
+	got1, err1 := c.CorrectOrder(context.Background(), &Session{}, CorrectOrderRequest{OrderNumber: "1", ExecutionDate: date, OrderPrice: 2000, OrderQuantity: NoChangeFloat, TriggerPrice: NoChangeFloat, StopOrderPrice: NoChangeFloat})
+	want1 := &CorrectOrderResponse{CommonResponse: CommonResponse{No: 1, SendDate: now, ReceiveDate: now, MessageType: MessageTypeCorrectOrder},
+		ResultCode: "0", ResultText: "dry run", OrderNumber: "1", ExecutionDate: date, OrderDateTime: now}
+	if !reflect.DeepEqual(want1, got1) || err1 != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want1, nil, got1, err1)
+	}
+
+	got2, err2 := c.CancelOrder(context.Background(), &Session{}, CancelOrderRequest{OrderNumber: "1", ExecutionDate: date})
+	want2 := &CancelOrderResponse{CommonResponse: CommonResponse{No: 2, SendDate: now, ReceiveDate: now, MessageType: MessageTypeCancelOrder},
+		ResultCode: "0", ResultText: "dry run", OrderNumber: "1", ExecutionDate: date, OrderDateTime: now}
+	if !reflect.DeepEqual(want2, got2) || err2 != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want2, nil, got2, err2)
+	}
+
+	_, err3 := c.CancelOrder(context.Background(), &Session{}, CancelOrderRequest{})
+	if !errors.Is(err3, DryRunInvalidErr) || len(logger.lines) != 2 {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), DryRunInvalidErr, 2, err3, logger.lines)
+	}
+}
+
+func Test_client_dryRun_validator(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	logger := &testDryRunLogger{}
+	requester := &testRequester{}
+	c := NewClient(EnvironmentProduction, ApiVersionLatest, WithDryRun(logger), WithDryRunValidator(newTestValidator())).(*client)
+	c.requester = requester
+	c.dryRun.clock = &testClock{Now1: now}
+	noChange := CorrectOrderRequest{OrderPrice: NoChangeFloat, OrderQuantity: NoChangeFloat, TriggerPrice: NoChangeFloat, StopOrderPrice: NoChangeFloat}
+
+	_, err1 := c.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 15, OrderPrice: 1000})
+	if !errors.Is(err1, DryRunInvalidErr) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), DryRunInvalidErr, err1)
+	}
+
+	got2, err2 := c.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 20, OrderPrice: 1000})
+	if err2 != nil || got2 == nil || got2.OrderNumber != "DRY1" {
+		t.Fatalf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), "DRY1", nil, got2, err2)
+	}
+
+	req3 := noChange
+	req3.OrderNumber, req3.OrderPrice = "DRY1", 2001
+	_, err3 := c.CorrectOrder(context.Background(), &Session{}, req3)
+	if !errors.Is(err3, DryRunInvalidErr) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), DryRunInvalidErr, err3)
+	}
+
+	req4 := noChange
+	req4.OrderNumber, req4.OrderPrice = "DRY1", 1500
+	if _, err4 := c.CorrectOrder(context.Background(), &Session{}, req4); err4 != nil {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err4)
+	}
+
+	if len(logger.lines) != 2 || requester.getCount != 0 {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), 2, 0, logger.lines, requester.getCount)
+	}
+}
@@ -0,0 +1,375 @@
+package tachibana
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOrderTrackerChangeBufferSize = 64               // 変更通知のバッファ
+	defaultOrderTrackerPollInterval     = 10 * time.Second // 終わるのを待っている注文を注文一覧で確認する間隔
+)
+
+// OrderState - 追跡している注文の状態
+type OrderState string
+
+const (
+	OrderStateUnspecified OrderState = ""            // 未指定
+	OrderStatePending     OrderState = "pending"     // 受付未済、発注待ち
+	OrderStateOpen        OrderState = "open"        // 受付済で未約定 訂正中や取消中、逆指値の待機中を含む
+	OrderStatePartFilled  OrderState = "part_filled" // 一部約定
+	OrderStateFilled      OrderState = "filled"      // 全部約定
+	OrderStateCanceled    OrderState = "canceled"    // 取消完了 一部約定したあとの取消を含む
+	OrderStateExpired     OrderState = "expired"     // 失効 一部約定したあとの失効を含む
+	OrderStateRejected    OrderState = "rejected"    // 受付エラー、登録エラー
+)
+
+// Done - これ以上状態が変わらないか
+func (s OrderState) Done() bool {
+	switch s {
+	case OrderStateFilled, OrderStateCanceled, OrderStateExpired, OrderStateRejected:
+		return true
+	}
+	return false
+}
+
+// TrackedOrder - 追跡している注文
+type TrackedOrder struct {
+	OrderNumber       string            // 注文番号
+	ExecutionDate     time.Time         // 営業日
+	IssueCode         string            // 銘柄コード
+	Exchange          Exchange          // 市場
+	Side              Side              // 売買区分
+	TradeType         TradeType         // 現金信用区分
+	State             OrderState        // 状態
+	OrderQuantity     float64           // 注文数量
+	ContractQuantity  float64           // 約定済数量
+	ContractStatus    ContractStatus    // 約定ステータス
+	CancelOrderStatus CancelOrderStatus // 訂正取消ステータス 約定通知でだけわかる
+	OrderStatus       OrderStatus       // 状態コード 注文一覧、注文詳細でだけわかる
+	LastEventNo       int64             // 最後に反映した約定通知のイベント番号
+	UpdateDateTime    time.Time         // 最後に状態を反映した日時
+}
+
+// NewOrderTracker - 注文の状態を追跡するトラッカーを生成する
+func NewOrderTracker(client Client, session *Session) *OrderTracker {
+	return &OrderTracker{
+		clock:        newClock(),
+		client:       client,
+		session:      session,
+		pollInterval: defaultOrderTrackerPollInterval,
+		orders:       map[string]*TrackedOrder{},
+		changed:      make(chan struct{}),
+		changes:      make(chan TrackedOrder, defaultOrderTrackerChangeBufferSize),
+	}
+}
+
+// OrderTracker - 注文番号ごとの状態を、約定通知で進め、注文一覧と注文詳細で突き合わせて追跡する
+// ApplyをStreamHandlers.OnContractに渡し、再接続や配信番号の欠番のあとにReconcileを呼ぶ Watchを使えばReconcileは自動で呼ばれる
+type OrderTracker struct {
+	clock        iClock
+	client       Client
+	session      *Session
+	pollInterval time.Duration // WaitForFillとWaitForCancelで約定通知がないときに注文一覧で確認する間隔
+	orders       map[string]*TrackedOrder
+	changed      chan struct{}     // 状態が変わったら閉じて作り直す
+	changes      chan TrackedOrder // 変更通知
+	mtx          sync.Mutex
+}
+
+// Track - 注文番号を追跡対象に加える 新規注文を送ったら、約定通知を待たずに登録しておく
+func (t *OrderTracker) Track(orderNumber string, executionDate time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if _, ok := t.orders[orderNumber]; ok {
+		return
+	}
+	o := &TrackedOrder{OrderNumber: orderNumber, ExecutionDate: executionDate, State: OrderStatePending, UpdateDateTime: t.clock.Now()}
+	t.orders[orderNumber] = o
+	t.notify(o)
+}
+
+// Order - 追跡している注文 追跡していなければfalse
+func (t *OrderTracker) Order(orderNumber string) (TrackedOrder, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	o, ok := t.orders[orderNumber]
+	if !ok {
+		return TrackedOrder{}, false
+	}
+	return *o, true
+}
+
+// Orders - 追跡している注文の一覧 注文番号順
+func (t *OrderTracker) Orders() []TrackedOrder {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	orders := make([]TrackedOrder, 0, len(t.orders))
+	for _, o := range t.orders {
+		orders = append(orders, *o)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].OrderNumber < orders[j].OrderNumber })
+	return orders
+}
+
+// Changes - 注文の状態が変わったら変更後の注文が通知されるチャネル 読まれずにバッファがいっぱいなら捨てる
+func (t *OrderTracker) Changes() <-chan TrackedOrder {
+	return t.changes
+}
+
+// notify - 状態の変更を待っているWaitと変更通知に知らせる ロックを取ってから呼ぶ
+func (t *OrderTracker) notify(o *TrackedOrder) {
+	close(t.changed)
+	t.changed = make(chan struct{})
+	select {
+	case t.changes <- *o:
+	default:
+	}
+}
+
+// order - 注文番号の注文 追跡していなければ追加する ロックを取ってから呼ぶ
+func (t *OrderTracker) order(orderNumber string) *TrackedOrder {
+	o, ok := t.orders[orderNumber]
+	if !ok {
+		o = &TrackedOrder{OrderNumber: orderNumber}
+		t.orders[orderNumber] = o
+	}
+	return o
+}
+
+// streamOrderState - 約定通知から注文の状態を決める 決められなければUnspecified
+func streamOrderState(res *ContractStreamResponse) OrderState {
+	switch res.StreamOrderType {
+	case StreamOrderTypeReceiveError, StreamOrderTypeOrderError:
+		return OrderStateRejected
+	case StreamOrderTypeCanceled:
+		return OrderStateCanceled
+	case StreamOrderTypeExpire, StreamOrderTypeExpireContinue:
+		return OrderStateExpired
+	}
+
+	switch {
+	case res.StreamOrderStatus == StreamOrderStatusError:
+		return OrderStateRejected
+	case res.CancelOrderStatus == CancelOrderStatusCanceled:
+		return OrderStateCanceled
+	case res.StreamOrderStatus == StreamOrderStatusPartExpired,
+		res.StreamOrderStatus == StreamOrderStatusExpired,
+		res.StreamOrderStatus == StreamOrderStatusCarryOverExpired:
+		return OrderStateExpired
+	case res.ContractStatus == ContractStatusDone:
+		return OrderStateFilled
+	case res.ContractStatus == ContractStatusPart, res.ContractStatus == ContractStatusInContract:
+		return OrderStatePartFilled
+	case res.StreamOrderStatus == StreamOrderStatusReceived:
+		return OrderStateOpen
+	case res.StreamOrderStatus == StreamOrderStatusNew:
+		return OrderStatePending
+	}
+	return OrderStateUnspecified
+}
+
+// Apply - 約定通知で注文の状態を進める StreamHandlers.OnContractに渡せる
+// 反映済みのイベント番号以前の通知は再送として無視する
+func (t *OrderTracker) Apply(res *ContractStreamResponse) {
+	if res == nil || res.OrderNumber == "" {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	o := t.order(res.OrderNumber)
+	if res.EventNo > 0 && res.EventNo <= o.LastEventNo {
+		return
+	}
+	if res.EventNo > 0 {
+		o.LastEventNo = res.EventNo
+	}
+
+	if !res.ExecutionDate.IsZero() {
+		o.ExecutionDate = res.ExecutionDate
+	}
+	if res.IssueCode != "" {
+		o.IssueCode, o.Exchange, o.Side, o.TradeType = res.IssueCode, res.Exchange, res.Side, res.TradeType
+	}
+	if res.Quantity > 0 {
+		o.OrderQuantity = res.Quantity
+	}
+	if res.StreamOrderType == StreamOrderTypeContract || res.StreamOrderType == StreamOrderTypeCancelContract || res.ContractQuantity > 0 {
+		o.ContractQuantity = res.ContractQuantity
+	}
+	if res.ContractStatus != ContractStatusUnspecified {
+		o.ContractStatus = res.ContractStatus
+	}
+	if res.CancelOrderStatus != CancelOrderStatusUnspecified {
+		o.CancelOrderStatus = res.CancelOrderStatus
+	}
+
+	// 約定取消でだけ、終わった注文が約定前の状態に戻る
+	if state := streamOrderState(res); state != OrderStateUnspecified && (!o.State.Done() || res.StreamOrderType == StreamOrderTypeCancelContract) {
+		o.State = state
+	}
+	o.UpdateDateTime = t.clock.Now()
+	t.notify(o)
+}
+
+// snapshotOrderState - 注文一覧、注文詳細の状態コードから注文の状態を決める
+func snapshotOrderState(status OrderStatus, contractQuantity float64) OrderState {
+	switch status {
+	case OrderStatusReceived, OrderStatusWait:
+		return OrderStatePending
+	case OrderStatusError, OrderStatusInvalid, OrderStatusTriggerFailed:
+		return OrderStateRejected
+	case OrderStatusCanceled:
+		return OrderStateCanceled
+	case OrderStatusPartExpired, OrderStatusExpired, OrderStatusCarryOverFailed:
+		return OrderStateExpired
+	case OrderStatusDone:
+		return OrderStateFilled
+	case OrderStatusPart:
+		return OrderStatePartFilled
+	case OrderStatusUnspecified:
+		return OrderStateUnspecified
+	}
+	if contractQuantity > 0 {
+		return OrderStatePartFilled
+	}
+	return OrderStateOpen
+}
+
+// applySnapshot - 注文一覧、注文詳細の状態を反映する 終わった注文を終わっていない状態には戻さない ロックを取ってから呼ぶ
+func (t *OrderTracker) applySnapshot(o *TrackedOrder, snapshot TrackedOrder) {
+	if snapshot.State == OrderStateUnspecified || (o.State.Done() && !snapshot.State.Done()) {
+		return
+	}
+	if o.State == snapshot.State && o.ContractQuantity == snapshot.ContractQuantity && o.OrderStatus == snapshot.OrderStatus {
+		return
+	}
+
+	if !snapshot.ExecutionDate.IsZero() {
+		o.ExecutionDate = snapshot.ExecutionDate
+	}
+	o.IssueCode, o.Exchange, o.Side, o.TradeType = snapshot.IssueCode, snapshot.Exchange, snapshot.Side, snapshot.TradeType
+	o.State = snapshot.State
+	o.OrderQuantity = snapshot.OrderQuantity
+	o.ContractQuantity = snapshot.ContractQuantity
+	o.ContractStatus = snapshot.ContractStatus
+	o.OrderStatus = snapshot.OrderStatus
+	o.UpdateDateTime = t.clock.Now()
+	t.notify(o)
+}
+
+// Reconcile - 注文一覧と突き合わせて状態を直す 注文一覧にない終わっていない注文は注文詳細で確認する
+// 約定通知を取りこぼしたかもしれない再接続や欠番のあとに呼ぶ
+func (t *OrderTracker) Reconcile(ctx context.Context) error {
+	res, err := t.client.OrderList(ctx, t.session, OrderListRequest{})
+	if err != nil {
+		return err
+	}
+
+	listed := map[string]bool{}
+	t.mtx.Lock()
+	for _, order := range res.Orders {
+		listed[order.OrderNumber] = true
+		t.applySnapshot(t.order(order.OrderNumber), TrackedOrder{
+			ExecutionDate:    order.ExecutionDate,
+			IssueCode:        order.IssueCode,
+			Exchange:         order.Exchange,
+			Side:             order.Side,
+			TradeType:        order.TradeType,
+			State:            snapshotOrderState(order.OrderStatus, order.ContractQuantity),
+			OrderQuantity:    order.OrderQuantity,
+			ContractQuantity: order.ContractQuantity,
+			ContractStatus:   order.ContractStatus,
+			OrderStatus:      order.OrderStatus,
+		})
+	}
+	var details []TrackedOrder
+	for _, o := range t.orders {
+		if !listed[o.OrderNumber] && !o.State.Done() {
+			details = append(details, *o)
+		}
+	}
+	t.mtx.Unlock()
+
+	for _, o := range details {
+		detail, err := t.client.OrderDetail(ctx, t.session, OrderDetailRequest{OrderNumber: o.OrderNumber, ExecutionDate: o.ExecutionDate})
+		if err != nil {
+			return err
+		}
+		t.mtx.Lock()
+		t.applySnapshot(t.order(o.OrderNumber), TrackedOrder{
+			ExecutionDate:    detail.ExecutionDate,
+			IssueCode:        detail.IssueCode,
+			Exchange:         detail.Exchange,
+			Side:             detail.Side,
+			TradeType:        detail.TradeType,
+			State:            snapshotOrderState(detail.OrderStatus, detail.ContractQuantity),
+			OrderQuantity:    detail.OrderQuantity,
+			ContractQuantity: detail.ContractQuantity,
+			OrderStatus:      detail.OrderStatus,
+		})
+		t.mtx.Unlock()
+	}
+	return nil
+}
+
+// Watch - ストリームの再接続と配信番号の欠番を監視し、起きたらReconcileする
+// ResilientStream.Startの状態通知とStreamMonitor.Gapsを渡す 使わないほうはnilでよい
+// ctxが終了したらctxのエラー、両方のチャネルが閉じられたらnil、Reconcileが失敗したらそのエラーを返す
+func (t *OrderTracker) Watch(ctx context.Context, statuses <-chan StreamStatus, gaps <-chan StreamGap) error {
+	for statuses != nil || gaps != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case status, ok := <-statuses:
+			if !ok {
+				statuses = nil
+				continue
+			}
+			// 初回の接続では取りこぼしはない
+			if status.Type != StreamStatusTypeConnecting || status.Attempt == 0 {
+				continue
+			}
+		case _, ok := <-gaps:
+			if !ok {
+				gaps = nil
+				continue
+			}
+		}
+		if err := t.Reconcile(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait - 注文がpredicateを満たすまで待つ 追跡していない注文は、追跡されて満たすまで待つ
+// ctxが終了したら、その時点の注文とctxのエラーを返す
+func (t *OrderTracker) Wait(ctx context.Context, orderNumber string, predicate func(order TrackedOrder) bool) (TrackedOrder, error) {
+	for {
+		t.mtx.Lock()
+		var order TrackedOrder
+		o, ok := t.orders[orderNumber]
+		if ok {
+			order = *o
+		}
+		changed := t.changed
+		t.mtx.Unlock()
+
+		if ok && predicate(order) {
+			return order, nil
+		}
+		select {
+		case <-ctx.Done():
+			return order, ctx.Err()
+		case <-changed:
+		}
+	}
+}
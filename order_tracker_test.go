@@ -0,0 +1,273 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestOrderTracker - 時計を固定したトラッカー
+func newTestOrderTracker(client Client) *OrderTracker {
+	t := NewOrderTracker(client, &Session{})
+	t.clock = &testClock{Now1: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}
+	return t
+}
+
+func Test_streamOrderState(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  ContractStreamResponse
+		want OrderState
+	}{
+		{name: "注文受付は受付済", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceiveOrder, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusInOrder}, want: OrderStateOpen},
+		{name: "受付未済", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceived, StreamOrderStatus: StreamOrderStatusNew}, want: OrderStatePending},
+		{name: "注文受付エラー", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceiveError}, want: OrderStateRejected},
+		{name: "新規登録エラー", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeOrderError}, want: OrderStateRejected},
+		{name: "注文ステータスの受付エラー", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceived, StreamOrderStatus: StreamOrderStatusError}, want: OrderStateRejected},
+		{name: "一部約定", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeContract, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusPart}, want: OrderStatePartFilled},
+		{name: "約定中", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceived, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusInContract}, want: OrderStatePartFilled},
+		{name: "全部約定", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeContract, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusDone}, want: OrderStateFilled},
+		{name: "取消完了", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeCanceled, ContractStatus: ContractStatusPart}, want: OrderStateCanceled},
+		{name: "訂正取消ステータスの取消完了", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceived, StreamOrderStatus: StreamOrderStatusReceived, CancelOrderStatus: CancelOrderStatusCanceled}, want: OrderStateCanceled},
+		{name: "取消中は受付済", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceiveCancel, StreamOrderStatus: StreamOrderStatusReceived, CancelOrderStatus: CancelOrderStatusInCancel, ContractStatus: ContractStatusInOrder}, want: OrderStateOpen},
+		{name: "失効", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeExpire}, want: OrderStateExpired},
+		{name: "失効(連続注文)", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeExpireContinue}, want: OrderStateExpired},
+		{name: "注文ステータスの一部失効", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceived, StreamOrderStatus: StreamOrderStatusPartExpired, ContractStatus: ContractStatusPart}, want: OrderStateExpired},
+		{name: "繰越失効", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeCarryOver, StreamOrderStatus: StreamOrderStatusCarryOverExpired}, want: OrderStateExpired},
+		{name: "取消受付エラーは決められない", arg: ContractStreamResponse{StreamOrderType: StreamOrderTypeReceiveCancelError}, want: OrderStateUnspecified},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := streamOrderState(&test.arg)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_snapshotOrderState(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg1 OrderStatus
+		arg2 float64
+		want OrderState
+	}{
+		{name: "受付未済", arg1: OrderStatusReceived, want: OrderStatePending},
+		{name: "発注待ち", arg1: OrderStatusWait, want: OrderStatePending},
+		{name: "未約定", arg1: OrderStatusInOrder, want: OrderStateOpen},
+		{name: "逆指値発注中", arg1: OrderStatusInOrderStop, want: OrderStateOpen},
+		{name: "約定があれば取消中は一部約定", arg1: OrderStatusInCancel, arg2: 100, want: OrderStatePartFilled},
+		{name: "一部約定", arg1: OrderStatusPart, arg2: 100, want: OrderStatePartFilled},
+		{name: "全部約定", arg1: OrderStatusDone, arg2: 200, want: OrderStateFilled},
+		{name: "取消完了", arg1: OrderStatusCanceled, want: OrderStateCanceled},
+		{name: "一部失効", arg1: OrderStatusPartExpired, arg2: 100, want: OrderStateExpired},
+		{name: "全部失効", arg1: OrderStatusExpired, want: OrderStateExpired},
+		{name: "繰越失効", arg1: OrderStatusCarryOverFailed, want: OrderStateExpired},
+		{name: "受付エラー", arg1: OrderStatusError, want: OrderStateRejected},
+		{name: "切替失敗", arg1: OrderStatusTriggerFailed, want: OrderStateRejected},
+		{name: "未指定", arg1: OrderStatusUnspecified, want: OrderStateUnspecified},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := snapshotOrderState(test.arg1, test.arg2)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_OrderTracker_Apply(t *testing.T) {
+	t.Parallel()
+	received := &ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeReceiveOrder, OrderNumber: "1", IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock,
+		Quantity: 200, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusInOrder}
+	part := &ContractStreamResponse{EventNo: 2, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock,
+		Quantity: 200, ContractQuantity: 100, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusPart}
+	done := &ContractStreamResponse{EventNo: 3, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock,
+		Quantity: 200, ContractQuantity: 200, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusDone}
+	canceled := &ContractStreamResponse{EventNo: 4, StreamOrderType: StreamOrderTypeCanceled, OrderNumber: "1", CancelOrderStatus: CancelOrderStatusCanceled}
+	cancelContract := &ContractStreamResponse{EventNo: 5, StreamOrderType: StreamOrderTypeCancelContract, OrderNumber: "1", IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock,
+		Quantity: 200, ContractQuantity: 100, StreamOrderStatus: StreamOrderStatusReceived, ContractStatus: ContractStatusPart}
+	now := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	order := func(state OrderState, contractQuantity float64, contractStatus ContractStatus, cancelOrderStatus CancelOrderStatus, eventNo int64) TrackedOrder {
+		return TrackedOrder{OrderNumber: "1", IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock, State: state, OrderQuantity: 200,
+			ContractQuantity: contractQuantity, ContractStatus: contractStatus, CancelOrderStatus: cancelOrderStatus, LastEventNo: eventNo, UpdateDateTime: now}
+	}
+	tests := []struct {
+		name string
+		arg  []*ContractStreamResponse
+		want TrackedOrder
+	}{
+		{name: "受付", arg: []*ContractStreamResponse{received}, want: order(OrderStateOpen, 0, ContractStatusInOrder, "", 1)},
+		{name: "一部約定", arg: []*ContractStreamResponse{received, part}, want: order(OrderStatePartFilled, 100, ContractStatusPart, "", 2)},
+		{name: "全部約定", arg: []*ContractStreamResponse{received, part, done}, want: order(OrderStateFilled, 200, ContractStatusDone, "", 3)},
+		{name: "受付より先に約定が届いてもよい", arg: []*ContractStreamResponse{part, done}, want: order(OrderStateFilled, 200, ContractStatusDone, "", 3)},
+		{name: "再送された古いイベントは無視する", arg: []*ContractStreamResponse{received, part, done, part}, want: order(OrderStateFilled, 200, ContractStatusDone, "", 3)},
+		{name: "終わった注文は取消完了でも変わらない", arg: []*ContractStreamResponse{received, done, canceled}, want: order(OrderStateFilled, 200, ContractStatusDone, CancelOrderStatusCanceled, 4)},
+		{name: "約定取消で終わった注文が一部約定に戻る", arg: []*ContractStreamResponse{received, done, cancelContract}, want: order(OrderStatePartFilled, 100, ContractStatusPart, "", 5)},
+		{name: "一部約定のあとの取消", arg: []*ContractStreamResponse{received, part, canceled}, want: order(OrderStateCanceled, 100, ContractStatusPart, CancelOrderStatusCanceled, 4)},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			tracker := newTestOrderTracker(&testClient{})
+			for _, res := range test.arg {
+				tracker.Apply(res)
+			}
+			got, _ := tracker.Order("1")
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_OrderTracker_Reconcile(t *testing.T) {
+	t.Parallel()
+	date := time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local)
+	client := &testClient{
+		orderList1: &OrderListResponse{Orders: []Order{
+			{OrderNumber: "1", IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 200, ContractQuantity: 200, ExecutionDate: date, OrderStatus: OrderStatusDone, ContractStatus: ContractStatusDone},
+			{OrderNumber: "2", IssueCode: "1475", Exchange: ExchangeToushou, Side: SideSell, TradeType: TradeTypeStock, OrderQuantity: 100, ExecutionDate: date, OrderStatus: OrderStatusInOrder, ContractStatus: ContractStatusInOrder},
+		}},
+		orderDetail1: &OrderDetailResponse{OrderNumber: "3", IssueCode: "1476", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, ExecutionDate: date, OrderStatus: OrderStatusExpired},
+	}
+	tracker := newTestOrderTracker(client)
+	tracker.Apply(&ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeReceiveOrder, OrderNumber: "1", Quantity: 200, StreamOrderStatus: StreamOrderStatusReceived})
+	tracker.Track("3", date)
+
+	err := tracker.Reconcile(context.Background())
+	got := map[string]OrderState{}
+	for _, o := range tracker.Orders() {
+		got[o.OrderNumber] = o.State
+	}
+	want := map[string]OrderState{"1": OrderStateFilled, "2": OrderStateOpen, "3": OrderStateExpired}
+	if !reflect.DeepEqual(want, got) || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, nil, got, err)
+	}
+}
+
+func Test_OrderTracker_Reconcile_error(t *testing.T) {
+	t.Parallel()
+	listErr := errors.New("list error")
+	tracker := newTestOrderTracker(&testClient{orderList2: listErr})
+	err := tracker.Reconcile(context.Background())
+	if !errors.Is(err, listErr) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), listErr, err)
+	}
+}
+
+// Test_OrderTracker_Reconcile_notRegress - 注文一覧が古くても、終わった注文を戻さない
+func Test_OrderTracker_Reconcile_notRegress(t *testing.T) {
+	t.Parallel()
+	client := &testClient{orderList1: &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 100, OrderStatus: OrderStatusInOrder}}}}
+	tracker := newTestOrderTracker(client)
+	tracker.Apply(&ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", Quantity: 100, ContractQuantity: 100, ContractStatus: ContractStatusDone})
+
+	_ = tracker.Reconcile(context.Background())
+	got, _ := tracker.Order("1")
+	if got.State != OrderStateFilled {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), OrderStateFilled, got.State)
+	}
+}
+
+func Test_OrderTracker_Wait(t *testing.T) {
+	t.Parallel()
+	tracker := newTestOrderTracker(&testClient{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.Apply(&ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeReceiveOrder, OrderNumber: "1", StreamOrderStatus: StreamOrderStatusReceived})
+		tracker.Apply(&ContractStreamResponse{EventNo: 2, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", ContractQuantity: 100, ContractStatus: ContractStatusDone})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := tracker.Wait(ctx, "1", func(o TrackedOrder) bool { return o.State.Done() })
+	if got.State != OrderStateFilled || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), OrderStateFilled, nil, got.State, err)
+	}
+}
+
+func Test_OrderTracker_Wait_timeout(t *testing.T) {
+	t.Parallel()
+	tracker := newTestOrderTracker(&testClient{})
+	tracker.Track("1", time.Time{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	got, err := tracker.Wait(ctx, "1", func(o TrackedOrder) bool { return o.State.Done() })
+	if got.State != OrderStatePending || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), OrderStatePending, context.DeadlineExceeded, got.State, err)
+	}
+}
+
+func Test_OrderTracker_Changes(t *testing.T) {
+	t.Parallel()
+	tracker := newTestOrderTracker(&testClient{})
+	tracker.Track("1", time.Time{})
+	tracker.Apply(&ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeReceiveOrder, OrderNumber: "1", StreamOrderStatus: StreamOrderStatusReceived})
+
+	var got []OrderState
+	for i := 0; i < 2; i++ {
+		got = append(got, (<-tracker.Changes()).State)
+	}
+	want := []OrderState{OrderStatePending, OrderStateOpen}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+// Test_OrderTracker_Watch - 初回の接続では突き合わせず、再接続と欠番で突き合わせる
+func Test_OrderTracker_Watch(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		statuses []StreamStatus
+		gaps     []StreamGap
+		want     OrderState
+	}{
+		{name: "初回の接続では突き合わせない", statuses: []StreamStatus{{Type: StreamStatusTypeConnecting}}, want: OrderStatePending},
+		{name: "再接続で突き合わせる", statuses: []StreamStatus{{Type: StreamStatusTypeConnecting}, {Type: StreamStatusTypeConnecting, Attempt: 1}}, want: OrderStateFilled},
+		{name: "欠番で突き合わせる", gaps: []StreamGap{{}}, want: OrderStateFilled},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{orderList1: &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 100, ContractQuantity: 100, OrderStatus: OrderStatusDone}}}}
+			tracker := newTestOrderTracker(client)
+			tracker.Track("1", time.Time{})
+
+			statuses := make(chan StreamStatus, len(test.statuses))
+			for _, s := range test.statuses {
+				statuses <- s
+			}
+			close(statuses)
+			gaps := make(chan StreamGap, len(test.gaps))
+			for _, g := range test.gaps {
+				gaps <- g
+			}
+			close(gaps)
+
+			err := tracker.Watch(context.Background(), statuses, gaps)
+			got, _ := tracker.Order("1")
+			if test.want != got.State || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, nil, got.State, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OrderFill - 終わった注文の約定の集計
+type OrderFill struct {
+	OrderNumber           string     // 注文番号
+	ExecutionDate         time.Time  // 営業日
+	State                 OrderState // 終わったときの状態
+	OrderQuantity         float64    // 注文数量
+	Quantity              float64    // 約定数量の合計
+	AveragePrice          float64    // 約定価格の数量加重平均 約定がなければ0
+	Commission            float64    // 手数料
+	CommissionTax         float64    // 消費税
+	FirstContractDateTime time.Time  // 最初の約定日時
+	LastContractDateTime  time.Time  // 最後の約定日時
+	Contracts             []Contract // 約定失効リスト
+}
+
+// WaitForFill - 新規注文を送り、全部約定、取消、失効、受付エラーのいずれかで終わるまで待って約定を集計する
+// 約定通知をApplyに渡していなくても、注文一覧で確認しながら待つ ctxが終了したらctxのエラーを返す
+// 注文が受け付けられなければ、OrderRejectedErrを包んだエラーと受付エラーのOrderFillを返す
+func (t *OrderTracker) WaitForFill(ctx context.Context, req NewOrderRequest) (*OrderFill, error) {
+	res, err := t.client.NewOrder(ctx, t.session, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.ResultCode != "0" {
+		return &OrderFill{State: OrderStateRejected, OrderQuantity: req.OrderQuantity},
+			fmt.Errorf("%s(%s): %w", res.ResultText, res.ResultCode, OrderRejectedErr)
+	}
+
+	t.Track(res.OrderNumber, res.ExecutionDate)
+	return t.waitDone(ctx, res.OrderNumber, res.ExecutionDate)
+}
+
+// WaitForCancel - 取消注文を送り、注文が終わるまで待って約定を集計する 取消までに約定していれば、その約定も集計される
+// 取消が受け付けられなかったとき、注文がすでに終わっていればその集計を、終わっていなければOrderRejectedErrを包んだエラーを返す
+func (t *OrderTracker) WaitForCancel(ctx context.Context, req CancelOrderRequest) (*OrderFill, error) {
+	t.Track(req.OrderNumber, req.ExecutionDate)
+	res, err := t.client.CancelOrder(ctx, t.session, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.ResultCode != "0" {
+		if err := t.Reconcile(ctx); err != nil {
+			return nil, err
+		}
+		if o, ok := t.Order(req.OrderNumber); ok && o.State.Done() {
+			return t.fill(ctx, o)
+		}
+		return nil, fmt.Errorf("%s(%s): %w", res.ResultText, res.ResultCode, OrderRejectedErr)
+	}
+	return t.waitDone(ctx, req.OrderNumber, req.ExecutionDate)
+}
+
+// waitDone - 注文が終わるまで待つ 約定通知が来ないままpollIntervalが過ぎたら注文一覧で確認する
+func (t *OrderTracker) waitDone(ctx context.Context, orderNumber string, executionDate time.Time) (*OrderFill, error) {
+	done := func(o TrackedOrder) bool { return o.State.Done() }
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, t.pollInterval)
+		o, err := t.Wait(pollCtx, orderNumber, done)
+		cancel()
+		if err == nil {
+			if o.ExecutionDate.IsZero() {
+				o.ExecutionDate = executionDate
+			}
+			return t.fill(ctx, o)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		if err := t.Reconcile(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fill - 注文詳細から約定を集計する
+func (t *OrderTracker) fill(ctx context.Context, o TrackedOrder) (*OrderFill, error) {
+	detail, err := t.client.OrderDetail(ctx, t.session, OrderDetailRequest{OrderNumber: o.OrderNumber, ExecutionDate: o.ExecutionDate})
+	if err != nil {
+		return nil, err
+	}
+
+	fill := &OrderFill{
+		OrderNumber:   o.OrderNumber,
+		ExecutionDate: o.ExecutionDate,
+		State:         o.State,
+		OrderQuantity: detail.OrderQuantity,
+		Commission:    detail.Commission,
+		CommissionTax: detail.CommissionTax,
+		Contracts:     detail.Contracts,
+	}
+	if !detail.ExecutionDate.IsZero() {
+		fill.ExecutionDate = detail.ExecutionDate
+	}
+
+	var amount float64
+	for _, c := range detail.Contracts {
+		if c.Quantity <= 0 {
+			continue
+		}
+		fill.Quantity += c.Quantity
+		amount += c.Price * c.Quantity
+		if fill.FirstContractDateTime.IsZero() || c.DateTime.Before(fill.FirstContractDateTime) {
+			fill.FirstContractDateTime = c.DateTime
+		}
+		if c.DateTime.After(fill.LastContractDateTime) {
+			fill.LastContractDateTime = c.DateTime
+		}
+	}
+	if fill.Quantity > 0 {
+		fill.AveragePrice = amount / fill.Quantity
+	}
+	return fill, nil
+}
@@ -0,0 +1,183 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testOrderWaitDetail - 2回に分けて約定した注文詳細
+func testOrderWaitDetail() *OrderDetailResponse {
+	return &OrderDetailResponse{
+		OrderNumber:   "1",
+		ExecutionDate: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local),
+		OrderQuantity: 300,
+		Commission:    100,
+		CommissionTax: 10,
+		Contracts: []Contract{
+			{Quantity: 100, Price: 2000, DateTime: time.Date(2022, 7, 26, 9, 0, 1, 0, time.Local)},
+			{Quantity: 200, Price: 2003, DateTime: time.Date(2022, 7, 26, 9, 5, 0, 0, time.Local)},
+		},
+	}
+}
+
+func Test_OrderTracker_fill(t *testing.T) {
+	t.Parallel()
+	date := time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		detail *OrderDetailResponse
+		order  TrackedOrder
+		want   *OrderFill
+	}{
+		{name: "約定を数量加重平均で集計する", detail: testOrderWaitDetail(), order: TrackedOrder{OrderNumber: "1", State: OrderStateFilled},
+			want: &OrderFill{OrderNumber: "1", ExecutionDate: date, State: OrderStateFilled, OrderQuantity: 300, Quantity: 300, AveragePrice: 2002, Commission: 100, CommissionTax: 10,
+				FirstContractDateTime: time.Date(2022, 7, 26, 9, 0, 1, 0, time.Local), LastContractDateTime: time.Date(2022, 7, 26, 9, 5, 0, 0, time.Local),
+				Contracts: testOrderWaitDetail().Contracts}},
+		{name: "約定がなければ平均価格は0", detail: &OrderDetailResponse{OrderQuantity: 100, Contracts: []Contract{{Quantity: 0}}}, order: TrackedOrder{OrderNumber: "1", ExecutionDate: date, State: OrderStateExpired},
+			want: &OrderFill{OrderNumber: "1", ExecutionDate: date, State: OrderStateExpired, OrderQuantity: 100, Contracts: []Contract{{Quantity: 0}}}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newTestOrderTracker(&testClient{orderDetail1: test.detail}).fill(context.Background(), test.order)
+			if !reflect.DeepEqual(test.want, got) || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, nil, got, err)
+			}
+		})
+	}
+}
+
+// Test_OrderTracker_WaitForFill_stream - 約定通知で全部約定したら返す
+func Test_OrderTracker_WaitForFill_stream(t *testing.T) {
+	t.Parallel()
+	client := &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1"}, orderDetail1: testOrderWaitDetail()}
+	tracker := newTestOrderTracker(client)
+	tracker.pollInterval = time.Hour
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.Apply(&ContractStreamResponse{EventNo: 1, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", Quantity: 300, ContractQuantity: 300, ContractStatus: ContractStatusDone})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := tracker.WaitForFill(ctx, NewOrderRequest{IssueCode: "1475", OrderQuantity: 300})
+	if got == nil || got.State != OrderStateFilled || got.AveragePrice != 2002 || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v\n", t.Name(), OrderStateFilled, 2002, nil, got, err)
+	}
+}
+
+// Test_OrderTracker_WaitForFill_poll - 約定通知がなくても注文一覧で終わったことがわかれば返す
+func Test_OrderTracker_WaitForFill_poll(t *testing.T) {
+	t.Parallel()
+	client := &testClient{
+		newOrder1:    &NewOrderResponse{ResultCode: "0", OrderNumber: "1"},
+		orderList1:   &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 300, ContractQuantity: 300, OrderStatus: OrderStatusDone}}},
+		orderDetail1: testOrderWaitDetail(),
+	}
+	tracker := newTestOrderTracker(client)
+	tracker.pollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := tracker.WaitForFill(ctx, NewOrderRequest{IssueCode: "1475", OrderQuantity: 300})
+	if got == nil || got.State != OrderStateFilled || got.Quantity != 300 || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v\n", t.Name(), OrderStateFilled, 300, nil, got, err)
+	}
+}
+
+func Test_OrderTracker_WaitForFill_error(t *testing.T) {
+	t.Parallel()
+	orderErr := errors.New("order error")
+	tests := []struct {
+		name      string
+		client    *testClient
+		timeout   time.Duration
+		wantState OrderState
+		wantErr   error
+	}{
+		{name: "新規注文のエラーはそのまま返す", client: &testClient{newOrder2: orderErr}, timeout: time.Second, wantErr: orderErr},
+		{name: "受け付けられなければ受付エラー",
+			client:  &testClient{newOrder1: &NewOrderResponse{ResultCode: "11104", ResultText: "error"}},
+			timeout: time.Second, wantState: OrderStateRejected, wantErr: OrderRejectedErr},
+		{name: "終わらないまま期限が来たらctxのエラー",
+			client: &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1"}, orderList1: &OrderListResponse{},
+				orderDetail1: &OrderDetailResponse{OrderNumber: "1", OrderQuantity: 100, OrderStatus: OrderStatusInOrder}},
+			timeout: 50 * time.Millisecond, wantErr: context.DeadlineExceeded},
+		{name: "注文一覧のエラーはそのまま返す",
+			client:  &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1"}, orderList2: orderErr},
+			timeout: time.Second, wantErr: orderErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			tracker := newTestOrderTracker(test.client)
+			tracker.pollInterval = 10 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+			defer cancel()
+
+			got, err := tracker.WaitForFill(ctx, NewOrderRequest{IssueCode: "1475", OrderQuantity: 100})
+			var gotState OrderState
+			if got != nil {
+				gotState = got.State
+			}
+			if test.wantState != gotState || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.wantState, test.wantErr, gotState, err)
+			}
+		})
+	}
+}
+
+func Test_OrderTracker_WaitForCancel(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		client    *testClient
+		wantState OrderState
+		wantErr   error
+	}{
+		{name: "取消されたら返す",
+			client: &testClient{
+				cancelOrder1: &CancelOrderResponse{ResultCode: "0", OrderNumber: "1"},
+				orderList1:   &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 300, OrderStatus: OrderStatusCanceled}}},
+				orderDetail1: &OrderDetailResponse{OrderQuantity: 300}},
+			wantState: OrderStateCanceled},
+		{name: "取消が受け付けられなくても、全部約定していれば約定を返す",
+			client: &testClient{
+				cancelOrder1: &CancelOrderResponse{ResultCode: "11109"},
+				orderList1:   &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 300, ContractQuantity: 300, OrderStatus: OrderStatusDone}}},
+				orderDetail1: testOrderWaitDetail()},
+			wantState: OrderStateFilled},
+		{name: "取消が受け付けられず、終わってもいなければエラー",
+			client: &testClient{
+				cancelOrder1: &CancelOrderResponse{ResultCode: "11109"},
+				orderList1:   &OrderListResponse{Orders: []Order{{OrderNumber: "1", OrderQuantity: 300, OrderStatus: OrderStatusInOrder}}}},
+			wantErr: OrderRejectedErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			tracker := newTestOrderTracker(test.client)
+			tracker.pollInterval = 10 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			got, err := tracker.WaitForCancel(ctx, CancelOrderRequest{OrderNumber: "1"})
+			var gotState OrderState
+			if got != nil {
+				gotState = got.State
+			}
+			if test.wantState != gotState || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.wantState, test.wantErr, gotState, err)
+			}
+		})
+	}
+}
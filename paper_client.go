@@ -0,0 +1,1446 @@
+package tachibana
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const paperProvider = "PAPER" // 模擬売買で作った約定通知のプロバイダ
+
+// PaperClientConfig - 模擬売買の設定
+type PaperClientConfig struct {
+	StockWallet   float64   // 現物買付可能額の初期値
+	MarginWallet  float64   // 信用新規建可能額の初期値 建玉と新規建の注文中の代金を差し引いて返す
+	ExecutionDate time.Time // 営業日 ゼロなら注文した日
+
+	// TickSize - 銘柄の値段の呼値の単位 TickService.PaperTickSizeを渡せる nilなら値段が呼値の単位に合っているかを確認しない
+	TickSize func(issueCode string, exchange Exchange, price float64) float64
+}
+
+// NewPaperClient - 模擬売買のクライアントを生成する
+// clientがnilなら、時価やマスタ、イベントストリームはClientUnavailableErrを返す
+func NewPaperClient(client Client, config PaperClientConfig) *PaperClient {
+	if client == nil {
+		client = unavailableClient{}
+	}
+	return &PaperClient{
+		Client:      client,
+		clock:       newClock(),
+		config:      config,
+		cash:        config.StockWallet,
+		orders:      map[string]*paperOrder{},
+		boards:      map[string]MarketPriceStreamResponse{},
+		subscribers: map[*paperSubscriber]struct{}{},
+	}
+}
+
+// PaperClient - 注文を取引所に送らず、時価情報の板に対して約定させる模擬売買のクライアント
+// 時価やマスタ、イベントストリームは元のクライアントに任せ、注文と余力、建玉、注文一覧はクライアントの中で管理する
+// 板はStreamで受信した時価情報か、UpdateBoardで渡されたものを使う
+// 約定は受信した板の気配値と数量で判定し、約定しても板の数量は減らさない 寄付や引けなどの執行条件は区別しない
+// 手数料と金利はかからないものとする
+// 約定はTradesで、現金と保有、建玉を合わせた評価額はEquityで確認できる
+type PaperClient struct {
+	Client
+	clock           iClock
+	config          PaperClientConfig
+	cash            float64                              // 現金 現物の売買と信用の返済損益で増減する
+	orders          map[string]*paperOrder               // 注文番号ごとの注文
+	orderNumbers    []string                             // 注文した順の注文番号
+	stockPositions  []*paperStockPosition                // 現物の保有
+	marginPositions []*paperMarginPosition               // 信用建玉
+	boards          map[string]MarketPriceStreamResponse // 銘柄ごとの最新の板
+	orderSeq        int
+	positionSeq     int
+	eventNo         int64
+	trades          []PaperTrade // 約定した順の約定
+	auctions        bool         // 板寄せを模擬し、寄付と引けの注文をザラバで約定させない バックテストで使う
+	subscribers     map[*paperSubscriber]struct{}
+	mtx             sync.Mutex
+}
+
+// paperOrder - 模擬売買の注文
+type paperOrder struct {
+	Order
+	reservePrice      float64           // 余力の計算に使う単価
+	triggered         bool              // 逆指値の条件を満たした
+	cancelOrderStatus CancelOrderStatus // 訂正取消ステータス
+	contracts         []Contract        // 約定
+	stockPosition     *paperStockPosition
+	marginPosition    *paperMarginPosition // 新規建で作った建玉
+	allocations       []*paperAllocation   // 返済する建玉
+}
+
+// PaperTrade - 模擬売買の約定
+type PaperTrade struct {
+	DateTime    time.Time // 約定日時
+	OrderNumber string    // 注文番号
+	IssueCode   string    // 銘柄コード
+	Side        Side      // 売買区分
+	TradeType   TradeType // 現金信用区分
+	Price       float64   // 約定値段
+	Quantity    float64   // 約定数量
+	Exit        bool      // 現物の売りか信用返済で、保有や建玉を減らした
+	Profit      float64   // Exitなら実現損益
+}
+
+// paperAllocation - 返済注文に割り当てた建玉と数量
+type paperAllocation struct {
+	position *paperMarginPosition
+	quantity float64
+}
+
+// open - 約定か取消を待っている
+func (o *paperOrder) open() bool {
+	return o.CurrentQuantity > 0
+}
+
+// trigger - 逆指値の条件を現在値で判定する 発火していない逆指値ならfalse
+// OCOは発火していなくても通常の指値として約定できるのでtrue
+func (o *paperOrder) trigger(currentPrice float64) bool {
+	if (o.StopOrderType != StopOrderTypeStop && o.StopOrderType != StopOrderTypeOCO) || o.triggered {
+		return true
+	}
+	if currentPrice > 0 && ((o.Side == SideBuy && currentPrice >= o.StopTriggerPrice) || (o.Side == SideSell && currentPrice <= o.StopTriggerPrice)) {
+		o.triggered = true
+		o.TriggerType = TriggerTypeAuto
+		o.OrderStatus = OrderStatusTriggered
+		o.ExecutionType = o.StopOrderExecutionType
+		return true
+	}
+	return o.StopOrderType == StopOrderTypeOCO
+}
+
+// price - 今の注文値段 0なら成行
+func (o *paperOrder) price() float64 {
+	if o.triggered {
+		return o.StopOrderPrice
+	}
+	return o.Price
+}
+
+// paperStockPosition - 現物の保有
+type paperStockPosition struct {
+	issueCode   string
+	accountType AccountType
+	quantity    float64 // 残高株数
+	hold        float64 // 売注文中の株数
+	cost        float64 // 簿価単価
+}
+
+// paperMarginPosition - 信用建玉
+type paperMarginPosition struct {
+	number       string
+	issueCode    string
+	exchange     Exchange
+	side         Side
+	tradeType    TradeType // 新規の現金信用区分
+	accountType  AccountType
+	quantity     float64 // 建株数
+	owned        float64 // 残っている建玉数量
+	hold         float64 // 返済注文中の数量
+	price        float64 // 建単価
+	contractDate time.Time
+}
+
+// paperSubscriber - 約定通知を受け取るStream
+type paperSubscriber struct {
+	queue  []StreamResponse
+	notify chan struct{}
+	mtx    sync.Mutex
+}
+
+func (s *paperSubscriber) push(events []StreamResponse) {
+	s.mtx.Lock()
+	s.queue = append(s.queue, events...)
+	s.mtx.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *paperSubscriber) take() []StreamResponse {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	events := s.queue
+	s.queue = nil
+	return events
+}
+
+// isMarginEntry - 信用新規か
+func isMarginEntry(tradeType TradeType) bool {
+	return tradeType == TradeTypeStandardEntry || tradeType == TradeTypeNegotiateEntry
+}
+
+// isMarginExit - 信用返済か
+func isMarginExit(tradeType TradeType) bool {
+	return tradeType == TradeTypeStandardExit || tradeType == TradeTypeNegotiateExit
+}
+
+// marginEntryTradeType - 返済の現金信用区分に対応する新規の現金信用区分
+func marginEntryTradeType(tradeType TradeType) TradeType {
+	if tradeType == TradeTypeNegotiateExit {
+		return TradeTypeNegotiateEntry
+	}
+	return TradeTypeStandardEntry
+}
+
+// oppositeSide - 反対の売買区分
+func oppositeSide(side Side) Side {
+	if side == SideBuy {
+		return SideSell
+	}
+	return SideBuy
+}
+
+// paperReject - 注文を受け付けなかったエラー
+func paperReject(format string, a ...interface{}) error {
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, a...), PaperOrderRejectedErr)
+}
+
+// checkTick - 値段が呼値の単位に合っているか 0とNoChangeFloatは確認しない
+func (p *PaperClient) checkTick(issueCode string, exchange Exchange, prices ...float64) error {
+	if p.config.TickSize == nil {
+		return nil
+	}
+	for _, price := range prices {
+		if price <= 0 || price == NoChangeFloat {
+			continue
+		}
+		tick := p.config.TickSize(issueCode, exchange, price)
+		if tick <= 0 {
+			continue
+		}
+		if n := price / tick; math.Abs(n-math.Round(n)) > 1e-9 {
+			return paperReject("price %v of %s is not a multiple of tick size %v", price, issueCode, tick)
+		}
+	}
+	return nil
+}
+
+// commonResponse - 模擬売買のレスポンスの共通項目
+func (p *PaperClient) commonResponse(messageType MessageType) CommonResponse {
+	now := p.clock.Now()
+	return CommonResponse{SendDate: now, ReceiveDate: now, ErrorNo: ErrorNoProblem, MessageType: messageType}
+}
+
+// executionDate - 営業日
+func (p *PaperClient) executionDate() time.Time {
+	if !p.config.ExecutionDate.IsZero() {
+		return p.config.ExecutionDate
+	}
+	now := p.clock.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// bestPrice - 板の最良気配 買いなら売気配、売りなら買気配 なければ現在値
+func (p *PaperClient) bestPrice(issueCode string, side Side) float64 {
+	board, ok := p.boards[issueCode]
+	if !ok {
+		return 0
+	}
+	levels := paperBoardLevels(board, side)
+	if len(levels) > 0 {
+		return levels[0].price
+	}
+	return board.CurrentPrice
+}
+
+// paperLevel - 板の1段
+type paperLevel struct {
+	price    float64
+	quantity float64
+}
+
+// paperBoardLevels - 約定の相手になる気配を良い順に並べる 買いなら売気配、売りなら買気配
+// 値段か数量のない気配は約定の相手にならないので除く
+func paperBoardLevels(board MarketPriceStreamResponse, side Side) []paperLevel {
+	var levels []paperLevel
+	if side == SideBuy {
+		levels = []paperLevel{
+			{board.AskPrice1, board.AskQuantity1}, {board.AskPrice2, board.AskQuantity2}, {board.AskPrice3, board.AskQuantity3},
+			{board.AskPrice4, board.AskQuantity4}, {board.AskPrice5, board.AskQuantity5}, {board.AskPrice6, board.AskQuantity6},
+			{board.AskPrice7, board.AskQuantity7}, {board.AskPrice8, board.AskQuantity8}, {board.AskPrice9, board.AskQuantity9},
+			{board.AskPrice10, board.AskQuantity10},
+		}
+	} else {
+		levels = []paperLevel{
+			{board.BidPrice1, board.BidQuantity1}, {board.BidPrice2, board.BidQuantity2}, {board.BidPrice3, board.BidQuantity3},
+			{board.BidPrice4, board.BidQuantity4}, {board.BidPrice5, board.BidQuantity5}, {board.BidPrice6, board.BidQuantity6},
+			{board.BidPrice7, board.BidQuantity7}, {board.BidPrice8, board.BidQuantity8}, {board.BidPrice9, board.BidQuantity9},
+			{board.BidPrice10, board.BidQuantity10},
+		}
+	}
+
+	res := make([]paperLevel, 0, len(levels))
+	for _, l := range levels {
+		if l.price > 0 && l.quantity > 0 {
+			res = append(res, l)
+		}
+	}
+	if len(res) == 0 {
+		// 10本気配がなければ最良気配だけを使う
+		if side == SideBuy && board.AskPrice > 0 && board.AskQuantity > 0 {
+			res = append(res, paperLevel{board.AskPrice, board.AskQuantity})
+		}
+		if side == SideSell && board.BidPrice > 0 && board.BidQuantity > 0 {
+			res = append(res, paperLevel{board.BidPrice, board.BidQuantity})
+		}
+	}
+	return res
+}
+
+// stockWallet - 現物買付可能額 現金から買注文中の代金を差し引く
+func (p *PaperClient) stockWallet() float64 {
+	wallet := p.cash
+	for _, o := range p.orders {
+		if o.open() && o.TradeType == TradeTypeStock && o.Side == SideBuy {
+			wallet -= o.CurrentQuantity * o.reservePrice
+		}
+	}
+	return wallet
+}
+
+// marginWallet - 信用新規建可能額 建玉と新規建の注文中の代金を差し引く
+func (p *PaperClient) marginWallet() float64 {
+	wallet := p.config.MarginWallet
+	for _, pos := range p.marginPositions {
+		wallet -= pos.owned * pos.price
+	}
+	for _, o := range p.orders {
+		if o.open() && isMarginEntry(o.TradeType) {
+			wallet -= o.CurrentQuantity * o.reservePrice
+		}
+	}
+	return wallet
+}
+
+// affordable - 買いと信用新規の約定代金が余力に収まるか 注文自身が差し引いている代金は余力に戻して比べる
+// 板がないときの成行は代金を差し引けないので、約定するときに確かめる
+func (p *PaperClient) affordable(o *paperOrder, price float64, quantity float64) bool {
+	reserved := o.CurrentQuantity * o.reservePrice
+	switch {
+	case o.TradeType == TradeTypeStock && o.Side == SideBuy:
+		return price*quantity <= p.stockWallet()+reserved
+	case isMarginEntry(o.TradeType):
+		return price*quantity <= p.marginWallet()+reserved
+	}
+	return true
+}
+
+// findStockPosition - 現物の保有 なければnil
+func (p *PaperClient) findStockPosition(issueCode string, accountType AccountType) *paperStockPosition {
+	for _, pos := range p.stockPositions {
+		if pos.issueCode == issueCode && pos.accountType == accountType {
+			return pos
+		}
+	}
+	return nil
+}
+
+// stockPosition - 現物の保有 なければ作る
+func (p *PaperClient) stockPosition(issueCode string, accountType AccountType) *paperStockPosition {
+	if pos := p.findStockPosition(issueCode, accountType); pos != nil {
+		return pos
+	}
+	pos := &paperStockPosition{issueCode: issueCode, accountType: accountType}
+	p.stockPositions = append(p.stockPositions, pos)
+	return pos
+}
+
+// allocate - 返済注文に建玉を割り当てる
+func (p *PaperClient) allocate(req NewOrderRequest) ([]*paperAllocation, error) {
+	side := oppositeSide(req.Side)
+	entryTradeType := marginEntryTradeType(req.TradeType)
+	returnable := func(pos *paperMarginPosition) float64 {
+		if pos.issueCode != req.IssueCode || pos.side != side || pos.tradeType != entryTradeType {
+			return 0
+		}
+		return pos.owned - pos.hold
+	}
+
+	var allocations []*paperAllocation
+	if len(req.ExitPositions) > 0 {
+		for _, e := range req.ExitPositions {
+			var found *paperMarginPosition
+			for _, pos := range p.marginPositions {
+				if pos.number == e.PositionNumber {
+					found = pos
+				}
+			}
+			if found == nil || returnable(found) < e.OrderQuantity {
+				return nil, paperReject("position %s does not have %v returnable", e.PositionNumber, e.OrderQuantity)
+			}
+			allocations = append(allocations, &paperAllocation{position: found, quantity: e.OrderQuantity})
+		}
+	} else {
+		// 建日順
+		remain := req.OrderQuantity
+		for _, pos := range p.marginPositions {
+			q := math.Min(remain, returnable(pos))
+			if q <= 0 {
+				continue
+			}
+			allocations = append(allocations, &paperAllocation{position: pos, quantity: q})
+			remain -= q
+		}
+		if remain > 0 {
+			return nil, paperReject("returnable quantity of %s is not enough", req.IssueCode)
+		}
+	}
+
+	var total float64
+	for _, a := range allocations {
+		total += a.quantity
+	}
+	if total != req.OrderQuantity {
+		return nil, paperReject("exit positions quantity %v does not match order quantity %v", total, req.OrderQuantity)
+	}
+	for _, a := range allocations {
+		a.position.hold += a.quantity
+	}
+	return allocations, nil
+}
+
+// NewOrder - 新規注文 取引所には送らず、板と照らし合わせて約定させる
+func (p *PaperClient) NewOrder(_ context.Context, session *Session, req NewOrderRequest) (*NewOrderResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+	if req.IssueCode == "" || req.OrderQuantity <= 0 || (req.Side != SideBuy && req.Side != SideSell) {
+		return nil, paperReject("invalid order: issue=%s, side=%s, quantity=%v", req.IssueCode, req.Side, req.OrderQuantity)
+	}
+	if req.TradeType != TradeTypeStock && !isMarginEntry(req.TradeType) && !isMarginExit(req.TradeType) {
+		return nil, paperReject("invalid trade type: %s", req.TradeType)
+	}
+	if err := p.checkTick(req.IssueCode, req.Exchange, req.OrderPrice, req.TriggerPrice, req.StopOrderPrice); err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	reservePrice := req.OrderPrice
+	switch {
+	case req.StopOrderType == StopOrderTypeStop && req.StopOrderPrice > 0:
+		reservePrice = req.StopOrderPrice
+	case req.StopOrderType == StopOrderTypeStop:
+		reservePrice = req.TriggerPrice
+	case reservePrice == 0:
+		reservePrice = p.bestPrice(req.IssueCode, req.Side)
+	}
+	amount := reservePrice * req.OrderQuantity
+
+	o := &paperOrder{reservePrice: reservePrice, cancelOrderStatus: CancelOrderStatusNoCorrect}
+	switch {
+	case req.TradeType == TradeTypeStock && req.Side == SideBuy:
+		if wallet := p.stockWallet(); amount > wallet {
+			return nil, paperReject("stock wallet %v is less than %v", wallet, amount)
+		}
+	case req.TradeType == TradeTypeStock && req.Side == SideSell:
+		pos := p.findStockPosition(req.IssueCode, req.AccountType)
+		if pos == nil || pos.quantity-pos.hold < req.OrderQuantity {
+			return nil, paperReject("sellable quantity of %s is less than %v", req.IssueCode, req.OrderQuantity)
+		}
+		pos.hold += req.OrderQuantity
+		o.stockPosition = pos
+	case isMarginEntry(req.TradeType):
+		if wallet := p.marginWallet(); amount > wallet {
+			return nil, paperReject("margin wallet %v is less than %v", wallet, amount)
+		}
+	case isMarginExit(req.TradeType):
+		allocations, err := p.allocate(req)
+		if err != nil {
+			return nil, err
+		}
+		o.allocations = allocations
+	}
+
+	p.orderSeq++
+	now := p.clock.Now()
+	executionDate := p.executionDate()
+	expireDate := req.ExpireDate
+	if req.ExpireDateIsToday || expireDate.IsZero() {
+		expireDate = executionDate
+	}
+	executionType := ExecutionTypeLimit
+	if req.OrderPrice == 0 {
+		executionType = ExecutionTypeMarket
+	}
+	stopOrderExecutionType := ExecutionTypeUnused
+	triggerType := TriggerTypeUnspecified
+	if req.StopOrderType == StopOrderTypeStop || req.StopOrderType == StopOrderTypeOCO {
+		stopOrderExecutionType = ExecutionTypeLimit
+		if req.StopOrderPrice == 0 {
+			stopOrderExecutionType = ExecutionTypeMarket
+		}
+		triggerType = TriggerTypeNoFired
+	}
+	o.Order = Order{
+		OrderNumber:            strconv.Itoa(p.orderSeq),
+		IssueCode:              req.IssueCode,
+		Exchange:               req.Exchange,
+		AccountType:            req.AccountType,
+		TradeType:              req.TradeType,
+		Side:                   req.Side,
+		OrderQuantity:          req.OrderQuantity,
+		CurrentQuantity:        req.OrderQuantity,
+		Price:                  req.OrderPrice,
+		ExecutionTiming:        req.ExecutionTiming,
+		ExecutionType:          executionType,
+		StopOrderType:          req.StopOrderType,
+		StopTriggerPrice:       req.TriggerPrice,
+		StopOrderExecutionType: stopOrderExecutionType,
+		StopOrderPrice:         req.StopOrderPrice,
+		TriggerType:            triggerType,
+		ExitPositionType:       req.ExitPositionType,
+		ExecutionDate:          executionDate,
+		OrderStatus:            OrderStatusInOrder,
+		ContractStatus:         ContractStatusInOrder,
+		OrderDateTime:          now,
+		ExpireDate:             expireDate,
+		CorrectCancelType:      CorrectCancelTypeCorrectable,
+		EstimationAmount:       amount,
+	}
+	if req.StopOrderType == StopOrderTypeStop {
+		o.OrderStatus = OrderStatusInOrderStop
+	}
+	p.orders[o.OrderNumber] = o
+	p.orderNumbers = append(p.orderNumbers, o.OrderNumber)
+
+	events := []StreamResponse{p.contractEvent(o, StreamOrderTypeReceiveOrder, 0, 0)}
+	if board, ok := p.boards[o.IssueCode]; ok {
+		events = append(events, p.match(o, board)...)
+	}
+	p.publish(events)
+
+	return &NewOrderResponse{
+		CommonResponse: p.commonResponse(MessageTypeNewOrder),
+		ResultCode:     "0",
+		OrderNumber:    o.OrderNumber,
+		ExecutionDate:  executionDate,
+		DeliveryAmount: amount,
+		OrderDateTime:  now,
+	}, nil
+}
+
+// CorrectOrder - 訂正注文
+func (p *PaperClient) CorrectOrder(_ context.Context, session *Session, req CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	o, ok := p.orders[req.OrderNumber]
+	if !ok || !o.open() {
+		return nil, paperReject("order %s is not correctable", req.OrderNumber)
+	}
+	if err := p.checkTick(o.IssueCode, o.Exchange, req.OrderPrice, req.TriggerPrice, req.StopOrderPrice); err != nil {
+		return nil, err
+	}
+	if req.OrderQuantity != NoChangeFloat && req.OrderQuantity != 0 && req.OrderQuantity <= o.ContractQuantity {
+		return nil, paperReject("order quantity %v must be greater than contract quantity %v", req.OrderQuantity, o.ContractQuantity)
+	}
+	if req.OrderQuantity != NoChangeFloat && req.OrderQuantity != 0 && (o.stockPosition != nil || len(o.allocations) > 0) && req.OrderQuantity > o.OrderQuantity {
+		return nil, paperReject("order quantity of sell or exit order cannot be increased")
+	}
+
+	if req.OrderPrice != NoChangeFloat {
+		o.Price = req.OrderPrice
+		o.ExecutionType = ExecutionTypeLimit
+		if o.Price == 0 {
+			o.ExecutionType = ExecutionTypeMarket
+		}
+		if !o.triggered && o.Price > 0 {
+			o.reservePrice = o.Price
+		}
+	}
+	if req.OrderQuantity != NoChangeFloat && req.OrderQuantity != 0 {
+		decreased := o.OrderQuantity - req.OrderQuantity
+		o.OrderQuantity = req.OrderQuantity
+		o.CurrentQuantity = req.OrderQuantity - o.ContractQuantity
+		p.release(o, decreased)
+	}
+	if req.TriggerPrice != NoChangeFloat {
+		o.StopTriggerPrice = req.TriggerPrice
+	}
+	if req.StopOrderPrice != NoChangeFloat {
+		o.StopOrderPrice = req.StopOrderPrice
+	}
+	if req.ExecutionTiming != ExecutionTimingUnspecified && req.ExecutionTiming != ExecutionTimingNoChange {
+		o.ExecutionTiming = req.ExecutionTiming
+	}
+	if !req.ExpireDateNoChange {
+		o.ExpireDate = req.ExpireDate
+		if req.ExpireDateIsToday || req.ExpireDate.IsZero() {
+			o.ExpireDate = o.ExecutionDate
+		}
+	}
+	o.OrderStatus = OrderStatusCorrected
+	o.cancelOrderStatus = CancelOrderStatusCorrected
+
+	events := []StreamResponse{p.contractEvent(o, StreamOrderTypeCorrected, 0, 0)}
+	if board, ok := p.boards[o.IssueCode]; ok {
+		events = append(events, p.match(o, board)...)
+	}
+	p.publish(events)
+
+	return &CorrectOrderResponse{
+		CommonResponse: p.commonResponse(MessageTypeCorrectOrder),
+		ResultCode:     "0",
+		OrderNumber:    o.OrderNumber,
+		ExecutionDate:  o.ExecutionDate,
+		DeliveryAmount: o.CurrentQuantity * o.reservePrice,
+		OrderDateTime:  p.clock.Now(),
+	}, nil
+}
+
+// CancelOrder - 取消注文
+func (p *PaperClient) CancelOrder(_ context.Context, session *Session, req CancelOrderRequest) (*CancelOrderResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	o, ok := p.orders[req.OrderNumber]
+	if !ok || !o.open() {
+		return nil, paperReject("order %s is not cancelable", req.OrderNumber)
+	}
+
+	canceled := o.CurrentQuantity
+	p.release(o, canceled)
+	o.CurrentQuantity = 0
+	o.OrderStatus = OrderStatusCanceled
+	o.cancelOrderStatus = CancelOrderStatusCanceled
+	o.CorrectCancelType = CorrectCancelTypeInvalid
+	event := p.contractEvent(o, StreamOrderTypeCanceled, 0, 0)
+	event.CancelQuantity = canceled
+	p.publish([]StreamResponse{event})
+
+	return &CancelOrderResponse{
+		CommonResponse: p.commonResponse(MessageTypeCancelOrder),
+		ResultCode:     "0",
+		OrderNumber:    o.OrderNumber,
+		ExecutionDate:  o.ExecutionDate,
+		OrderDateTime:  p.clock.Now(),
+	}, nil
+}
+
+// release - 注文数量が減った分の売注文中、返済注文中の数量を戻す
+func (p *PaperClient) release(o *paperOrder, quantity float64) {
+	if o.stockPosition != nil {
+		o.stockPosition.hold -= quantity
+	}
+	for i := len(o.allocations) - 1; i >= 0 && quantity > 0; i-- {
+		a := o.allocations[i]
+		q := math.Min(quantity, a.quantity)
+		a.quantity -= q
+		a.position.hold -= q
+		quantity -= q
+	}
+}
+
+// UpdateBoard - 銘柄の板を更新し、その銘柄の注文を約定させる
+// boardは差分ではなく、BoardStateなどで組み立てた最新の状態を渡す
+func (p *PaperClient) UpdateBoard(issueCode string, board MarketPriceStreamResponse) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.boards[issueCode] = board
+	var events []StreamResponse
+	for _, number := range p.orderNumbers {
+		if o := p.orders[number]; o.IssueCode == issueCode && o.open() {
+			events = append(events, p.match(o, board)...)
+		}
+	}
+	p.publish(events)
+}
+
+// match - 注文を板と照らし合わせて約定させ、約定通知を返す 約定代金が余力に収まらなければ残りを失効させる
+func (p *PaperClient) match(o *paperOrder, board MarketPriceStreamResponse) []StreamResponse {
+	if !o.open() {
+		return nil
+	}
+	if p.auctions && (o.ExecutionTiming == ExecutionTimingOpening || o.ExecutionTiming == ExecutionTimingClosing) {
+		return nil
+	}
+
+	// 逆指値は現在値が条件に達したら発火する
+	if !o.trigger(board.CurrentPrice) {
+		return nil
+	}
+
+	limit := o.price()
+	var events []StreamResponse
+	for _, level := range paperBoardLevels(board, o.Side) {
+		if !o.open() {
+			break
+		}
+		if limit > 0 && ((o.Side == SideBuy && level.price > limit) || (o.Side == SideSell && level.price < limit)) {
+			break
+		}
+		quantity := math.Min(o.CurrentQuantity, level.quantity)
+		if !p.affordable(o, level.price, quantity) {
+			events = append(events, p.expire(o))
+			break
+		}
+		events = append(events, p.fill(o, level.price, quantity))
+	}
+	return events
+}
+
+// fill - 約定を注文と余力、保有に反映し、約定通知を返す
+func (p *PaperClient) fill(o *paperOrder, price float64, quantity float64) *ContractStreamResponse {
+	now := p.clock.Now()
+	o.ContractPrice = (o.ContractPrice*o.ContractQuantity + price*quantity) / (o.ContractQuantity + quantity)
+	o.ContractQuantity += quantity
+	o.CurrentQuantity -= quantity
+	o.contracts = append(o.contracts, Contract{Quantity: quantity, Price: price, DateTime: now})
+	o.OrderStatus = OrderStatusPart
+	o.ContractStatus = ContractStatusPart
+	if !o.open() {
+		o.OrderStatus = OrderStatusDone
+		o.ContractStatus = ContractStatusDone
+		o.CorrectCancelType = CorrectCancelTypeInvalid
+	}
+	trade := PaperTrade{DateTime: now, OrderNumber: o.OrderNumber, IssueCode: o.IssueCode, Side: o.Side, TradeType: o.TradeType, Price: price, Quantity: quantity}
+
+	switch {
+	case o.TradeType == TradeTypeStock && o.Side == SideBuy:
+		p.cash -= price * quantity
+		pos := p.stockPosition(o.IssueCode, o.AccountType)
+		pos.cost = (pos.cost*pos.quantity + price*quantity) / (pos.quantity + quantity)
+		pos.quantity += quantity
+	case o.TradeType == TradeTypeStock && o.Side == SideSell:
+		p.cash += price * quantity
+		trade.Exit = true
+		trade.Profit = (price - o.stockPosition.cost) * quantity
+		o.stockPosition.quantity -= quantity
+		o.stockPosition.hold -= quantity
+	case isMarginEntry(o.TradeType):
+		if o.marginPosition == nil {
+			p.positionSeq++
+			o.marginPosition = &paperMarginPosition{
+				number:       strconv.Itoa(p.positionSeq),
+				issueCode:    o.IssueCode,
+				exchange:     o.Exchange,
+				side:         o.Side,
+				tradeType:    o.TradeType,
+				accountType:  o.AccountType,
+				contractDate: o.ExecutionDate,
+			}
+			p.marginPositions = append(p.marginPositions, o.marginPosition)
+		}
+		pos := o.marginPosition
+		pos.price = (pos.price*pos.quantity + price*quantity) / (pos.quantity + quantity)
+		pos.quantity += quantity
+		pos.owned += quantity
+	case isMarginExit(o.TradeType):
+		remain := quantity
+		for _, a := range o.allocations {
+			q := math.Min(remain, a.quantity)
+			if q <= 0 {
+				continue
+			}
+			a.quantity -= q
+			a.position.hold -= q
+			a.position.owned -= q
+			profit := (price - a.position.price) * q
+			if a.position.side == SideSell {
+				profit = -profit
+			}
+			p.cash += profit
+			trade.Exit = true
+			trade.Profit += profit
+			remain -= q
+		}
+		p.removeClosedPositions()
+	}
+	p.trades = append(p.trades, trade)
+
+	return p.contractEvent(o, StreamOrderTypeContract, price, quantity)
+}
+
+// auction - 板寄せで約定させる 寄付では引け以外の注文を、引けではすべての注文を、priceで残りの数量すべて約定させる
+// 引けの板寄せでは不成を成行として扱う 板寄せのあとに残った寄付の注文、引けと不成の注文は失効させる
+// 約定代金が余力に収まらない注文も失効させる
+func (p *PaperClient) auction(issueCode string, price float64, closing bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var events []StreamResponse
+	for _, number := range p.orderNumbers {
+		o := p.orders[number]
+		if o.IssueCode != issueCode || !o.open() || (!closing && o.ExecutionTiming == ExecutionTimingClosing) {
+			continue
+		}
+
+		if price > 0 && o.trigger(price) {
+			limit := o.price()
+			if closing && o.ExecutionTiming == ExecutionTimingFunari {
+				limit = 0
+			}
+			if limit == 0 || (o.Side == SideBuy && price <= limit) || (o.Side == SideSell && price >= limit) {
+				if p.affordable(o, price, o.CurrentQuantity) {
+					events = append(events, p.fill(o, price, o.CurrentQuantity))
+				} else {
+					events = append(events, p.expire(o))
+				}
+			}
+		}
+		if o.open() && (o.ExecutionTiming == ExecutionTimingOpening ||
+			(closing && (o.ExecutionTiming == ExecutionTimingClosing || o.ExecutionTiming == ExecutionTimingFunari))) {
+			events = append(events, p.expire(o))
+		}
+	}
+	p.publish(events)
+}
+
+// expireBefore - 有効期限がdateより前の注文を失効させる
+func (p *PaperClient) expireBefore(date time.Time) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var events []StreamResponse
+	for _, number := range p.orderNumbers {
+		if o := p.orders[number]; o.open() && o.ExpireDate.Before(date) {
+			events = append(events, p.expire(o))
+		}
+	}
+	p.publish(events)
+}
+
+// expire - 注文を失効させ、約定通知を返す
+func (p *PaperClient) expire(o *paperOrder) *ContractStreamResponse {
+	p.release(o, o.CurrentQuantity)
+	o.CurrentQuantity = 0
+	o.OrderStatus = OrderStatusExpired
+	if o.ContractQuantity > 0 {
+		o.OrderStatus = OrderStatusPartExpired
+	}
+	o.CorrectCancelType = CorrectCancelTypeInvalid
+	return p.contractEvent(o, StreamOrderTypeExpire, 0, 0)
+}
+
+// closeBoard - 板の気配を消して現在値だけを残す 次に板を受け取るまで注文を約定させない
+func (p *PaperClient) closeBoard(issueCode string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if board, ok := p.boards[issueCode]; ok {
+		p.boards[issueCode] = MarketPriceStreamResponse{CurrentPrice: board.CurrentPrice}
+	}
+}
+
+// Trades - 約定した順の約定
+func (p *PaperClient) Trades() []PaperTrade {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return append([]PaperTrade{}, p.trades...)
+}
+
+// Equity - 評価額 現金と現物の時価評価額、信用建玉の評価損益の合計
+func (p *PaperClient) Equity() float64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	equity := p.cash
+	for _, pos := range p.stockPositions {
+		equity += p.currentPrice(pos.issueCode, pos.cost) * pos.quantity
+	}
+	for _, pos := range p.marginPositions {
+		profit := (p.currentPrice(pos.issueCode, pos.price) - pos.price) * pos.owned
+		if pos.side == SideSell {
+			profit = -profit
+		}
+		equity += profit
+	}
+	return equity
+}
+
+// removeClosedPositions - すべて返済した建玉を消す
+func (p *PaperClient) removeClosedPositions() {
+	positions := p.marginPositions[:0]
+	for _, pos := range p.marginPositions {
+		if pos.owned > 0 {
+			positions = append(positions, pos)
+		}
+	}
+	p.marginPositions = positions
+}
+
+// contractEvent - 注文の状態から約定通知を作る
+func (p *PaperClient) contractEvent(o *paperOrder, orderType StreamOrderType, price float64, quantity float64) *ContractStreamResponse {
+	p.eventNo++
+	now := p.clock.Now()
+	event := &ContractStreamResponse{
+		CommonStreamResponse:     CommonStreamResponse{EventType: EventTypeContract, StreamDateTime: now, ErrorNo: ErrorNoProblem},
+		Provider:                 paperProvider,
+		EventNo:                  p.eventNo,
+		FirstTime:                true,
+		StreamOrderType:          orderType,
+		OrderNumber:              o.OrderNumber,
+		ExecutionDate:            o.ExecutionDate,
+		ProductType:              ProductTypeStock,
+		IssueCode:                o.IssueCode,
+		Exchange:                 o.Exchange,
+		Side:                     o.Side,
+		TradeType:                o.TradeType,
+		ExecutionTiming:          o.ExecutionTiming,
+		ExecutionType:            o.ExecutionType,
+		Price:                    o.Price,
+		Quantity:                 o.OrderQuantity,
+		ContractQuantity:         o.ContractQuantity,
+		StreamOrderStatus:        StreamOrderStatusReceived,
+		CancelOrderStatus:        o.cancelOrderStatus,
+		ContractStatus:           o.ContractStatus,
+		ExpireDate:               o.ExpireDate,
+		SecurityContractPrice:    price,
+		SecurityContractQuantity: quantity,
+		NotifyDateTime:           now,
+	}
+	if orderType == StreamOrderTypeCorrected {
+		event.CorrectExecutionTiming = o.ExecutionTiming
+		event.CorrectExecutionType = o.ExecutionType
+		event.CorrectPrice = o.Price
+		event.CorrectQuantity = o.OrderQuantity
+		event.CorrectExpireDate = o.ExpireDate
+		event.CorrectStopOrderType = o.StopOrderType
+		event.CorrectTriggerPrice = o.StopTriggerPrice
+		event.CorrectStopOrderPrice = o.StopOrderPrice
+	}
+	return event
+}
+
+// publish - 約定通知をStreamに流す
+func (p *PaperClient) publish(events []StreamResponse) {
+	if len(events) == 0 {
+		return
+	}
+	for s := range p.subscribers {
+		s.push(events)
+	}
+}
+
+// OrderList - 注文一覧
+func (p *PaperClient) OrderList(_ context.Context, session *Session, req OrderListRequest) (*OrderListResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	orders := make([]Order, 0)
+	for _, number := range p.orderNumbers {
+		o := p.orders[number]
+		if req.IssueCode != "" && req.IssueCode != o.IssueCode {
+			continue
+		}
+		if !req.ExecutionDate.IsZero() && !req.ExecutionDate.Equal(o.ExecutionDate) {
+			continue
+		}
+		match := true
+		switch req.OrderInquiryStatus {
+		case OrderInquiryStatusInOrder:
+			match = o.open() && o.ContractQuantity == 0
+		case OrderInquiryStatusDone:
+			match = o.ContractStatus == ContractStatusDone
+		case OrderInquiryStatusPart:
+			match = o.ContractStatus == ContractStatusPart
+		case OrderInquiryStatusEditable, OrderInquiryStatusPartInOrder:
+			match = o.open()
+		}
+		if match {
+			orders = append(orders, o.Order)
+		}
+	}
+
+	return &OrderListResponse{
+		CommonResponse:     p.commonResponse(MessageTypeOrderList),
+		IssueCode:          req.IssueCode,
+		ExecutionDate:      req.ExecutionDate,
+		OrderInquiryStatus: req.OrderInquiryStatus,
+		ResultCode:         "0",
+		Orders:             orders,
+	}, nil
+}
+
+// OrderDetail - 注文一覧(詳細)
+func (p *PaperClient) OrderDetail(_ context.Context, session *Session, req OrderDetailRequest) (*OrderDetailResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	o, ok := p.orders[req.OrderNumber]
+	if !ok {
+		return nil, paperReject("order %s is not found", req.OrderNumber)
+	}
+
+	var holdPositions []HoldPosition
+	for i, a := range o.allocations {
+		holdPositions = append(holdPositions, HoldPosition{
+			SortOrder:    i + 1,
+			ContractDate: a.position.contractDate,
+			EntryPrice:   a.position.price,
+			HoldQuantity: a.quantity,
+		})
+	}
+	stockAccountType, marginAccountType := o.AccountType, AccountTypeUnspecified
+	if o.TradeType != TradeTypeStock {
+		stockAccountType, marginAccountType = AccountTypeUnspecified, o.AccountType
+	}
+
+	return &OrderDetailResponse{
+		CommonResponse:         p.commonResponse(MessageTypeOrderDetail),
+		OrderNumber:            o.OrderNumber,
+		ExecutionDate:          o.ExecutionDate,
+		ResultCode:             "0",
+		IssueCode:              o.IssueCode,
+		Exchange:               o.Exchange,
+		Side:                   o.Side,
+		TradeType:              o.TradeType,
+		ExitTermType:           o.ExitTermType,
+		ExecutionTiming:        o.ExecutionTiming,
+		ExecutionType:          o.ExecutionType,
+		Price:                  o.Price,
+		OrderQuantity:          o.OrderQuantity,
+		CurrentQuantity:        o.CurrentQuantity,
+		OrderStatus:            o.OrderStatus,
+		OrderDateTime:          o.OrderDateTime,
+		ExpireDate:             o.ExpireDate,
+		StockAccountType:       stockAccountType,
+		MarginAccountType:      marginAccountType,
+		StopOrderType:          o.StopOrderType,
+		StopTriggerPrice:       o.StopTriggerPrice,
+		StopOrderExecutionType: o.StopOrderExecutionType,
+		StopOrderPrice:         o.StopOrderPrice,
+		TriggerType:            o.TriggerType,
+		ContractPrice:          o.ContractPrice,
+		ContractQuantity:       o.ContractQuantity,
+		TradingAmount:          o.ContractPrice * o.ContractQuantity,
+		EstimationAmount:       o.EstimationAmount,
+		ExitPositionType:       o.ExitPositionType,
+		Contracts:              append([]Contract{}, o.contracts...),
+		HoldPositions:          holdPositions,
+	}, nil
+}
+
+// currentPrice - 評価に使う単価 板の現在値がなければ簿価
+func (p *PaperClient) currentPrice(issueCode string, cost float64) float64 {
+	if board, ok := p.boards[issueCode]; ok && board.CurrentPrice > 0 {
+		return board.CurrentPrice
+	}
+	return cost
+}
+
+// StockPositionList - 現物株リスト
+func (p *PaperClient) StockPositionList(_ context.Context, session *Session, req StockPositionListRequest) (*StockPositionListResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	res := &StockPositionListResponse{
+		CommonResponse: p.commonResponse(MessageTypeStockPositionList),
+		IssueCode:      req.IssueCode,
+		ResultCode:     "0",
+		Positions:      make([]StockPosition, 0),
+	}
+	for _, pos := range p.stockPositions {
+		if pos.quantity <= 0 || (req.IssueCode != "" && req.IssueCode != pos.issueCode) {
+			continue
+		}
+
+		current := p.currentPrice(pos.issueCode, pos.cost)
+		valuation := current * pos.quantity
+		profit := (current - pos.cost) * pos.quantity
+		var profitRatio float64
+		if pos.cost > 0 {
+			profitRatio = (current - pos.cost) / pos.cost * 100
+		}
+		res.Positions = append(res.Positions, StockPosition{
+			IssueCode:      pos.issueCode,
+			AccountType:    pos.accountType,
+			OwnedQuantity:  pos.quantity,
+			UnHoldQuantity: pos.quantity - pos.hold,
+			UnitValuation:  current,
+			BookValuation:  pos.cost,
+			TotalValuation: valuation,
+			Profit:         profit,
+			ProfitRatio:    profitRatio,
+		})
+
+		switch pos.accountType {
+		case AccountTypeGeneral:
+			res.GeneralAmount += valuation
+			res.GeneralProfit += profit
+		case AccountTypeNISA:
+			res.NisaAmount += valuation
+			res.NisaProfit += profit
+		case AccountTypeGrowth:
+			res.GrowthAmount += valuation
+			res.GrowthProfit += profit
+		default:
+			res.SpecificAmount += valuation
+			res.SpecificProfit += profit
+		}
+		res.TotalAmount += valuation
+		res.TotalProfit += profit
+	}
+	return res, nil
+}
+
+// MarginPositionList - 信用建玉リスト
+func (p *PaperClient) MarginPositionList(_ context.Context, session *Session, req MarginPositionListRequest) (*MarginPositionListResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	res := &MarginPositionListResponse{
+		CommonResponse: p.commonResponse(MessageTypeMarginPositionList),
+		IssueCode:      req.IssueCode,
+		ResultCode:     "0",
+		Positions:      make([]MarginPosition, 0),
+	}
+	for _, pos := range p.marginPositions {
+		if req.IssueCode != "" && req.IssueCode != pos.issueCode {
+			continue
+		}
+
+		current := p.currentPrice(pos.issueCode, pos.price)
+		profit := (current - pos.price) * pos.owned
+		if pos.side == SideSell {
+			profit = -profit
+		}
+		var profitRatio float64
+		if pos.price > 0 {
+			profitRatio = profit / (pos.price * pos.owned) * 100
+		}
+		exitTermType := ExitTermTypeStandardMargin6m
+		if pos.tradeType == TradeTypeNegotiateEntry {
+			exitTermType = ExitTermTypeNegotiateMargin6m
+		}
+		res.Positions = append(res.Positions, MarginPosition{
+			PositionNumber:     pos.number,
+			IssueCode:          pos.issueCode,
+			Exchange:           pos.exchange,
+			Side:               pos.side,
+			ExitTermType:       exitTermType,
+			AccountType:        pos.accountType,
+			OrderQuantity:      pos.quantity,
+			UnitPrice:          pos.price,
+			CurrentPrice:       current,
+			Profit:             profit,
+			ProfitRatio:        profitRatio,
+			TotalPrice:         pos.price * pos.owned,
+			ContractDate:       pos.contractDate,
+			ExitTerm:           pos.contractDate.AddDate(0, 6, 0),
+			OwnedQuantity:      pos.owned,
+			ExitQuantity:       pos.quantity - pos.owned,
+			HoldQuantity:       pos.hold,
+			ReturnableQuantity: pos.owned - pos.hold,
+		})
+
+		if pos.side == SideSell {
+			res.TotalSellAmount += pos.price * pos.owned
+			res.TotalSellProfit += profit
+		} else {
+			res.TotalBuyAmount += pos.price * pos.owned
+			res.TotalBuyProfit += profit
+		}
+		res.TotalAmount += pos.price * pos.owned
+		res.TotalProfit += profit
+		if pos.accountType == AccountTypeGeneral {
+			res.GeneralAccountProfit += profit
+		} else {
+			res.SpecificAccountProfit += profit
+		}
+	}
+	return res, nil
+}
+
+// StockWallet - 買余力
+func (p *PaperClient) StockWallet(_ context.Context, session *Session, req StockWalletRequest) (*StockWalletResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	wallet := p.stockWallet()
+	return &StockWalletResponse{
+		CommonResponse: p.commonResponse(MessageTypeStockWallet),
+		IssueCode:      req.IssueCode,
+		Exchange:       req.Exchange,
+		ResultCode:     "0",
+		UpdateDateTime: p.clock.Now(),
+		StockWallet:    wallet,
+		Shortage:       wallet < 0,
+	}, nil
+}
+
+// MarginWallet - 建余力&本日維持率
+func (p *PaperClient) MarginWallet(_ context.Context, session *Session, req MarginWalletRequest) (*MarginWalletResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return &MarginWalletResponse{
+		CommonResponse: p.commonResponse(MessageTypeMarginWallet),
+		IssueCode:      req.IssueCode,
+		Exchange:       req.Exchange,
+		ResultCode:     "0",
+		UpdateDateTime: p.clock.Now(),
+		MarginWallet:   p.marginWallet(),
+	}, nil
+}
+
+// StockSellable - 売却可能数量
+func (p *PaperClient) StockSellable(_ context.Context, session *Session, req StockSellableRequest) (*StockSellableResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	res := &StockSellableResponse{
+		CommonResponse: p.commonResponse(MessageTypeStockSellable),
+		IssueCode:      req.IssueCode,
+		ResultCode:     "0",
+		UpdateDateTime: p.clock.Now(),
+	}
+	for _, pos := range p.stockPositions {
+		if pos.issueCode != req.IssueCode {
+			continue
+		}
+		switch pos.accountType {
+		case AccountTypeGeneral:
+			res.GeneralQuantity += pos.quantity - pos.hold
+		case AccountTypeNISA, AccountTypeGrowth:
+			res.NisaQuantity += pos.quantity - pos.hold
+		default:
+			res.SpecificQuantity += pos.quantity - pos.hold
+		}
+	}
+	return res, nil
+}
+
+// Stream - イベントストリーム
+// 元のクライアントのストリームを流し、受信した時価情報で注文を約定させ、模擬売買の約定通知を差し込む
+// 実際の口座の約定通知は流さない
+func (p *PaperClient) Stream(ctx context.Context, session *Session, req StreamRequest) (<-chan StreamResponse, <-chan error) {
+	notifyContract := len(req.StreamEventTypes) == 0
+	for _, t := range req.StreamEventTypes {
+		if t == EventTypeContract {
+			notifyContract = true
+		}
+	}
+	issueCodes := map[int]string{}
+	for i, column := range req.ColumnNumber {
+		if i < len(req.IssueCodes) {
+			issueCodes[column] = req.IssueCodes[i]
+		}
+	}
+
+	sub := &paperSubscriber{notify: make(chan struct{}, 1)}
+	if notifyContract {
+		p.mtx.Lock()
+		p.subscribers[sub] = struct{}{}
+		p.mtx.Unlock()
+	}
+
+	ch := make(chan StreamResponse)
+	errCh := make(chan error)
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+		defer func() {
+			p.mtx.Lock()
+			delete(p.subscribers, sub)
+			p.mtx.Unlock()
+		}()
+
+		send := func(res StreamResponse) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- res:
+				return true
+			}
+		}
+
+		// 抜けるときは元のストリームを止め、チャネルが閉じられるまで待つ
+		cCtx, cf := context.WithCancel(ctx)
+		sCh, sErrCh := p.Client.Stream(cCtx, session, req)
+		defer func() {
+			cf()
+			for sCh != nil || sErrCh != nil {
+				select {
+				case _, ok := <-sCh:
+					if !ok {
+						sCh = nil
+					}
+				case _, ok := <-sErrCh:
+					if !ok {
+						sErrCh = nil
+					}
+				}
+			}
+		}()
+
+		state := NewBoardState()
+		for {
+			for _, event := range sub.take() {
+				if !send(event) {
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.notify:
+			case err, ok := <-sErrCh:
+				if !ok {
+					sErrCh = nil
+					continue
+				}
+				select {
+				case <-ctx.Done():
+				case errCh <- err:
+				}
+				return
+			case res, ok := <-sCh:
+				if !ok {
+					sCh = nil
+					return
+				}
+
+				switch r := res.(type) {
+				case *ContractStreamResponse:
+					continue
+				case *MarketPriceStreamResponse:
+					if issueCode, ok := issueCodes[r.ColumnNumber]; ok {
+						p.UpdateBoard(issueCode, state.Apply(r))
+					}
+				}
+				if !send(res) {
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, errCh
+}
+
+// unavailableClient - 元のクライアントがないときに使う、すべてClientUnavailableErrを返すクライアント
+type unavailableClient struct{}
+
+func (unavailableClient) Login(context.Context, LoginRequest) (*LoginResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) Logout(context.Context, *Session, LogoutRequest) (*LogoutResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) NewOrder(context.Context, *Session, NewOrderRequest) (*NewOrderResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) CorrectOrder(context.Context, *Session, CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) CancelOrder(context.Context, *Session, CancelOrderRequest) (*CancelOrderResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) StockWallet(context.Context, *Session, StockWalletRequest) (*StockWalletResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) MarginWallet(context.Context, *Session, MarginWalletRequest) (*MarginWalletResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) StockSellable(context.Context, *Session, StockSellableRequest) (*StockSellableResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) OrderList(context.Context, *Session, OrderListRequest) (*OrderListResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) OrderDetail(context.Context, *Session, OrderDetailRequest) (*OrderDetailResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) StockPositionList(context.Context, *Session, StockPositionListRequest) (*StockPositionListResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) MarginPositionList(context.Context, *Session, MarginPositionListRequest) (*MarginPositionListResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) StockMaster(context.Context, *Session, StockMasterRequest) (*StockMasterResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) StockExchangeMaster(context.Context, *Session, StockExchangeMasterRequest) (*StockExchangeMasterResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) MarketPrice(context.Context, *Session, MarketPriceRequest) (*MarketPriceResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) BusinessDay(context.Context, *Session, BusinessDayRequest) ([]*BusinessDayResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+func (unavailableClient) TickGroup(context.Context, *Session, TickGroupRequest) ([]*TickGroupResponse, error) {
+	return nil, ClientUnavailableErr
+}
+
+// Stream - レスポンスは流さず、ClientUnavailableErrを流してから閉じる
+func (unavailableClient) Stream(ctx context.Context, _ *Session, _ StreamRequest) (<-chan StreamResponse, <-chan error) {
+	ch, errCh := make(chan StreamResponse), make(chan error)
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+		select {
+		case <-ctx.Done():
+		case errCh <- ClientUnavailableErr:
+		}
+	}()
+	return ch, errCh
+}
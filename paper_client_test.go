@@ -0,0 +1,408 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testPaperBoard - 現在値1000、売気配1001(100株)と1002(200株)、買気配999(100株)と998(200株)の板
+var testPaperBoard = MarketPriceStreamResponse{
+	CurrentPrice: 1000,
+	AskPrice1:    1001, AskQuantity1: 100, AskPrice2: 1002, AskQuantity2: 200,
+	BidPrice1: 999, BidQuantity1: 100, BidPrice2: 998, BidQuantity2: 200,
+}
+
+// newTestPaperClient - 時刻を固定した模擬売買のクライアント
+func newTestPaperClient(client Client, config PaperClientConfig) *PaperClient {
+	p := NewPaperClient(client, config)
+	p.clock = &testClock{Now1: time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)}
+	return p
+}
+
+func Test_PaperClient_NewOrder(t *testing.T) {
+	t.Parallel()
+	type want struct {
+		OrderStatus      OrderStatus
+		ContractQuantity float64
+		ContractPrice    float64
+	}
+	tests := []struct {
+		name    string
+		config  PaperClientConfig
+		board   *MarketPriceStreamResponse
+		session *Session
+		arg     NewOrderRequest
+		want    want
+		wantErr error
+	}{
+		{name: "sessionがnilならエラー",
+			session: nil,
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100},
+			wantErr: NilArgumentErr},
+		{name: "数量が0なら受け付けない",
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock},
+			wantErr: PaperOrderRejectedErr},
+		{name: "買付可能額が足りなければ受け付けない",
+			config:  PaperClientConfig{StockWallet: 100_000},
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderPrice: 1001},
+			wantErr: PaperOrderRejectedErr},
+		{name: "保有していない現物は売れない",
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, OrderQuantity: 100},
+			wantErr: PaperOrderRejectedErr},
+		{name: "新規建可能額が足りなければ受け付けない",
+			config:  PaperClientConfig{MarginWallet: 100_000},
+			board:   &testPaperBoard,
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStandardEntry, OrderQuantity: 200},
+			wantErr: PaperOrderRejectedErr},
+		{name: "建玉がなければ返済できない",
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStandardExit, OrderQuantity: 100},
+			wantErr: PaperOrderRejectedErr},
+		{name: "板がなければ約定しない",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100},
+			want:    want{OrderStatus: OrderStatusInOrder}},
+		{name: "指値が売気配に届かなければ約定しない",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &testPaperBoard,
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderPrice: 1000},
+			want:    want{OrderStatus: OrderStatusInOrder}},
+		{name: "成行の買いは売気配を安い順に約定する",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &testPaperBoard,
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 250},
+			want:    want{OrderStatus: OrderStatusDone, ContractQuantity: 250, ContractPrice: 1001.6}},
+		{name: "指値の買いは指値までの売気配だけ約定する",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &testPaperBoard,
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 250, OrderPrice: 1001},
+			want:    want{OrderStatus: OrderStatusPart, ContractQuantity: 100, ContractPrice: 1001}},
+		{name: "成行の信用新規売りは買気配を高い順に約定する",
+			config:  PaperClientConfig{MarginWallet: 1_000_000},
+			board:   &testPaperBoard,
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStandardEntry, OrderQuantity: 150},
+			want:    want{OrderStatus: OrderStatusDone, ContractQuantity: 150, ContractPrice: (999*100 + 998*50) / 150.0}},
+		{name: "逆指値は条件に達しなければ約定しない",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &testPaperBoard,
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, StopOrderType: StopOrderTypeStop, TriggerPrice: 1010},
+			want:    want{OrderStatus: OrderStatusInOrderStop}},
+		{name: "逆指値は現在値が条件に達したら逆指値値段で約定する",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &testPaperBoard,
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, StopOrderType: StopOrderTypeStop, TriggerPrice: 1000},
+			want:    want{OrderStatus: OrderStatusDone, ContractQuantity: 100, ContractPrice: 1001}},
+		{name: "最良気配の数量までは約定する",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &MarketPriceStreamResponse{AskPrice: 1001, AskQuantity: 100},
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 500, OrderPrice: 1001},
+			want:    want{OrderStatus: OrderStatusPart, ContractQuantity: 100, ContractPrice: 1001}},
+		{name: "売気配の数量が0なら約定しない",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &MarketPriceStreamResponse{AskPrice: 1001},
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 500, OrderPrice: 1001},
+			want:    want{OrderStatus: OrderStatusInOrder}},
+		{name: "数量が0の気配は飛ばして次の気配で約定する",
+			config:  PaperClientConfig{StockWallet: 1_000_000},
+			board:   &MarketPriceStreamResponse{AskPrice1: 1001, AskPrice2: 1002, AskQuantity2: 200},
+			session: &Session{},
+			arg:     NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100},
+			want:    want{OrderStatus: OrderStatusDone, ContractQuantity: 100, ContractPrice: 1002}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			p := newTestPaperClient(&testClient{}, test.config)
+			if test.board != nil {
+				p.UpdateBoard("1475", *test.board)
+			}
+			res, err := p.NewOrder(context.Background(), test.session, test.arg)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			detail, _ := p.OrderDetail(context.Background(), &Session{}, OrderDetailRequest{OrderNumber: res.OrderNumber})
+			got := want{OrderStatus: detail.OrderStatus, ContractQuantity: detail.ContractQuantity, ContractPrice: detail.ContractPrice}
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+// Test_PaperClient_stock - 現物の売買で買付可能額、保有、売却可能数量が変わる
+func Test_PaperClient_stock(t *testing.T) {
+	t.Parallel()
+	ctx, session := context.Background(), &Session{}
+	p := newTestPaperClient(&testClient{}, PaperClientConfig{StockWallet: 1_000_000})
+	p.UpdateBoard("1475", testPaperBoard)
+
+	_, err := p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, AccountType: AccountTypeSpecific, OrderQuantity: 100})
+	if err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+	board := testPaperBoard
+	board.CurrentPrice = 1011
+	p.UpdateBoard("1475", board)
+
+	wallet, _ := p.StockWallet(ctx, session, StockWalletRequest{})
+	positions, _ := p.StockPositionList(ctx, session, StockPositionListRequest{})
+	diff, cost := 10.0, 1001.0
+	wantPositions := []StockPosition{{IssueCode: "1475", AccountType: AccountTypeSpecific, OwnedQuantity: 100, UnHoldQuantity: 100,
+		UnitValuation: 1011, BookValuation: 1001, TotalValuation: 101_100, Profit: 1_000, ProfitRatio: diff / cost * 100}}
+	if wallet.StockWallet != 899_900 || !reflect.DeepEqual(wantPositions, positions.Positions) || positions.TotalProfit != 1_000 {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), 899_900, wantPositions, wallet.StockWallet, positions)
+	}
+
+	// 売注文中は売却可能数量から除かれ、取り消せば戻る
+	sell, _ := p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, AccountType: AccountTypeSpecific, OrderQuantity: 100, OrderPrice: 1100})
+	sellable1, _ := p.StockSellable(ctx, session, StockSellableRequest{IssueCode: "1475"})
+	_, err = p.CancelOrder(ctx, session, CancelOrderRequest{OrderNumber: sell.OrderNumber})
+	sellable2, _ := p.StockSellable(ctx, session, StockSellableRequest{IssueCode: "1475"})
+	if sellable1.SpecificQuantity != 0 || sellable2.SpecificQuantity != 100 || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), 0, 100, nil, sellable1.SpecificQuantity, sellable2.SpecificQuantity, err)
+	}
+
+	// 売れば現金が増え、保有がなくなる
+	_, err = p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, AccountType: AccountTypeSpecific, OrderQuantity: 100})
+	wallet, _ = p.StockWallet(ctx, session, StockWalletRequest{})
+	positions, _ = p.StockPositionList(ctx, session, StockPositionListRequest{})
+	if wallet.StockWallet != 999_800 || len(positions.Positions) != 0 || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), 999_800, 0, nil, wallet.StockWallet, len(positions.Positions), err)
+	}
+
+	// 保有していない銘柄の売りは受け付けず、保有も作らない
+	count := len(p.stockPositions)
+	_, err = p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1306", Side: SideSell, TradeType: TradeTypeStock, AccountType: AccountTypeSpecific, OrderQuantity: 100})
+	if !errors.Is(err, PaperOrderRejectedErr) || len(p.stockPositions) != count {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), PaperOrderRejectedErr, count, err, len(p.stockPositions))
+	}
+}
+
+// Test_PaperClient_affordable - 板がないときの成行は、約定代金が余力に収まらなければ約定させずに失効させる
+func Test_PaperClient_affordable(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		config     PaperClientConfig
+		arg        NewOrderRequest
+		auction    bool
+		wantStatus OrderStatus
+		wantStock  float64
+		wantMargin float64
+	}{
+		{name: "現物の成行の買いは買付可能額に収まれば約定する",
+			config:     PaperClientConfig{StockWallet: 200_000},
+			arg:        NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100},
+			wantStatus: OrderStatusDone, wantStock: 99_900},
+		{name: "現物の成行の買いは買付可能額を超えたら失効する",
+			config:     PaperClientConfig{StockWallet: 100_000},
+			arg:        NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100},
+			wantStatus: OrderStatusExpired, wantStock: 100_000},
+		{name: "信用新規の成行は新規建可能額を超えたら失効する",
+			config:     PaperClientConfig{MarginWallet: 100_000},
+			arg:        NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStandardEntry, OrderQuantity: 100},
+			wantStatus: OrderStatusExpired, wantMargin: 100_000},
+		{name: "板寄せでも買付可能額を超えたら失効する",
+			config:     PaperClientConfig{StockWallet: 100_000},
+			arg:        NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100},
+			auction:    true,
+			wantStatus: OrderStatusExpired, wantStock: 100_000},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, session := context.Background(), &Session{}
+			p := newTestPaperClient(&testClient{}, test.config)
+			res, err := p.NewOrder(ctx, session, test.arg)
+			if err != nil {
+				t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+			}
+			if test.auction {
+				p.auction("1475", 1001, false)
+			} else {
+				p.UpdateBoard("1475", testPaperBoard)
+			}
+
+			detail, _ := p.OrderDetail(ctx, session, OrderDetailRequest{OrderNumber: res.OrderNumber})
+			stock, _ := p.StockWallet(ctx, session, StockWalletRequest{})
+			margin, _ := p.MarginWallet(ctx, session, MarginWalletRequest{})
+			if test.wantStatus != detail.OrderStatus || test.wantStock != stock.StockWallet || test.wantMargin != margin.MarginWallet {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(),
+					test.wantStatus, test.wantStock, test.wantMargin, detail.OrderStatus, stock.StockWallet, margin.MarginWallet)
+			}
+		})
+	}
+}
+
+// Test_PaperClient_margin - 信用の新規と返済で建余力、建玉、損益が変わる
+func Test_PaperClient_margin(t *testing.T) {
+	t.Parallel()
+	ctx, session := context.Background(), &Session{}
+	p := newTestPaperClient(&testClient{}, PaperClientConfig{StockWallet: 1_000_000, MarginWallet: 1_000_000})
+	p.UpdateBoard("1475", testPaperBoard)
+
+	_, err := p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStandardEntry, OrderQuantity: 100})
+	if err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+	wallet, _ := p.MarginWallet(ctx, session, MarginWalletRequest{})
+	positions, _ := p.MarginPositionList(ctx, session, MarginPositionListRequest{})
+	if wallet.MarginWallet != 900_100 || len(positions.Positions) != 1 {
+		t.Fatalf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), 900_100, 1, wallet.MarginWallet, positions)
+	}
+	got := positions.Positions[0]
+	profit, total := -100.0, 99_900.0
+	want := MarginPosition{PositionNumber: "1", IssueCode: "1475", Side: SideSell, ExitTermType: ExitTermTypeStandardMargin6m,
+		OrderQuantity: 100, UnitPrice: 999, CurrentPrice: 1000, Profit: profit, ProfitRatio: profit / total * 100, TotalPrice: total,
+		ContractDate: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), ExitTerm: time.Date(2023, 1, 26, 0, 0, 0, 0, time.Local),
+		OwnedQuantity: 100, ReturnableQuantity: 100}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+
+	// 建玉を指定して返済すると、損益が現金に入り、建玉がなくなる
+	board := testPaperBoard
+	board.AskPrice1 = 990
+	p.UpdateBoard("1475", board)
+	_, err = p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStandardExit, OrderQuantity: 100,
+		ExitPositionType: ExitPositionTypePositionNumber, ExitPositions: []ExitPosition{{PositionNumber: "1", OrderQuantity: 100}}})
+	stockWallet, _ := p.StockWallet(ctx, session, StockWalletRequest{})
+	wallet, _ = p.MarginWallet(ctx, session, MarginWalletRequest{})
+	positions, _ = p.MarginPositionList(ctx, session, MarginPositionListRequest{})
+	if stockWallet.StockWallet != 1_000_900 || wallet.MarginWallet != 1_000_000 || len(positions.Positions) != 0 || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(),
+			1_000_900, 1_000_000, 0, nil, stockWallet.StockWallet, wallet.MarginWallet, len(positions.Positions), err)
+	}
+}
+
+// Test_PaperClient_Stream - 元のストリームの時価情報で約定させ、模擬売買の約定通知を流す
+func Test_PaperClient_Stream(t *testing.T) {
+	t.Parallel()
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, _ chan<- error) {
+			ch <- &MarketPriceStreamResponse{ColumnNumber: 1, CurrentPrice: 1000, AskPrice1: 1001, AskQuantity1: 100,
+				PresentFields: marketPriceFieldSetOf(MarketPriceFieldCurrentPrice, MarketPriceFieldAskPrice1, MarketPriceFieldAskQuantity1)}
+			ch <- &ContractStreamResponse{OrderNumber: "99"}                                     // 実際の口座の約定通知は流さない
+			ch <- &MarketPriceStreamResponse{ColumnNumber: 1, BidPrice1: 999, BidQuantity1: 100, // 差分なので売気配は残る
+				PresentFields: marketPriceFieldSetOf(MarketPriceFieldBidPrice1, MarketPriceFieldBidQuantity1)}
+			<-ctx.Done()
+		},
+	}}
+	p := newTestPaperClient(client, PaperClientConfig{StockWallet: 1_000_000})
+	ctx, cf := context.WithCancel(context.Background())
+	defer cf()
+	session := &Session{}
+	ch, _ := p.Stream(ctx, session, StreamRequest{ColumnNumber: []int{1}, IssueCodes: []string{"1475"}})
+
+	var got []StreamOrderType
+	receive := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case res := <-ch:
+				if r, ok := res.(*ContractStreamResponse); ok {
+					got = append(got, r.StreamOrderType)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s error\nwant: event\ngot: timeout\n", t.Name())
+			}
+		}
+	}
+	receive(2) // 時価情報2つ 間の約定通知は捨てられる
+
+	order1, _ := p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderPrice: 1000})
+	_, _ = p.CorrectOrder(ctx, session, CorrectOrderRequest{OrderNumber: order1.OrderNumber, OrderPrice: 1001,
+		OrderQuantity: NoChangeFloat, TriggerPrice: NoChangeFloat, StopOrderPrice: NoChangeFloat, ExpireDateNoChange: true})
+	order2, _ := p.NewOrder(ctx, session, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderPrice: 900})
+	_, _ = p.CancelOrder(ctx, session, CancelOrderRequest{OrderNumber: order2.OrderNumber})
+	receive(5)
+
+	want := []StreamOrderType{StreamOrderTypeReceiveOrder, StreamOrderTypeCorrected, StreamOrderTypeContract, StreamOrderTypeReceiveOrder, StreamOrderTypeCanceled}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+
+	list, _ := p.OrderList(ctx, session, OrderListRequest{OrderInquiryStatus: OrderInquiryStatusDone})
+	if len(list.Orders) != 1 || list.Orders[0].OrderNumber != order1.OrderNumber || list.Orders[0].ContractPrice != 1001 {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), order1.OrderNumber, list.Orders)
+	}
+}
+
+// Test_PaperClient_contractEvent - 約定通知に約定値段と数量が入る
+func Test_PaperClient_contractEvent(t *testing.T) {
+	t.Parallel()
+	p := newTestPaperClient(&testClient{}, PaperClientConfig{StockWallet: 1_000_000})
+	p.UpdateBoard("1475", testPaperBoard)
+	sub := &paperSubscriber{notify: make(chan struct{}, 1)}
+	p.subscribers[sub] = struct{}{}
+
+	_, _ = p.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 150})
+	events := sub.take()
+	if len(events) != 3 {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), 3, events)
+	}
+
+	now := time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)
+	date := time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local)
+	want := &ContractStreamResponse{
+		CommonStreamResponse:     CommonStreamResponse{EventType: EventTypeContract, StreamDateTime: now, ErrorNo: ErrorNoProblem},
+		Provider:                 paperProvider,
+		EventNo:                  3,
+		FirstTime:                true,
+		StreamOrderType:          StreamOrderTypeContract,
+		OrderNumber:              "1",
+		ExecutionDate:            date,
+		ProductType:              ProductTypeStock,
+		IssueCode:                "1475",
+		Exchange:                 ExchangeToushou,
+		Side:                     SideBuy,
+		TradeType:                TradeTypeStock,
+		ExecutionType:            ExecutionTypeMarket,
+		Quantity:                 150,
+		ContractQuantity:         150,
+		StreamOrderStatus:        StreamOrderStatusReceived,
+		CancelOrderStatus:        CancelOrderStatusNoCorrect,
+		ContractStatus:           ContractStatusDone,
+		ExpireDate:               date,
+		SecurityContractPrice:    1002,
+		SecurityContractQuantity: 50,
+		NotifyDateTime:           now,
+	}
+	if !reflect.DeepEqual(want, events[2]) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, events[2])
+	}
+}
+
+// Test_PaperClient_MarketPrice - 時価情報は元のクライアントに任せる
+func Test_PaperClient_MarketPrice(t *testing.T) {
+	t.Parallel()
+	want := &MarketPriceResponse{CommonResponse: CommonResponse{No: 2}}
+	p := NewPaperClient(&testClient{marketPrice1: want}, PaperClientConfig{})
+	got, err := p.MarketPrice(context.Background(), &Session{}, MarketPriceRequest{})
+	if want != got || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, nil, got, err)
+	}
+}
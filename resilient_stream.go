@@ -0,0 +1,425 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultResilientStreamBaseInterval     = 1 * time.Second // 再接続の待機時間の初期値
+	defaultResilientStreamMaxInterval      = 1 * time.Minute // 再接続の待機時間の上限
+	defaultResilientStreamStatusBufferSize = 16              // 状態通知のバッファ
+)
+
+// errStreamResubscribe - 購読内容の変更で接続を切ったことを表す
+var errStreamResubscribe = errors.New("stream resubscribe")
+
+// StreamStatusType - ストリームの状態種別
+type StreamStatusType string
+
+const (
+	StreamStatusTypeUnspecified   StreamStatusType = ""              // 未指定
+	StreamStatusTypeConnecting    StreamStatusType = "connecting"    // 接続開始
+	StreamStatusTypeDisconnected  StreamStatusType = "disconnected"  // 切断
+	StreamStatusTypeReconnecting  StreamStatusType = "reconnecting"  // 再接続待ち
+	StreamStatusTypeResubscribing StreamStatusType = "resubscribing" // 購読内容の変更による再接続
+	StreamStatusTypeClosed        StreamStatusType = "closed"        // 終了
+)
+
+// StreamStatus - ストリームの状態通知
+type StreamStatus struct {
+	Type              StreamStatusType // 状態種別
+	Attempt           int              // 連続した再接続の試行回数
+	StartStreamNumber int64            // 接続時に指定した配信開始イベント通知番号
+	LastStreamNumber  int64            // 最後に受信した配信番号
+	Wait              time.Duration    // 再接続までの待機時間
+	Err               error            // 切断理由
+	DateTime          time.Time        // 通知日時
+}
+
+// ResilientStreamConfig - 再接続するストリームの設定
+type ResilientStreamConfig struct {
+	BaseInterval     time.Duration  // 再接続の待機時間の初期値 失敗が続くと倍になる 0なら1秒
+	MaxInterval      time.Duration  // 再接続の待機時間の上限 0なら1分
+	MaxRetries       int            // 連続して再接続を試行する上限 0なら無制限
+	StatusBufferSize int            // 状態通知チャネルのバッファ 0なら16
+	StallTimeout     time.Duration  // キープアライブを含め何も受信しない時間がこれを超えたら停止とみなして再接続する 0なら監視しない
+	Monitor          *StreamMonitor // キープアライブを含めたすべてのイベントを渡す監視 nilなら監視しない
+}
+
+// StreamHealth - ストリームの受信状況
+type StreamHealth struct {
+	LastFrameTime     time.Time // 最後に何らかのフレームを受信した日時
+	LastKeepAliveTime time.Time // 最後にキープアライブを受信した日時
+	LastEventTime     time.Time // 最後にキープアライブ以外のイベントを受信した日時
+	Stalled           bool      // 停止を検知して再接続待ちになっているか
+}
+
+// NewResilientStream - 切断されても再接続するストリームを生成する
+func NewResilientStream(client Client, session *Session, req StreamRequest, config ResilientStreamConfig) *ResilientStream {
+	if config.BaseInterval <= 0 {
+		config.BaseInterval = defaultResilientStreamBaseInterval
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = defaultResilientStreamMaxInterval
+	}
+	if config.StatusBufferSize <= 0 {
+		config.StatusBufferSize = defaultResilientStreamStatusBufferSize
+	}
+
+	return &ResilientStream{
+		client:        client,
+		session:       session,
+		req:           req,
+		config:        config,
+		clock:         newClock(),
+		resubscribeCh: make(chan struct{}, 1),
+	}
+}
+
+// ResilientStream - 再接続するストリーム
+// 切断されたら待機時間をおいて再接続し、最後に受け取ったイベント番号(EventNo)から配信を再開する
+// 再開時に重複して届いたイベントは捨てる
+type ResilientStream struct {
+	client           Client
+	session          *Session
+	req              StreamRequest
+	config           ResilientStreamConfig
+	clock            iClock
+	lastEventNo      int64
+	lastStreamNumber int64
+	health           StreamHealth
+	resubscribeCh    chan struct{}
+	mtx              sync.Mutex
+}
+
+// Start - ストリームを開始する
+// 1つ目のチャネルにはイベント、2つ目のチャネルには接続状態の変化が流れる
+// 状態通知は読まれなければバッファを超えた分を捨てるが、イベントは捨てない
+// 再接続できないエラーが発生したら3つ目のチャネルにエラーを流して終了する
+func (s *ResilientStream) Start(ctx context.Context) (<-chan StreamResponse, <-chan StreamStatus, <-chan error) {
+	eventCh := make(chan StreamResponse)
+	statusCh := make(chan StreamStatus, s.config.StatusBufferSize)
+	errCh := make(chan error)
+
+	go func() {
+		defer close(eventCh)
+		defer close(statusCh)
+		defer close(errCh)
+
+		attempt := 0
+		for {
+			// これから最新のリクエストで接続するので、それまでの購読変更の通知は不要
+			select {
+			case <-s.resubscribeCh:
+			default:
+			}
+
+			req := s.request()
+			s.notify(statusCh, StreamStatus{Type: StreamStatusTypeConnecting, Attempt: attempt, StartStreamNumber: req.StartStreamNumber})
+
+			received, err := s.consume(ctx, req, eventCh)
+			s.setStalled(errors.Is(err, StreamStalledErr))
+			if ctx.Err() != nil {
+				s.notify(statusCh, StreamStatus{Type: StreamStatusTypeClosed, Err: ctx.Err()})
+				return
+			}
+
+			// 購読内容の変更なら待たずに再接続する
+			if errors.Is(err, errStreamResubscribe) {
+				attempt = 0
+				s.notify(statusCh, StreamStatus{Type: StreamStatusTypeResubscribing})
+				continue
+			}
+			s.notify(statusCh, StreamStatus{Type: StreamStatusTypeDisconnected, Attempt: attempt, Err: err})
+
+			if !s.retryable(err) {
+				s.sendErr(ctx, errCh, err)
+				return
+			}
+
+			// 何か受信できていれば接続には成功していたので、連続失敗回数を数えなおす
+			if received {
+				attempt = 0
+			}
+			attempt++
+			if s.config.MaxRetries > 0 && attempt > s.config.MaxRetries {
+				s.sendErr(ctx, errCh, fmt.Errorf("%s: %w", err, StreamRetryExceededErr))
+				return
+			}
+
+			wait := s.interval(attempt)
+			s.notify(statusCh, StreamStatus{Type: StreamStatusTypeReconnecting, Attempt: attempt, Wait: wait, Err: err})
+			select {
+			case <-ctx.Done():
+				s.notify(statusCh, StreamStatus{Type: StreamStatusTypeClosed, Err: ctx.Err()})
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	return eventCh, statusCh, errCh
+}
+
+// consume - 1回分の接続からイベントを受け取って流す
+// 接続が終了したら、何か受信できたかと終了理由を返す
+func (s *ResilientStream) consume(ctx context.Context, req StreamRequest, eventCh chan<- StreamResponse) (bool, error) {
+	// 受信状況を把握するため、キープアライブは常に受け取る
+	notifyKeepAlive := req.NotifyKeepAlive
+	req.NotifyKeepAlive = true
+
+	// 配信番号は接続ごとに振りなおされる
+	if s.config.Monitor != nil {
+		s.config.Monitor.Reset()
+	}
+
+	cCtx, cf := context.WithCancel(ctx)
+	ch, errCh := s.client.Stream(cCtx, s.session, req)
+	defer func() {
+		cf()
+		drainStream(ch, errCh)
+	}()
+
+	// 停止の監視 監視しない場合はnilチャネルのままにして発火させない
+	var stallTimer *time.Timer
+	var stallCh <-chan time.Time
+	if s.config.StallTimeout > 0 {
+		stallTimer = time.NewTimer(s.config.StallTimeout)
+		defer stallTimer.Stop()
+		stallCh = stallTimer.C
+	}
+
+	var received bool
+	for {
+		select {
+		case <-ctx.Done():
+			return received, ctx.Err()
+		case <-s.resubscribeCh:
+			return received, errStreamResubscribe
+		case <-stallCh:
+			return received, fmt.Errorf("no frame in %s: %w", s.config.StallTimeout, StreamStalledErr)
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			return received, err
+		case res, ok := <-ch:
+			if !ok {
+				return received, StreamClosedErr
+			}
+			received = true
+			if stallTimer != nil {
+				if !stallTimer.Stop() {
+					select {
+					case <-stallTimer.C:
+					default:
+					}
+				}
+				stallTimer.Reset(s.config.StallTimeout)
+			}
+
+			s.beat(res)
+			if s.config.Monitor != nil {
+				s.config.Monitor.Observe(res)
+			}
+			if res.GetEventType() == EventTypeKeepAlive && !notifyKeepAlive {
+				continue
+			}
+			if !s.accept(res) {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return received, ctx.Err()
+			case eventCh <- res:
+			}
+		}
+	}
+}
+
+// accept - 受信したイベントを記録し、流すべきイベントかを返す
+func (s *ResilientStream) accept(res StreamResponse) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if common := streamCommon(res); common != nil {
+		s.lastStreamNumber = common.StreamNumber
+	}
+
+	no, ok := streamEventNo(res)
+	if !ok || no <= 0 {
+		return true
+	}
+	if no <= s.lastEventNo {
+		return false // 再開時に重複して届いたイベント
+	}
+	s.lastEventNo = no
+	return true
+}
+
+// beat - 受信日時を記録する
+func (s *ResilientStream) beat(res StreamResponse) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := s.clock.Now()
+	s.health.LastFrameTime = now
+	s.health.Stalled = false
+	if res.GetEventType() == EventTypeKeepAlive {
+		s.health.LastKeepAliveTime = now
+	} else {
+		s.health.LastEventTime = now
+	}
+}
+
+func (s *ResilientStream) setStalled(stalled bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.health.Stalled = stalled
+}
+
+// Health - 受信状況 ヘルスチェックに使う
+func (s *ResilientStream) Health() StreamHealth {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.health
+}
+
+// request - 次に接続するときのリクエスト
+func (s *ResilientStream) request() StreamRequest {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	req := s.req
+	if s.lastEventNo > req.StartStreamNumber {
+		req.StartStreamNumber = s.lastEventNo
+	}
+	return req
+}
+
+// resubscribe - リクエストを変更し、接続中なら新しいリクエストで再接続させる
+// 再接続後は最後に受け取ったイベント番号から配信されるので、約定や通知のイベントは途切れない
+func (s *ResilientStream) resubscribe(f func(req *StreamRequest)) {
+	s.mtx.Lock()
+	f(&s.req)
+	s.mtx.Unlock()
+
+	select {
+	case s.resubscribeCh <- struct{}{}:
+	default:
+	}
+}
+
+// retryable - 再接続してよいエラーか
+// サーバから返されたエラーや引数のエラーは再接続しても解決しないので再接続しない
+func (s *ResilientStream) retryable(err error) bool {
+	return !errors.Is(err, StreamError) && !errors.Is(err, NilArgumentErr)
+}
+
+// interval - 試行回数に応じた待機時間
+func (s *ResilientStream) interval(attempt int) time.Duration {
+	d := s.config.BaseInterval
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= s.config.MaxInterval {
+			return s.config.MaxInterval
+		}
+	}
+	if d > s.config.MaxInterval {
+		return s.config.MaxInterval
+	}
+	return d
+}
+
+// notify - 状態を通知する 受け取られずにバッファがいっぱいなら捨てる
+func (s *ResilientStream) notify(statusCh chan<- StreamStatus, status StreamStatus) {
+	status.DateTime = s.clock.Now()
+	status.LastStreamNumber = s.LastStreamNumber()
+	select {
+	case statusCh <- status:
+	default:
+	}
+}
+
+func (s *ResilientStream) sendErr(ctx context.Context, errCh chan<- error, err error) {
+	select {
+	case <-ctx.Done():
+	case errCh <- err:
+	}
+}
+
+// LastEventNo - 最後に受け取ったイベント番号
+func (s *ResilientStream) LastEventNo() int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.lastEventNo
+}
+
+// LastStreamNumber - 最後に受け取った配信番号
+func (s *ResilientStream) LastStreamNumber() int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.lastStreamNumber
+}
+
+// drainStream - 読まれなくなったストリームを送信側が終了するまで読み捨てる
+func drainStream(ch <-chan StreamResponse, errCh <-chan error) {
+	go func() {
+		for ch != nil || errCh != nil {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					ch = nil
+				}
+			case _, ok := <-errCh:
+				if !ok {
+					errCh = nil
+				}
+			}
+		}
+	}()
+}
+
+// streamCommon - イベントの共通項目を取り出す
+func streamCommon(res StreamResponse) *CommonStreamResponse {
+	switch r := res.(type) {
+	case *CommonStreamResponse:
+		return r
+	case *MarketPriceStreamResponse:
+		return &r.CommonStreamResponse
+	case *ContractStreamResponse:
+		return &r.CommonStreamResponse
+	case *NewsStreamResponse:
+		return &r.CommonStreamResponse
+	case *SystemStatusStreamResponse:
+		return &r.CommonStreamResponse
+	case *OperationStatusStreamResponse:
+		return &r.CommonStreamResponse
+	}
+	return nil
+}
+
+// streamEventNo - イベント番号を持つイベントならイベント番号を取り出す
+func streamEventNo(res StreamResponse) (int64, bool) {
+	switch r := res.(type) {
+	case *ContractStreamResponse:
+		return r.EventNo, true
+	case *NewsStreamResponse:
+		return r.EventNo, true
+	case *SystemStatusStreamResponse:
+		return r.EventNo, true
+	case *OperationStatusStreamResponse:
+		return r.EventNo, true
+	}
+	return 0, false
+}
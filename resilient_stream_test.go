@@ -0,0 +1,307 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_NewResilientStream(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		arg4  ResilientStreamConfig
+		want1 ResilientStreamConfig
+	}{
+		{name: "設定がゼロ値ならデフォルト値で埋める",
+			arg4:  ResilientStreamConfig{},
+			want1: ResilientStreamConfig{BaseInterval: 1 * time.Second, MaxInterval: 1 * time.Minute, MaxRetries: 0, StatusBufferSize: 16}},
+		{name: "設定があればそのまま使う",
+			arg4:  ResilientStreamConfig{BaseInterval: 2 * time.Second, MaxInterval: 5 * time.Second, MaxRetries: 3, StatusBufferSize: 1},
+			want1: ResilientStreamConfig{BaseInterval: 2 * time.Second, MaxInterval: 5 * time.Second, MaxRetries: 3, StatusBufferSize: 1}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := NewResilientStream(&testClient{}, &Session{}, StreamRequest{}, test.arg4)
+			if !reflect.DeepEqual(test.want1, got.config) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want1, got.config)
+			}
+		})
+	}
+}
+
+func Test_ResilientStream_interval(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		arg1  int
+		want1 time.Duration
+	}{
+		{name: "1回目なら初期値", arg1: 1, want1: 1 * time.Second},
+		{name: "2回目なら倍", arg1: 2, want1: 2 * time.Second},
+		{name: "上限を超えたら上限", arg1: 5, want1: 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			stream := &ResilientStream{config: ResilientStreamConfig{BaseInterval: 1 * time.Second, MaxInterval: 10 * time.Second}}
+			got1 := stream.interval(test.arg1)
+			if !reflect.DeepEqual(test.want1, got1) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want1, got1)
+			}
+		})
+	}
+}
+
+func Test_ResilientStream_accept(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name                 string
+		lastEventNo          int64
+		arg1                 StreamResponse
+		want1                bool
+		wantLastEventNo      int64
+		wantLastStreamNumber int64
+	}{
+		{name: "イベント番号のないイベントは流す",
+			lastEventNo:          10,
+			arg1:                 &MarketPriceStreamResponse{CommonStreamResponse: CommonStreamResponse{StreamNumber: 3}},
+			want1:                true,
+			wantLastEventNo:      10,
+			wantLastStreamNumber: 3},
+		{name: "最後のイベント番号より大きければ流して記録する",
+			lastEventNo:          10,
+			arg1:                 &ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{StreamNumber: 4}, EventNo: 11},
+			want1:                true,
+			wantLastEventNo:      11,
+			wantLastStreamNumber: 4},
+		{name: "最後のイベント番号以下なら重複として捨てる",
+			lastEventNo:          10,
+			arg1:                 &NewsStreamResponse{CommonStreamResponse: CommonStreamResponse{StreamNumber: 5}, EventNo: 10},
+			want1:                false,
+			wantLastEventNo:      10,
+			wantLastStreamNumber: 5},
+		{name: "イベント番号が0なら流す",
+			lastEventNo:          10,
+			arg1:                 &SystemStatusStreamResponse{CommonStreamResponse: CommonStreamResponse{StreamNumber: 6}},
+			want1:                true,
+			wantLastEventNo:      10,
+			wantLastStreamNumber: 6},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			stream := &ResilientStream{lastEventNo: test.lastEventNo}
+			got1 := stream.accept(test.arg1)
+			if !reflect.DeepEqual(test.want1, got1) || test.wantLastEventNo != stream.LastEventNo() || test.wantLastStreamNumber != stream.LastStreamNumber() {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(),
+					test.want1, test.wantLastEventNo, test.wantLastStreamNumber,
+					got1, stream.LastEventNo(), stream.LastStreamNumber())
+			}
+		})
+	}
+}
+
+func Test_ResilientStream_request(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		req         StreamRequest
+		lastEventNo int64
+		want1       StreamRequest
+	}{
+		{name: "まだ何も受け取っていなければ指定されたリクエストのまま",
+			req:   StreamRequest{StartStreamNumber: 5, StreamEventTypes: []EventType{EventTypeContract}},
+			want1: StreamRequest{StartStreamNumber: 5, StreamEventTypes: []EventType{EventTypeContract}}},
+		{name: "受け取ったイベント番号があればそこから再開する",
+			req:         StreamRequest{StreamEventTypes: []EventType{EventTypeContract}},
+			lastEventNo: 12,
+			want1:       StreamRequest{StartStreamNumber: 12, StreamEventTypes: []EventType{EventTypeContract}}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			stream := &ResilientStream{req: test.req, lastEventNo: test.lastEventNo}
+			got1 := stream.request()
+			if !reflect.DeepEqual(test.want1, got1) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want1, got1)
+			}
+		})
+	}
+}
+
+func Test_ResilientStream_Start(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		streams         []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error)
+		maxRetries      int
+		wantEventNos    []int64
+		wantErr         error
+		wantStartNos    []int64
+		wantReconnected bool
+	}{
+		{name: "切断されたら最後のイベント番号から再開し、重複は捨てる",
+			streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+					ch <- &ContractStreamResponse{EventNo: 1}
+					ch <- &ContractStreamResponse{EventNo: 2}
+					errCh <- errors.New("connection reset by peer")
+				},
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+					ch <- &ContractStreamResponse{EventNo: 2}
+					ch <- &ContractStreamResponse{EventNo: 3}
+					errCh <- StreamError
+				},
+			},
+			wantEventNos:    []int64{1, 2, 3},
+			wantErr:         StreamError,
+			wantStartNos:    []int64{0, 2},
+			wantReconnected: true},
+		{name: "再接続の上限を超えたらエラーを返して終了",
+			streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {},
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {},
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {},
+			},
+			maxRetries:      2,
+			wantEventNos:    nil,
+			wantErr:         StreamRetryExceededErr,
+			wantStartNos:    []int64{0, 0, 0},
+			wantReconnected: true},
+		{name: "引数エラーなら再接続しない",
+			streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) { errCh <- NilArgumentErr },
+			},
+			wantEventNos: nil,
+			wantErr:      NilArgumentErr,
+			wantStartNos: []int64{0}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{streams: test.streams}
+			stream := NewResilientStream(client, &Session{}, StreamRequest{}, ResilientStreamConfig{
+				BaseInterval: 1 * time.Millisecond,
+				MaxInterval:  1 * time.Millisecond,
+				MaxRetries:   test.maxRetries,
+			})
+			ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cf()
+			ch, statusCh, errCh := stream.Start(ctx)
+
+			var gotEventNos []int64
+			var gotErr error
+			for ch != nil || errCh != nil {
+				select {
+				case res, ok := <-ch:
+					if !ok {
+						ch = nil
+						continue
+					}
+					no, _ := streamEventNo(res)
+					gotEventNos = append(gotEventNos, no)
+				case err, ok := <-errCh:
+					if !ok {
+						errCh = nil
+						continue
+					}
+					gotErr = err
+				}
+			}
+
+			var gotReconnected bool
+			for status := range statusCh {
+				if status.Type == StreamStatusTypeReconnecting {
+					gotReconnected = true
+				}
+			}
+
+			var gotStartNos []int64
+			for _, req := range client.getStreamHistory() {
+				gotStartNos = append(gotStartNos, req.StartStreamNumber)
+			}
+
+			if !reflect.DeepEqual(test.wantEventNos, gotEventNos) || !errors.Is(gotErr, test.wantErr) ||
+				!reflect.DeepEqual(test.wantStartNos, gotStartNos) || test.wantReconnected != gotReconnected {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(),
+					test.wantEventNos, test.wantErr, test.wantStartNos, test.wantReconnected,
+					gotEventNos, gotErr, gotStartNos, gotReconnected)
+			}
+		})
+	}
+}
+
+func Test_ResilientStream_Start_stall(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 7, 16, 16, 47, 28, 0, time.Local)
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			ch <- &CommonStreamResponse{EventType: EventTypeKeepAlive, StreamNumber: 1}
+			<-ctx.Done() // 以降何も届かない
+		},
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			ch <- &ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeContract, StreamNumber: 1}, EventNo: 1}
+			errCh <- StreamError
+		},
+	}}
+	stream := NewResilientStream(client, &Session{}, StreamRequest{}, ResilientStreamConfig{
+		BaseInterval: 1 * time.Millisecond,
+		MaxInterval:  1 * time.Millisecond,
+		StallTimeout: 50 * time.Millisecond,
+	})
+	stream.clock = &testClock{Now1: now}
+
+	ctx, cf := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cf()
+	ch, statusCh, errCh := stream.Start(ctx)
+
+	var got1 []StreamResponse
+	var got2 error
+	for ch != nil || errCh != nil {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				ch = nil
+				continue
+			}
+			got1 = append(got1, res)
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			got2 = err
+		}
+	}
+
+	var gotStalled bool
+	for status := range statusCh {
+		if status.Type == StreamStatusTypeDisconnected && errors.Is(status.Err, StreamStalledErr) {
+			gotStalled = true
+		}
+	}
+
+	want1 := []StreamResponse{&ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeContract, StreamNumber: 1}, EventNo: 1}}
+	want3 := StreamHealth{LastFrameTime: now, LastKeepAliveTime: now, LastEventTime: now}
+	history := client.getStreamHistory()
+	if !reflect.DeepEqual(want1, got1) || !errors.Is(got2, StreamError) || !gotStalled ||
+		!reflect.DeepEqual(want3, stream.Health()) || len(history) != 2 || !history[0].NotifyKeepAlive {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v, %+v\n", t.Name(),
+			want1, StreamError, true, want3,
+			got1, got2, gotStalled, stream.Health(), history)
+	}
+}
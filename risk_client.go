@@ -0,0 +1,475 @@
+package tachibana
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RiskLimits - リスク上限 0や空なら制限しない
+type RiskLimits struct {
+	MaxOrderNotional    float64  // 1注文の代金の上限
+	MaxDailyNotional    float64  // 1日に受け付けられた新規注文の代金の合計の上限
+	MaxPositionQuantity float64  // 1銘柄の買い、売りそれぞれの保有数量と注文中数量の合計の上限
+	MaxOpenOrders       int      // 注文中の注文数の上限
+	MaxDailyLoss        float64  // 1日の確定損失の上限 正の数で指定し、損失がこれに達したら新規注文を止める
+	BlockedIssueCodes   []string // 新規注文を禁止する銘柄コード
+}
+
+// RiskLimitType - 超えたリスク上限の種類
+type RiskLimitType string
+
+const (
+	RiskLimitTypeUnspecified   RiskLimitType = ""               // 未指定
+	RiskLimitTypeBlockedIssue  RiskLimitType = "blocked_issue"  // 禁止銘柄
+	RiskLimitTypeOrderNotional RiskLimitType = "order_notional" // 1注文の代金
+	RiskLimitTypeDailyNotional RiskLimitType = "daily_notional" // 1日の代金の合計
+	RiskLimitTypePosition      RiskLimitType = "position"       // 1銘柄の数量
+	RiskLimitTypeOpenOrders    RiskLimitType = "open_orders"    // 注文中の注文数
+	RiskLimitTypeDailyLoss     RiskLimitType = "daily_loss"     // 1日の確定損失
+	RiskLimitTypeUnknownPrice  RiskLimitType = "unknown_price"  // 成行で値段がわからず代金を計算できない
+)
+
+// RiskLimitError - リスク上限を超えたため送らなかった注文のエラー errors.IsでRiskLimitErrと比較できる
+type RiskLimitError struct {
+	Type      RiskLimitType // 超えたリスク上限の種類
+	IssueCode string        // 銘柄コード
+	Limit     float64       // 上限
+	Value     float64       // 注文を送ったらなる値
+}
+
+func (e *RiskLimitError) Error() string {
+	return fmt.Sprintf("%s: %s limit %v, value %v (%s)", RiskLimitErr, e.Type, e.Limit, e.Value, e.IssueCode)
+}
+
+func (e *RiskLimitError) Unwrap() error {
+	return RiskLimitErr
+}
+
+// RiskPosition - 1銘柄の保有数量と平均単価 現物と信用建玉をまとめる
+type RiskPosition struct {
+	IssueCode     string  // 銘柄コード
+	LongQuantity  float64 // 現物、買建玉の数量
+	LongPrice     float64 // 現物、買建玉の平均単価
+	ShortQuantity float64 // 売建玉の数量
+	ShortPrice    float64 // 売建玉の平均単価
+}
+
+// RiskExposure - リスク上限の判定に使っている状態
+type RiskExposure struct {
+	Date           time.Time      // 日付 日付が変わったら代金の合計と確定損益を0に戻す
+	DailyNotional  float64        // 受け付けられた新規注文の代金の合計
+	RealizedProfit float64        // 約定通知から計算した確定損益 手数料を含まない
+	OpenOrders     int            // 注文中の注文数
+	Positions      []RiskPosition // 銘柄ごとの保有数量 銘柄コード順
+}
+
+// riskOrder - 注文中の注文
+type riskOrder struct {
+	issueCode        string
+	side             Side
+	entry            bool
+	price            float64
+	quantity         float64
+	contractQuantity float64
+	lastEventNo      int64
+}
+
+// remaining - 約定していない数量
+func (o *riskOrder) remaining() float64 {
+	return o.quantity - o.contractQuantity
+}
+
+// isEntryOrder - 保有数量を増やす注文か 現物売り、信用返済、現引、現渡は減らす注文
+func isEntryOrder(tradeType TradeType, side Side) bool {
+	switch tradeType {
+	case TradeTypeStock:
+		return side == SideBuy
+	case TradeTypeStandardEntry, TradeTypeNegotiateEntry:
+		return true
+	}
+	return false
+}
+
+// NewRiskClient - リスク上限を超える新規注文と訂正注文をサーバーに送らずに拒否するクライアントを生成する
+// 保有数量と注文中の注文はRefreshで、約定はApplyで更新する
+func NewRiskClient(client Client, limits RiskLimits) *RiskClient {
+	blocked := make(map[string]bool, len(limits.BlockedIssueCodes))
+	for _, issueCode := range limits.BlockedIssueCodes {
+		blocked[issueCode] = true
+	}
+	return &RiskClient{
+		Client:    client,
+		clock:     newClock(),
+		limits:    limits,
+		blocked:   blocked,
+		positions: map[string]*RiskPosition{},
+		orders:    map[string]*riskOrder{},
+		pending:   map[int64]*riskOrder{},
+		finished:  map[string]int64{},
+		prices:    map[string]float64{},
+	}
+}
+
+// RiskClient - リスク上限を守るクライアント
+// 保有数量を減らす注文はリスクを減らすので制限しない キルスイッチもこのクライアント越しに使える
+type RiskClient struct {
+	Client
+	clock          iClock
+	limits         RiskLimits
+	blocked        map[string]bool
+	date           time.Time
+	dailyNotional  float64
+	realizedProfit float64
+	positions      map[string]*RiskPosition
+	orders         map[string]*riskOrder
+	pending        map[int64]*riskOrder // 送っている最中の注文 レスポンスを待つ間も上限の判定に含める
+	finished       map[string]int64     // 終わった注文の最後のイベント番号 遅れて届いたイベントで注文を作り直さないように残す
+	lastReserveNo  int64
+	prices         map[string]float64
+	mtx            sync.Mutex
+}
+
+// NewOrder - リスク上限を確認してから新規注文を送る
+// 確認と同じロックの中で代金、注文数、注文中数量を予約し、送れなかったり受け付けられなかったら予約を戻す
+func (c *RiskClient) NewOrder(ctx context.Context, session *Session, req NewOrderRequest) (*NewOrderResponse, error) {
+	entry := isEntryOrder(req.TradeType, req.Side)
+
+	c.mtx.Lock()
+	c.resetDaily()
+	price := c.orderPrice(req.IssueCode, req.OrderPrice, req.TriggerPrice, req.StopOrderPrice)
+	if entry {
+		if err := c.checkEntry(req.IssueCode, req.Side, price, req.OrderQuantity, req.OrderQuantity, true); err != nil {
+			c.mtx.Unlock()
+			return nil, err
+		}
+	}
+	reserved := &riskOrder{issueCode: req.IssueCode, side: req.Side, entry: entry, price: price, quantity: req.OrderQuantity}
+	c.lastReserveNo++
+	reserveNo, date := c.lastReserveNo, c.date
+	c.pending[reserveNo] = reserved
+	var notional float64
+	if entry {
+		notional = price * req.OrderQuantity
+		c.dailyNotional += notional
+	}
+	c.mtx.Unlock()
+
+	res, err := c.Client.NewOrder(ctx, session, req)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.pending, reserveNo)
+	if err != nil || res == nil || res.ResultCode != "0" {
+		if c.date.Equal(date) {
+			c.dailyNotional -= notional
+		}
+		return res, err
+	}
+	if _, ok := c.finished[res.OrderNumber]; ok {
+		// 注文のレスポンスより先に約定や取消で終わっていた
+		return res, nil
+	}
+	if o, ok := c.orders[res.OrderNumber]; ok {
+		// 注文のレスポンスより先に約定通知が届いていた
+		o.entry = entry
+		if o.price <= 0 {
+			o.price = price
+		}
+		return res, nil
+	}
+	c.orders[res.OrderNumber] = reserved
+	return res, nil
+}
+
+// CorrectOrder - 新規の注文の値段か数量を変えるなら、リスク上限を確認してから訂正注文を送る
+// 確認と同じロックの中で訂正後の値段と数量を予約し、送れなかったり受け付けられなかったら戻す
+// 知らない注文はリスク上限を判定できないので、そのまま送る
+func (c *RiskClient) CorrectOrder(ctx context.Context, session *Session, req CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	c.mtx.Lock()
+	o, ok := c.orders[req.OrderNumber]
+	if !ok {
+		c.mtx.Unlock()
+		return c.Client.CorrectOrder(ctx, session, req)
+	}
+
+	c.resetDaily()
+	beforePrice, beforeQuantity := o.price, o.quantity
+	price, quantity := o.price, o.quantity
+	if req.OrderPrice != NoChangeFloat {
+		price = c.orderPrice(o.issueCode, req.OrderPrice)
+	}
+	if req.OrderQuantity != NoChangeFloat {
+		quantity = req.OrderQuantity
+	}
+	if o.entry && (price != o.price || quantity != o.quantity) {
+		if err := c.checkEntry(o.issueCode, o.side, price, quantity-o.contractQuantity, quantity-o.quantity, false); err != nil {
+			c.mtx.Unlock()
+			return nil, err
+		}
+	}
+	o.price, o.quantity = price, quantity
+	c.mtx.Unlock()
+
+	res, err := c.Client.CorrectOrder(ctx, session, req)
+	if err != nil || res == nil || res.ResultCode != "0" {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		// 待っている間に約定通知や他の訂正で変わっていたら、そちらを優先する
+		if c.orders[req.OrderNumber] == o && o.price == price && o.quantity == quantity {
+			o.price, o.quantity = beforePrice, beforeQuantity
+		}
+	}
+	return res, err
+}
+
+// orderPrice - 代金の計算に使う値段 指値、逆指値、最後にわかった値段の順に使う 0ならわからない ロックを取ってから呼ぶ
+func (c *RiskClient) orderPrice(issueCode string, prices ...float64) float64 {
+	for _, p := range prices {
+		if p > 0 && p != NoChangeFloat {
+			return p
+		}
+	}
+	return c.prices[issueCode]
+}
+
+// checkEntry - 新規注文、新規注文の訂正がリスク上限を超えないか確認する ロックを取ってから呼ぶ
+// notionalQuantityは代金の計算に使う数量、addQuantityは保有数量と注文中数量に加わる数量
+func (c *RiskClient) checkEntry(issueCode string, side Side, price float64, notionalQuantity float64, addQuantity float64, newOrder bool) error {
+	if c.blocked[issueCode] {
+		return &RiskLimitError{Type: RiskLimitTypeBlockedIssue, IssueCode: issueCode}
+	}
+	if c.limits.MaxDailyLoss > 0 && -c.realizedProfit >= c.limits.MaxDailyLoss {
+		return &RiskLimitError{Type: RiskLimitTypeDailyLoss, IssueCode: issueCode, Limit: c.limits.MaxDailyLoss, Value: -c.realizedProfit}
+	}
+	if openOrders := len(c.orders) + len(c.pending) + 1; newOrder && c.limits.MaxOpenOrders > 0 && openOrders > c.limits.MaxOpenOrders {
+		return &RiskLimitError{Type: RiskLimitTypeOpenOrders, IssueCode: issueCode, Limit: float64(c.limits.MaxOpenOrders), Value: float64(openOrders)}
+	}
+
+	if c.limits.MaxOrderNotional > 0 || c.limits.MaxDailyNotional > 0 {
+		if price <= 0 {
+			return &RiskLimitError{Type: RiskLimitTypeUnknownPrice, IssueCode: issueCode}
+		}
+		notional := price * notionalQuantity
+		if c.limits.MaxOrderNotional > 0 && notional > c.limits.MaxOrderNotional {
+			return &RiskLimitError{Type: RiskLimitTypeOrderNotional, IssueCode: issueCode, Limit: c.limits.MaxOrderNotional, Value: notional}
+		}
+		if newOrder && c.limits.MaxDailyNotional > 0 && c.dailyNotional+notional > c.limits.MaxDailyNotional {
+			return &RiskLimitError{Type: RiskLimitTypeDailyNotional, IssueCode: issueCode, Limit: c.limits.MaxDailyNotional, Value: c.dailyNotional + notional}
+		}
+	}
+
+	if c.limits.MaxPositionQuantity > 0 && addQuantity > 0 {
+		quantity := c.exposureQuantity(issueCode, side) + addQuantity
+		if quantity > c.limits.MaxPositionQuantity {
+			return &RiskLimitError{Type: RiskLimitTypePosition, IssueCode: issueCode, Limit: c.limits.MaxPositionQuantity, Value: quantity}
+		}
+	}
+	return nil
+}
+
+// exposureQuantity - 銘柄の保有数量と新規の注文中数量の合計 ロックを取ってから呼ぶ
+func (c *RiskClient) exposureQuantity(issueCode string, side Side) float64 {
+	var quantity float64
+	if p, ok := c.positions[issueCode]; ok {
+		if side == SideBuy {
+			quantity = p.LongQuantity
+		} else {
+			quantity = p.ShortQuantity
+		}
+	}
+	for _, o := range c.orders {
+		if o.entry && o.issueCode == issueCode && o.side == side {
+			quantity += o.remaining()
+		}
+	}
+	for _, o := range c.pending {
+		if o.entry && o.issueCode == issueCode && o.side == side {
+			quantity += o.remaining()
+		}
+	}
+	return quantity
+}
+
+// resetDaily - 日付が変わっていたら代金の合計と確定損益を0に戻す ロックを取ってから呼ぶ
+func (c *RiskClient) resetDaily() {
+	now := c.clock.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !c.date.Equal(today) {
+		c.date, c.dailyNotional, c.realizedProfit = today, 0, 0
+	}
+}
+
+// UpdatePrice - 成行注文の代金の計算に使う値段を更新する
+func (c *RiskClient) UpdatePrice(issueCode string, price float64) {
+	if price <= 0 {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.prices[issueCode] = price
+}
+
+// Refresh - 現物、信用建玉の一覧と注文一覧で、保有数量と注文中の注文を置き換える 代金の合計と確定損益はそのまま
+func (c *RiskClient) Refresh(ctx context.Context, session *Session) error {
+	stocks, err := c.Client.StockPositionList(ctx, session, StockPositionListRequest{})
+	if err != nil {
+		return err
+	}
+	margins, err := c.Client.MarginPositionList(ctx, session, MarginPositionListRequest{})
+	if err != nil {
+		return err
+	}
+	list, err := c.Client.OrderList(ctx, session, OrderListRequest{OrderInquiryStatus: OrderInquiryStatusEditable})
+	if err != nil {
+		return err
+	}
+
+	positions := map[string]*RiskPosition{}
+	position := func(issueCode string) *RiskPosition {
+		if _, ok := positions[issueCode]; !ok {
+			positions[issueCode] = &RiskPosition{IssueCode: issueCode}
+		}
+		return positions[issueCode]
+	}
+	for _, s := range stocks.Positions {
+		p := position(s.IssueCode)
+		p.LongPrice, p.LongQuantity = averagePrice(p.LongPrice, p.LongQuantity, s.BookValuation, s.OwnedQuantity)
+	}
+	for _, m := range margins.Positions {
+		p := position(m.IssueCode)
+		if m.Side == SideBuy {
+			p.LongPrice, p.LongQuantity = averagePrice(p.LongPrice, p.LongQuantity, m.UnitPrice, m.OwnedQuantity)
+		} else {
+			p.ShortPrice, p.ShortQuantity = averagePrice(p.ShortPrice, p.ShortQuantity, m.UnitPrice, m.OwnedQuantity)
+		}
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, s := range stocks.Positions {
+		if s.UnitValuation > 0 {
+			c.prices[s.IssueCode] = s.UnitValuation
+		}
+	}
+	for _, m := range margins.Positions {
+		if m.CurrentPrice > 0 {
+			c.prices[m.IssueCode] = m.CurrentPrice
+		}
+	}
+
+	orders := map[string]*riskOrder{}
+	for _, o := range list.Orders {
+		order := &riskOrder{issueCode: o.IssueCode, side: o.Side, entry: isEntryOrder(o.TradeType, o.Side), price: o.Price, quantity: o.OrderQuantity, contractQuantity: o.ContractQuantity}
+		if known, ok := c.orders[o.OrderNumber]; ok {
+			order.lastEventNo = known.lastEventNo
+			if order.price <= 0 {
+				order.price = known.price
+			}
+		}
+		orders[o.OrderNumber] = order
+	}
+	c.positions, c.orders = positions, orders
+	return nil
+}
+
+// averagePrice - 平均単価と数量に、単価と数量を加えた平均単価と数量
+func averagePrice(price float64, quantity float64, addPrice float64, addQuantity float64) (float64, float64) {
+	total := quantity + addQuantity
+	if total <= 0 {
+		return 0, 0
+	}
+	return (price*quantity + addPrice*addQuantity) / total, total
+}
+
+// Apply - 約定通知で保有数量、確定損益、注文中の注文を更新する 同じ注文の古いイベントと、終わった注文のイベントは無視する
+// 現物と信用の買いは同じ平均単価にまとめるので、確定損益は目安になる
+func (c *RiskClient) Apply(res *ContractStreamResponse) {
+	if res == nil || res.OrderNumber == "" {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.resetDaily()
+
+	if _, ok := c.finished[res.OrderNumber]; ok {
+		return
+	}
+	o, ok := c.orders[res.OrderNumber]
+	if !ok {
+		o = &riskOrder{issueCode: res.IssueCode, side: res.Side, entry: isEntryOrder(res.TradeType, res.Side), price: res.Price, quantity: res.Quantity}
+		c.orders[res.OrderNumber] = o
+	}
+	if res.EventNo <= o.lastEventNo {
+		return
+	}
+	o.lastEventNo = res.EventNo
+	if res.Quantity > 0 {
+		o.quantity = res.Quantity
+	}
+
+	if res.StreamOrderType == StreamOrderTypeContract && res.SecurityContractQuantity > 0 {
+		c.fill(o, res.SecurityContractPrice, res.SecurityContractQuantity)
+		if res.ContractQuantity > o.contractQuantity {
+			o.contractQuantity = res.ContractQuantity
+		}
+	}
+	if streamOrderState(res).Done() {
+		c.finished[res.OrderNumber] = o.lastEventNo
+		delete(c.orders, res.OrderNumber)
+	}
+}
+
+// fill - 約定を保有数量と確定損益に反映する ロックを取ってから呼ぶ
+func (c *RiskClient) fill(o *riskOrder, price float64, quantity float64) {
+	if price > 0 {
+		c.prices[o.issueCode] = price
+	}
+	p, ok := c.positions[o.issueCode]
+	if !ok {
+		p = &RiskPosition{IssueCode: o.issueCode}
+		c.positions[o.issueCode] = p
+	}
+
+	switch {
+	case o.entry && o.side == SideBuy:
+		p.LongPrice, p.LongQuantity = averagePrice(p.LongPrice, p.LongQuantity, price, quantity)
+	case o.entry:
+		p.ShortPrice, p.ShortQuantity = averagePrice(p.ShortPrice, p.ShortQuantity, price, quantity)
+	case o.side == SideSell:
+		c.realizedProfit += (price - p.LongPrice) * quantity
+		p.LongQuantity -= quantity
+		if p.LongQuantity <= 0 {
+			p.LongQuantity, p.LongPrice = 0, 0
+		}
+	default:
+		c.realizedProfit += (p.ShortPrice - price) * quantity
+		p.ShortQuantity -= quantity
+		if p.ShortQuantity <= 0 {
+			p.ShortQuantity, p.ShortPrice = 0, 0
+		}
+	}
+}
+
+// Exposure - リスク上限の判定に使っている状態
+func (c *RiskClient) Exposure() RiskExposure {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.resetDaily()
+
+	positions := make([]RiskPosition, 0, len(c.positions))
+	for _, p := range c.positions {
+		positions = append(positions, *p)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].IssueCode < positions[j].IssueCode })
+	return RiskExposure{
+		Date:           c.date,
+		DailyNotional:  c.dailyNotional,
+		RealizedProfit: c.realizedProfit,
+		OpenOrders:     len(c.orders) + len(c.pending),
+		Positions:      positions,
+	}
+}
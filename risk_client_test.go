@@ -0,0 +1,396 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestRiskClient - テスト用のリスク上限を守るクライアント 日付は2022/07/26
+func newTestRiskClient(client Client, limits RiskLimits) *RiskClient {
+	c := NewRiskClient(client, limits)
+	c.clock = &testClock{Now1: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)}
+	return c
+}
+
+func Test_RiskLimitError(t *testing.T) {
+	t.Parallel()
+	var err error = &RiskLimitError{Type: RiskLimitTypePosition, IssueCode: "1475", Limit: 100, Value: 200}
+
+	var got *RiskLimitError
+	if !errors.Is(err, RiskLimitErr) || !errors.As(err, &got) || got.Type != RiskLimitTypePosition {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), RiskLimitTypePosition, err)
+	}
+}
+
+func Test_isEntryOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		tradeType TradeType
+		side      Side
+		want      bool
+	}{
+		{name: "現物買いは新規", tradeType: TradeTypeStock, side: SideBuy, want: true},
+		{name: "現物売りは返済", tradeType: TradeTypeStock, side: SideSell, want: false},
+		{name: "制度信用新規売りは新規", tradeType: TradeTypeStandardEntry, side: SideSell, want: true},
+		{name: "一般信用新規買いは新規", tradeType: TradeTypeNegotiateEntry, side: SideBuy, want: true},
+		{name: "制度信用返済は返済", tradeType: TradeTypeStandardExit, side: SideBuy, want: false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := isEntryOrder(test.tradeType, test.side)
+			if test.want != got {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_RiskClient_NewOrder(t *testing.T) {
+	t.Parallel()
+	buy := NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderPrice: 2000, OrderQuantity: 100}
+	tests := []struct {
+		name          string
+		limits        RiskLimits
+		setup         func(c *RiskClient)
+		req           NewOrderRequest
+		wantType      RiskLimitType
+		wantNewOrders int
+	}{
+		{name: "上限内なら送る", limits: RiskLimits{MaxOrderNotional: 200000, MaxDailyNotional: 200000, MaxPositionQuantity: 100, MaxOpenOrders: 1, MaxDailyLoss: 10000},
+			req: buy, wantNewOrders: 1},
+		{name: "禁止銘柄は送らない", limits: RiskLimits{BlockedIssueCodes: []string{"1475"}}, req: buy, wantType: RiskLimitTypeBlockedIssue},
+		{name: "1注文の代金を超えたら送らない", limits: RiskLimits{MaxOrderNotional: 199999}, req: buy, wantType: RiskLimitTypeOrderNotional},
+		{name: "1日の代金の合計を超えたら送らない", limits: RiskLimits{MaxDailyNotional: 300000},
+			setup: func(c *RiskClient) { c.date, c.dailyNotional = time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), 100001 },
+			req:   buy, wantType: RiskLimitTypeDailyNotional},
+		{name: "日付が変わったら1日の代金の合計は0から", limits: RiskLimits{MaxDailyNotional: 300000},
+			setup: func(c *RiskClient) { c.date, c.dailyNotional = time.Date(2022, 7, 25, 0, 0, 0, 0, time.Local), 300000 },
+			req:   buy, wantNewOrders: 1},
+		{name: "保有数量と注文中数量の合計が上限を超えたら送らない", limits: RiskLimits{MaxPositionQuantity: 300},
+			setup: func(c *RiskClient) {
+				c.positions["1475"] = &RiskPosition{IssueCode: "1475", LongQuantity: 100}
+				c.orders["1"] = &riskOrder{issueCode: "1475", side: SideBuy, entry: true, quantity: 200, contractQuantity: 100}
+			},
+			req: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderPrice: 2000, OrderQuantity: 200}, wantType: RiskLimitTypePosition},
+		{name: "売建玉の数量は買いの上限に含めない", limits: RiskLimits{MaxPositionQuantity: 100},
+			setup: func(c *RiskClient) { c.positions["1475"] = &RiskPosition{IssueCode: "1475", ShortQuantity: 100} },
+			req:   buy, wantNewOrders: 1},
+		{name: "注文中の注文数が上限に達していたら送らない", limits: RiskLimits{MaxOpenOrders: 1},
+			setup: func(c *RiskClient) { c.orders["1"] = &riskOrder{issueCode: "1476", quantity: 100} },
+			req:   buy, wantType: RiskLimitTypeOpenOrders},
+		{name: "確定損失が上限に達していたら送らない", limits: RiskLimits{MaxDailyLoss: 10000},
+			setup: func(c *RiskClient) { c.date, c.realizedProfit = time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), -10000 },
+			req:   buy, wantType: RiskLimitTypeDailyLoss},
+		{name: "成行は最後にわかった値段で代金を計算する", limits: RiskLimits{MaxOrderNotional: 100000},
+			setup: func(c *RiskClient) { c.prices["1475"] = 2000 },
+			req:   NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100}, wantType: RiskLimitTypeOrderNotional},
+		{name: "成行で値段がわからなければ送らない", limits: RiskLimits{MaxOrderNotional: 100000},
+			req: NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100}, wantType: RiskLimitTypeUnknownPrice},
+		{name: "返済はどの上限も超えていても送る",
+			limits: RiskLimits{MaxOrderNotional: 1, MaxDailyNotional: 1, MaxPositionQuantity: 1, MaxOpenOrders: 1, MaxDailyLoss: 1, BlockedIssueCodes: []string{"1475"}},
+			setup: func(c *RiskClient) {
+				c.date, c.realizedProfit = time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), -10000
+				c.orders["1"] = &riskOrder{issueCode: "1476", quantity: 100}
+			},
+			req: NewOrderRequest{IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, OrderQuantity: 100}, wantNewOrders: 1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "2"}}
+			c := newTestRiskClient(client, test.limits)
+			if test.setup != nil {
+				test.setup(c)
+			}
+
+			_, err := c.NewOrder(context.Background(), &Session{}, test.req)
+			var gotType RiskLimitType
+			var limitErr *RiskLimitError
+			if errors.As(err, &limitErr) {
+				gotType = limitErr.Type
+			}
+			if test.wantType != gotType || test.wantNewOrders != client.newOrderCount || (test.wantType == RiskLimitTypeUnspecified) != (err == nil) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantType, test.wantNewOrders, gotType, client.newOrderCount, err)
+			}
+		})
+	}
+}
+
+// Test_RiskClient_NewOrder_exposure - 受け付けられた新規注文は代金の合計と注文中の注文に加える
+func Test_RiskClient_NewOrder_exposure(t *testing.T) {
+	t.Parallel()
+	client := &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1"}}
+	c := newTestRiskClient(client, RiskLimits{})
+	if _, err := c.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderPrice: 2000, OrderQuantity: 100}); err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+	client.newOrder1 = &NewOrderResponse{ResultCode: "11104"}
+	if _, err := c.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderPrice: 2000, OrderQuantity: 100}); err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+
+	want := RiskExposure{Date: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), DailyNotional: 200000, OpenOrders: 1, Positions: []RiskPosition{}}
+	got := c.Exposure()
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+// slowNewOrderClient - 新規注文のレスポンスを遅らせるクライアント
+type slowNewOrderClient struct {
+	*testClient
+	delay time.Duration
+}
+
+func (c *slowNewOrderClient) NewOrder(ctx context.Context, session *Session, req NewOrderRequest) (*NewOrderResponse, error) {
+	time.Sleep(c.delay)
+	return c.testClient.NewOrder(ctx, session, req)
+}
+
+// Test_RiskClient_NewOrder_concurrent - 同時に送っても、確認と予約が同じロックの中なので上限を超えない
+func Test_RiskClient_NewOrder_concurrent(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		limits RiskLimits
+	}{
+		{name: "注文数の上限", limits: RiskLimits{MaxOpenOrders: 1}},
+		{name: "1日の代金の合計の上限", limits: RiskLimits{MaxDailyNotional: 200000}},
+		{name: "1銘柄の数量の上限", limits: RiskLimits{MaxPositionQuantity: 100}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "1"}}
+			c := newTestRiskClient(&slowNewOrderClient{testClient: client, delay: 10 * time.Millisecond}, test.limits)
+
+			n := 10
+			start := make(chan struct{})
+			errs := make(chan error, n)
+			for i := 0; i < n; i++ {
+				go func() {
+					<-start
+					_, err := c.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderPrice: 2000, OrderQuantity: 100})
+					errs <- err
+				}()
+			}
+			close(start)
+
+			var limited int
+			for i := 0; i < n; i++ {
+				if err := <-errs; errors.Is(err, RiskLimitErr) {
+					limited++
+				}
+			}
+			if limited != n-1 || client.newOrderCount != 1 {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), n-1, 1, limited, client.newOrderCount)
+			}
+		})
+	}
+}
+
+// Test_RiskClient_NewOrder_release - 送れなかったり受け付けられなかった新規注文の予約は戻す
+func Test_RiskClient_NewOrder_release(t *testing.T) {
+	t.Parallel()
+	sendErr := errors.New("send error")
+	tests := []struct {
+		name   string
+		client *testClient
+	}{
+		{name: "受け付けられなければ戻す", client: &testClient{newOrder1: &NewOrderResponse{ResultCode: "11104"}}},
+		{name: "送れなければ戻す", client: &testClient{newOrder2: sendErr}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			c := newTestRiskClient(test.client, RiskLimits{MaxOpenOrders: 1, MaxDailyNotional: 200000, MaxPositionQuantity: 100})
+			_, _ = c.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderPrice: 2000, OrderQuantity: 100})
+
+			want := RiskExposure{Date: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), Positions: []RiskPosition{}}
+			got := c.Exposure()
+			if !reflect.DeepEqual(want, got) || len(c.pending) != 0 {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, 0, got, len(c.pending))
+			}
+		})
+	}
+}
+
+// Test_RiskClient_CorrectOrder_release - 受け付けられなかった訂正注文は値段と数量を戻す
+func Test_RiskClient_CorrectOrder_release(t *testing.T) {
+	t.Parallel()
+	client := &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "11109"}}
+	c := newTestRiskClient(client, RiskLimits{MaxPositionQuantity: 200})
+	c.orders["1"] = &riskOrder{issueCode: "1475", side: SideBuy, entry: true, price: 2000, quantity: 100}
+
+	_, _ = c.CorrectOrder(context.Background(), &Session{}, CorrectOrderRequest{OrderNumber: "1", OrderPrice: 2100, OrderQuantity: 200})
+	want := riskOrder{issueCode: "1475", side: SideBuy, entry: true, price: 2000, quantity: 100}
+	if got := *c.orders["1"]; !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+func Test_RiskClient_CorrectOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		req          CorrectOrderRequest
+		wantType     RiskLimitType
+		wantCorrects int
+		wantOrder    riskOrder
+	}{
+		{name: "上限内の数量の変更なら送って注文を更新する", req: CorrectOrderRequest{OrderNumber: "1", OrderPrice: NoChangeFloat, OrderQuantity: 200},
+			wantCorrects: 1, wantOrder: riskOrder{issueCode: "1475", side: SideBuy, entry: true, price: 2000, quantity: 200}},
+		{name: "数量を増やして上限を超えるなら送らない", req: CorrectOrderRequest{OrderNumber: "1", OrderPrice: NoChangeFloat, OrderQuantity: 300},
+			wantType: RiskLimitTypePosition, wantOrder: riskOrder{issueCode: "1475", side: SideBuy, entry: true, price: 2000, quantity: 100}},
+		{name: "値段を上げて1注文の代金を超えるなら送らない", req: CorrectOrderRequest{OrderNumber: "1", OrderPrice: 7001, OrderQuantity: NoChangeFloat},
+			wantType: RiskLimitTypeOrderNotional, wantOrder: riskOrder{issueCode: "1475", side: SideBuy, entry: true, price: 2000, quantity: 100}},
+		{name: "知らない注文はそのまま送る", req: CorrectOrderRequest{OrderNumber: "9", OrderPrice: 9999, OrderQuantity: 9999},
+			wantCorrects: 1, wantOrder: riskOrder{issueCode: "1475", side: SideBuy, entry: true, price: 2000, quantity: 100}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "0"}}
+			c := newTestRiskClient(client, RiskLimits{MaxOrderNotional: 700000, MaxPositionQuantity: 200})
+			c.orders["1"] = &riskOrder{issueCode: "1475", side: SideBuy, entry: true, price: 2000, quantity: 100}
+
+			_, err := c.CorrectOrder(context.Background(), &Session{}, test.req)
+			var gotType RiskLimitType
+			var limitErr *RiskLimitError
+			if errors.As(err, &limitErr) {
+				gotType = limitErr.Type
+			}
+			got := *c.orders["1"]
+			if test.wantType != gotType || test.wantCorrects != client.correctCount || !reflect.DeepEqual(test.wantOrder, got) {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantType, test.wantCorrects, test.wantOrder, gotType, client.correctCount, got)
+			}
+		})
+	}
+}
+
+func Test_RiskClient_Refresh(t *testing.T) {
+	t.Parallel()
+	client := &testClient{
+		stockPositionList1: &StockPositionListResponse{Positions: []StockPosition{{IssueCode: "1475", OwnedQuantity: 100, BookValuation: 1900, UnitValuation: 2000}}},
+		marginPositionList1: &MarginPositionListResponse{Positions: []MarginPosition{
+			{IssueCode: "1475", Side: SideBuy, OwnedQuantity: 300, UnitPrice: 2100, CurrentPrice: 2001},
+			{IssueCode: "1476", Side: SideSell, OwnedQuantity: 200, UnitPrice: 3000}}},
+		orderList1: &OrderListResponse{Orders: []Order{{OrderNumber: "1", IssueCode: "1476", Side: SideSell, TradeType: TradeTypeStandardEntry, Price: 3100, OrderQuantity: 100}}},
+	}
+	c := newTestRiskClient(client, RiskLimits{})
+	if err := c.Refresh(context.Background(), &Session{}); err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+
+	want := RiskExposure{Date: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), OpenOrders: 1, Positions: []RiskPosition{
+		{IssueCode: "1475", LongQuantity: 400, LongPrice: 2050},
+		{IssueCode: "1476", ShortQuantity: 200, ShortPrice: 3000}}}
+	got := c.Exposure()
+	if !reflect.DeepEqual(want, got) || c.prices["1475"] != 2001 {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, 2001, got, c.prices["1475"])
+	}
+}
+
+// Test_RiskClient_Apply - 約定通知で保有数量と確定損益を更新し、終わった注文を注文中から外す 同じイベントは二重に数えない
+func Test_RiskClient_Apply(t *testing.T) {
+	t.Parallel()
+	c := newTestRiskClient(&testClient{}, RiskLimits{})
+	c.positions["1475"] = &RiskPosition{IssueCode: "1475", LongQuantity: 200, LongPrice: 2000}
+
+	events := []*ContractStreamResponse{
+		{EventNo: 1, StreamOrderType: StreamOrderTypeReceiveOrder, OrderNumber: "1", IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, Quantity: 200},
+		{EventNo: 2, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, Quantity: 200,
+			ContractQuantity: 100, ContractStatus: ContractStatusPart, SecurityContractPrice: 1950, SecurityContractQuantity: 100},
+		{EventNo: 2, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, Quantity: 200,
+			ContractQuantity: 100, ContractStatus: ContractStatusPart, SecurityContractPrice: 1950, SecurityContractQuantity: 100},
+		{EventNo: 3, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", IssueCode: "1475", Side: SideSell, TradeType: TradeTypeStock, Quantity: 200,
+			ContractQuantity: 200, ContractStatus: ContractStatusDone, SecurityContractPrice: 1900, SecurityContractQuantity: 100},
+		{EventNo: 4, StreamOrderType: StreamOrderTypeContract, OrderNumber: "2", IssueCode: "1476", Side: SideSell, TradeType: TradeTypeStandardEntry, Quantity: 100,
+			ContractQuantity: 100, ContractStatus: ContractStatusDone, SecurityContractPrice: 3000, SecurityContractQuantity: 100},
+	}
+	for _, e := range events {
+		c.Apply(e)
+	}
+
+	want := RiskExposure{Date: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), RealizedProfit: -15000, OpenOrders: 0, Positions: []RiskPosition{
+		{IssueCode: "1475"},
+		{IssueCode: "1476", ShortQuantity: 100, ShortPrice: 3000}}}
+	got := c.Exposure()
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+// Test_RiskClient_Apply_afterDone - 終わった注文に遅れて届いたイベントや再送されたイベントでは、注文中の注文を作り直さない
+func Test_RiskClient_Apply_afterDone(t *testing.T) {
+	t.Parallel()
+	client := &testClient{newOrder1: &NewOrderResponse{ResultCode: "0", OrderNumber: "2"}}
+	c := newTestRiskClient(client, RiskLimits{MaxOpenOrders: 1})
+
+	events := []*ContractStreamResponse{
+		{EventNo: 3, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, Quantity: 100,
+			ContractQuantity: 100, ContractStatus: ContractStatusDone, SecurityContractPrice: 2000, SecurityContractQuantity: 100},
+		{EventNo: 1, StreamOrderType: StreamOrderTypeReceiveOrder, OrderNumber: "1", IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, Quantity: 100},
+		{EventNo: 3, StreamOrderType: StreamOrderTypeContract, OrderNumber: "1", IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, Quantity: 100,
+			ContractQuantity: 100, ContractStatus: ContractStatusDone, SecurityContractPrice: 2000, SecurityContractQuantity: 100},
+		{EventNo: 4, StreamOrderType: StreamOrderTypeContract, OrderNumber: "2", IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, Quantity: 100,
+			ContractQuantity: 100, ContractStatus: ContractStatusDone, SecurityContractPrice: 2010, SecurityContractQuantity: 100},
+	}
+	for _, e := range events {
+		c.Apply(e)
+	}
+	// 約定通知が先に届いて終わった注文は、新規注文のレスポンスを受けても注文中にしない
+	if _, err := c.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Side: SideBuy, TradeType: TradeTypeStock, OrderPrice: 2010, OrderQuantity: 100}); err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+
+	want := RiskExposure{Date: time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local), DailyNotional: 201000, OpenOrders: 0, Positions: []RiskPosition{
+		{IssueCode: "1475", LongQuantity: 200, LongPrice: 2005}}}
+	got := c.Exposure()
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+func Test_averagePrice(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		price        float64
+		quantity     float64
+		addPrice     float64
+		addQuantity  float64
+		wantPrice    float64
+		wantQuantity float64
+	}{
+		{name: "数量加重平均", price: 2000, quantity: 100, addPrice: 2100, addQuantity: 300, wantPrice: 2075, wantQuantity: 400},
+		{name: "0に加える", addPrice: 2100, addQuantity: 300, wantPrice: 2100, wantQuantity: 300},
+		{name: "どちらも0なら0", wantPrice: 0, wantQuantity: 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			gotPrice, gotQuantity := averagePrice(test.price, test.quantity, test.addPrice, test.addQuantity)
+			if test.wantPrice != gotPrice || test.wantQuantity != gotQuantity {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.wantPrice, test.wantQuantity, gotPrice, gotQuantity)
+			}
+		})
+	}
+}
@@ -1,10 +1,8 @@
 package tachibana
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +14,7 @@ type StreamRequest struct {
 	MarketCodes       []Exchange  // 株価ボード専用 市場コード
 	StartStreamNumber int64       // 配信開始イベント通知番号
 	StreamEventTypes  []EventType // 通知種別
+	NotifyKeepAlive   bool        // キープアライブもイベントとして通知する ※リクエストには含まれない
 }
 
 func (r *StreamRequest) Query() []byte {
@@ -63,7 +62,7 @@ type StreamResponse interface {
 	GetEventType() EventType
 	GetErrorNo() ErrorNo
 	GetErrorText() string
-	parse(m map[string][]string, b []byte)
+	decode(f *streamFrame)
 }
 
 type CommonStreamResponse struct {
@@ -87,23 +86,6 @@ func (r *CommonStreamResponse) GetErrorText() string {
 	return r.ErrorText
 }
 
-func (r *CommonStreamResponse) getFromMap(m map[string][]string, key string) []string {
-	if s, ok := m[key]; ok {
-		return s
-	} else {
-		return []string{""}
-	}
-}
-
-func (r *CommonStreamResponse) parse(m map[string][]string, b []byte) {
-	r.EventType = EventType(r.getFromMap(m, "p_cmd")[0])
-	r.StreamNumber, _ = strconv.ParseInt(r.getFromMap(m, "p_no")[0], 10, 64)
-	r.StreamDateTime, _ = time.ParseInLocation("2006.01.02-15:04:05.000", r.getFromMap(m, "p_date")[0], time.Local)
-	r.ErrorNo = ErrorNo(r.getFromMap(m, "p_errno")[0])
-	r.ErrorText = r.getFromMap(m, "p_err")[0]
-	r.Body = b
-}
-
 type MarketPriceStreamResponse struct {
 	CommonStreamResponse
 	ColumnNumber      int                 // 行番号
@@ -177,94 +159,211 @@ type MarketPriceStreamResponse struct {
 	AskQuantityOver   float64             // 売-OVER
 	BidQuantityUnder  float64             // 買-UNDER
 	VWAP              float64             // VWAP
+	PresentFields     MarketPriceFieldSet // フレームに含まれていた項目 差分配信で含まれなかった項目はゼロ値になっている
 }
 
-func (r *MarketPriceStreamResponse) getColumnNumber(m map[string][]string) int {
-	for k := range m {
-		match := regexp.MustCompile(`^p_(\d+)_.+$`).FindAllStringSubmatch(k, -1)
-		if len(match) == 0 {
-			continue
-		}
+// Has - 項目がフレームに含まれていたか
+func (r *MarketPriceStreamResponse) Has(f MarketPriceField) bool {
+	return r.PresentFields.Has(f)
+}
+
+// MarketPriceField - 時価情報の項目
+type MarketPriceField uint8
+
+const (
+	MarketPriceFieldAskQuantityMarket MarketPriceField = iota // 売数量(成行)
+	MarketPriceFieldBidQuantityMarket                         // 買数量(成行)
+	MarketPriceFieldAskQuantity                               // 売気配数量
+	MarketPriceFieldBidQuantity                               // 買気配数量
+	MarketPriceFieldDiscontinuityType                         // 不連続要因銘柄区分
+	MarketPriceFieldStopHigh                                  // 日通し高値フラグ
+	MarketPriceFieldHighPrice                                 // 高値
+	MarketPriceFieldHighPriceTime                             // 高値時刻
+	MarketPriceFieldTradingAmount                             // 売買代金
+	MarketPriceFieldStopLow                                   // 日通し安値フラグ
+	MarketPriceFieldLowPrice                                  // 安値
+	MarketPriceFieldLowPriceTime                              // 安値時刻
+	MarketPriceFieldOpenPrice                                 // 始値
+	MarketPriceFieldOpenPriceTime                             // 始値時刻
+	MarketPriceFieldChangePriceType                           // 現値前値比較
+	MarketPriceFieldCurrentPrice                              // 現在値
+	MarketPriceFieldCurrentPriceTime                          // 現在値時刻
+	MarketPriceFieldVolume                                    // 出来高
+	MarketPriceFieldExRightType                               // 配当落銘柄区分
+	MarketPriceFieldPrevDayPercent                            // 騰落率
+	MarketPriceFieldPrevDayRatio                              // 前日比
+	MarketPriceFieldAskQuantity10                             // 売-10-数量
+	MarketPriceFieldAskPrice10                                // 売-10-値段
+	MarketPriceFieldAskQuantity9                              // 売-9-数量
+	MarketPriceFieldAskPrice9                                 // 売-9-値段
+	MarketPriceFieldAskQuantity8                              // 売-8-数量
+	MarketPriceFieldAskPrice8                                 // 売-8-値段
+	MarketPriceFieldAskQuantity7                              // 売-7-数量
+	MarketPriceFieldAskPrice7                                 // 売-7-値段
+	MarketPriceFieldAskQuantity6                              // 売-6-数量
+	MarketPriceFieldAskPrice6                                 // 売-6-値段
+	MarketPriceFieldAskQuantity5                              // 売-5-数量
+	MarketPriceFieldAskPrice5                                 // 売-5-値段
+	MarketPriceFieldAskQuantity4                              // 売-4-数量
+	MarketPriceFieldAskPrice4                                 // 売-4-値段
+	MarketPriceFieldAskQuantity3                              // 売-3-数量
+	MarketPriceFieldAskPrice3                                 // 売-3-値段
+	MarketPriceFieldAskQuantity2                              // 売-2-数量
+	MarketPriceFieldAskPrice2                                 // 売-2-値段
+	MarketPriceFieldAskQuantity1                              // 売-1-数量
+	MarketPriceFieldAskPrice1                                 // 売-1-値段
+	MarketPriceFieldBidQuantity1                              // 買-1-数量
+	MarketPriceFieldBidPrice1                                 // 買-1-値段
+	MarketPriceFieldBidQuantity2                              // 買-2-数量
+	MarketPriceFieldBidPrice2                                 // 買-2-値段
+	MarketPriceFieldBidQuantity3                              // 買-3-数量
+	MarketPriceFieldBidPrice3                                 // 買-3-値段
+	MarketPriceFieldBidQuantity4                              // 買-4-数量
+	MarketPriceFieldBidPrice4                                 // 買-4-値段
+	MarketPriceFieldBidQuantity5                              // 買-5-数量
+	MarketPriceFieldBidPrice5                                 // 買-5-値段
+	MarketPriceFieldBidQuantity6                              // 買-6-数量
+	MarketPriceFieldBidPrice6                                 // 買-6-値段
+	MarketPriceFieldBidQuantity7                              // 買-7-数量
+	MarketPriceFieldBidPrice7                                 // 買-7-値段
+	MarketPriceFieldBidQuantity8                              // 買-8-数量
+	MarketPriceFieldBidPrice8                                 // 買-8-値段
+	MarketPriceFieldBidQuantity9                              // 買-9-数量
+	MarketPriceFieldBidPrice9                                 // 買-9-値段
+	MarketPriceFieldBidQuantity10                             // 買-10-数量
+	MarketPriceFieldBidPrice10                                // 買-10-値段
+	MarketPriceFieldSection                                   // 所属
+	MarketPriceFieldPRP                                       // 前日終値
+	MarketPriceFieldAskPrice                                  // 売気配値
+	MarketPriceFieldAskSign                                   // 売気配値種類
+	MarketPriceFieldBidPrice                                  // 買気配値
+	MarketPriceFieldBidSign                                   // 買気配値種類
+	MarketPriceFieldAskQuantityOver                           // 売-OVER
+	MarketPriceFieldBidQuantityUnder                          // 買-UNDER
+	MarketPriceFieldVWAP                                      // VWAP
+	marketPriceFieldLen
+)
+
+// marketPriceFields - 項目ごとのキーと構造体のフィールド名
+var marketPriceFields = [marketPriceFieldLen]struct {
+	key  string
+	name string
+}{
+	MarketPriceFieldAskQuantityMarket: {key: "AAV", name: "AskQuantityMarket"},
+	MarketPriceFieldBidQuantityMarket: {key: "ABV", name: "BidQuantityMarket"},
+	MarketPriceFieldAskQuantity:       {key: "AV", name: "AskQuantity"},
+	MarketPriceFieldBidQuantity:       {key: "BV", name: "BidQuantity"},
+	MarketPriceFieldDiscontinuityType: {key: "DCFS", name: "DiscontinuityType"},
+	MarketPriceFieldStopHigh:          {key: "DHF", name: "StopHigh"},
+	MarketPriceFieldHighPrice:         {key: "DHP", name: "HighPrice"},
+	MarketPriceFieldHighPriceTime:     {key: "DHP:T", name: "HighPriceTime"},
+	MarketPriceFieldTradingAmount:     {key: "DJ", name: "TradingAmount"},
+	MarketPriceFieldStopLow:           {key: "DLF", name: "StopLow"},
+	MarketPriceFieldLowPrice:          {key: "DLP", name: "LowPrice"},
+	MarketPriceFieldLowPriceTime:      {key: "DLP:T", name: "LowPriceTime"},
+	MarketPriceFieldOpenPrice:         {key: "DOP", name: "OpenPrice"},
+	MarketPriceFieldOpenPriceTime:     {key: "DOP:T", name: "OpenPriceTime"},
+	MarketPriceFieldChangePriceType:   {key: "DPG", name: "ChangePriceType"},
+	MarketPriceFieldCurrentPrice:      {key: "DPP", name: "CurrentPrice"},
+	MarketPriceFieldCurrentPriceTime:  {key: "DPP:T", name: "CurrentPriceTime"},
+	MarketPriceFieldVolume:            {key: "DV", name: "Volume"},
+	MarketPriceFieldExRightType:       {key: "DVES", name: "ExRightType"},
+	MarketPriceFieldPrevDayPercent:    {key: "DYRP", name: "PrevDayPercent"},
+	MarketPriceFieldPrevDayRatio:      {key: "DYWP", name: "PrevDayRatio"},
+	MarketPriceFieldAskQuantity10:     {key: "GAV10", name: "AskQuantity10"},
+	MarketPriceFieldAskPrice10:        {key: "GAP10", name: "AskPrice10"},
+	MarketPriceFieldAskQuantity9:      {key: "GAV9", name: "AskQuantity9"},
+	MarketPriceFieldAskPrice9:         {key: "GAP9", name: "AskPrice9"},
+	MarketPriceFieldAskQuantity8:      {key: "GAV8", name: "AskQuantity8"},
+	MarketPriceFieldAskPrice8:         {key: "GAP8", name: "AskPrice8"},
+	MarketPriceFieldAskQuantity7:      {key: "GAV7", name: "AskQuantity7"},
+	MarketPriceFieldAskPrice7:         {key: "GAP7", name: "AskPrice7"},
+	MarketPriceFieldAskQuantity6:      {key: "GAV6", name: "AskQuantity6"},
+	MarketPriceFieldAskPrice6:         {key: "GAP6", name: "AskPrice6"},
+	MarketPriceFieldAskQuantity5:      {key: "GAV5", name: "AskQuantity5"},
+	MarketPriceFieldAskPrice5:         {key: "GAP5", name: "AskPrice5"},
+	MarketPriceFieldAskQuantity4:      {key: "GAV4", name: "AskQuantity4"},
+	MarketPriceFieldAskPrice4:         {key: "GAP4", name: "AskPrice4"},
+	MarketPriceFieldAskQuantity3:      {key: "GAV3", name: "AskQuantity3"},
+	MarketPriceFieldAskPrice3:         {key: "GAP3", name: "AskPrice3"},
+	MarketPriceFieldAskQuantity2:      {key: "GAV2", name: "AskQuantity2"},
+	MarketPriceFieldAskPrice2:         {key: "GAP2", name: "AskPrice2"},
+	MarketPriceFieldAskQuantity1:      {key: "GAV1", name: "AskQuantity1"},
+	MarketPriceFieldAskPrice1:         {key: "GAP1", name: "AskPrice1"},
+	MarketPriceFieldBidQuantity1:      {key: "GBV1", name: "BidQuantity1"},
+	MarketPriceFieldBidPrice1:         {key: "GBP1", name: "BidPrice1"},
+	MarketPriceFieldBidQuantity2:      {key: "GBV2", name: "BidQuantity2"},
+	MarketPriceFieldBidPrice2:         {key: "GBP2", name: "BidPrice2"},
+	MarketPriceFieldBidQuantity3:      {key: "GBV3", name: "BidQuantity3"},
+	MarketPriceFieldBidPrice3:         {key: "GBP3", name: "BidPrice3"},
+	MarketPriceFieldBidQuantity4:      {key: "GBV4", name: "BidQuantity4"},
+	MarketPriceFieldBidPrice4:         {key: "GBP4", name: "BidPrice4"},
+	MarketPriceFieldBidQuantity5:      {key: "GBV5", name: "BidQuantity5"},
+	MarketPriceFieldBidPrice5:         {key: "GBP5", name: "BidPrice5"},
+	MarketPriceFieldBidQuantity6:      {key: "GBV6", name: "BidQuantity6"},
+	MarketPriceFieldBidPrice6:         {key: "GBP6", name: "BidPrice6"},
+	MarketPriceFieldBidQuantity7:      {key: "GBV7", name: "BidQuantity7"},
+	MarketPriceFieldBidPrice7:         {key: "GBP7", name: "BidPrice7"},
+	MarketPriceFieldBidQuantity8:      {key: "GBV8", name: "BidQuantity8"},
+	MarketPriceFieldBidPrice8:         {key: "GBP8", name: "BidPrice8"},
+	MarketPriceFieldBidQuantity9:      {key: "GBV9", name: "BidQuantity9"},
+	MarketPriceFieldBidPrice9:         {key: "GBP9", name: "BidPrice9"},
+	MarketPriceFieldBidQuantity10:     {key: "GBV10", name: "BidQuantity10"},
+	MarketPriceFieldBidPrice10:        {key: "GBP10", name: "BidPrice10"},
+	MarketPriceFieldSection:           {key: "LISS", name: "Section"},
+	MarketPriceFieldPRP:               {key: "PRP", name: "PRP"},
+	MarketPriceFieldAskPrice:          {key: "QAP", name: "AskPrice"},
+	MarketPriceFieldAskSign:           {key: "QAS", name: "AskSign"},
+	MarketPriceFieldBidPrice:          {key: "QBP", name: "BidPrice"},
+	MarketPriceFieldBidSign:           {key: "QBS", name: "BidSign"},
+	MarketPriceFieldAskQuantityOver:   {key: "QOV", name: "AskQuantityOver"},
+	MarketPriceFieldBidQuantityUnder:  {key: "QUV", name: "BidQuantityUnder"},
+	MarketPriceFieldVWAP:              {key: "VWAP", name: "VWAP"},
+}
+
+// key - フレームでのキー p_行番号_の後ろの部分
+func (f MarketPriceField) key() string {
+	if f >= marketPriceFieldLen {
+		return ""
+	}
+	return marketPriceFields[f].key
+}
 
-		i, _ := strconv.Atoi(match[0][1])
-		return i
+// String - 構造体のフィールド名
+func (f MarketPriceField) String() string {
+	if f >= marketPriceFieldLen {
+		return fmt.Sprintf("MarketPriceField(%d)", uint8(f))
 	}
-	return 0
+	return marketPriceFields[f].name
 }
 
-func (r *MarketPriceStreamResponse) parse(m map[string][]string, b []byte) {
-	r.CommonStreamResponse.parse(m, b)
-	r.ColumnNumber = r.getColumnNumber(m)
-	r.AskQuantityMarket, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_AAV", r.ColumnNumber))[0], 64)
-	r.BidQuantityMarket, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_ABV", r.ColumnNumber))[0], 64)
-	r.AskQuantity, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_AV", r.ColumnNumber))[0], 64)
-	r.BidQuantity, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_BV", r.ColumnNumber))[0], 64)
-	r.DiscontinuityType = r.getFromMap(m, fmt.Sprintf("p_%d_DCFS", r.ColumnNumber))[0]
-	r.StopHigh = CurrentPriceType(r.getFromMap(m, fmt.Sprintf("p_%d_DHF", r.ColumnNumber))[0])
-	r.HighPrice, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DHP", r.ColumnNumber))[0], 64)
-	r.HighPriceTime, _ = time.ParseInLocation("15:04", r.getFromMap(m, fmt.Sprintf("p_%d_DHP:T", r.ColumnNumber))[0], time.Local)
-	r.TradingAmount, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DJ", r.ColumnNumber))[0], 64)
-	r.StopLow = CurrentPriceType(r.getFromMap(m, fmt.Sprintf("p_%d_DLF", r.ColumnNumber))[0])
-	r.LowPrice, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DLP", r.ColumnNumber))[0], 64)
-	r.LowPriceTime, _ = time.ParseInLocation("15:04", r.getFromMap(m, fmt.Sprintf("p_%d_DLP:T", r.ColumnNumber))[0], time.Local)
-	r.OpenPrice, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DOP", r.ColumnNumber))[0], 64)
-	r.OpenPriceTime, _ = time.ParseInLocation("15:04", r.getFromMap(m, fmt.Sprintf("p_%d_DOP:T", r.ColumnNumber))[0], time.Local)
-	r.ChangePriceType = ChangePriceType(r.getFromMap(m, fmt.Sprintf("p_%d_DPG", r.ColumnNumber))[0])
-	r.CurrentPrice, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DPP", r.ColumnNumber))[0], 64)
-	r.CurrentPriceTime, _ = time.ParseInLocation("15:04", r.getFromMap(m, fmt.Sprintf("p_%d_DPP:T", r.ColumnNumber))[0], time.Local)
-	r.Volume, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DV", r.ColumnNumber))[0], 64)
-	r.ExRightType = r.getFromMap(m, fmt.Sprintf("p_%d_DVES", r.ColumnNumber))[0]
-	r.PrevDayPercent, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DYRP", r.ColumnNumber))[0], 64)
-	r.PrevDayRatio, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_DYWP", r.ColumnNumber))[0], 64)
-	r.AskQuantity10, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV10", r.ColumnNumber))[0], 64)
-	r.AskPrice10, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP10", r.ColumnNumber))[0], 64)
-	r.AskQuantity9, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV9", r.ColumnNumber))[0], 64)
-	r.AskPrice9, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP9", r.ColumnNumber))[0], 64)
-	r.AskQuantity8, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV8", r.ColumnNumber))[0], 64)
-	r.AskPrice8, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP8", r.ColumnNumber))[0], 64)
-	r.AskQuantity7, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV7", r.ColumnNumber))[0], 64)
-	r.AskPrice7, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP7", r.ColumnNumber))[0], 64)
-	r.AskQuantity6, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV6", r.ColumnNumber))[0], 64)
-	r.AskPrice6, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP6", r.ColumnNumber))[0], 64)
-	r.AskQuantity5, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV5", r.ColumnNumber))[0], 64)
-	r.AskPrice5, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP5", r.ColumnNumber))[0], 64)
-	r.AskQuantity4, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV4", r.ColumnNumber))[0], 64)
-	r.AskPrice4, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP4", r.ColumnNumber))[0], 64)
-	r.AskQuantity3, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV3", r.ColumnNumber))[0], 64)
-	r.AskPrice3, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP3", r.ColumnNumber))[0], 64)
-	r.AskQuantity2, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV2", r.ColumnNumber))[0], 64)
-	r.AskPrice2, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP2", r.ColumnNumber))[0], 64)
-	r.AskQuantity1, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAV1", r.ColumnNumber))[0], 64)
-	r.AskPrice1, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GAP1", r.ColumnNumber))[0], 64)
-	r.BidQuantity1, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV1", r.ColumnNumber))[0], 64)
-	r.BidPrice1, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP1", r.ColumnNumber))[0], 64)
-	r.BidQuantity2, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV2", r.ColumnNumber))[0], 64)
-	r.BidPrice2, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP2", r.ColumnNumber))[0], 64)
-	r.BidQuantity3, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV3", r.ColumnNumber))[0], 64)
-	r.BidPrice3, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP3", r.ColumnNumber))[0], 64)
-	r.BidQuantity4, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV4", r.ColumnNumber))[0], 64)
-	r.BidPrice4, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP4", r.ColumnNumber))[0], 64)
-	r.BidQuantity5, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV5", r.ColumnNumber))[0], 64)
-	r.BidPrice5, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP5", r.ColumnNumber))[0], 64)
-	r.BidQuantity6, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV6", r.ColumnNumber))[0], 64)
-	r.BidPrice6, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP6", r.ColumnNumber))[0], 64)
-	r.BidQuantity7, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV7", r.ColumnNumber))[0], 64)
-	r.BidPrice7, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP7", r.ColumnNumber))[0], 64)
-	r.BidQuantity8, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV8", r.ColumnNumber))[0], 64)
-	r.BidPrice8, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP8", r.ColumnNumber))[0], 64)
-	r.BidQuantity9, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV9", r.ColumnNumber))[0], 64)
-	r.BidPrice9, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP9", r.ColumnNumber))[0], 64)
-	r.BidQuantity10, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBV10", r.ColumnNumber))[0], 64)
-	r.BidPrice10, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_GBP10", r.ColumnNumber))[0], 64)
-	r.Section = r.getFromMap(m, fmt.Sprintf("p_%d_LISS", r.ColumnNumber))[0]
-	r.PRP, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_PRP", r.ColumnNumber))[0], 64)
-	r.AskPrice, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_QAP", r.ColumnNumber))[0], 64)
-	r.AskSign = IndicationPriceType(r.getFromMap(m, fmt.Sprintf("p_%d_QAS", r.ColumnNumber))[0])
-	r.BidPrice, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_QBP", r.ColumnNumber))[0], 64)
-	r.BidSign = IndicationPriceType(r.getFromMap(m, fmt.Sprintf("p_%d_QBS", r.ColumnNumber))[0])
-	r.AskQuantityOver, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_QOV", r.ColumnNumber))[0], 64)
-	r.BidQuantityUnder, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_QUV", r.ColumnNumber))[0], 64)
-	r.VWAP, _ = strconv.ParseFloat(r.getFromMap(m, fmt.Sprintf("p_%d_VWAP", r.ColumnNumber))[0], 64)
+// MarketPriceFieldSet - 時価情報の項目の集合
+type MarketPriceFieldSet [2]uint64
+
+// Has - 項目が含まれているか
+func (s MarketPriceFieldSet) Has(f MarketPriceField) bool {
+	if f >= marketPriceFieldLen {
+		return false
+	}
+	return s[f/64]&(1<<(f%64)) != 0
+}
+
+// Fields - 含まれている項目の一覧
+func (s MarketPriceFieldSet) Fields() []MarketPriceField {
+	var fields []MarketPriceField
+	for f := MarketPriceField(0); f < marketPriceFieldLen; f++ {
+		if s.Has(f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func (s *MarketPriceFieldSet) add(f MarketPriceField) {
+	if f >= marketPriceFieldLen {
+		return
+	}
+	s[f/64] |= 1 << (f % 64)
 }
 
 type ContractStreamResponse struct {
@@ -311,67 +410,6 @@ type ContractStreamResponse struct {
 	CorrectStopOrderPrice    float64           // 訂正逆指値段
 }
 
-func (r *ContractStreamResponse) parse(m map[string][]string, b []byte) {
-	r.CommonStreamResponse.parse(m, b)
-
-	r.Provider = r.getFromMap(m, "p_PV")[0]
-	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
-	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
-	r.StreamOrderType = StreamOrderType(r.getFromMap(m, "p_NT")[0])
-	r.OrderNumber = r.getFromMap(m, "p_ON")[0]
-	r.ExecutionDate, _ = time.ParseInLocation("20060102", r.getFromMap(m, "p_ED")[0], time.Local)
-	r.ParentOrderNumber = r.getFromMap(m, "p_OON")[0]
-	r.ParentOrder = r.getFromMap(m, "p_OT")[0] == "1"
-	r.ProductType = ProductType(r.getFromMap(m, "p_ST")[0])
-	r.IssueCode = r.getFromMap(m, "p_IC")[0]
-	r.Exchange = Exchange(r.getFromMap(m, "p_MC")[0])
-	r.Side = Side(r.getFromMap(m, "p_BBKB")[0])
-	r.TradeType = TradeType(r.getFromMap(m, "p_THKB")[0])
-	r.ExecutionTiming = ExecutionTiming(r.getFromMap(m, "p_CRSJ")[0])
-	r.ExecutionType = ExecutionType(r.getFromMap(m, "p_CRPRKB")[0])
-	r.Price, _ = strconv.ParseFloat(r.getFromMap(m, "p_CRPR")[0], 64)
-	r.Quantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CRSR")[0], 64)
-	r.CancelQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CRTKSR")[0], 64)
-	r.ExpireQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CREPSR")[0], 64)
-	r.ContractQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CREXSR")[0], 64)
-	r.StreamOrderStatus = StreamOrderStatus(r.getFromMap(m, "p_ODST")[0])
-	r.CarryOverType = CarryOverType(r.getFromMap(m, "p_KOFG")[0])
-	r.CancelOrderStatus = CancelOrderStatus(r.getFromMap(m, "p_TTST")[0])
-	r.ContractStatus = ContractStatus(r.getFromMap(m, "p_EXST")[0])
-	if r.getFromMap(m, "p_LMIT")[0] == "00000000" { // 当日
-		r.ExpireDate = r.ExecutionDate
-	} else {
-		r.ExpireDate, _ = time.ParseInLocation("20060102", r.getFromMap(m, "p_LMIT")[0], time.Local)
-	}
-	r.SecurityExpireReason = r.getFromMap(m, "p_EPRC")[0]
-	r.SecurityContractPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_EXPR")[0], 64)
-	r.SecurityContractQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_EXSR")[0], 64)
-	r.SecurityError = r.getFromMap(m, "p_EXRC")[0]
-	r.NotifyDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_EXDT")[0], time.Local)
-	r.IssueName = r.getFromMap(m, "p_IN")[0]
-	r.CorrectExecutionTiming = ExecutionTiming(r.getFromMap(m, "p_UPSJ")[0])
-	if r.getFromMap(m, "p_UPEXSR")[0] != "" {
-		r.CorrectContractQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPEXSR")[0], 64)
-	}
-	r.CorrectExecutionType = ExecutionType(r.getFromMap(m, "p_UPPRKB")[0])
-	if r.getFromMap(m, "p_UPPR")[0] != "" {
-		r.CorrectPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPPR")[0], 64)
-	}
-	if r.getFromMap(m, "p_UPSR")[0] != "" {
-		r.CorrectQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPSR")[0], 64)
-	}
-	if r.getFromMap(m, "p_UPLMIT")[0] != "" {
-		r.CorrectExpireDate, _ = time.ParseInLocation("20060102", r.getFromMap(m, "p_UPLMIT")[0], time.Local)
-	}
-	r.CorrectStopOrderType = StopOrderType(r.getFromMap(m, "p_UPGKCDPR")[0])
-	if r.getFromMap(m, "p_UPGKPRKB")[0] != "" {
-		r.CorrectTriggerPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPGKPRKB")[0], 64)
-	}
-	if r.getFromMap(m, "p_UPGKPR")[0] != "" {
-		r.CorrectStopOrderPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPGKPR")[0], 64)
-	}
-}
-
 type NewsStreamResponse struct {
 	CommonStreamResponse
 	Provider      string    // プロバイダ(情報提供元)
@@ -389,24 +427,6 @@ type NewsStreamResponse struct {
 	Content       string    // ニュース本文
 }
 
-func (r *NewsStreamResponse) parse(m map[string][]string, b []byte) {
-	r.CommonStreamResponse.parse(m, b)
-
-	r.Provider = r.getFromMap(m, "p_PV")[0]
-	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
-	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
-	r.NewsId = r.getFromMap(m, "p_ID")[0]
-	r.NewsDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_DT")[0]+r.getFromMap(m, "p_TM")[0], time.Local)
-	r.NumOfCategory, _ = strconv.Atoi(r.getFromMap(m, "p_CGN")[0])
-	r.Categories = r.getFromMap(m, "p_CGL")
-	r.NumOfGenre, _ = strconv.Atoi(r.getFromMap(m, "p_GRN")[0])
-	r.Genres = r.getFromMap(m, "p_GRL")
-	r.NumOfIssue, _ = strconv.Atoi(r.getFromMap(m, "p_ISN")[0])
-	r.Issues = r.getFromMap(m, "p_ISL")
-	r.Title = r.getFromMap(m, "p_HDL")[0]
-	r.Content = r.getFromMap(m, "p_TX")[0]
-}
-
 type SystemStatusStreamResponse struct {
 	CommonStreamResponse
 	Provider       string        // プロバイダ(情報提供元)
@@ -417,17 +437,6 @@ type SystemStatusStreamResponse struct {
 	SystemStatus   SystemStatus  // システムステータス
 }
 
-func (r *SystemStatusStreamResponse) parse(m map[string][]string, b []byte) {
-	r.CommonStreamResponse.parse(m, b)
-
-	r.Provider = r.getFromMap(m, "p_PV")[0]
-	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
-	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
-	r.UpdateDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_CT")[0], time.Local)
-	r.ApprovalLogin = ApprovalLogin(r.getFromMap(m, "p_LK")[0])
-	r.SystemStatus = SystemStatus(r.getFromMap(m, "p_SS")[0])
-}
-
 type OperationStatusStreamResponse struct {
 	CommonStreamResponse
 	Provider          string    // プロバイダ(情報提供元)
@@ -443,98 +452,83 @@ type OperationStatusStreamResponse struct {
 	OperationStatus   string    // 運用ステータス
 }
 
-func (r *OperationStatusStreamResponse) parse(m map[string][]string, b []byte) {
-	r.CommonStreamResponse.parse(m, b)
-
-	r.Provider = r.getFromMap(m, "p_PV")[0]
-	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
-	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
-	r.UpdateDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_CT")[0], time.Local)
-	r.Exchange = Exchange(r.getFromMap(m, "p_MC")[0])
-	r.AssetCode = r.getFromMap(m, "p_GSCD")[0]
-	r.ProductType = r.getFromMap(m, "p_SHSB")[0]
-	r.OperationCategory = r.getFromMap(m, "p_UC")[0]
-	r.OperationUnit = r.getFromMap(m, "p_UU")[0]
-	r.BusinessDayType = r.getFromMap(m, "p_EDK")[0]
-	r.OperationStatus = r.getFromMap(m, "p_US")[0]
-}
-
 func (c *client) Stream(ctx context.Context, session *Session, req StreamRequest) (<-chan StreamResponse, <-chan error) {
 	eventCh := make(chan StreamResponse)
 	errCh := make(chan error)
 
 	go func() {
-		defer time.Sleep(1 * time.Second)
 		defer close(eventCh)
 		defer close(errCh)
 
+		sendErr := func(err error) {
+			select {
+			case <-ctx.Done():
+			case errCh <- err:
+			}
+		}
+
 		if session == nil {
-			errCh <- NilArgumentErr
+			sendErr(NilArgumentErr)
 			return
 		}
 
-		ch1, ch2 := c.requester.stream(ctx, session.EventURL, req)
+		// 抜けるときはrequesterのgoroutineを止め、チャネルが閉じられるまで待つ
+		cCtx, cf := context.WithCancel(ctx)
+		ch1, ch2 := c.requester.stream(cCtx, session.EventURL, req)
+		defer func() {
+			cf()
+			for ch1 != nil || ch2 != nil {
+				select {
+				case _, ok := <-ch1:
+					if !ok {
+						ch1 = nil
+					}
+				case _, ok := <-ch2:
+					if !ok {
+						ch2 = nil
+					}
+				}
+			}
+		}()
+
+		var frame streamFrame // 項目のバッファはフレーム間で使いまわす
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case err, ok := <-ch2:
-				if ok {
-					errCh <- err
-					return
+				if !ok {
+					ch2 = nil
+					continue
 				}
+				sendErr(err)
+				return
 			case b, ok := <-ch1:
 				// chanがcloseされたら抜ける
 				if !ok {
+					ch1 = nil
 					return
 				}
 
-				// ここでcommonResponseに一回変換する
-				m := c.streamResponseToMap(b)
-				t, ok := m["p_cmd"]
-				if !ok {
-					t = []string{""}
-				}
-				var res StreamResponse
-				switch EventType(t[0]) {
-				case EventTypeKeepAlive: // keep aliveは通知しない
+				frame.reset(b)
+				if frame.eventType() == EventTypeKeepAlive && !req.NotifyKeepAlive { // keep aliveは指定されたときだけ通知する
 					continue
-				case EventTypeMarketPrice:
-					res = new(MarketPriceStreamResponse)
-				case EventTypeContract:
-					res = new(ContractStreamResponse)
-				case EventTypeNews:
-					res = new(NewsStreamResponse)
-				case EventTypeSystemStatus:
-					res = new(SystemStatusStreamResponse)
-				case EventTypeOperationStatus:
-					res = new(OperationStatusStreamResponse)
-				default:
-					res = new(CommonStreamResponse)
 				}
-				res.parse(m, b)
+				res := decodeStreamFrame(&frame)
 
 				if res.GetErrorNo() != ErrorNoProblem {
-					errCh <- fmt.Errorf("%w: %s(%s)", StreamError, res.GetErrorText(), res.GetErrorNo())
+					sendErr(fmt.Errorf("%w: %s(%s)", StreamError, res.GetErrorText(), res.GetErrorNo()))
 					return
 				}
 
-				eventCh <- res
+				select {
+				case <-ctx.Done():
+					return
+				case eventCh <- res:
+				}
 			}
 		}
 	}()
 
 	return eventCh, errCh
 }
-
-func (c *client) streamResponseToMap(b []byte) map[string][]string {
-	res := make(map[string][]string)
-	for _, b := range bytes.Split(b, []byte{1}) {
-		bs := bytes.Split(b, []byte{2})
-		switch len(bs) {
-		case 1:
-			res[string(bs[0])] = []string{""}
-		case 2:
-			res[string(bs[0])] = strings.Split(string(bs[1]), string([]byte{2}))
-		}
-	}
-	return res
-}
@@ -0,0 +1,409 @@
+package tachibana
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStreamConsumerBufferSize   = 64          // 購読者ごとのバッファ
+	defaultStreamConsumerBlockTimeout = time.Second // Blockでバッファが空くのを待つ時間
+)
+
+// StreamConsumerPolicy - 購読者が読み遅れたときの扱い
+type StreamConsumerPolicy string
+
+const (
+	StreamConsumerPolicyUnspecified StreamConsumerPolicy = ""      // 未指定(Drop)
+	StreamConsumerPolicyDrop        StreamConsumerPolicy = "drop"  // バッファがいっぱいなら新しいイベントを捨てる
+	StreamConsumerPolicyBlock       StreamConsumerPolicy = "block" // バッファがいっぱいなら空くまでBlockTimeoutだけ待ち、空かなければ購読を終了する Err()でStreamOverflowErrを返す
+)
+
+// StreamFilter - 購読者が受け取るイベントの条件
+// 指定された条件はすべて満たす必要がある 何も指定しなければすべてのイベントを受け取る
+type StreamFilter struct {
+	EventTypes   []EventType // 通知種別
+	IssueCodes   []string    // 銘柄コード 時価情報は株価ボードの行番号から、ニュースは関連銘柄から判定する
+	OrderNumbers []string    // 注文番号 親注文番号でも一致する
+}
+
+// match - イベントが条件を満たすか
+func (f *StreamFilter) match(res StreamResponse, issueCode string) bool {
+	if len(f.EventTypes) > 0 {
+		var ok bool
+		for _, t := range f.EventTypes {
+			if t == res.GetEventType() {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(f.IssueCodes) > 0 {
+		var issueCodes []string
+		switch r := res.(type) {
+		case *MarketPriceStreamResponse:
+			issueCodes = []string{issueCode}
+		case *ContractStreamResponse:
+			issueCodes = []string{r.IssueCode}
+		case *NewsStreamResponse:
+			issueCodes = r.Issues
+		}
+		if !containsString(f.IssueCodes, issueCodes...) {
+			return false
+		}
+	}
+
+	if len(f.OrderNumbers) > 0 {
+		r, ok := res.(*ContractStreamResponse)
+		if !ok || !containsString(f.OrderNumbers, r.OrderNumber, r.ParentOrderNumber) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsString - targetsのいずれかがlistに含まれるか 空文字は一致させない
+func containsString(list []string, targets ...string) bool {
+	for _, t := range targets {
+		if t == "" {
+			continue
+		}
+		for _, s := range list {
+			if s == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StreamConsumerConfig - 購読者の設定
+type StreamConsumerConfig struct {
+	Filter       StreamFilter         // 受け取るイベントの条件
+	Policy       StreamConsumerPolicy // 読み遅れたときの扱い
+	BufferSize   int                  // 購読者ごとに溜められるイベントの数 0なら64
+	BlockTimeout time.Duration        // Blockでバッファが空くのを待つ時間 待っているあいだは他の購読者への配信も止まる 0なら1秒
+}
+
+// NewStreamBroker - 1本のイベントストリームを複数の購読者に配信するブローカーを生成する
+func NewStreamBroker(client Client, session *Session, req StreamRequest) *StreamBroker {
+	return &StreamBroker{
+		client:    client,
+		session:   session,
+		req:       req,
+		consumers: make(map[*StreamConsumer]struct{}),
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// StreamBroker - 1本のイベントストリームを複数の購読者に配信するブローカー
+// 購読者ごとにバッファを持つので、読み遅れた購読者が他の購読者の配信を止めるのはBlockの購読者が待つBlockTimeoutのあいだだけ
+type StreamBroker struct {
+	client    Client
+	session   *Session
+	req       StreamRequest
+	sub       *Subscription
+	consumers map[*StreamConsumer]struct{}
+	started   bool
+	closing   chan struct{} // Closeが呼ばれたら閉じる Blockの購読者が待つのをやめる
+	closeOnce sync.Once
+	done      chan struct{}
+	mtx       sync.Mutex
+}
+
+// Register - 購読者を登録する Startの前後どちらでも登録できる
+// ブローカーが終了したら、受け取っていないイベントを流し終えたあとにEvents()が閉じられる
+func (b *StreamBroker) Register(config StreamConsumerConfig) *StreamConsumer {
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultStreamConsumerBufferSize
+	}
+	if config.Policy == StreamConsumerPolicyUnspecified {
+		config.Policy = StreamConsumerPolicyDrop
+	}
+	if config.BlockTimeout <= 0 {
+		config.BlockTimeout = defaultStreamConsumerBlockTimeout
+	}
+
+	c := &StreamConsumer{
+		broker: b,
+		config: config,
+		events: make(chan StreamResponse),
+		signal: make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	select {
+	case <-b.done:
+		c.finish() // 終了済みのブローカーには登録しない
+	default:
+		b.consumers[c] = struct{}{}
+	}
+	return c
+}
+
+// Start - ストリームに接続して配信を開始する 2回目以降の呼び出しは何もしない
+func (b *StreamBroker) Start(ctx context.Context) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.started {
+		return
+	}
+	b.started = true
+	b.sub = NewSubscription(ctx, b.client, b.session, b.req)
+	go b.run()
+}
+
+func (b *StreamBroker) run() {
+	defer func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+
+		close(b.done)
+		for c := range b.consumers {
+			c.finish()
+			delete(b.consumers, c)
+		}
+	}()
+
+	for res := range b.sub.Events() {
+		issueCode := b.issueCode(res)
+
+		// Blockの購読者が待っていてもRegisterやCloseを止めないよう、ロックを外して積む
+		b.mtx.Lock()
+		consumers := make([]*StreamConsumer, 0, len(b.consumers))
+		for c := range b.consumers {
+			if c.config.Filter.match(res, issueCode) {
+				consumers = append(consumers, c)
+			}
+		}
+		b.mtx.Unlock()
+
+		for _, c := range consumers {
+			if !c.push(res, b.closing) {
+				b.unregister(c)
+			}
+		}
+	}
+	<-b.sub.Done()
+}
+
+// issueCode - 時価情報イベントの行番号から銘柄コードを引く
+func (b *StreamBroker) issueCode(res StreamResponse) string {
+	r, ok := res.(*MarketPriceStreamResponse)
+	if !ok {
+		return ""
+	}
+	for i, column := range b.req.ColumnNumber {
+		if column == r.ColumnNumber && i < len(b.req.IssueCodes) {
+			return b.req.IssueCodes[i]
+		}
+	}
+	return ""
+}
+
+func (b *StreamBroker) unregister(c *StreamConsumer) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	delete(b.consumers, c)
+}
+
+// Close - ストリームを切断し、すべての購読者を終了する Startの前に呼ばれたら、そのあとのStartは何もしない
+func (b *StreamBroker) Close() error {
+	b.closeOnce.Do(func() { close(b.closing) })
+
+	b.mtx.Lock()
+	if !b.started {
+		b.started = true
+		close(b.done)
+		for c := range b.consumers {
+			c.finish()
+			delete(b.consumers, c)
+		}
+	}
+	sub := b.sub
+	b.mtx.Unlock()
+
+	if sub == nil {
+		return nil
+	}
+	err := sub.Close()
+	<-b.done
+	return err
+}
+
+// Done - ストリームが終了したら閉じられるチャネル
+func (b *StreamBroker) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err - ストリームがエラーで終了した場合のエラー
+func (b *StreamBroker) Err() error {
+	b.mtx.Lock()
+	sub := b.sub
+	b.mtx.Unlock()
+
+	if sub == nil {
+		return nil
+	}
+	return sub.Err()
+}
+
+// StreamConsumer - ブローカーの購読者
+type StreamConsumer struct {
+	broker   *StreamBroker
+	config   StreamConsumerConfig
+	events   chan StreamResponse
+	queue    []StreamResponse
+	signal   chan struct{}
+	space    chan struct{} // runがキューからイベントを取り出したら通知する
+	stop     chan struct{}
+	done     chan struct{}
+	dropped  int64
+	finished bool
+	err      error
+	stopOnce sync.Once
+	mtx      sync.Mutex
+}
+
+// push - イベントをキューに積む 溜まっている数がバッファに達していたら、Dropなら捨て、Blockなら空くまでBlockTimeoutだけ待つ
+// 待っても空かなければ購読を終了する closingが閉じられたら待つのをやめて捨てる
+// 購読を終了したらfalseを返すので、ブローカーは購読者から外す
+func (c *StreamConsumer) push(res StreamResponse, closing <-chan struct{}) bool {
+	var timeout <-chan time.Time
+	for {
+		c.mtx.Lock()
+		if c.finished {
+			c.mtx.Unlock()
+			return false
+		}
+		if len(c.queue) < c.config.BufferSize {
+			c.queue = append(c.queue, res)
+			c.mtx.Unlock()
+			c.notify()
+			return true
+		}
+		if c.config.Policy != StreamConsumerPolicyBlock {
+			c.dropped++
+			c.mtx.Unlock()
+			return true
+		}
+		c.mtx.Unlock()
+
+		if timeout == nil {
+			timer := time.NewTimer(c.config.BlockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-c.space:
+		case <-c.stop:
+			return false
+		case <-closing:
+			return true
+		case <-timeout:
+			c.mtx.Lock()
+			c.finished, c.err = true, StreamOverflowErr
+			c.mtx.Unlock()
+			c.notify()
+			return false
+		}
+	}
+}
+
+// notify - キューが変わったことをrunに伝える
+func (c *StreamConsumer) notify() {
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// finish - これ以上イベントが積まれないことを伝える キューを流し終えたらEvents()を閉じる
+func (c *StreamConsumer) finish() {
+	c.mtx.Lock()
+	c.finished = true
+	c.mtx.Unlock()
+
+	c.notify()
+}
+
+// run - キューに積まれたイベントを順にEvents()に流す
+func (c *StreamConsumer) run() {
+	defer close(c.done)
+	defer close(c.events)
+
+	for {
+		c.mtx.Lock()
+		if len(c.queue) == 0 {
+			finished := c.finished
+			c.mtx.Unlock()
+			if finished {
+				return
+			}
+			select {
+			case <-c.stop:
+				return
+			case <-c.signal:
+			}
+			continue
+		}
+		res := c.queue[0]
+		c.queue[0] = nil
+		c.queue = c.queue[1:]
+		c.mtx.Unlock()
+
+		select {
+		case c.space <- struct{}{}:
+		default:
+		}
+
+		select {
+		case <-c.stop:
+			return
+		case c.events <- res:
+		}
+	}
+}
+
+// Events - 条件に一致したイベントのチャネル
+func (c *StreamConsumer) Events() <-chan StreamResponse {
+	return c.events
+}
+
+// Dropped - バッファがいっぱいで捨てたイベントの数
+func (c *StreamConsumer) Dropped() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.dropped
+}
+
+// Err - 読み遅れて購読が終了した場合のエラー Blockでバッファが空かなかったら、Events()を閉じたあとStreamOverflowErrを返す
+func (c *StreamConsumer) Err() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.err
+}
+
+// Close - 購読をやめる 受け取っていないイベントは捨て、Events()を閉じる
+func (c *StreamConsumer) Close() {
+	c.broker.unregister(c)
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+}
@@ -0,0 +1,279 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_StreamFilter_match(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		filter StreamFilter
+		arg1   StreamResponse
+		arg2   string
+		want   bool
+	}{
+		{name: "条件がなければ一致する",
+			filter: StreamFilter{},
+			arg1:   &CommonStreamResponse{EventType: EventTypeKeepAlive},
+			want:   true},
+		{name: "通知種別が含まれていれば一致する",
+			filter: StreamFilter{EventTypes: []EventType{EventTypeContract, EventTypeNews}},
+			arg1:   &NewsStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeNews}},
+			want:   true},
+		{name: "通知種別が含まれていなければ一致しない",
+			filter: StreamFilter{EventTypes: []EventType{EventTypeContract}},
+			arg1:   &NewsStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeNews}},
+			want:   false},
+		{name: "時価情報は渡された銘柄コードで判定する",
+			filter: StreamFilter{IssueCodes: []string{"1475"}},
+			arg1:   &MarketPriceStreamResponse{ColumnNumber: 1},
+			arg2:   "1475",
+			want:   true},
+		{name: "時価情報の銘柄コードが不明なら一致しない",
+			filter: StreamFilter{IssueCodes: []string{"1475"}},
+			arg1:   &MarketPriceStreamResponse{ColumnNumber: 1},
+			arg2:   "",
+			want:   false},
+		{name: "約定通知は銘柄コードで判定する",
+			filter: StreamFilter{IssueCodes: []string{"1475"}},
+			arg1:   &ContractStreamResponse{IssueCode: "1475"},
+			want:   true},
+		{name: "ニュースは関連銘柄のいずれかで判定する",
+			filter: StreamFilter{IssueCodes: []string{"1475"}},
+			arg1:   &NewsStreamResponse{Issues: []string{"1476", "1475"}},
+			want:   true},
+		{name: "銘柄を持たないイベントは銘柄コードの条件に一致しない",
+			filter: StreamFilter{IssueCodes: []string{"1475"}},
+			arg1:   &SystemStatusStreamResponse{},
+			want:   false},
+		{name: "約定通知は注文番号で判定する",
+			filter: StreamFilter{OrderNumbers: []string{"1000001"}},
+			arg1:   &ContractStreamResponse{OrderNumber: "1000001"},
+			want:   true},
+		{name: "約定通知は親注文番号でも判定する",
+			filter: StreamFilter{OrderNumbers: []string{"1000001"}},
+			arg1:   &ContractStreamResponse{OrderNumber: "1000002", ParentOrderNumber: "1000001"},
+			want:   true},
+		{name: "約定通知以外は注文番号の条件に一致しない",
+			filter: StreamFilter{OrderNumbers: []string{"1000001"}},
+			arg1:   &NewsStreamResponse{},
+			want:   false},
+		{name: "すべての条件を満たす必要がある",
+			filter: StreamFilter{EventTypes: []EventType{EventTypeContract}, IssueCodes: []string{"1475"}, OrderNumbers: []string{"1000001"}},
+			arg1:   &ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeContract}, IssueCode: "1476", OrderNumber: "1000001"},
+			want:   false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := test.filter.match(test.arg1, test.arg2)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_StreamBroker_issueCode(t *testing.T) {
+	t.Parallel()
+	broker := NewStreamBroker(&testClient{}, &Session{}, StreamRequest{ColumnNumber: []int{1, 3}, IssueCodes: []string{"1475", "1476"}})
+	tests := []struct {
+		name string
+		arg  StreamResponse
+		want string
+	}{
+		{name: "行番号から銘柄コードを引く", arg: &MarketPriceStreamResponse{ColumnNumber: 3}, want: "1476"},
+		{name: "登録されていない行番号なら空", arg: &MarketPriceStreamResponse{ColumnNumber: 2}, want: ""},
+		{name: "時価情報以外なら空", arg: &ContractStreamResponse{}, want: ""},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := broker.issueCode(test.arg)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+// readAll - チャネルが閉じられるまで読む
+func readAll(ch <-chan StreamResponse) []StreamResponse {
+	var res []StreamResponse
+	for r := range ch {
+		res = append(res, r)
+	}
+	return res
+}
+
+func Test_StreamBroker_Start(t *testing.T) {
+	t.Parallel()
+	events := []StreamResponse{
+		&MarketPriceStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeMarketPrice}, ColumnNumber: 1},
+		&ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeContract}, OrderNumber: "1000001", IssueCode: "1476"},
+		&NewsStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeNews}, Issues: []string{"1475"}},
+		&MarketPriceStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeMarketPrice}, ColumnNumber: 2},
+		&ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeContract}, OrderNumber: "1000002", IssueCode: "1475"},
+	}
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			for _, e := range events {
+				ch <- e
+			}
+			errCh <- StreamError
+		},
+	}}
+	broker := NewStreamBroker(client, &Session{}, StreamRequest{ColumnNumber: []int{1, 2}, IssueCodes: []string{"1475", "1476"}})
+
+	all := broker.Register(StreamConsumerConfig{Policy: StreamConsumerPolicyBlock})
+	news := broker.Register(StreamConsumerConfig{Filter: StreamFilter{EventTypes: []EventType{EventTypeNews}}})
+	issue := broker.Register(StreamConsumerConfig{Filter: StreamFilter{IssueCodes: []string{"1475"}}})
+	order := broker.Register(StreamConsumerConfig{Filter: StreamFilter{OrderNumbers: []string{"1000001"}}})
+	broker.Start(context.Background())
+	<-broker.Done()
+
+	got1, got2, got3, got4 := readAll(all.Events()), readAll(news.Events()), readAll(issue.Events()), readAll(order.Events())
+	want1 := events
+	want2 := []StreamResponse{events[2]}
+	want3 := []StreamResponse{events[0], events[2], events[4]}
+	want4 := []StreamResponse{events[1]}
+	if !reflect.DeepEqual(want1, got1) || !reflect.DeepEqual(want2, got2) || !reflect.DeepEqual(want3, got3) || !reflect.DeepEqual(want4, got4) || !errors.Is(broker.Err(), StreamError) {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v, %+v, %+v\ngot: %+v, %+v, %+v, %+v, %+v\n", t.Name(), want1, want2, want3, want4, StreamError, got1, got2, got3, got4, broker.Err())
+	}
+
+	// 終了したブローカーに登録した購読者はすぐに閉じられる
+	if _, ok := <-broker.Register(StreamConsumerConfig{}).Events(); ok {
+		t.Errorf("%s error\nconsumer registered after done is not closed", t.Name())
+	}
+}
+
+func Test_StreamBroker_slowConsumer(t *testing.T) {
+	t.Parallel()
+	const n = 100
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			for i := 1; i <= n; i++ {
+				ch <- &ContractStreamResponse{EventNo: int64(i)}
+			}
+		},
+	}}
+	broker := NewStreamBroker(client, &Session{}, StreamRequest{})
+
+	// 読まない購読者がいても、他の購読者には遅れずに届く
+	drop := broker.Register(StreamConsumerConfig{Policy: StreamConsumerPolicyDrop, BufferSize: 1})
+	block := broker.Register(StreamConsumerConfig{Policy: StreamConsumerPolicyBlock, BufferSize: 1, BlockTimeout: 50 * time.Millisecond})
+	fast := broker.Register(StreamConsumerConfig{Policy: StreamConsumerPolicyDrop, BufferSize: n})
+	broker.Start(context.Background())
+
+	var gotFast int
+	timeout := time.After(3 * time.Second)
+	for gotFast < n {
+		select {
+		case <-fast.Events():
+			gotFast++
+		case <-timeout:
+			t.Fatalf("%s error\nfast consumer stalled: %d/%d", t.Name(), gotFast, n)
+		}
+	}
+	<-broker.Done()
+
+	// Dropは捨てた数を数え、BlockはBlockTimeoutだけ待っても空かなければ捨てずに購読を終了する
+	gotDrop := readAll(drop.Events())
+	gotBlock := readAll(block.Events())
+	if drop.Dropped() == 0 || len(gotDrop)+int(drop.Dropped()) != n || drop.Err() != nil ||
+		len(gotBlock) == 0 || len(gotBlock) >= n || block.Dropped() != 0 || !errors.Is(block.Err(), StreamOverflowErr) {
+		t.Errorf("%s error\nwant: drop>0 && received+dropped=%d, 0<block<%d && %+v\ngot: drop received=%d dropped=%d, block received=%d dropped=%d err=%+v\n",
+			t.Name(), n, n, StreamOverflowErr, len(gotDrop), drop.Dropped(), len(gotBlock), block.Dropped(), block.Err())
+	}
+}
+
+func Test_StreamBroker_blockConsumer(t *testing.T) {
+	t.Parallel()
+	const n = 20
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			for i := 1; i <= n; i++ {
+				ch <- &ContractStreamResponse{EventNo: int64(i)}
+			}
+		},
+	}}
+	broker := NewStreamBroker(client, &Session{}, StreamRequest{})
+
+	// バッファより多く溜まっても、BlockTimeoutより早く読んでいれば捨てずにすべて届く
+	block := broker.Register(StreamConsumerConfig{Policy: StreamConsumerPolicyBlock, BufferSize: 1, BlockTimeout: time.Second})
+	broker.Start(context.Background())
+
+	var got []int64
+	for res := range block.Events() {
+		got = append(got, res.(*ContractStreamResponse).EventNo)
+		time.Sleep(time.Millisecond)
+	}
+	if len(got) != n || got[n-1] != n || block.Dropped() != 0 || block.Err() != nil {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), n, 0, nil, got, block.Dropped(), block.Err())
+	}
+}
+
+func Test_StreamBroker_Close_beforeStart(t *testing.T) {
+	t.Parallel()
+	broker := NewStreamBroker(&testClient{}, &Session{}, StreamRequest{})
+	consumer := broker.Register(StreamConsumerConfig{})
+
+	// Startの前に閉じても購読者は終了し、そのあとのStartは接続しない
+	err := broker.Close()
+	broker.Start(context.Background())
+	select {
+	case <-consumer.done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s error\nconsumer is not finished", t.Name())
+	}
+	select {
+	case <-broker.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("%s error\nbroker is not done", t.Name())
+	}
+	if _, ok := <-consumer.Events(); ok || err != nil || broker.Close() != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), false, nil, ok, err)
+	}
+}
+
+func Test_StreamConsumer_Close(t *testing.T) {
+	t.Parallel()
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- &CommonStreamResponse{}:
+				}
+			}
+		},
+	}}
+	broker := NewStreamBroker(client, &Session{}, StreamRequest{})
+	consumer := broker.Register(StreamConsumerConfig{})
+	other := broker.Register(StreamConsumerConfig{})
+	broker.Start(context.Background())
+	<-consumer.Events()
+
+	consumer.Close()
+	for range consumer.Events() {
+	}
+
+	broker.mtx.Lock()
+	_, registered := broker.consumers[consumer]
+	broker.mtx.Unlock()
+
+	if err := broker.Close(); err != nil || registered {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), nil, false, err, registered)
+	}
+	readAll(other.Events())
+}
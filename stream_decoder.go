@@ -0,0 +1,516 @@
+package tachibana
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamField - フレームの1項目
+type streamField struct {
+	key   string
+	value string
+}
+
+// streamFrame - 区切り文字(\x01, \x02)で分割した1フレーム
+// 項目のスライスは次のフレームでも使いまわす
+type streamFrame struct {
+	body   []byte
+	fields []streamField
+}
+
+// reset - フレームを1回走査して項目に分割する
+// 文字列への変換はフレーム全体で1回だけ行い、各項目はその部分文字列を参照する
+// 値に\x02を含む項目は、置き換える前のマップに変換する実装と同じく捨てる
+func (f *streamFrame) reset(b []byte) {
+	f.body = b
+	f.fields = f.fields[:0]
+
+	s := string(b)
+	for {
+		field := s
+		next := strings.IndexByte(s, 1)
+		if next >= 0 {
+			field = s[:next]
+		}
+
+		if i := strings.IndexByte(field, 2); i < 0 {
+			f.fields = append(f.fields, streamField{key: field})
+		} else if strings.IndexByte(field[i+1:], 2) < 0 {
+			f.fields = append(f.fields, streamField{key: field[:i], value: field[i+1:]})
+		}
+
+		if next < 0 {
+			return
+		}
+		s = s[next+1:]
+	}
+}
+
+// eventType - フレームの通知種別
+func (f *streamFrame) eventType() EventType {
+	var t string
+	for _, field := range f.fields {
+		if field.key == "p_cmd" {
+			t = field.value
+		}
+	}
+	return EventType(t)
+}
+
+// decodeStreamFrame - フレームを通知種別に応じたレスポンスに変換する
+func decodeStreamFrame(f *streamFrame) StreamResponse {
+	var res StreamResponse
+	switch f.eventType() {
+	case EventTypeMarketPrice:
+		res = new(MarketPriceStreamResponse)
+	case EventTypeContract:
+		res = new(ContractStreamResponse)
+	case EventTypeNews:
+		res = new(NewsStreamResponse)
+	case EventTypeSystemStatus:
+		res = new(SystemStatusStreamResponse)
+	case EventTypeOperationStatus:
+		res = new(OperationStatusStreamResponse)
+	default:
+		res = new(CommonStreamResponse)
+	}
+	res.decode(f)
+	return res
+}
+
+// set - 共通項目を設定する 共通項目でなければfalseを返す
+func (r *CommonStreamResponse) set(key, value string) bool {
+	switch key {
+	case "p_cmd":
+		r.EventType = EventType(value)
+	case "p_no":
+		r.StreamNumber, _ = strconv.ParseInt(value, 10, 64)
+	case "p_date":
+		r.StreamDateTime, _ = time.ParseInLocation("2006.01.02-15:04:05.000", value, time.Local)
+	case "p_errno":
+		r.ErrorNo = ErrorNo(value)
+	case "p_err":
+		r.ErrorText = value
+	default:
+		return false
+	}
+	return true
+}
+
+func (r *CommonStreamResponse) decode(f *streamFrame) {
+	for _, field := range f.fields {
+		r.set(field.key, field.value)
+	}
+	r.Body = f.body
+}
+
+// marketPriceFieldIndex - キー(p_行番号_の後ろの部分)から項目を引く表
+var marketPriceFieldIndex = func() map[string]MarketPriceField {
+	m := make(map[string]MarketPriceField, marketPriceFieldLen)
+	for f := MarketPriceField(0); f < marketPriceFieldLen; f++ {
+		m[marketPriceFields[f].key] = f
+	}
+	return m
+}()
+
+// splitMarketPriceKey - p_行番号_キー の形式のキーを行番号とキーに分ける
+func splitMarketPriceKey(key string) (int, string, bool) {
+	if len(key) < 5 || key[0] != 'p' || key[1] != '_' {
+		return 0, "", false
+	}
+
+	column := 0
+	i := 2
+	for ; i < len(key) && '0' <= key[i] && key[i] <= '9'; i++ {
+		column = column*10 + int(key[i]-'0')
+	}
+	if i == 2 || i+1 >= len(key) || key[i] != '_' {
+		return 0, "", false
+	}
+	return column, key[i+1:], true
+}
+
+func (r *MarketPriceStreamResponse) decode(f *streamFrame) {
+	var found bool
+	for _, field := range f.fields {
+		if r.CommonStreamResponse.set(field.key, field.value) {
+			continue
+		}
+
+		column, key, ok := splitMarketPriceKey(field.key)
+		if !ok {
+			continue
+		}
+		// 1フレームには1行分の項目しか含まれないので、最初に見つかった行番号を使う
+		if !found {
+			r.ColumnNumber = column
+			found = true
+		} else if column != r.ColumnNumber {
+			continue
+		}
+
+		if mf, ok := marketPriceFieldIndex[key]; ok {
+			r.PresentFields.add(mf)
+			r.setField(mf, field.value)
+		}
+	}
+	r.Body = f.body
+}
+
+// setField - 項目に値を設定する
+func (r *MarketPriceStreamResponse) setField(f MarketPriceField, value string) {
+	switch f {
+	case MarketPriceFieldAskQuantityMarket:
+		r.AskQuantityMarket, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantityMarket:
+		r.BidQuantityMarket, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity:
+		r.AskQuantity, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity:
+		r.BidQuantity, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldDiscontinuityType:
+		r.DiscontinuityType = value
+	case MarketPriceFieldStopHigh:
+		r.StopHigh = CurrentPriceType(value)
+	case MarketPriceFieldHighPrice:
+		r.HighPrice, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldHighPriceTime:
+		r.HighPriceTime, _ = time.ParseInLocation("15:04", value, time.Local)
+	case MarketPriceFieldTradingAmount:
+		r.TradingAmount, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldStopLow:
+		r.StopLow = CurrentPriceType(value)
+	case MarketPriceFieldLowPrice:
+		r.LowPrice, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldLowPriceTime:
+		r.LowPriceTime, _ = time.ParseInLocation("15:04", value, time.Local)
+	case MarketPriceFieldOpenPrice:
+		r.OpenPrice, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldOpenPriceTime:
+		r.OpenPriceTime, _ = time.ParseInLocation("15:04", value, time.Local)
+	case MarketPriceFieldChangePriceType:
+		r.ChangePriceType = ChangePriceType(value)
+	case MarketPriceFieldCurrentPrice:
+		r.CurrentPrice, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldCurrentPriceTime:
+		r.CurrentPriceTime, _ = time.ParseInLocation("15:04", value, time.Local)
+	case MarketPriceFieldVolume:
+		r.Volume, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldExRightType:
+		r.ExRightType = value
+	case MarketPriceFieldPrevDayPercent:
+		r.PrevDayPercent, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldPrevDayRatio:
+		r.PrevDayRatio, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity10:
+		r.AskQuantity10, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice10:
+		r.AskPrice10, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity9:
+		r.AskQuantity9, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice9:
+		r.AskPrice9, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity8:
+		r.AskQuantity8, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice8:
+		r.AskPrice8, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity7:
+		r.AskQuantity7, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice7:
+		r.AskPrice7, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity6:
+		r.AskQuantity6, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice6:
+		r.AskPrice6, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity5:
+		r.AskQuantity5, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice5:
+		r.AskPrice5, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity4:
+		r.AskQuantity4, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice4:
+		r.AskPrice4, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity3:
+		r.AskQuantity3, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice3:
+		r.AskPrice3, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity2:
+		r.AskQuantity2, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice2:
+		r.AskPrice2, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskQuantity1:
+		r.AskQuantity1, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice1:
+		r.AskPrice1, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity1:
+		r.BidQuantity1, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice1:
+		r.BidPrice1, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity2:
+		r.BidQuantity2, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice2:
+		r.BidPrice2, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity3:
+		r.BidQuantity3, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice3:
+		r.BidPrice3, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity4:
+		r.BidQuantity4, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice4:
+		r.BidPrice4, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity5:
+		r.BidQuantity5, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice5:
+		r.BidPrice5, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity6:
+		r.BidQuantity6, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice6:
+		r.BidPrice6, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity7:
+		r.BidQuantity7, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice7:
+		r.BidPrice7, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity8:
+		r.BidQuantity8, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice8:
+		r.BidPrice8, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity9:
+		r.BidQuantity9, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice9:
+		r.BidPrice9, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantity10:
+		r.BidQuantity10, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidPrice10:
+		r.BidPrice10, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldSection:
+		r.Section = value
+	case MarketPriceFieldPRP:
+		r.PRP, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskPrice:
+		r.AskPrice, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldAskSign:
+		r.AskSign = IndicationPriceType(value)
+	case MarketPriceFieldBidPrice:
+		r.BidPrice, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidSign:
+		r.BidSign = IndicationPriceType(value)
+	case MarketPriceFieldAskQuantityOver:
+		r.AskQuantityOver, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldBidQuantityUnder:
+		r.BidQuantityUnder, _ = strconv.ParseFloat(value, 64)
+	case MarketPriceFieldVWAP:
+		r.VWAP, _ = strconv.ParseFloat(value, 64)
+	}
+}
+
+func (r *ContractStreamResponse) decode(f *streamFrame) {
+	r.FirstTime = true // p_ALTが含まれていなければ"0"以外とみなす
+	var expireDate string
+	for _, field := range f.fields {
+		if r.CommonStreamResponse.set(field.key, field.value) {
+			continue
+		}
+
+		value := field.value
+		switch field.key {
+		case "p_PV":
+			r.Provider = value
+		case "p_ENO":
+			r.EventNo, _ = strconv.ParseInt(value, 10, 64)
+		case "p_ALT":
+			r.FirstTime = value != "0"
+		case "p_NT":
+			r.StreamOrderType = StreamOrderType(value)
+		case "p_ON":
+			r.OrderNumber = value
+		case "p_ED":
+			r.ExecutionDate, _ = time.ParseInLocation("20060102", value, time.Local)
+		case "p_OON":
+			r.ParentOrderNumber = value
+		case "p_OT":
+			r.ParentOrder = value == "1"
+		case "p_ST":
+			r.ProductType = ProductType(value)
+		case "p_IC":
+			r.IssueCode = value
+		case "p_MC":
+			r.Exchange = Exchange(value)
+		case "p_BBKB":
+			r.Side = Side(value)
+		case "p_THKB":
+			r.TradeType = TradeType(value)
+		case "p_CRSJ":
+			r.ExecutionTiming = ExecutionTiming(value)
+		case "p_CRPRKB":
+			r.ExecutionType = ExecutionType(value)
+		case "p_CRPR":
+			r.Price, _ = strconv.ParseFloat(value, 64)
+		case "p_CRSR":
+			r.Quantity, _ = strconv.ParseFloat(value, 64)
+		case "p_CRTKSR":
+			r.CancelQuantity, _ = strconv.ParseFloat(value, 64)
+		case "p_CREPSR":
+			r.ExpireQuantity, _ = strconv.ParseFloat(value, 64)
+		case "p_CREXSR":
+			r.ContractQuantity, _ = strconv.ParseFloat(value, 64)
+		case "p_ODST":
+			r.StreamOrderStatus = StreamOrderStatus(value)
+		case "p_KOFG":
+			r.CarryOverType = CarryOverType(value)
+		case "p_TTST":
+			r.CancelOrderStatus = CancelOrderStatus(value)
+		case "p_EXST":
+			r.ContractStatus = ContractStatus(value)
+		case "p_LMIT":
+			expireDate = value
+		case "p_EPRC":
+			r.SecurityExpireReason = value
+		case "p_EXPR":
+			r.SecurityContractPrice, _ = strconv.ParseFloat(value, 64)
+		case "p_EXSR":
+			r.SecurityContractQuantity, _ = strconv.ParseFloat(value, 64)
+		case "p_EXRC":
+			r.SecurityError = value
+		case "p_EXDT":
+			r.NotifyDateTime, _ = time.ParseInLocation("20060102150405", value, time.Local)
+		case "p_IN":
+			r.IssueName = value
+		case "p_UPSJ":
+			r.CorrectExecutionTiming = ExecutionTiming(value)
+		case "p_UPEXSR":
+			r.CorrectContractQuantity, _ = strconv.ParseFloat(value, 64)
+		case "p_UPPRKB":
+			r.CorrectExecutionType = ExecutionType(value)
+		case "p_UPPR":
+			r.CorrectPrice, _ = strconv.ParseFloat(value, 64)
+		case "p_UPSR":
+			r.CorrectQuantity, _ = strconv.ParseFloat(value, 64)
+		case "p_UPLMIT":
+			r.CorrectExpireDate, _ = time.ParseInLocation("20060102", value, time.Local)
+		case "p_UPGKCDPR":
+			r.CorrectStopOrderType = StopOrderType(value)
+		case "p_UPGKPRKB":
+			r.CorrectTriggerPrice, _ = strconv.ParseFloat(value, 64)
+		case "p_UPGKPR":
+			r.CorrectStopOrderPrice, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+
+	// 営業日がフレームのどこにあっても使えるよう、期限は最後に決める
+	if expireDate == "00000000" { // 当日
+		r.ExpireDate = r.ExecutionDate
+	} else {
+		r.ExpireDate, _ = time.ParseInLocation("20060102", expireDate, time.Local)
+	}
+	r.Body = f.body
+}
+
+func (r *NewsStreamResponse) decode(f *streamFrame) {
+	r.FirstTime = true // p_ALTが含まれていなければ"0"以外とみなす
+	r.Categories = []string{""}
+	r.Genres = []string{""}
+	r.Issues = []string{""}
+	var date, tm string
+	for _, field := range f.fields {
+		if r.CommonStreamResponse.set(field.key, field.value) {
+			continue
+		}
+
+		value := field.value
+		switch field.key {
+		case "p_PV":
+			r.Provider = value
+		case "p_ENO":
+			r.EventNo, _ = strconv.ParseInt(value, 10, 64)
+		case "p_ALT":
+			r.FirstTime = value != "0"
+		case "p_ID":
+			r.NewsId = value
+		case "p_DT":
+			date = value
+		case "p_TM":
+			tm = value
+		case "p_CGN":
+			r.NumOfCategory, _ = strconv.Atoi(value)
+		case "p_CGL":
+			r.Categories = []string{value}
+		case "p_GRN":
+			r.NumOfGenre, _ = strconv.Atoi(value)
+		case "p_GRL":
+			r.Genres = []string{value}
+		case "p_ISN":
+			r.NumOfIssue, _ = strconv.Atoi(value)
+		case "p_ISL":
+			r.Issues = []string{value}
+		case "p_HDL":
+			r.Title = value
+		case "p_TX":
+			r.Content = value
+		}
+	}
+	r.NewsDateTime, _ = time.ParseInLocation("20060102150405", date+tm, time.Local)
+	r.Body = f.body
+}
+
+func (r *SystemStatusStreamResponse) decode(f *streamFrame) {
+	r.FirstTime = true // p_ALTが含まれていなければ"0"以外とみなす
+	for _, field := range f.fields {
+		if r.CommonStreamResponse.set(field.key, field.value) {
+			continue
+		}
+
+		value := field.value
+		switch field.key {
+		case "p_PV":
+			r.Provider = value
+		case "p_ENO":
+			r.EventNo, _ = strconv.ParseInt(value, 10, 64)
+		case "p_ALT":
+			r.FirstTime = value != "0"
+		case "p_CT":
+			r.UpdateDateTime, _ = time.ParseInLocation("20060102150405", value, time.Local)
+		case "p_LK":
+			r.ApprovalLogin = ApprovalLogin(value)
+		case "p_SS":
+			r.SystemStatus = SystemStatus(value)
+		}
+	}
+	r.Body = f.body
+}
+
+func (r *OperationStatusStreamResponse) decode(f *streamFrame) {
+	r.FirstTime = true // p_ALTが含まれていなければ"0"以外とみなす
+	for _, field := range f.fields {
+		if r.CommonStreamResponse.set(field.key, field.value) {
+			continue
+		}
+
+		value := field.value
+		switch field.key {
+		case "p_PV":
+			r.Provider = value
+		case "p_ENO":
+			r.EventNo, _ = strconv.ParseInt(value, 10, 64)
+		case "p_ALT":
+			r.FirstTime = value != "0"
+		case "p_CT":
+			r.UpdateDateTime, _ = time.ParseInLocation("20060102150405", value, time.Local)
+		case "p_MC":
+			r.Exchange = Exchange(value)
+		case "p_GSCD":
+			r.AssetCode = value
+		case "p_SHSB":
+			r.ProductType = value
+		case "p_UC":
+			r.OperationCategory = value
+		case "p_UU":
+			r.OperationUnit = value
+		case "p_EDK":
+			r.BusinessDayType = value
+		case "p_US":
+			r.OperationStatus = value
+		}
+	}
+	r.Body = f.body
+}
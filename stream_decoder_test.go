@@ -0,0 +1,196 @@
+package tachibana
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStreamFrame - キーと値を交互に並べたものからフレームを作る
+func testStreamFrame(kv ...string) []byte {
+	fields := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields = append(fields, kv[i]+"\x02"+kv[i+1])
+	}
+	return []byte(strings.Join(fields, "\x01"))
+}
+
+// testMarketPriceFrame - 全項目を含んだ時価情報のフレーム
+func testMarketPriceFrame(column string) []byte {
+	kv := []string{"p_no", "3", "p_date", "2022.07.26-20:04:48.809", "p_errno", "0", "p_err", "", "p_cmd", "FD"}
+	values := map[string]string{"DCFS": "", "DHF": "0000", "DPG": "0057", "DVES": "", "LISS": "ﾌﾟﾗｲﾑ", "QAS": "0101", "QBS": "0101",
+		"DHP:T": "14:59", "DLP:T": "09:50", "DOP:T": "09:03", "DPP:T": "15:00", "DLF": "0000"}
+	for f := MarketPriceField(0); f < marketPriceFieldLen; f++ {
+		v, ok := values[f.key()]
+		if !ok {
+			v = "378.6"
+		}
+		kv = append(kv, "p_"+column+"_"+f.key(), v)
+	}
+	return testStreamFrame(kv...)
+}
+
+var testContractFrame = testStreamFrame(
+	"p_no", "2", "p_date", "2022.07.12-21:01:56.551", "p_errno", "0", "p_err", "", "p_cmd", "EC",
+	"p_PV", "MSGSV", "p_ENO", "16200", "p_ALT", "1", "p_NT", "100", "p_ON", "12004850", "p_ED", "20220712",
+	"p_OON", "", "p_OT", "1", "p_ST", "1", "p_IC", "1475", "p_MC", "00", "p_BBKB", "3", "p_THKB", "0",
+	"p_CRSJ", "0", "p_CRPRKB", "1", "p_CRPR", "0.000000", "p_CRSR", "3", "p_CRTKSR", "0", "p_CREPSR", "0",
+	"p_CREXSR", "0", "p_ODST", "0", "p_KOFG", "0", "p_TTST", "0", "p_EXST", "0", "p_LMIT", "00000000",
+	"p_EPRC", "", "p_EXPR", "0.000000", "p_EXSR", "0", "p_EXRC", "", "p_EXDT", "20220712085903",
+	"p_IN", "ｉシェアーズＴＯＰＩＸ", "p_UPSJ", "", "p_UPEXSR", "", "p_UPPRKB", "", "p_UPPR", "", "p_UPSR", "",
+	"p_UPLMIT", "", "p_UPGKCDPR", "", "p_UPGKPRKB", "", "p_UPGKPR", "")
+
+func Test_streamFrame_reset(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  []byte
+		want []streamField
+	}{
+		{name: "キーと値に分割できる",
+			arg:  []byte("p_no\x021\x01p_cmd\x02KP"),
+			want: []streamField{{key: "p_no", value: "1"}, {key: "p_cmd", value: "KP"}}},
+		{name: "区切りのない項目は値が空",
+			arg:  []byte("p_no\x021\x01p_err"),
+			want: []streamField{{key: "p_no", value: "1"}, {key: "p_err", value: ""}}},
+		{name: "値が空の項目も扱える",
+			arg:  []byte("p_err\x02\x01p_cmd\x02ST"),
+			want: []streamField{{key: "p_err", value: ""}, {key: "p_cmd", value: "ST"}}},
+		{name: "値に\x02を含む項目は捨てる",
+			arg:  []byte("p_no\x021\x02x\x01p_cmd\x02ST"),
+			want: []streamField{{key: "p_cmd", value: "ST"}}},
+		{name: "空のフレームは空の項目が1つ",
+			arg:  []byte{},
+			want: []streamField{{}}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var frame streamFrame
+			frame.reset([]byte("p_dummy\x02dummy\x01p_dummy2\x02dummy2\x01p_dummy3\x02dummy3")) // 前のフレームの項目が残らないこと
+			frame.reset(test.arg)
+			if !reflect.DeepEqual(test.want, frame.fields) || !reflect.DeepEqual(test.arg, frame.body) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, frame.fields)
+			}
+		})
+	}
+}
+
+func Test_splitMarketPriceKey(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		arg   string
+		want1 int
+		want2 string
+		want3 bool
+	}{
+		{name: "行番号とキーに分けられる", arg: "p_5_DPP", want1: 5, want2: "DPP", want3: true},
+		{name: "時刻のキーも分けられる", arg: "p_120_DPP:T", want1: 120, want2: "DPP:T", want3: true},
+		{name: "行番号がなければfalse", arg: "p_cmd", want1: 0, want2: "", want3: false},
+		{name: "キーがなければfalse", arg: "p_5_", want1: 0, want2: "", want3: false},
+		{name: "区切りがなければfalse", arg: "p_55", want1: 0, want2: "", want3: false},
+		{name: "p_で始まらなければfalse", arg: "x_5_DPP", want1: 0, want2: "", want3: false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got1, got2, got3 := splitMarketPriceKey(test.arg)
+			if test.want1 != got1 || test.want2 != got2 || test.want3 != got3 {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.want1, test.want2, test.want3, got1, got2, got3)
+			}
+		})
+	}
+}
+
+// Test_decodeStreamFrame - streamResponseToMapとparseを使った変換と同じ結果になること
+func Test_decodeStreamFrame(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  []byte
+		want StreamResponse
+	}{
+		{name: "時価情報", arg: testMarketPriceFrame("5"), want: new(MarketPriceStreamResponse)},
+		{name: "時価情報(差分)", arg: testStreamFrame("p_no", "4", "p_cmd", "FD", "p_12_DV", "3120180", "p_12_QBP", "0", "p_12_DPP:T", "15:00"), want: new(MarketPriceStreamResponse)},
+		{name: "約定通知", arg: testContractFrame, want: new(ContractStreamResponse)},
+		{name: "約定通知(期限が営業日より前にある)",
+			arg:  testStreamFrame("p_cmd", "EC", "p_LMIT", "00000000", "p_ED", "20220712", "p_UPPR", "380.5", "p_UPGKPR", "379"),
+			want: new(ContractStreamResponse)},
+		{name: "約定通知(期限指定あり、アラートフラグなし)",
+			arg:  testStreamFrame("p_cmd", "EC", "p_ED", "20220712", "p_LMIT", "20220720"),
+			want: new(ContractStreamResponse)},
+		{name: "ニュース通知",
+			arg: testStreamFrame("p_no", "4864", "p_date", "2022.07.25-17:49:57.424", "p_errno", "0", "p_err", "", "p_cmd", "NS",
+				"p_PV", "QNSD", "p_ENO", "1", "p_ALT", "0", "p_ID", "20220725174900_NWQ7154", "p_DT", "20220725", "p_TM", "174900",
+				"p_CGN", "1", "p_CGL", "129", "p_GRN", "1", "p_GRL", "62199", "p_ISN", "1", "p_ISL", "3494", "p_HDL", "タイトル", "p_TX", "本文\r\r本文"),
+			want: new(NewsStreamResponse)},
+		{name: "ニュース通知(リストなし)", arg: testStreamFrame("p_cmd", "NS", "p_DT", "20220725"), want: new(NewsStreamResponse)},
+		{name: "システムステータス",
+			arg:  testStreamFrame("p_no", "2", "p_cmd", "SS", "p_PV", "MSGSV", "p_ENO", "3", "p_ALT", "1", "p_CT", "20220712053002", "p_LK", "1", "p_SS", "1"),
+			want: new(SystemStatusStreamResponse)},
+		{name: "運用ステータス",
+			arg: testStreamFrame("p_no", "3", "p_cmd", "US", "p_PV", "MSGSV", "p_ENO", "4", "p_ALT", "0", "p_CT", "20220712053002", "p_MC", "00",
+				"p_GSCD", "101", "p_SHSB", "01", "p_UC", "01", "p_UU", "0101", "p_EDK", "1", "p_US", "100"),
+			want: new(OperationStatusStreamResponse)},
+		{name: "キープアライブ", arg: testStreamFrame("p_no", "5", "p_date", "2022.07.26-20:04:48.809", "p_errno", "0", "p_err", "", "p_cmd", "KP"), want: new(CommonStreamResponse)},
+		{name: "エラー", arg: []byte("p_no\x021\x01p_date\x022022.07.14-05:37:06.392\x01p_errno\x02-1\x01p_err\x02parameter error.\x01p_cmd\x02ST"), want: new(CommonStreamResponse)},
+		{name: "通知種別なし", arg: []byte("p_no\x021\x01p_err"), want: new(CommonStreamResponse)},
+	}
+
+	c := &client{}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			test.want.(parsedStreamResponse).parse(c.streamResponseToMap(test.arg), test.arg)
+
+			var frame streamFrame
+			frame.reset(test.arg)
+			got := decodeStreamFrame(&frame)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func benchmarkStreamParse(b *testing.B, frame []byte, newRes func() parsedStreamResponse) {
+	c := &client{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := newRes()
+		res.parse(c.streamResponseToMap(frame), frame)
+	}
+}
+
+func benchmarkStreamDecode(b *testing.B, frame []byte) {
+	var f streamFrame
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.reset(frame)
+		_ = decodeStreamFrame(&f)
+	}
+}
+
+func Benchmark_parse_MarketPrice(b *testing.B) {
+	benchmarkStreamParse(b, testMarketPriceFrame("120"), func() parsedStreamResponse { return new(MarketPriceStreamResponse) })
+}
+
+func Benchmark_decode_MarketPrice(b *testing.B) {
+	benchmarkStreamDecode(b, testMarketPriceFrame("120"))
+}
+
+func Benchmark_parse_Contract(b *testing.B) {
+	benchmarkStreamParse(b, testContractFrame, func() parsedStreamResponse { return new(ContractStreamResponse) })
+}
+
+func Benchmark_decode_Contract(b *testing.B) {
+	benchmarkStreamDecode(b, testContractFrame)
+}
@@ -0,0 +1,84 @@
+package tachibana
+
+import (
+	"context"
+	"fmt"
+)
+
+// StreamHandlers - イベントの種類ごとのハンドラ
+// 型で振り分けて渡すので、StreamResponseを型switchする必要がない nilのハンドラに対応するイベントは捨てる
+type StreamHandlers struct {
+	OnMarketPrice     func(res *MarketPriceStreamResponse)     // 時価情報
+	OnContract        func(res *ContractStreamResponse)        // 約定通知
+	OnNews            func(res *NewsStreamResponse)            // ニュース通知
+	OnSystemStatus    func(res *SystemStatusStreamResponse)    // システムステータス
+	OnOperationStatus func(res *OperationStatusStreamResponse) // 運用ステータス
+	OnUnknown         func(res StreamResponse)                 // 上記以外 キープアライブ等
+	OnPanic           func(res StreamResponse, err error)      // ハンドラがpanicしたとき errはStreamHandlerPanicErrをラップしている
+}
+
+// Dispatch - イベントを対応するハンドラに渡す
+// ハンドラがpanicしたら回復してStreamHandlerPanicErrをラップしたエラーを返す
+func (h *StreamHandlers) Dispatch(res StreamResponse) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v: %w", r, StreamHandlerPanicErr)
+		}
+	}()
+
+	switch r := res.(type) {
+	case *MarketPriceStreamResponse:
+		if h.OnMarketPrice != nil {
+			h.OnMarketPrice(r)
+		}
+	case *ContractStreamResponse:
+		if h.OnContract != nil {
+			h.OnContract(r)
+		}
+	case *NewsStreamResponse:
+		if h.OnNews != nil {
+			h.OnNews(r)
+		}
+	case *SystemStatusStreamResponse:
+		if h.OnSystemStatus != nil {
+			h.OnSystemStatus(r)
+		}
+	case *OperationStatusStreamResponse:
+		if h.OnOperationStatus != nil {
+			h.OnOperationStatus(r)
+		}
+	default:
+		if h.OnUnknown != nil {
+			h.OnUnknown(res)
+		}
+	}
+	return nil
+}
+
+// Serve - チャネルから受け取った順にイベントをハンドラに渡す
+// ハンドラは1つずつ呼ばれ、panicしてもOnPanicに通知して次のイベントの処理を続ける
+// チャネルが閉じられたらnil、ctxが終了したらctxのエラーを返す
+func (h *StreamHandlers) Serve(ctx context.Context, ch <-chan StreamResponse) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case res, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := h.Dispatch(res); err != nil {
+				h.panicked(res, err)
+			}
+		}
+	}
+}
+
+// panicked - OnPanicに通知する OnPanic自体のpanicは握りつぶす
+func (h *StreamHandlers) panicked(res StreamResponse, err error) {
+	if h.OnPanic == nil {
+		return
+	}
+	defer func() { _ = recover() }()
+	h.OnPanic(res, err)
+}
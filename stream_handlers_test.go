@@ -0,0 +1,108 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_StreamHandlers_Dispatch(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		arg     StreamResponse
+		want    string
+		wantErr error
+	}{
+		{name: "時価情報はOnMarketPriceに渡す", arg: &MarketPriceStreamResponse{}, want: "market price"},
+		{name: "約定通知はOnContractに渡す", arg: &ContractStreamResponse{}, want: "contract"},
+		{name: "ニュース通知はOnNewsに渡す", arg: &NewsStreamResponse{}, want: "news"},
+		{name: "システムステータスはOnSystemStatusに渡す", arg: &SystemStatusStreamResponse{}, want: "system status"},
+		{name: "運用ステータスはOnOperationStatusに渡す", arg: &OperationStatusStreamResponse{}, want: "operation status"},
+		{name: "それ以外はOnUnknownに渡す", arg: &CommonStreamResponse{EventType: EventTypeKeepAlive}, want: "unknown"},
+		{name: "panicしたらエラーを返す", arg: &NewsStreamResponse{Title: "panic"}, want: "news", wantErr: StreamHandlerPanicErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			var got string
+			handlers := &StreamHandlers{
+				OnMarketPrice: func(*MarketPriceStreamResponse) { got = "market price" },
+				OnContract:    func(*ContractStreamResponse) { got = "contract" },
+				OnNews: func(res *NewsStreamResponse) {
+					got = "news"
+					if res.Title == "panic" {
+						panic("handler panic")
+					}
+				},
+				OnSystemStatus:    func(*SystemStatusStreamResponse) { got = "system status" },
+				OnOperationStatus: func(*OperationStatusStreamResponse) { got = "operation status" },
+				OnUnknown:         func(StreamResponse) { got = "unknown" },
+			}
+			gotErr := handlers.Dispatch(test.arg)
+			if !reflect.DeepEqual(test.want, got) || !errors.Is(gotErr, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErr, got, gotErr)
+			}
+		})
+	}
+}
+
+func Test_StreamHandlers_Dispatch_nilHandler(t *testing.T) {
+	t.Parallel()
+	handlers := &StreamHandlers{}
+	for _, res := range []StreamResponse{&MarketPriceStreamResponse{}, &ContractStreamResponse{}, &NewsStreamResponse{}, &SystemStatusStreamResponse{}, &OperationStatusStreamResponse{}, &CommonStreamResponse{}} {
+		if err := handlers.Dispatch(res); err != nil {
+			t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+		}
+	}
+}
+
+func Test_StreamHandlers_Serve(t *testing.T) {
+	t.Parallel()
+	ch := make(chan StreamResponse, 4)
+	ch <- &ContractStreamResponse{EventNo: 1}
+	ch <- &ContractStreamResponse{EventNo: 2}
+	ch <- &NewsStreamResponse{EventNo: 3}
+	ch <- &ContractStreamResponse{EventNo: 4}
+	close(ch)
+
+	var got []int64
+	var gotPanics []int64
+	handlers := &StreamHandlers{
+		OnContract: func(res *ContractStreamResponse) {
+			if res.EventNo == 2 {
+				panic("handler panic")
+			}
+			got = append(got, res.EventNo)
+		},
+		OnNews: func(res *NewsStreamResponse) { got = append(got, res.EventNo) },
+		OnPanic: func(res StreamResponse, err error) {
+			if errors.Is(err, StreamHandlerPanicErr) {
+				no, _ := streamEventNo(res)
+				gotPanics = append(gotPanics, no)
+			}
+			panic("OnPanic also panics")
+		},
+	}
+	gotErr := handlers.Serve(context.Background(), ch)
+
+	want := []int64{1, 3, 4}
+	wantPanics := []int64{2}
+	if !reflect.DeepEqual(want, got) || !reflect.DeepEqual(wantPanics, gotPanics) || gotErr != nil {
+		t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), want, wantPanics, nil, got, gotPanics, gotErr)
+	}
+}
+
+func Test_StreamHandlers_Serve_ctxDone(t *testing.T) {
+	t.Parallel()
+	ctx, cf := context.WithCancel(context.Background())
+	cf()
+	handlers := &StreamHandlers{}
+	got := handlers.Serve(ctx, make(chan StreamResponse))
+	if !errors.Is(got, context.Canceled) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), context.Canceled, got)
+	}
+}
@@ -0,0 +1,177 @@
+package tachibana
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultStreamMonitorGapBufferSize = 16 // 欠番通知のバッファ
+
+// defaultLatencyBuckets - 遅延のヒストグラムの区切り
+var defaultLatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// StreamMonitorConfig - ストリーム監視の設定
+type StreamMonitorConfig struct {
+	LatencyBuckets []time.Duration // 遅延のヒストグラムの区切り(各区間の上限) 昇順 nilなら10ms~5s
+	GapBufferSize  int             // 欠番通知チャネルのバッファ 0なら16
+}
+
+// StreamGap - 配信番号の欠番
+type StreamGap struct {
+	From     int64     // 欠けた最初の配信番号
+	To       int64     // 欠けた最後の配信番号
+	DateTime time.Time // 検知日時
+}
+
+// Missing - 欠けた件数
+func (g StreamGap) Missing() int64 {
+	return g.To - g.From + 1
+}
+
+// LatencyHistogram - 遅延(受信日時 - 配信日時)のヒストグラム
+type LatencyHistogram struct {
+	Buckets []time.Duration // 各区間の上限
+	Counts  []int64         // 各区間の件数 最後の要素は最後の上限を超えたものの件数
+	Count   int64           // 件数
+	Sum     time.Duration   // 合計
+	Min     time.Duration   // 最小
+	Max     time.Duration   // 最大
+}
+
+// Mean - 平均
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// NewStreamMonitor - ストリームの監視を生成する
+func NewStreamMonitor(config StreamMonitorConfig) *StreamMonitor {
+	if config.LatencyBuckets == nil {
+		config.LatencyBuckets = defaultLatencyBuckets
+	}
+	if config.GapBufferSize <= 0 {
+		config.GapBufferSize = defaultStreamMonitorGapBufferSize
+	}
+
+	return &StreamMonitor{
+		clock: newClock(),
+		gaps:  make(chan StreamGap, config.GapBufferSize),
+		latency: LatencyHistogram{
+			Buckets: append([]time.Duration{}, config.LatencyBuckets...),
+			Counts:  make([]int64, len(config.LatencyBuckets)+1),
+		},
+	}
+}
+
+// StreamMonitor - 配信番号(p_no)の欠番と、配信の遅延を監視する
+// 配信番号はキープアライブにも振られるので、キープアライブも含めてすべてのイベントをObserveに渡す
+// ResilientStreamConfig.Monitorに設定すれば、キープアライブを含めて自動で渡される
+type StreamMonitor struct {
+	clock      iClock
+	lastNumber int64
+	gaps       chan StreamGap
+	gapCount   int64
+	dropped    int64
+	latency    LatencyHistogram
+	mtx        sync.Mutex
+}
+
+// Observe - 受信したイベントを記録する
+func (m *StreamMonitor) Observe(res StreamResponse) {
+	common := streamCommon(res)
+	if common == nil {
+		return
+	}
+	now := m.clock.Now()
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.observeNumber(common.StreamNumber, now)
+	if !common.StreamDateTime.IsZero() {
+		m.observeLatency(now.Sub(common.StreamDateTime))
+	}
+}
+
+func (m *StreamMonitor) observeNumber(number int64, now time.Time) {
+	switch {
+	case number <= 0:
+		return
+	case number == 1:
+		// 配信番号は接続ごとに1から振られるので、1なら新しい接続として数えなおす
+	case m.lastNumber > 0 && number > m.lastNumber+1:
+		gap := StreamGap{From: m.lastNumber + 1, To: number - 1, DateTime: now}
+		m.gapCount++
+		select {
+		case m.gaps <- gap:
+		default:
+			m.dropped++
+		}
+	case number <= m.lastNumber:
+		return // 重複や逆転は欠番として扱わない
+	}
+	m.lastNumber = number
+}
+
+func (m *StreamMonitor) observeLatency(d time.Duration) {
+	h := &m.latency
+	i := 0
+	for ; i < len(h.Buckets); i++ {
+		if d <= h.Buckets[i] {
+			break
+		}
+	}
+	h.Counts[i]++
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if h.Count == 0 || d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+}
+
+// Reset - 新しい接続として配信番号を数えなおす 遅延の記録は残す
+func (m *StreamMonitor) Reset() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.lastNumber = 0
+}
+
+// Gaps - 欠番を検知したら通知されるチャネル 読まれずにバッファがいっぱいなら捨てる
+// 欠番があったら、約定通知の取りこぼしがないか注文一覧で確認する
+func (m *StreamMonitor) Gaps() <-chan StreamGap {
+	return m.gaps
+}
+
+// GapCount - 検知した欠番の回数と、そのうち通知できずに捨てた回数
+func (m *StreamMonitor) GapCount() (int64, int64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.gapCount, m.dropped
+}
+
+// Latency - 遅延のヒストグラム
+func (m *StreamMonitor) Latency() LatencyHistogram {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	h := m.latency
+	h.Buckets = append([]time.Duration{}, m.latency.Buckets...)
+	h.Counts = append([]int64{}, m.latency.Counts...)
+	return h
+}
@@ -0,0 +1,182 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_NewStreamMonitor(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		arg         StreamMonitorConfig
+		wantBuckets []time.Duration
+		wantCounts  []int64
+		wantGapCap  int
+	}{
+		{name: "未指定なら初期値を使う",
+			arg:         StreamMonitorConfig{},
+			wantBuckets: defaultLatencyBuckets,
+			wantCounts:  make([]int64, len(defaultLatencyBuckets)+1),
+			wantGapCap:  defaultStreamMonitorGapBufferSize},
+		{name: "指定した区切りとバッファを使う",
+			arg:         StreamMonitorConfig{LatencyBuckets: []time.Duration{time.Second}, GapBufferSize: 2},
+			wantBuckets: []time.Duration{time.Second},
+			wantCounts:  []int64{0, 0},
+			wantGapCap:  2},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := NewStreamMonitor(test.arg)
+			if !reflect.DeepEqual(test.wantBuckets, got.latency.Buckets) || !reflect.DeepEqual(test.wantCounts, got.latency.Counts) || test.wantGapCap != cap(got.gaps) {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantBuckets, test.wantCounts, test.wantGapCap, got.latency.Buckets, got.latency.Counts, cap(got.gaps))
+			}
+		})
+	}
+}
+
+func Test_StreamMonitor_Observe_gap(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)
+	tests := []struct {
+		name         string
+		arg          []int64
+		bufferSize   int
+		wantGaps     []StreamGap
+		wantGapCount int64
+		wantDropped  int64
+	}{
+		{name: "連番なら欠番なし", arg: []int64{1, 2, 3, 4}, wantGaps: nil},
+		{name: "飛んだ番号を欠番として通知する",
+			arg:          []int64{1, 2, 5, 6, 8},
+			wantGaps:     []StreamGap{{From: 3, To: 4, DateTime: now}, {From: 7, To: 7, DateTime: now}},
+			wantGapCount: 2},
+		{name: "1に戻ったら新しい接続として数えなおす", arg: []int64{1, 2, 3, 1, 2}, wantGaps: nil},
+		{name: "重複や逆転は欠番にしない", arg: []int64{1, 2, 3, 2, 4}, wantGaps: nil},
+		{name: "最初のイベントが1でなくても欠番にしない", arg: []int64{10, 11}, wantGaps: nil},
+		{name: "配信番号がなければ無視する", arg: []int64{1, 0, 2}, wantGaps: nil},
+		{name: "バッファを超えた通知は捨てて数える",
+			arg:          []int64{1, 3, 5},
+			bufferSize:   1,
+			wantGaps:     []StreamGap{{From: 2, To: 2, DateTime: now}},
+			wantGapCount: 2,
+			wantDropped:  1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			monitor := NewStreamMonitor(StreamMonitorConfig{GapBufferSize: test.bufferSize})
+			monitor.clock = &testClock{Now1: now}
+			for _, no := range test.arg {
+				monitor.Observe(&CommonStreamResponse{EventType: EventTypeKeepAlive, StreamNumber: no})
+			}
+
+			var got []StreamGap
+			for len(monitor.Gaps()) > 0 {
+				got = append(got, <-monitor.Gaps())
+			}
+			gotGapCount, gotDropped := monitor.GapCount()
+			if !reflect.DeepEqual(test.wantGaps, got) || test.wantGapCount != gotGapCount || test.wantDropped != gotDropped {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantGaps, test.wantGapCount, test.wantDropped, got, gotGapCount, gotDropped)
+			}
+		})
+	}
+}
+
+func Test_StreamMonitor_Observe_latency(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 7, 26, 9, 0, 1, 0, time.Local)
+	monitor := NewStreamMonitor(StreamMonitorConfig{LatencyBuckets: []time.Duration{100 * time.Millisecond, 500 * time.Millisecond}})
+	monitor.clock = &testClock{Now1: now}
+
+	for _, d := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 300 * time.Millisecond, 2 * time.Second} {
+		monitor.Observe(&MarketPriceStreamResponse{CommonStreamResponse: CommonStreamResponse{StreamDateTime: now.Add(-d)}})
+	}
+	monitor.Observe(&CommonStreamResponse{}) // 配信日時がなければ数えない
+
+	want := LatencyHistogram{
+		Buckets: []time.Duration{100 * time.Millisecond, 500 * time.Millisecond},
+		Counts:  []int64{2, 1, 1},
+		Count:   4,
+		Sum:     2450 * time.Millisecond,
+		Min:     50 * time.Millisecond,
+		Max:     2 * time.Second,
+	}
+	got := monitor.Latency()
+	if !reflect.DeepEqual(want, got) || got.Mean() != 612500*time.Microsecond {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v, %+v\n", t.Name(), want, got, got.Mean())
+	}
+
+	// 返したヒストグラムを変更しても影響しない
+	got.Counts[0] = 100
+	if monitor.Latency().Counts[0] != 2 {
+		t.Errorf("%s error\nhistogram is shared", t.Name())
+	}
+}
+
+func Test_LatencyHistogram_Mean(t *testing.T) {
+	t.Parallel()
+	if got := (LatencyHistogram{}).Mean(); got != 0 {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), 0, got)
+	}
+}
+
+func Test_StreamGap_Missing(t *testing.T) {
+	t.Parallel()
+	if got := (StreamGap{From: 3, To: 5}).Missing(); got != 3 {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), 3, got)
+	}
+}
+
+func Test_ResilientStream_Start_monitor(t *testing.T) {
+	t.Parallel()
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			ch <- &CommonStreamResponse{EventType: EventTypeKeepAlive, StreamNumber: 1}
+			ch <- &ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeContract, StreamNumber: 2}, EventNo: 1}
+			ch <- &CommonStreamResponse{EventType: EventTypeKeepAlive, StreamNumber: 3}
+			ch <- &ContractStreamResponse{CommonStreamResponse: CommonStreamResponse{EventType: EventTypeContract, StreamNumber: 5}, EventNo: 2}
+			errCh <- errors.New("connection reset by peer")
+		},
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			// 再接続後は前の接続の続きとはみなさないので、5の次が7でも欠番にしない
+			ch <- &CommonStreamResponse{EventType: EventTypeKeepAlive, StreamNumber: 7}
+			ch <- &CommonStreamResponse{EventType: EventTypeKeepAlive, StreamNumber: 8}
+			errCh <- StreamError
+		},
+	}}
+	monitor := NewStreamMonitor(StreamMonitorConfig{})
+	stream := NewResilientStream(client, &Session{}, StreamRequest{}, ResilientStreamConfig{BaseInterval: time.Millisecond, Monitor: monitor})
+	ch, _, errCh := stream.Start(context.Background())
+	for ch != nil || errCh != nil {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				ch = nil
+			}
+		case _, ok := <-errCh:
+			if !ok {
+				errCh = nil
+			}
+		}
+	}
+
+	var got []StreamGap
+	for len(monitor.Gaps()) > 0 {
+		gap := <-monitor.Gaps()
+		gap.DateTime = time.Time{}
+		got = append(got, gap)
+	}
+	want := []StreamGap{{From: 4, To: 4}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
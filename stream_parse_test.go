@@ -0,0 +1,253 @@
+package tachibana
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stream_decoder.goのデコーダに置き換える前の、フレームをマップにしてから構造体に詰める実装 デコーダのテストとベンチマークで比較に使う
+
+// parsedStreamResponse - マップから詰められるイベント
+type parsedStreamResponse interface {
+	StreamResponse
+	parse(m map[string][]string, b []byte)
+}
+
+func (r *CommonStreamResponse) getFromMap(m map[string][]string, key string) []string {
+	if s, ok := m[key]; ok {
+		return s
+	} else {
+		return []string{""}
+	}
+}
+
+func (r *CommonStreamResponse) parse(m map[string][]string, b []byte) {
+	r.EventType = EventType(r.getFromMap(m, "p_cmd")[0])
+	r.StreamNumber, _ = strconv.ParseInt(r.getFromMap(m, "p_no")[0], 10, 64)
+	r.StreamDateTime, _ = time.ParseInLocation("2006.01.02-15:04:05.000", r.getFromMap(m, "p_date")[0], time.Local)
+	r.ErrorNo = ErrorNo(r.getFromMap(m, "p_errno")[0])
+	r.ErrorText = r.getFromMap(m, "p_err")[0]
+	r.Body = b
+}
+
+func (r *MarketPriceStreamResponse) getColumnNumber(m map[string][]string) int {
+	for k := range m {
+		match := regexp.MustCompile(`^p_(\d+)_.+$`).FindAllStringSubmatch(k, -1)
+		if len(match) == 0 {
+			continue
+		}
+
+		i, _ := strconv.Atoi(match[0][1])
+		return i
+	}
+	return 0
+}
+
+func (r *MarketPriceStreamResponse) parse(m map[string][]string, b []byte) {
+	r.CommonStreamResponse.parse(m, b)
+	r.ColumnNumber = r.getColumnNumber(m)
+	r.PresentFields = MarketPriceFieldSet{}
+	get := func(f MarketPriceField) string {
+		v, ok := m[fmt.Sprintf("p_%d_%s", r.ColumnNumber, f.key())]
+		if !ok || len(v) == 0 {
+			return ""
+		}
+		r.PresentFields.add(f)
+		return v[0]
+	}
+	r.AskQuantityMarket, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantityMarket), 64)
+	r.BidQuantityMarket, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantityMarket), 64)
+	r.AskQuantity, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity), 64)
+	r.BidQuantity, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity), 64)
+	r.DiscontinuityType = get(MarketPriceFieldDiscontinuityType)
+	r.StopHigh = CurrentPriceType(get(MarketPriceFieldStopHigh))
+	r.HighPrice, _ = strconv.ParseFloat(get(MarketPriceFieldHighPrice), 64)
+	r.HighPriceTime, _ = time.ParseInLocation("15:04", get(MarketPriceFieldHighPriceTime), time.Local)
+	r.TradingAmount, _ = strconv.ParseFloat(get(MarketPriceFieldTradingAmount), 64)
+	r.StopLow = CurrentPriceType(get(MarketPriceFieldStopLow))
+	r.LowPrice, _ = strconv.ParseFloat(get(MarketPriceFieldLowPrice), 64)
+	r.LowPriceTime, _ = time.ParseInLocation("15:04", get(MarketPriceFieldLowPriceTime), time.Local)
+	r.OpenPrice, _ = strconv.ParseFloat(get(MarketPriceFieldOpenPrice), 64)
+	r.OpenPriceTime, _ = time.ParseInLocation("15:04", get(MarketPriceFieldOpenPriceTime), time.Local)
+	r.ChangePriceType = ChangePriceType(get(MarketPriceFieldChangePriceType))
+	r.CurrentPrice, _ = strconv.ParseFloat(get(MarketPriceFieldCurrentPrice), 64)
+	r.CurrentPriceTime, _ = time.ParseInLocation("15:04", get(MarketPriceFieldCurrentPriceTime), time.Local)
+	r.Volume, _ = strconv.ParseFloat(get(MarketPriceFieldVolume), 64)
+	r.ExRightType = get(MarketPriceFieldExRightType)
+	r.PrevDayPercent, _ = strconv.ParseFloat(get(MarketPriceFieldPrevDayPercent), 64)
+	r.PrevDayRatio, _ = strconv.ParseFloat(get(MarketPriceFieldPrevDayRatio), 64)
+	r.AskQuantity10, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity10), 64)
+	r.AskPrice10, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice10), 64)
+	r.AskQuantity9, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity9), 64)
+	r.AskPrice9, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice9), 64)
+	r.AskQuantity8, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity8), 64)
+	r.AskPrice8, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice8), 64)
+	r.AskQuantity7, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity7), 64)
+	r.AskPrice7, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice7), 64)
+	r.AskQuantity6, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity6), 64)
+	r.AskPrice6, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice6), 64)
+	r.AskQuantity5, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity5), 64)
+	r.AskPrice5, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice5), 64)
+	r.AskQuantity4, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity4), 64)
+	r.AskPrice4, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice4), 64)
+	r.AskQuantity3, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity3), 64)
+	r.AskPrice3, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice3), 64)
+	r.AskQuantity2, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity2), 64)
+	r.AskPrice2, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice2), 64)
+	r.AskQuantity1, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantity1), 64)
+	r.AskPrice1, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice1), 64)
+	r.BidQuantity1, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity1), 64)
+	r.BidPrice1, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice1), 64)
+	r.BidQuantity2, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity2), 64)
+	r.BidPrice2, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice2), 64)
+	r.BidQuantity3, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity3), 64)
+	r.BidPrice3, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice3), 64)
+	r.BidQuantity4, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity4), 64)
+	r.BidPrice4, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice4), 64)
+	r.BidQuantity5, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity5), 64)
+	r.BidPrice5, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice5), 64)
+	r.BidQuantity6, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity6), 64)
+	r.BidPrice6, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice6), 64)
+	r.BidQuantity7, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity7), 64)
+	r.BidPrice7, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice7), 64)
+	r.BidQuantity8, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity8), 64)
+	r.BidPrice8, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice8), 64)
+	r.BidQuantity9, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity9), 64)
+	r.BidPrice9, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice9), 64)
+	r.BidQuantity10, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantity10), 64)
+	r.BidPrice10, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice10), 64)
+	r.Section = get(MarketPriceFieldSection)
+	r.PRP, _ = strconv.ParseFloat(get(MarketPriceFieldPRP), 64)
+	r.AskPrice, _ = strconv.ParseFloat(get(MarketPriceFieldAskPrice), 64)
+	r.AskSign = IndicationPriceType(get(MarketPriceFieldAskSign))
+	r.BidPrice, _ = strconv.ParseFloat(get(MarketPriceFieldBidPrice), 64)
+	r.BidSign = IndicationPriceType(get(MarketPriceFieldBidSign))
+	r.AskQuantityOver, _ = strconv.ParseFloat(get(MarketPriceFieldAskQuantityOver), 64)
+	r.BidQuantityUnder, _ = strconv.ParseFloat(get(MarketPriceFieldBidQuantityUnder), 64)
+	r.VWAP, _ = strconv.ParseFloat(get(MarketPriceFieldVWAP), 64)
+}
+
+func (r *ContractStreamResponse) parse(m map[string][]string, b []byte) {
+	r.CommonStreamResponse.parse(m, b)
+
+	r.Provider = r.getFromMap(m, "p_PV")[0]
+	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
+	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
+	r.StreamOrderType = StreamOrderType(r.getFromMap(m, "p_NT")[0])
+	r.OrderNumber = r.getFromMap(m, "p_ON")[0]
+	r.ExecutionDate, _ = time.ParseInLocation("20060102", r.getFromMap(m, "p_ED")[0], time.Local)
+	r.ParentOrderNumber = r.getFromMap(m, "p_OON")[0]
+	r.ParentOrder = r.getFromMap(m, "p_OT")[0] == "1"
+	r.ProductType = ProductType(r.getFromMap(m, "p_ST")[0])
+	r.IssueCode = r.getFromMap(m, "p_IC")[0]
+	r.Exchange = Exchange(r.getFromMap(m, "p_MC")[0])
+	r.Side = Side(r.getFromMap(m, "p_BBKB")[0])
+	r.TradeType = TradeType(r.getFromMap(m, "p_THKB")[0])
+	r.ExecutionTiming = ExecutionTiming(r.getFromMap(m, "p_CRSJ")[0])
+	r.ExecutionType = ExecutionType(r.getFromMap(m, "p_CRPRKB")[0])
+	r.Price, _ = strconv.ParseFloat(r.getFromMap(m, "p_CRPR")[0], 64)
+	r.Quantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CRSR")[0], 64)
+	r.CancelQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CRTKSR")[0], 64)
+	r.ExpireQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CREPSR")[0], 64)
+	r.ContractQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_CREXSR")[0], 64)
+	r.StreamOrderStatus = StreamOrderStatus(r.getFromMap(m, "p_ODST")[0])
+	r.CarryOverType = CarryOverType(r.getFromMap(m, "p_KOFG")[0])
+	r.CancelOrderStatus = CancelOrderStatus(r.getFromMap(m, "p_TTST")[0])
+	r.ContractStatus = ContractStatus(r.getFromMap(m, "p_EXST")[0])
+	if r.getFromMap(m, "p_LMIT")[0] == "00000000" { // 当日
+		r.ExpireDate = r.ExecutionDate
+	} else {
+		r.ExpireDate, _ = time.ParseInLocation("20060102", r.getFromMap(m, "p_LMIT")[0], time.Local)
+	}
+	r.SecurityExpireReason = r.getFromMap(m, "p_EPRC")[0]
+	r.SecurityContractPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_EXPR")[0], 64)
+	r.SecurityContractQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_EXSR")[0], 64)
+	r.SecurityError = r.getFromMap(m, "p_EXRC")[0]
+	r.NotifyDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_EXDT")[0], time.Local)
+	r.IssueName = r.getFromMap(m, "p_IN")[0]
+	r.CorrectExecutionTiming = ExecutionTiming(r.getFromMap(m, "p_UPSJ")[0])
+	if r.getFromMap(m, "p_UPEXSR")[0] != "" {
+		r.CorrectContractQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPEXSR")[0], 64)
+	}
+	r.CorrectExecutionType = ExecutionType(r.getFromMap(m, "p_UPPRKB")[0])
+	if r.getFromMap(m, "p_UPPR")[0] != "" {
+		r.CorrectPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPPR")[0], 64)
+	}
+	if r.getFromMap(m, "p_UPSR")[0] != "" {
+		r.CorrectQuantity, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPSR")[0], 64)
+	}
+	if r.getFromMap(m, "p_UPLMIT")[0] != "" {
+		r.CorrectExpireDate, _ = time.ParseInLocation("20060102", r.getFromMap(m, "p_UPLMIT")[0], time.Local)
+	}
+	r.CorrectStopOrderType = StopOrderType(r.getFromMap(m, "p_UPGKCDPR")[0])
+	if r.getFromMap(m, "p_UPGKPRKB")[0] != "" {
+		r.CorrectTriggerPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPGKPRKB")[0], 64)
+	}
+	if r.getFromMap(m, "p_UPGKPR")[0] != "" {
+		r.CorrectStopOrderPrice, _ = strconv.ParseFloat(r.getFromMap(m, "p_UPGKPR")[0], 64)
+	}
+}
+
+func (r *NewsStreamResponse) parse(m map[string][]string, b []byte) {
+	r.CommonStreamResponse.parse(m, b)
+
+	r.Provider = r.getFromMap(m, "p_PV")[0]
+	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
+	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
+	r.NewsId = r.getFromMap(m, "p_ID")[0]
+	r.NewsDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_DT")[0]+r.getFromMap(m, "p_TM")[0], time.Local)
+	r.NumOfCategory, _ = strconv.Atoi(r.getFromMap(m, "p_CGN")[0])
+	r.Categories = r.getFromMap(m, "p_CGL")
+	r.NumOfGenre, _ = strconv.Atoi(r.getFromMap(m, "p_GRN")[0])
+	r.Genres = r.getFromMap(m, "p_GRL")
+	r.NumOfIssue, _ = strconv.Atoi(r.getFromMap(m, "p_ISN")[0])
+	r.Issues = r.getFromMap(m, "p_ISL")
+	r.Title = r.getFromMap(m, "p_HDL")[0]
+	r.Content = r.getFromMap(m, "p_TX")[0]
+}
+
+func (r *SystemStatusStreamResponse) parse(m map[string][]string, b []byte) {
+	r.CommonStreamResponse.parse(m, b)
+
+	r.Provider = r.getFromMap(m, "p_PV")[0]
+	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
+	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
+	r.UpdateDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_CT")[0], time.Local)
+	r.ApprovalLogin = ApprovalLogin(r.getFromMap(m, "p_LK")[0])
+	r.SystemStatus = SystemStatus(r.getFromMap(m, "p_SS")[0])
+}
+
+func (r *OperationStatusStreamResponse) parse(m map[string][]string, b []byte) {
+	r.CommonStreamResponse.parse(m, b)
+
+	r.Provider = r.getFromMap(m, "p_PV")[0]
+	r.EventNo, _ = strconv.ParseInt(r.getFromMap(m, "p_ENO")[0], 10, 64)
+	r.FirstTime = r.getFromMap(m, "p_ALT")[0] != "0"
+	r.UpdateDateTime, _ = time.ParseInLocation("20060102150405", r.getFromMap(m, "p_CT")[0], time.Local)
+	r.Exchange = Exchange(r.getFromMap(m, "p_MC")[0])
+	r.AssetCode = r.getFromMap(m, "p_GSCD")[0]
+	r.ProductType = r.getFromMap(m, "p_SHSB")[0]
+	r.OperationCategory = r.getFromMap(m, "p_UC")[0]
+	r.OperationUnit = r.getFromMap(m, "p_UU")[0]
+	r.BusinessDayType = r.getFromMap(m, "p_EDK")[0]
+	r.OperationStatus = r.getFromMap(m, "p_US")[0]
+}
+
+// streamResponseToMap - フレームをマップに変換する stream_decoder.goのデコーダに置き換える前の実装で、デコーダとの比較に使う
+func (c *client) streamResponseToMap(b []byte) map[string][]string {
+	res := make(map[string][]string)
+	for _, b := range bytes.Split(b, []byte{1}) {
+		bs := bytes.Split(b, []byte{2})
+		switch len(bs) {
+		case 1:
+			res[string(bs[0])] = []string{""}
+		case 2:
+			res[string(bs[0])] = strings.Split(string(bs[1]), string([]byte{2}))
+		}
+	}
+	return res
+}
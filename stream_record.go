@@ -0,0 +1,299 @@
+package tachibana
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+const (
+	defaultStreamRecorderPrefix   = "stream"         // 記録ファイル名の接頭辞
+	defaultStreamRecorderMaxBytes = 64 * 1024 * 1024 // 記録ファイルを切り替えるサイズ(圧縮前)
+)
+
+// WithStreamRecorder - イベントストリームで受信したフレームをキープアライブも含めて、Shift-JISのまま記録する
+// 記録するのはサーバと直接通信しているときだけで、WithTransportやWithStreamReplayで通信を差し替えたあとに指定しても記録しない
+func WithStreamRecorder(recorder *StreamRecorder) ClientOption {
+	return func(c *client) {
+		if r, ok := c.requester.(*requester); ok {
+			r.recorder, r.clock = recorder, newClock()
+		}
+	}
+}
+
+// WithStreamReplay - イベントストリームをサーバに接続せずに記録ファイルから再生する
+// ストリーム以外のリクエストはそのままサーバに送る
+func WithStreamReplay(replay *StreamReplay) ClientOption {
+	return func(c *client) {
+		c.requester = &replayRequester{iRequester: c.requester, replay: replay}
+	}
+}
+
+// StreamRecorderConfig - 記録の設定
+type StreamRecorderConfig struct {
+	Dir      string // 記録ファイルを置くディレクトリ なければ作る
+	Prefix   string // 記録ファイル名の接頭辞 空なら"stream"
+	MaxBytes int64  // 1ファイルに書く量(圧縮前) 超えたら次のファイルに切り替える 0なら64MiB
+}
+
+// NewStreamRecorder - フレームの記録を生成する
+func NewStreamRecorder(config StreamRecorderConfig) (*StreamRecorder, error) {
+	if config.Prefix == "" {
+		config.Prefix = defaultStreamRecorderPrefix
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultStreamRecorderMaxBytes
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &StreamRecorder{config: config, clock: newClock()}, nil
+}
+
+// StreamRecorder - 受信したフレームを受信日時つきでgzip圧縮したファイルに記録する
+// 1行に「受信日時(UnixNano)\tフレーム」を書く フレームはサーバが送ったShift-JISのバイト列で、改行を含まない
+type StreamRecorder struct {
+	config  StreamRecorderConfig
+	clock   iClock
+	file    *os.File
+	gz      *gzip.Writer
+	written int64
+	seq     int
+	files   []string
+	err     error
+	mtx     sync.Mutex
+}
+
+// Record - フレームを記録する
+func (r *StreamRecorder) Record(receivedAt time.Time, frame []byte) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.gz == nil || r.written >= r.config.MaxBytes {
+		if err := r.rotate(); err != nil {
+			return r.fail(err)
+		}
+	}
+
+	line := make([]byte, 0, len(frame)+21)
+	line = strconv.AppendInt(line, receivedAt.UnixNano(), 10)
+	line = append(line, '\t')
+	line = append(line, frame...)
+	line = append(line, '\n')
+	n, err := r.gz.Write(line)
+	r.written += int64(n)
+	if err != nil {
+		return r.fail(err)
+	}
+	return nil
+}
+
+// rotate - 今のファイルを閉じて次のファイルを開く
+func (r *StreamRecorder) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+
+	r.seq++
+	name := filepath.Join(r.config.Dir, fmt.Sprintf("%s-%s-%04d.gz", r.config.Prefix, r.clock.Now().Format("20060102150405"), r.seq))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.gz = gzip.NewWriter(f)
+	r.written = 0
+	r.files = append(r.files, name)
+	return nil
+}
+
+func (r *StreamRecorder) closeFile() error {
+	if r.gz == nil {
+		return nil
+	}
+	gzErr := r.gz.Close()
+	fileErr := r.file.Close()
+	r.gz, r.file = nil, nil
+	if gzErr != nil {
+		return gzErr
+	}
+	return fileErr
+}
+
+func (r *StreamRecorder) fail(err error) error {
+	if r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+// Flush - 書きかけのデータをファイルに書き出す
+func (r *StreamRecorder) Flush() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.gz == nil {
+		return nil
+	}
+	return r.gz.Flush()
+}
+
+// Close - 記録を終了してファイルを閉じる
+func (r *StreamRecorder) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.closeFile()
+}
+
+// Files - 記録したファイルの一覧 記録した順
+func (r *StreamRecorder) Files() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return append([]string{}, r.files...)
+}
+
+// Err - 記録中に最初に発生したエラー ストリームを止めないよう、記録の失敗はここで確認する
+func (r *StreamRecorder) Err() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.err
+}
+
+// StreamReplaySpeed - 再生速度
+type StreamReplaySpeed float64
+
+const (
+	StreamReplaySpeedMax  StreamReplaySpeed = 0 // 待たずにできるだけ速く再生する
+	StreamReplaySpeedReal StreamReplaySpeed = 1 // 記録したときと同じ間隔で再生する
+)
+
+// StreamReplayConfig - 再生の設定
+type StreamReplayConfig struct {
+	Files []string          // 再生する記録ファイル 指定した順に再生する
+	Speed StreamReplaySpeed // 再生速度 2なら2倍速 0なら待たない
+}
+
+// NewStreamReplay - 記録ファイルの再生を生成する
+func NewStreamReplay(config StreamReplayConfig) *StreamReplay {
+	return &StreamReplay{config: config}
+}
+
+// StreamReplay - 記録ファイルからフレームを再生する
+// 接続するたびに記録の先頭から再生し、最後まで再生したらストリームを閉じる
+type StreamReplay struct {
+	config StreamReplayConfig
+}
+
+// frames - 記録したフレームを記録した間隔で流す
+func (r *StreamReplay) frames(ctx context.Context) (<-chan []byte, <-chan error) {
+	ch := make(chan []byte)
+	errCh := make(chan error)
+
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+
+		var first time.Time
+		var start time.Time
+		for _, name := range r.config.Files {
+			err := r.readFile(name, func(receivedAt time.Time, frame []byte) bool {
+				if r.config.Speed > 0 {
+					if first.IsZero() {
+						first, start = receivedAt, time.Now()
+					}
+					wait := time.Until(start.Add(time.Duration(float64(receivedAt.Sub(first)) / float64(r.config.Speed))))
+					if wait > 0 {
+						timer := time.NewTimer(wait)
+						select {
+						case <-ctx.Done():
+							timer.Stop()
+							return false
+						case <-timer.C:
+						}
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return false
+				case ch <- frame:
+					return true
+				}
+			})
+			if err != nil {
+				select {
+				case <-ctx.Done():
+				case errCh <- err:
+				}
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+
+	return ch, errCh
+}
+
+// readFile - 記録ファイルを読み、Shift-JISからUTF-8に変換したフレームごとにfを呼ぶ fがfalseを返したら終了する
+func (r *StreamReplay) readFile(name string, f func(receivedAt time.Time, frame []byte) bool) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		i := bytes.IndexByte(scanner.Bytes(), '\t')
+		if i < 0 {
+			return fmt.Errorf("%s:%d: %w", name, line, StreamRecordErr)
+		}
+		nano, err := strconv.ParseInt(string(scanner.Bytes()[:i]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", name, line, err, StreamRecordErr)
+		}
+
+		// 変換で新しいバイト列になるので、scannerのバッファをコピーしなくてよい
+		frame, _, _ := transform.Bytes(japanese.ShiftJIS.NewDecoder(), scanner.Bytes()[i+1:])
+		if !f(time.Unix(0, nano), frame) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// replayRequester - ストリームを記録ファイルから再生するrequester
+type replayRequester struct {
+	iRequester
+	replay *StreamReplay
+}
+
+func (r *replayRequester) stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) {
+	if _, ok := request.(StreamRequest); !ok {
+		return r.iRequester.stream(ctx, uri, request)
+	}
+	return r.replay.frames(ctx)
+}
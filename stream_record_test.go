@@ -0,0 +1,347 @@
+package tachibana
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// testRecordFrames - UTF-8のフレームをShift-JISにして記録ファイルを作り、そのファイル名を返す
+func testRecordFrames(t *testing.T, config StreamRecorderConfig, start time.Time, interval time.Duration, frames ...[]byte) []string {
+	t.Helper()
+	recorder, err := NewStreamRecorder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range frames {
+		// サーバと同じShift-JISで記録する
+		sjis, _, err := transform.Bytes(japanese.ShiftJIS.NewEncoder(), frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.Record(start.Add(time.Duration(i)*interval), sjis); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Files()
+}
+
+// testReplayFrames - 再生したフレームをすべて読む
+func testReplayFrames(ctx context.Context, replay *StreamReplay) ([][]byte, error) {
+	ch, errCh := replay.frames(ctx)
+	var frames [][]byte
+	var err error
+	for ch != nil || errCh != nil {
+		select {
+		case b, ok := <-ch:
+			if !ok {
+				ch = nil
+				continue
+			}
+			frames = append(frames, b)
+		case e, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			err = e
+		}
+	}
+	return frames, err
+}
+
+func Test_NewStreamRecorder(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	got, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := StreamRecorderConfig{Dir: dir, Prefix: defaultStreamRecorderPrefix, MaxBytes: defaultStreamRecorderMaxBytes}
+	if _, statErr := os.Stat(dir); !reflect.DeepEqual(want, got.config) || statErr != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), want, nil, got.config, statErr)
+	}
+}
+
+func Test_StreamRecorder_Record(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	start := time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)
+	frames := [][]byte{
+		testStreamFrame("p_no", "1", "p_cmd", "KP"),
+		testStreamFrame("p_no", "2", "p_cmd", "FD", "p_1_DPP", "378.6"),
+		testStreamFrame("p_no", "3", "p_cmd", "KP"),
+		testStreamFrame("p_no", "4", "p_cmd", "FD", "p_1_DPP", "378.7"),
+		testStreamFrame("p_no", "5", "p_cmd", "KP"),
+	}
+
+	// 2フレーム書くと上限を超えるので、3ファイルに分かれる
+	recorder, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir, Prefix: "test", MaxBytes: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.clock = &testClock{Now1: start}
+	for i, frame := range frames {
+		if err := recorder.Record(start.Add(time.Duration(i)*time.Second), frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantFiles := []string{
+		filepath.Join(dir, "test-20220726090000-0001.gz"),
+		filepath.Join(dir, "test-20220726090000-0002.gz"),
+		filepath.Join(dir, "test-20220726090000-0003.gz"),
+	}
+	gotFiles := recorder.Files()
+	gotFrames, gotErr := testReplayFrames(context.Background(), NewStreamReplay(StreamReplayConfig{Files: gotFiles}))
+	if !reflect.DeepEqual(wantFiles, gotFiles) || !reflect.DeepEqual(frames, gotFrames) || gotErr != nil || recorder.Err() != nil {
+		t.Errorf("%s error\nwant: %+v, %q, %+v\ngot: %+v, %q, %+v, %+v\n", t.Name(), wantFiles, frames, nil, gotFiles, gotFrames, gotErr, recorder.Err())
+	}
+}
+
+func Test_StreamRecorder_Record_error(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	recorder, err := NewStreamRecorder(StreamRecorderConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.clock = &testClock{Now1: time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)}
+
+	// 同じ名前のファイルがあれば上書きせずにエラーにする
+	if err := os.WriteFile(filepath.Join(dir, "stream-20220726090000-0001.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := recorder.Record(time.Now(), []byte("p_cmd\x02KP"))
+	if !errors.Is(got, os.ErrExist) || !errors.Is(recorder.Err(), os.ErrExist) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v, %+v\n", t.Name(), os.ErrExist, got, recorder.Err())
+	}
+}
+
+func Test_StreamReplay_frames_error(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.gz")
+	f, err := os.Create(invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	_, _ = gz.Write([]byte("1658793600000000000\tp_cmd\x02KP\nbroken\n"))
+	_ = gz.Close()
+	_ = f.Close()
+
+	tests := []struct {
+		name       string
+		files      []string
+		wantFrames [][]byte
+		wantErr    error
+	}{
+		{name: "ファイルがなければエラー", files: []string{filepath.Join(dir, "none.gz")}, wantFrames: nil, wantErr: os.ErrNotExist},
+		{name: "壊れた行があればそこまで再生してエラー", files: []string{invalid}, wantFrames: [][]byte{[]byte("p_cmd\x02KP")}, wantErr: StreamRecordErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			gotFrames, gotErr := testReplayFrames(context.Background(), NewStreamReplay(StreamReplayConfig{Files: test.files}))
+			if !reflect.DeepEqual(test.wantFrames, gotFrames) || !errors.Is(gotErr, test.wantErr) {
+				t.Errorf("%s error\nwant: %q, %+v\ngot: %q, %+v\n", t.Name(), test.wantFrames, test.wantErr, gotFrames, gotErr)
+			}
+		})
+	}
+}
+
+func Test_StreamReplay_frames_speed(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)
+	files := testRecordFrames(t, StreamRecorderConfig{Dir: t.TempDir()}, start, 100*time.Millisecond,
+		[]byte("p_no\x021"), []byte("p_no\x022"), []byte("p_no\x023"))
+
+	tests := []struct {
+		name  string
+		speed StreamReplaySpeed
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "等速なら記録した間隔で再生する", speed: StreamReplaySpeedReal, min: 200 * time.Millisecond, max: 2 * time.Second},
+		{name: "4倍速なら1/4の間隔で再生する", speed: 4, min: 50 * time.Millisecond, max: 190 * time.Millisecond},
+		{name: "最速なら待たない", speed: StreamReplaySpeedMax, min: 0, max: 50 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			begin := time.Now()
+			frames, err := testReplayFrames(context.Background(), NewStreamReplay(StreamReplayConfig{Files: files, Speed: test.speed}))
+			got := time.Since(begin)
+			if len(frames) != 3 || err != nil || got < test.min || got > test.max {
+				t.Errorf("%s error\nwant: %+v~%+v\ngot: %+v, %+v, %+v\n", t.Name(), test.min, test.max, got, len(frames), err)
+			}
+		})
+	}
+}
+
+func Test_StreamReplay_frames_cancel(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)
+	files := testRecordFrames(t, StreamRecorderConfig{Dir: t.TempDir()}, start, time.Hour, []byte("p_no\x021"), []byte("p_no\x022"))
+
+	ctx, cf := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cf()
+	frames, err := testReplayFrames(ctx, NewStreamReplay(StreamReplayConfig{Files: files, Speed: StreamReplaySpeedReal}))
+	if !reflect.DeepEqual([][]byte{[]byte("p_no\x021")}, frames) || err != nil {
+		t.Errorf("%s error\nwant: %q, %+v\ngot: %q, %+v\n", t.Name(), [][]byte{[]byte("p_no\x021")}, nil, frames, err)
+	}
+}
+
+func Test_client_Stream_replay(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2022, 7, 26, 9, 0, 0, 0, time.Local)
+	files := testRecordFrames(t, StreamRecorderConfig{Dir: t.TempDir()}, start, time.Second,
+		testStreamFrame("p_no", "1", "p_date", "2022.07.26-09:00:00.000", "p_errno", "0", "p_err", "", "p_cmd", "KP"),
+		testContractFrame,
+		testStreamFrame("p_no", "3", "p_date", "2022.07.26-09:00:02.000", "p_errno", "0", "p_err", "", "p_cmd", "KP"))
+
+	tests := []struct {
+		name string
+		req  StreamRequest
+		want []EventType
+	}{
+		{name: "キープアライブを通知しない", req: StreamRequest{}, want: []EventType{EventTypeContract}},
+		{name: "キープアライブも通知する", req: StreamRequest{NotifyKeepAlive: true}, want: []EventType{EventTypeKeepAlive, EventTypeContract, EventTypeKeepAlive}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			c := NewClient(EnvironmentDemo, ApiVersionLatest, WithStreamReplay(NewStreamReplay(StreamReplayConfig{Files: files})))
+			ch, errCh := c.Stream(context.Background(), &Session{EventURL: "https://example.com/event/"}, test.req)
+			var got []EventType
+			var gotErr error
+			for ch != nil || errCh != nil {
+				select {
+				case res, ok := <-ch:
+					if !ok {
+						ch = nil
+						continue
+					}
+					got = append(got, res.GetEventType())
+				case err, ok := <-errCh:
+					if !ok {
+						errCh = nil
+						continue
+					}
+					gotErr = err
+				}
+			}
+			if !reflect.DeepEqual(test.want, got) || gotErr != nil {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, nil, got, gotErr)
+			}
+		})
+	}
+}
+
+func Test_client_Stream_record(t *testing.T) {
+	t.Parallel()
+	recorder, err := NewStreamRecorder(StreamRecorderConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := [][]byte{
+		testStreamFrame("p_no", "1", "p_date", "2022.07.26-09:00:00.000", "p_errno", "0", "p_err", "", "p_cmd", "KP"),
+		testContractFrame,
+	}
+	sjisFrames := make([][]byte, len(frames))
+	for i, frame := range frames {
+		sjisFrames[i], _, _ = transform.Bytes(japanese.ShiftJIS.NewEncoder(), frame)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		flusher, _ := w.(http.Flusher)
+		w.WriteHeader(http.StatusOK)
+		for _, b := range sjisFrames {
+			_, _ = w.Write(append(b, '\n'))
+			flusher.Flush()
+		}
+	})
+	ts := httptest.NewTLSServer(mux)
+	defer ts.Close()
+
+	c := &client{clock: newClock(), requester: &requester{insecureSkipVerify: true}}
+	WithStreamRecorder(recorder)(c)
+
+	// キープアライブは通知しなくても記録する
+	ch, errCh := c.Stream(context.Background(), &Session{EventURL: ts.URL}, StreamRequest{})
+	var got []EventType
+	for res := range ch {
+		got = append(got, res.GetEventType())
+	}
+	for range errCh {
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 記録はサーバが送ったShift-JISのままで、再生するとUTF-8に変換される
+	var recorded [][]byte
+	for _, name := range recorder.Files() {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(gz)
+		_ = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n")) {
+			recorded = append(recorded, line[bytes.IndexByte(line, '\t')+1:])
+		}
+	}
+	replayed, replayErr := testReplayFrames(context.Background(), NewStreamReplay(StreamReplayConfig{Files: recorder.Files()}))
+	if !reflect.DeepEqual([]EventType{EventTypeContract}, got) || !reflect.DeepEqual(sjisFrames, recorded) || !reflect.DeepEqual(frames, replayed) || replayErr != nil {
+		t.Errorf("%s error\nwant: %+v, %q, %q\ngot: %+v, %q, %q, %+v\n", t.Name(), []EventType{EventTypeContract}, sjisFrames, frames, got, recorded, replayed, replayErr)
+	}
+}
+
+func Test_WithStreamRecorder_transport(t *testing.T) {
+	t.Parallel()
+	recorder, err := NewStreamRecorder(StreamRecorderConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 通信を差し替えたあとは記録しない
+	transport := &testTransport{}
+	c := NewClient(EnvironmentDemo, ApiVersionLatest, WithTransport(transport), WithStreamRecorder(recorder)).(*client)
+	if got, ok := c.requester.(*transportRequester); !ok || got.transport != transport {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), transport, c.requester)
+	}
+}
@@ -836,6 +836,85 @@ func Test_MarketPriceStreamResponse_getColumnNumber(t *testing.T) {
 	}
 }
 
+// marketPriceFieldSetOf - 指定した項目の集合
+func marketPriceFieldSetOf(fields ...MarketPriceField) MarketPriceFieldSet {
+	var set MarketPriceFieldSet
+	for _, f := range fields {
+		set.add(f)
+	}
+	return set
+}
+
+// marketPriceFieldSetExcept - 指定した項目以外のすべての項目の集合
+func marketPriceFieldSetExcept(fields ...MarketPriceField) MarketPriceFieldSet {
+	var set MarketPriceFieldSet
+	for f := MarketPriceField(0); f < marketPriceFieldLen; f++ {
+		set.add(f)
+	}
+	for _, f := range fields {
+		set[f/64] &^= 1 << (f % 64)
+	}
+	return set
+}
+
+func Test_MarketPriceFieldSet_Has(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		set  MarketPriceFieldSet
+		arg  MarketPriceField
+		want bool
+	}{
+		{name: "含まれていればtrue", set: marketPriceFieldSetOf(MarketPriceFieldCurrentPrice), arg: MarketPriceFieldCurrentPrice, want: true},
+		{name: "含まれていなければfalse", set: marketPriceFieldSetOf(MarketPriceFieldCurrentPrice), arg: MarketPriceFieldVolume, want: false},
+		{name: "64番目以降の項目も扱える", set: marketPriceFieldSetOf(MarketPriceFieldVWAP), arg: MarketPriceFieldVWAP, want: true},
+		{name: "範囲外ならfalse", set: marketPriceFieldSetExcept(), arg: marketPriceFieldLen, want: false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := test.set.Has(test.arg)
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_MarketPriceFieldSet_Fields(t *testing.T) {
+	t.Parallel()
+	got := marketPriceFieldSetOf(MarketPriceFieldVWAP, MarketPriceFieldAskQuantityMarket, MarketPriceFieldCurrentPrice).Fields()
+	want := []MarketPriceField{MarketPriceFieldAskQuantityMarket, MarketPriceFieldCurrentPrice, MarketPriceFieldVWAP}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+func Test_MarketPriceField_String(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  MarketPriceField
+		want string
+	}{
+		{name: "フィールド名を返す", arg: MarketPriceFieldCurrentPriceTime, want: "CurrentPriceTime"},
+		{name: "範囲外なら番号を返す", arg: marketPriceFieldLen, want: "MarketPriceField(70)"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := test.arg.String()
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
 func Test_MarketPriceStreamResponse_parse(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -998,6 +1077,33 @@ func Test_MarketPriceStreamResponse_parse(t *testing.T) {
 				AskQuantityOver:   1020310,
 				BidQuantityUnder:  781260,
 				VWAP:              374.4676,
+				PresentFields:     marketPriceFieldSetExcept(MarketPriceFieldAskQuantityMarket, MarketPriceFieldBidQuantityMarket, MarketPriceFieldDiscontinuityType, MarketPriceFieldExRightType, MarketPriceFieldSection),
+			},
+		},
+		{name: "含まれていない項目はゼロ値で、PresentFieldsで区別できる",
+			arg1: map[string][]string{
+				"p_no":    {"4"},
+				"p_date":  {"2022.07.26-20:04:49.000"},
+				"p_errno": {"0"},
+				"p_err":   {""},
+				"p_cmd":   {"FD"},
+				"p_5_DV":  {"3120180"},
+				"p_5_QBP": {"0"},
+			},
+			arg2: []byte("p_no\x024\x01p_date\x022022.07.26-20:04:49.000\x01p_errno\x020\x01p_err\x02\x01p_cmd\x02FD\x01p_5_DV\x023120180\x01p_5_QBP\x020"),
+			want1: MarketPriceStreamResponse{
+				CommonStreamResponse: CommonStreamResponse{
+					EventType:      EventTypeMarketPrice,
+					StreamNumber:   4,
+					StreamDateTime: time.Date(2022, 7, 26, 20, 4, 49, 0, time.Local),
+					ErrorNo:        ErrorNoProblem,
+					ErrorText:      "",
+					Body:           []byte("p_no\x024\x01p_date\x022022.07.26-20:04:49.000\x01p_errno\x020\x01p_err\x02\x01p_cmd\x02FD\x01p_5_DV\x023120180\x01p_5_QBP\x020"),
+				},
+				ColumnNumber:  5,
+				Volume:        3120180,
+				BidPrice:      0,
+				PresentFields: marketPriceFieldSetOf(MarketPriceFieldVolume, MarketPriceFieldBidPrice),
 			},
 		},
 	}
@@ -1069,6 +1175,26 @@ func Test_client_Stream(t *testing.T) {
 			arg3:  StreamRequest{},
 			want1: nil,
 			want2: nil},
+		{name: "NotifyKeepAliveが指定されていればKeep Aliveも通知する",
+			stream: func(stream1 chan<- []byte, stream2 chan<- error) {
+				defer close(stream1)
+				defer close(stream2)
+				stream1 <- []byte{112, 95, 110, 111, 2, 53, 1, 112, 95, 100, 97, 116, 101, 2, 50, 48, 50, 50, 46, 48, 55, 46, 49, 54, 45, 49, 54, 58, 52, 55, 58, 50, 56, 46, 49, 55, 52, 1, 112, 95, 101, 114, 114, 110, 111, 2, 48, 1, 112, 95, 101, 114, 114, 2, 1, 112, 95, 99, 109, 100, 2, 75, 80}
+			},
+			arg1: context.Background(),
+			arg2: &Session{lastRequestNo: 1, RequestURL: "", EventURL: ""},
+			arg3: StreamRequest{NotifyKeepAlive: true},
+			want1: []StreamResponse{
+				&CommonStreamResponse{
+					EventType:      EventTypeKeepAlive,
+					StreamNumber:   5,
+					StreamDateTime: time.Date(2022, 7, 16, 16, 47, 28, 174000000, time.Local),
+					ErrorNo:        ErrorNoProblem,
+					ErrorText:      "",
+					Body:           []byte{112, 95, 110, 111, 2, 53, 1, 112, 95, 100, 97, 116, 101, 2, 50, 48, 50, 50, 46, 48, 55, 46, 49, 54, 45, 49, 54, 58, 52, 55, 58, 50, 56, 46, 49, 55, 52, 1, 112, 95, 101, 114, 114, 110, 111, 2, 48, 1, 112, 95, 101, 114, 114, 2, 1, 112, 95, 99, 109, 100, 2, 75, 80},
+				},
+			},
+			want2: nil},
 		{name: "p_cmdがレスポンスに含まれていなかったらCommonStreamResponseとしてパース",
 			stream: func(stream1 chan<- []byte, stream2 chan<- error) {
 				defer close(stream1)
@@ -1291,6 +1417,7 @@ func Test_client_Stream(t *testing.T) {
 					AskQuantityOver:   1020310,
 					BidQuantityUnder:  781260,
 					VWAP:              374.4676,
+					PresentFields:     marketPriceFieldSetExcept(MarketPriceFieldAskQuantityMarket, MarketPriceFieldBidQuantityMarket, MarketPriceFieldDiscontinuityType, MarketPriceFieldExRightType, MarketPriceFieldSection),
 				},
 			},
 			want2: nil},
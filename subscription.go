@@ -0,0 +1,95 @@
+package tachibana
+
+import (
+	"context"
+	"sync"
+)
+
+// NewSubscription - イベントストリームを購読する
+// 購読をやめるときはCloseを呼ぶ 渡したctxが終了した場合も購読は終了する
+func NewSubscription(ctx context.Context, client Client, session *Session, req StreamRequest) *Subscription {
+	cCtx, cf := context.WithCancel(ctx)
+	s := &Subscription{
+		events: make(chan StreamResponse),
+		cancel: cf,
+		done:   make(chan struct{}),
+	}
+
+	ch, errCh := client.Stream(cCtx, session, req)
+	go s.run(cCtx, ch, errCh)
+
+	return s
+}
+
+// Subscription - イベントストリームの購読
+// 終了時には、ストリームの受信で起動したgoroutineとコネクションがすべて解放されてからDoneが閉じられる
+type Subscription struct {
+	events chan StreamResponse
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	mtx    sync.Mutex
+}
+
+func (s *Subscription) run(ctx context.Context, ch <-chan StreamResponse, errCh <-chan error) {
+	defer close(s.done)
+	defer close(s.events)
+	defer s.cancel()
+
+	// 購読が終わっても、ストリームのチャネルが閉じられるまで読み続けて送信側の終了を待つ
+	for ch != nil || errCh != nil {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				ch = nil
+				s.cancel()
+				continue
+			}
+			select {
+			case <-ctx.Done():
+			case s.events <- res:
+			}
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			s.setErr(err)
+			s.cancel()
+		}
+	}
+}
+
+func (s *Subscription) setErr(err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Events - 受信したイベントのチャネル 購読が終了したら閉じられる
+func (s *Subscription) Events() <-chan StreamResponse {
+	return s.events
+}
+
+// Err - 購読がエラーで終了した場合のエラー Closeやctxの終了で終わった場合はnil
+func (s *Subscription) Err() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.err
+}
+
+// Done - 購読が終了し、すべてのリソースが解放されたら閉じられるチャネル
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close - 購読を終了し、すべてのリソースが解放されるまで待つ 何度呼んでもよい
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return s.Err()
+}
@@ -0,0 +1,216 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitGoroutines - goroutineの数がwant以下に戻るまで待つ 戻らなければ残っているgoroutineを出力して失敗にする
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("%s goroutine leaked\nwant: %d\ngot: %d\n%s", t.Name(), want, runtime.NumGoroutine(), buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newTestEventServer - 止められるまで時価情報のイベントを流し続けるサーバ 閉じられたコネクション数を数える
+func newTestEventServer() (*httptest.Server, func() int) {
+	var closed int
+	var mtx sync.Mutex
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, _ := w.(http.Flusher)
+		w.WriteHeader(http.StatusOK)
+		for i := 1; ; i++ {
+			_, _ = w.Write([]byte(fmt.Sprintf("p_no\x02%d\x01p_date\x022022.07.14-05:37:06.392\x01p_errno\x020\x01p_err\x02\x01p_cmd\x02FD\n", i)))
+			flusher.Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			mtx.Lock()
+			defer mtx.Unlock()
+			closed++
+		}
+	}
+	ts.StartTLS()
+
+	return ts, func() int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return closed
+	}
+}
+
+func Test_NewSubscription(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		streams    []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error)
+		wantEvents []StreamResponse
+		wantErr    error
+	}{
+		{name: "ストリームが閉じられるまでイベントを流し、エラーなしで終了する",
+			streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+					ch <- &CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 1}
+					ch <- &CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 2}
+				},
+			},
+			wantEvents: []StreamResponse{
+				&CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 1},
+				&CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 2},
+			},
+			wantErr: nil},
+		{name: "エラーが流れたらイベントを閉じてErrでエラーを返す",
+			streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+				func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+					ch <- &CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 1}
+					errCh <- StreamError
+				},
+			},
+			wantEvents: []StreamResponse{
+				&CommonStreamResponse{EventType: EventTypeMarketPrice, StreamNumber: 1},
+			},
+			wantErr: StreamError},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{streams: test.streams}
+			sub := NewSubscription(context.Background(), client, &Session{}, StreamRequest{})
+
+			var got []StreamResponse
+			for res := range sub.Events() {
+				got = append(got, res)
+			}
+			<-sub.Done()
+
+			if !reflect.DeepEqual(test.wantEvents, got) || !errors.Is(sub.Err(), test.wantErr) || !errors.Is(sub.Close(), test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.wantEvents, test.wantErr, got, sub.Err())
+			}
+		})
+	}
+}
+
+func Test_Subscription_Close(t *testing.T) {
+	t.Parallel()
+	client := &testClient{streams: []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error){
+		func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- &CommonStreamResponse{EventType: EventTypeMarketPrice}:
+				}
+			}
+		},
+	}}
+	sub := NewSubscription(context.Background(), client, &Session{}, StreamRequest{})
+	<-sub.Events()
+
+	got1 := sub.Close()
+	got2 := sub.Close() // 2回目も待たずに返る
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Errorf("%s error\nDone is not closed", t.Name())
+	}
+	if got1 != nil || got2 != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), nil, nil, got1, got2)
+	}
+}
+
+// Test_Subscription_Close_NoLeak - 読み手が止まった状態でCloseしても、goroutineとコネクションが解放されること
+// goroutineの数を比較するため、他のテストと並列に実行しない
+func Test_Subscription_Close_NoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ts, closed := newTestEventServer()
+	client := &client{clock: newClock(), requester: &requester{insecureSkipVerify: true}}
+	sub := NewSubscription(context.Background(), client, &Session{EventURL: ts.URL}, StreamRequest{})
+
+	// 1件だけ読んで、その後は読まずにサーバからの送信を詰まらせる
+	<-sub.Events()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := sub.Close(); err != nil {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("%s error\nClose took %s", t.Name(), d)
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Errorf("%s error\nEvents is not closed", t.Name())
+	}
+
+	ts.Close()
+	if got := closed(); got != 1 {
+		t.Errorf("%s error\nwant closed connections: %d\ngot: %d\n", t.Name(), 1, got)
+	}
+	waitGoroutines(t, before)
+}
+
+// Test_client_Stream_NoLeak - 読み手がいなくなってもctxを終了すればStreamのgoroutineが解放されること
+// goroutineの数を比較するため、他のテストと並列に実行しない
+func Test_client_Stream_NoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ts, closed := newTestEventServer()
+	client := &client{clock: newClock(), requester: &requester{insecureSkipVerify: true}}
+	ctx, cf := context.WithCancel(context.Background())
+	ch, errCh := client.Stream(ctx, &Session{EventURL: ts.URL}, StreamRequest{})
+
+	<-ch
+	time.Sleep(100 * time.Millisecond)
+	cf()
+
+	// ctxの終了後は送信されずに閉じられる
+	for ch != nil || errCh != nil {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				ch = nil
+			}
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("%s error\nchannels are not closed", t.Name())
+		}
+	}
+
+	ts.Close()
+	if got := closed(); got != 1 {
+		t.Errorf("%s error\nwant closed connections: %d\ngot: %d\n", t.Name(), 1, got)
+	}
+	waitGoroutines(t, before)
+}
@@ -22,17 +22,24 @@ import (
 )
 
 // NewClient - クライアントの生成
-func NewClient(env Environment, ver ApiVersion) Client {
+// 本番環境で注文を送るにはWithProductionOrders、送らずに試すにはWithDryRunを指定する 環境を指定しなければ注文は送れない
+func NewClient(env Environment, ver ApiVersion, opts ...ClientOption) Client {
 	client := &client{
 		clock:     newClock(),
 		env:       env,
 		ver:       ver,
 		requester: &requester{},
 	}
+	for _, opt := range opts {
+		opt(client)
+	}
 
 	return client
 }
 
+// ClientOption - クライアント生成時のオプション
+type ClientOption func(c *client)
+
 type Client interface {
 	Login(ctx context.Context, req LoginRequest) (*LoginResponse, error)                                                             // ログイン
 	Logout(ctx context.Context, session *Session, req LogoutRequest) (*LogoutResponse, error)                                        // ログアウト
@@ -55,10 +62,13 @@ type Client interface {
 }
 
 type client struct {
-	clock     iClock
-	env       Environment
-	ver       ApiVersion
-	requester iRequester
+	clock            iClock
+	env              Environment
+	ver              ApiVersion
+	requester        iRequester
+	productionOrders bool
+	dryRun           *dryRun
+	dryRunValidator  *Validator
 }
 
 // host - ホスト
@@ -134,6 +144,8 @@ type iRequester interface {
 
 type requester struct {
 	insecureSkipVerify bool
+	recorder           *StreamRecorder // イベントストリームで受信したフレームを変換する前に記録する
+	clock              iClock
 }
 
 // encode - 文字コードの変換(UTF-8 -> Shift-JIS)と、URLエンコード
@@ -199,6 +211,7 @@ func (r *requester) get(ctx context.Context, uri string, request interface{}) ([
 }
 
 // stream - chunked response リクエスト
+// ctxが終了したらコネクションを閉じ、内部のgoroutineがすべて終了してからチャネルを閉じる
 func (r *requester) stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) {
 	ch := make(chan []byte)
 	errCh := make(chan error)
@@ -207,6 +220,13 @@ func (r *requester) stream(ctx context.Context, uri string, request interface{})
 		defer close(ch)
 		defer close(errCh)
 
+		sendErr := func(err error) {
+			select {
+			case <-ctx.Done():
+			case errCh <- err:
+			}
+		}
+
 		var query []byte
 		switch req := request.(type) {
 		case StreamRequest:
@@ -214,12 +234,12 @@ func (r *requester) stream(ctx context.Context, uri string, request interface{})
 		default:
 			rb, err := json.Marshal(request)
 			if err != nil {
-				errCh <- err
+				sendErr(err)
 				return
 			}
 			query, err = r.encode(rb)
 			if err != nil {
-				errCh <- err
+				sendErr(err)
 				return
 			}
 		}
@@ -228,30 +248,44 @@ func (r *requester) stream(ctx context.Context, uri string, request interface{})
 		u.RawQuery = string(query)
 
 		// TCPソケットオープン
-		dialer := &net.Dialer{
-			Timeout:   5 * time.Second,
-			KeepAlive: 5 * time.Second,
+		dialer := &tls.Dialer{
+			NetDialer: &net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 5 * time.Second,
+			},
+			Config: &tls.Config{InsecureSkipVerify: r.insecureSkipVerify},
 		}
 		host := u.Host
 		if !strings.Contains(host, ":") {
 			host += ":443"
 		}
-		conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{InsecureSkipVerify: r.insecureSkipVerify})
+		conn, err := dialer.DialContext(ctx, "tcp", host)
 		if err != nil {
-			errCh <- err
+			sendErr(err)
 			return
 		}
 		defer conn.Close()
 
+		// 読み込み中でもctxの終了で抜けられるよう、ctxが終了したらコネクションを閉じる
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = conn.Close()
+			case <-stop:
+			}
+		}()
+
 		// コネクションを通してリクエストの送信
 		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 		if err != nil {
-			errCh <- err
+			sendErr(err)
 			return
 		}
 		err = req.Write(conn)
 		if err != nil {
-			errCh <- err
+			sendErr(err)
 			return
 		}
 
@@ -259,23 +293,30 @@ func (r *requester) stream(ctx context.Context, uri string, request interface{})
 		reader := bufio.NewReader(conn)
 		res, err := http.ReadResponse(reader, req)
 		if err != nil {
-			errCh <- err
+			sendErr(err)
 			return
 		}
 		if len(res.TransferEncoding) < 1 || res.TransferEncoding[0] != "chunked" {
-			errCh <- errors.New("response is not chunked")
+			sendErr(errors.New("response is not chunked"))
 			return
 		}
 
 		// レスポンスをチャネルに流していく
-		sCh, sErrCh := r.scanChunkedResponse(reader)
+		sCh, sErrCh := r.scanChunkedResponse(ctx, reader)
+		defer func() {
+			// 読み込み中のgoroutineを止めて、終了するまで待つ
+			_ = conn.Close()
+			for range sCh {
+			}
+		}()
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case err, ok := <-sErrCh:
-				if ok && err != nil {
-					errCh <- err
+				// ctxの終了でコネクションを閉じたことによるエラーは通知しない
+				if ok && err != nil && ctx.Err() == nil {
+					sendErr(err)
 				}
 				return
 			case b, ok := <-sCh:
@@ -283,8 +324,15 @@ func (r *requester) stream(ctx context.Context, uri string, request interface{})
 					return
 				}
 
+				if _, ok := request.(StreamRequest); ok && r.recorder != nil {
+					_ = r.recorder.Record(r.clock.Now(), b) // 記録に失敗してもストリームは止めない
+				}
 				d, _ := r.decode(b) // decodeでは失敗がおきないのでエラーを捨てる
-				ch <- d
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- d:
+				}
 			}
 		}
 	}()
@@ -292,7 +340,7 @@ func (r *requester) stream(ctx context.Context, uri string, request interface{})
 	return ch, errCh
 }
 
-func (r *requester) scanChunkedResponse(reader io.Reader) (<-chan []byte, <-chan error) {
+func (r *requester) scanChunkedResponse(ctx context.Context, reader io.Reader) (<-chan []byte, <-chan error) {
 	ch := make(chan []byte)
 	errCh := make(chan error)
 
@@ -302,9 +350,19 @@ func (r *requester) scanChunkedResponse(reader io.Reader) (<-chan []byte, <-chan
 
 		scanner := bufio.NewScanner(httputil.NewChunkedReader(reader))
 		for scanner.Scan() {
-			ch <- scanner.Bytes()
+			// scannerのバッファは次のScanで上書きされるのでコピーして流す
+			b := make([]byte, len(scanner.Bytes()))
+			copy(b, scanner.Bytes())
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- b:
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case errCh <- scanner.Err():
 		}
-		errCh <- scanner.Err()
 	}()
 
 	return ch, errCh
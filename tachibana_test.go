@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -38,6 +39,112 @@ func (t *testRequester) stream(ctx context.Context, uri string, request interfac
 	return t.stream1, t.stream2
 }
 
+type testClient struct {
+	Client
+	login1              *LoginResponse
+	login2              error
+	loginCount          int
+	streams             []func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error)
+	streamCount         int
+	streamHistory       []StreamRequest
+	marketPrice1        *MarketPriceResponse
+	marketPrice2        error
+	newOrder1           *NewOrderResponse
+	newOrder2           error
+	newOrderCount       int
+	correctOrder1       *CorrectOrderResponse
+	correctOrder2       error
+	correctCount        int
+	orderDetail1        *OrderDetailResponse
+	orderDetail2        error
+	orderList1          *OrderListResponse
+	orderList2          error
+	cancelOrder1        *CancelOrderResponse
+	cancelOrder2        error
+	cancelCount         int
+	stockPositionList1  *StockPositionListResponse
+	stockPositionList2  error
+	marginPositionList1 *MarginPositionListResponse
+	marginPositionList2 error
+	mtx                 sync.Mutex
+}
+
+func (t *testClient) Login(context.Context, LoginRequest) (*LoginResponse, error) {
+	t.loginCount++
+	return t.login1, t.login2
+}
+
+func (t *testClient) MarketPrice(context.Context, *Session, MarketPriceRequest) (*MarketPriceResponse, error) {
+	return t.marketPrice1, t.marketPrice2
+}
+
+func (t *testClient) NewOrder(context.Context, *Session, NewOrderRequest) (*NewOrderResponse, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.newOrderCount++
+	return t.newOrder1, t.newOrder2
+}
+
+func (t *testClient) CorrectOrder(context.Context, *Session, CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.correctCount++
+	return t.correctOrder1, t.correctOrder2
+}
+
+func (t *testClient) CancelOrder(context.Context, *Session, CancelOrderRequest) (*CancelOrderResponse, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.cancelCount++
+	return t.cancelOrder1, t.cancelOrder2
+}
+
+func (t *testClient) OrderDetail(context.Context, *Session, OrderDetailRequest) (*OrderDetailResponse, error) {
+	return t.orderDetail1, t.orderDetail2
+}
+
+func (t *testClient) OrderList(context.Context, *Session, OrderListRequest) (*OrderListResponse, error) {
+	return t.orderList1, t.orderList2
+}
+
+func (t *testClient) StockPositionList(context.Context, *Session, StockPositionListRequest) (*StockPositionListResponse, error) {
+	return t.stockPositionList1, t.stockPositionList2
+}
+
+func (t *testClient) MarginPositionList(context.Context, *Session, MarginPositionListRequest) (*MarginPositionListResponse, error) {
+	return t.marginPositionList1, t.marginPositionList2
+}
+
+// Stream - streamsに登録された関数を呼び出し順に使ってストリームを返す 使い切ったら何も返さずに閉じる
+func (t *testClient) Stream(ctx context.Context, _ *Session, req StreamRequest) (<-chan StreamResponse, <-chan error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	ch := make(chan StreamResponse)
+	errCh := make(chan error)
+	var f func(ctx context.Context, ch chan<- StreamResponse, errCh chan<- error)
+	if t.streamCount < len(t.streams) {
+		f = t.streams[t.streamCount]
+	}
+	t.streamCount++
+	t.streamHistory = append(t.streamHistory, req)
+
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+		if f != nil {
+			f(ctx, ch, errCh)
+		}
+	}()
+	return ch, errCh
+}
+
+func (t *testClient) getStreamHistory() []StreamRequest {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return append([]StreamRequest{}, t.streamHistory...)
+}
+
 func Test_tachibana_authURL(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -0,0 +1,307 @@
+package tachibana
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// tickEpsilon - 浮動小数点の誤差として無視する呼値の単位に対する割合
+const tickEpsilon = 1e-9
+
+// TickRound - 呼値の単位に丸める方向
+type TickRound string
+
+const (
+	TickRoundUnspecified TickRound = ""        // 未指定(Nearest)
+	TickRoundNearest     TickRound = "nearest" // 近いほう 真ん中なら上
+	TickRoundUp          TickRound = "up"      // 切り上げ
+	TickRoundDown        TickRound = "down"    // 切り捨て
+)
+
+// tickIssue - 銘柄の呼値の単位番号
+type tickIssue struct {
+	tickGroupType     TickGroupType // 当日
+	nextTickGroupType TickGroupType // 翌営業日
+	underLimitPrice   float64       // 当日の値幅下限
+	upperLimitPrice   float64       // 当日の値幅上限
+}
+
+// NewTickService - 呼値と株式銘柄市場マスタから呼値の計算を生成する
+// businessDayはマスタを取得した営業日で、それより後の日付では翌営業日の呼値の単位番号を使う
+func NewTickService(tickGroups []*TickGroupResponse, masters []StockExchangeMaster, businessDay time.Time) *TickService {
+	groups := map[TickGroupType][]*TickGroupResponse{}
+	for _, g := range tickGroups {
+		if g != nil {
+			groups[g.TickGroupType] = append(groups[g.TickGroupType], g)
+		}
+	}
+	for _, g := range groups {
+		g := g
+		sort.SliceStable(g, func(i, j int) bool { return g[i].StartDate.Before(g[j].StartDate) })
+	}
+
+	issues := map[string]map[Exchange]tickIssue{}
+	for _, m := range masters {
+		if _, ok := issues[m.IssueCode]; !ok {
+			issues[m.IssueCode] = map[Exchange]tickIssue{}
+		}
+		issues[m.IssueCode][m.Exchange] = tickIssue{
+			tickGroupType:     m.TickGroupType,
+			nextTickGroupType: m.NextTickGroupType,
+			underLimitPrice:   m.UnderLimitPrice,
+			upperLimitPrice:   m.UpperLimitPrice,
+		}
+	}
+
+	return &TickService{clock: newClock(), groups: groups, issues: issues, businessDay: tickDate(businessDay)}
+}
+
+// TickService - 呼値の計算
+// 呼値は適用日が計算する日以前で最も新しいものを使う 計算する日はOnDateで固定しなければ今日
+type TickService struct {
+	clock       iClock
+	groups      map[TickGroupType][]*TickGroupResponse // 呼値の単位番号ごとの呼値 適用日順
+	issues      map[string]map[Exchange]tickIssue      // 銘柄コードと市場ごとの呼値の単位番号
+	businessDay time.Time
+	date        time.Time // 計算する日 ゼロなら今日
+}
+
+// tickDate - 日付だけにする
+func tickDate(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// OnDate - dateの呼値で計算するTickServiceを返す 翌営業日の注文の値段を確認するときに使う
+func (s *TickService) OnDate(date time.Time) *TickService {
+	copied := *s
+	copied.date = tickDate(date)
+	return &copied
+}
+
+// calcDate - 計算する日
+func (s *TickService) calcDate() time.Time {
+	if !s.date.IsZero() {
+		return s.date
+	}
+	return tickDate(s.clock.Now())
+}
+
+// issue - 銘柄の呼値の単位番号 市場が未指定なら銘柄のいずれかの市場のもの
+func (s *TickService) issue(issueCode string, exchange Exchange) (tickIssue, error) {
+	exchanges, ok := s.issues[issueCode]
+	if ok && exchange == ExchangeUnspecified {
+		for _, e := range []Exchange{ExchangeToushou, ExchangeMeishou, ExchangeFukushou, ExchangeSatsushou} {
+			if issue, ok := exchanges[e]; ok {
+				return issue, nil
+			}
+		}
+		for _, issue := range exchanges {
+			return issue, nil
+		}
+	}
+	issue, ok := exchanges[exchange]
+	if !ok {
+		return tickIssue{}, fmt.Errorf("issue %s(%s) is not found: %w", issueCode, exchange, TickGroupNotFoundErr)
+	}
+	return issue, nil
+}
+
+// table - 銘柄に適用する呼値
+func (s *TickService) table(issueCode string, exchange Exchange) (*TickGroupResponse, error) {
+	issue, err := s.issue(issueCode, exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	date := s.calcDate()
+	tickGroupType := issue.tickGroupType
+	if !s.businessDay.IsZero() && date.After(s.businessDay) && issue.nextTickGroupType != TickGroupTypeUnspecified {
+		tickGroupType = issue.nextTickGroupType
+	}
+
+	var table *TickGroupResponse
+	for _, g := range s.groups[tickGroupType] {
+		if !tickDate(g.StartDate).After(date) {
+			table = g
+		}
+	}
+	if table == nil {
+		return nil, fmt.Errorf("tick group %s on %s is not found: %w", tickGroupType, date.Format("2006-01-02"), TickGroupNotFoundErr)
+	}
+	return table, nil
+}
+
+// tickBand - 値段の属する呼値グループ aboveなら値段より少し上の値段の呼値グループ
+func tickBand(table *TickGroupResponse, price float64, above bool) (TickGroup, error) {
+	for _, g := range table.TickGroups {
+		if g.BasePrice <= 0 || g.UnitPrice <= 0 {
+			break
+		}
+		if price < g.BasePrice || (!above && price == g.BasePrice) {
+			return g, nil
+		}
+	}
+	return TickGroup{}, fmt.Errorf("price %v is out of tick group %s: %w", price, table.TickGroupType, InvalidPriceErr)
+}
+
+// tickRound - 小数点桁数で丸める
+func tickRound(price float64, digits float64) float64 {
+	p := math.Pow(10, digits)
+	return math.Round(price*p) / p
+}
+
+// onTick - 値段が呼値の単位の倍数か
+func onTick(price float64, unit float64) bool {
+	n := price / unit
+	return math.Abs(n-math.Round(n)) < tickEpsilon
+}
+
+// TickSize - 値段の呼値の単位
+func (s *TickService) TickSize(issueCode string, exchange Exchange, price float64) (float64, error) {
+	table, err := s.table(issueCode, exchange)
+	if err != nil {
+		return 0, err
+	}
+	band, err := tickBand(table, price, false)
+	if err != nil {
+		return 0, err
+	}
+	return band.UnitPrice, nil
+}
+
+// RoundToTick - 値段を呼値の単位に丸める
+func (s *TickService) RoundToTick(issueCode string, exchange Exchange, price float64, round TickRound) (float64, error) {
+	table, err := s.table(issueCode, exchange)
+	if err != nil {
+		return 0, err
+	}
+	band, err := tickBand(table, price, false)
+	if err != nil {
+		return 0, err
+	}
+
+	n := price / band.UnitPrice
+	if math.Abs(n-math.Round(n)) < tickEpsilon {
+		return tickRound(math.Round(n)*band.UnitPrice, band.Digits), nil
+	}
+	switch round {
+	case TickRoundUp:
+		n = math.Ceil(n)
+	case TickRoundDown:
+		n = math.Floor(n)
+	default:
+		n = math.Floor(n + 0.5)
+	}
+	return tickRound(n*band.UnitPrice, band.Digits), nil
+}
+
+// NextTick - 1呼値上の値段 priceが呼値の単位に合っていなければ切り上げた値段
+func (s *TickService) NextTick(issueCode string, exchange Exchange, price float64) (float64, error) {
+	table, err := s.table(issueCode, exchange)
+	if err != nil {
+		return 0, err
+	}
+	if valid, _ := s.onTable(table, price); !valid {
+		return s.RoundToTick(issueCode, exchange, price, TickRoundUp)
+	}
+	band, err := tickBand(table, price, true)
+	if err != nil {
+		return 0, err
+	}
+	return tickRound(price+band.UnitPrice, band.Digits), nil
+}
+
+// PrevTick - 1呼値下の値段 priceが呼値の単位に合っていなければ切り捨てた値段
+func (s *TickService) PrevTick(issueCode string, exchange Exchange, price float64) (float64, error) {
+	table, err := s.table(issueCode, exchange)
+	if err != nil {
+		return 0, err
+	}
+	if valid, _ := s.onTable(table, price); !valid {
+		return s.RoundToTick(issueCode, exchange, price, TickRoundDown)
+	}
+	band, err := tickBand(table, price, false)
+	if err != nil {
+		return 0, err
+	}
+	prev := tickRound(price-band.UnitPrice, band.Digits)
+	if prev <= 0 {
+		return 0, fmt.Errorf("no tick below %v: %w", price, InvalidPriceErr)
+	}
+	return prev, nil
+}
+
+// TicksBetween - fromからtoまでの呼値の数 toがfromより小さければ負の数
+// fromとtoは呼値の単位に合っていなければならない
+func (s *TickService) TicksBetween(issueCode string, exchange Exchange, from float64, to float64) (int, error) {
+	table, err := s.table(issueCode, exchange)
+	if err != nil {
+		return 0, err
+	}
+	for _, price := range []float64{from, to} {
+		if valid, err := s.onTable(table, price); err != nil {
+			return 0, err
+		} else if !valid {
+			return 0, fmt.Errorf("price %v is not on tick: %w", price, InvalidPriceErr)
+		}
+	}
+	if to < from {
+		n, err := s.TicksBetween(issueCode, exchange, to, from)
+		return -n, err
+	}
+
+	var ticks int
+	for price := from; price < to; {
+		band, err := tickBand(table, price, true)
+		if err != nil {
+			return 0, err
+		}
+		end := math.Min(to, band.BasePrice)
+		ticks += int(math.Round((end - price) / band.UnitPrice))
+		price = end
+	}
+	return ticks, nil
+}
+
+// onTable - 値段が呼値の単位に合っているか
+func (s *TickService) onTable(table *TickGroupResponse, price float64) (bool, error) {
+	if price <= 0 {
+		return false, nil
+	}
+	band, err := tickBand(table, price, false)
+	if err != nil {
+		return false, err
+	}
+	return onTick(price, band.UnitPrice), nil
+}
+
+// IsValidPrice - 値段が呼値の単位に合っているか マスタを取得した営業日は値幅制限の範囲内かも確認する
+func (s *TickService) IsValidPrice(issueCode string, exchange Exchange, price float64) (bool, error) {
+	table, err := s.table(issueCode, exchange)
+	if err != nil {
+		return false, err
+	}
+	valid, err := s.onTable(table, price)
+	if err != nil || !valid {
+		return false, nil
+	}
+
+	if s.calcDate().Equal(s.businessDay) {
+		issue, _ := s.issue(issueCode, exchange)
+		if (issue.underLimitPrice > 0 && price < issue.underLimitPrice) || (issue.upperLimitPrice > 0 && price > issue.upperLimitPrice) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// PaperTickSize - PaperClientConfig.TickSizeに渡す呼値の単位 呼値がわからなければ0
+func (s *TickService) PaperTickSize(issueCode string, exchange Exchange, price float64) float64 {
+	size, _ := s.TickSize(issueCode, exchange, price)
+	return size
+}
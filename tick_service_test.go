@@ -0,0 +1,222 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testTickGroups - 株式1(2014/01/01から)とTOPIX100の株式3(2014/01/01からと2022/07/28から)の呼値
+func testTickGroups() []*TickGroupResponse {
+	return []*TickGroupResponse{
+		{TickGroupType: TickGroupTypeStock1, StartDate: time.Date(2014, 1, 1, 0, 0, 0, 0, time.Local), TickGroups: [20]TickGroup{
+			{Number: 1, BasePrice: 3000, UnitPrice: 1},
+			{Number: 2, BasePrice: 5000, UnitPrice: 5},
+			{Number: 3, BasePrice: 30000, UnitPrice: 10},
+			{Number: 4, BasePrice: 999999999, UnitPrice: 100},
+		}},
+		{TickGroupType: TickGroupTypeStock3, StartDate: time.Date(2022, 7, 28, 0, 0, 0, 0, time.Local), TickGroups: [20]TickGroup{
+			{Number: 1, BasePrice: 1000, UnitPrice: 0.5, Digits: 1},
+			{Number: 2, BasePrice: 999999999, UnitPrice: 5},
+		}},
+		{TickGroupType: TickGroupTypeStock3, StartDate: time.Date(2014, 1, 1, 0, 0, 0, 0, time.Local), TickGroups: [20]TickGroup{
+			{Number: 1, BasePrice: 1000, UnitPrice: 0.1, Digits: 1},
+			{Number: 2, BasePrice: 3000, UnitPrice: 0.5, Digits: 1},
+			{Number: 3, BasePrice: 10000, UnitPrice: 1},
+			{Number: 4, BasePrice: 999999999, UnitPrice: 5},
+		}},
+	}
+}
+
+// newTestTickService - 1475は株式3、1476は株式1で翌営業日から株式3、営業日は2022/07/26
+func newTestTickService(now time.Time) *TickService {
+	masters := []StockExchangeMaster{
+		{IssueCode: "1475", Exchange: ExchangeToushou, TickGroupType: TickGroupTypeStock3, NextTickGroupType: TickGroupTypeStock3, UnderLimitPrice: 500, UpperLimitPrice: 2000},
+		{IssueCode: "1476", Exchange: ExchangeToushou, TickGroupType: TickGroupTypeStock1, NextTickGroupType: TickGroupTypeStock3},
+	}
+	s := NewTickService(testTickGroups(), masters, time.Date(2022, 7, 26, 0, 0, 0, 0, time.Local))
+	s.clock = &testClock{Now1: now}
+	return s
+}
+
+func Test_TickService_TickSize(t *testing.T) {
+	t.Parallel()
+	today := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		name      string
+		now       time.Time
+		issueCode string
+		exchange  Exchange
+		price     float64
+		want      float64
+		wantErr   error
+	}{
+		{name: "基準値段以下ならその呼値グループ", now: today, issueCode: "1475", exchange: ExchangeToushou, price: 1000, want: 0.1},
+		{name: "基準値段を超えたら次の呼値グループ", now: today, issueCode: "1475", exchange: ExchangeToushou, price: 1000.5, want: 0.5},
+		{name: "市場が未指定なら東証", now: today, issueCode: "1475", price: 3500, want: 1},
+		{name: "株式1", now: today, issueCode: "1476", exchange: ExchangeToushou, price: 3500, want: 5},
+		{name: "翌営業日は翌営業日の呼値の単位番号", now: today.AddDate(0, 0, 1), issueCode: "1476", exchange: ExchangeToushou, price: 3500, want: 1},
+		{name: "適用日になったら新しい呼値", now: today.AddDate(0, 0, 2), issueCode: "1475", exchange: ExchangeToushou, price: 3500, want: 5},
+		{name: "銘柄がなければエラー", now: today, issueCode: "9999", exchange: ExchangeToushou, price: 1000, wantErr: TickGroupNotFoundErr},
+		{name: "市場がなければエラー", now: today, issueCode: "1475", exchange: ExchangeMeishou, price: 1000, wantErr: TickGroupNotFoundErr},
+		{name: "呼値グループの範囲外ならエラー", now: today, issueCode: "1475", exchange: ExchangeToushou, price: 1_000_000_000, wantErr: InvalidPriceErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newTestTickService(test.now).TickSize(test.issueCode, test.exchange, test.price)
+			if test.want != got || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErr, got, err)
+			}
+		})
+	}
+}
+
+func Test_TickService_RoundToTick(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		price float64
+		round TickRound
+		want  float64
+	}{
+		{name: "呼値に合っていればそのまま", price: 2000.5, round: TickRoundUp, want: 2000.5},
+		{name: "未指定なら近いほう", price: 2000.2, round: TickRoundUnspecified, want: 2000},
+		{name: "真ん中なら上", price: 2000.25, round: TickRoundNearest, want: 2000.5},
+		{name: "切り上げ", price: 2000.1, round: TickRoundUp, want: 2000.5},
+		{name: "切り捨て", price: 2000.4, round: TickRoundDown, want: 2000},
+		{name: "小数点桁数で丸める", price: 123.45, round: TickRoundDown, want: 123.4},
+		{name: "基準値段をまたいで切り上げ", price: 3000.2, round: TickRoundUp, want: 3001},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newTestTickService(time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)).RoundToTick("1475", ExchangeToushou, test.price, test.round)
+			if test.want != got || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, nil, got, err)
+			}
+		})
+	}
+}
+
+func Test_TickService_NextTick_PrevTick(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		price    float64
+		wantNext float64
+		wantPrev float64
+	}{
+		{name: "呼値グループの中", price: 500, wantNext: 500.1, wantPrev: 499.9},
+		{name: "基準値段の上は次の呼値グループの単位", price: 1000, wantNext: 1000.5, wantPrev: 999.9},
+		{name: "基準値段の次の値段の下は基準値段", price: 1000.5, wantNext: 1001, wantPrev: 1000},
+		{name: "呼値に合っていなければ丸める", price: 2000.3, wantNext: 2000.5, wantPrev: 2000},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			s := newTestTickService(time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local))
+			next, err1 := s.NextTick("1475", ExchangeToushou, test.price)
+			prev, err2 := s.PrevTick("1475", ExchangeToushou, test.price)
+			if test.wantNext != next || test.wantPrev != prev || err1 != nil || err2 != nil {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v, %+v, %+v\n", t.Name(), test.wantNext, test.wantPrev, next, prev, err1, err2)
+			}
+		})
+	}
+}
+
+func Test_TickService_PrevTick_min(t *testing.T) {
+	t.Parallel()
+	_, err := newTestTickService(time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)).PrevTick("1476", ExchangeToushou, 1)
+	if !errors.Is(err, InvalidPriceErr) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), InvalidPriceErr, err)
+	}
+}
+
+func Test_TickService_TicksBetween(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		from    float64
+		to      float64
+		want    int
+		wantErr error
+	}{
+		{name: "同じ値段なら0", from: 1000, to: 1000, want: 0},
+		{name: "呼値グループの中", from: 999, to: 1000, want: 10},
+		{name: "呼値グループをまたぐ", from: 999.9, to: 1001, want: 3},
+		{name: "下がるなら負の数", from: 3001, to: 2999.5, want: -2},
+		{name: "呼値に合っていなければエラー", from: 1000, to: 1000.3, wantErr: InvalidPriceErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newTestTickService(time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)).TicksBetween("1475", ExchangeToushou, test.from, test.to)
+			if test.want != got || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, test.wantErr, got, err)
+			}
+		})
+	}
+}
+
+func Test_TickService_IsValidPrice(t *testing.T) {
+	t.Parallel()
+	today := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		name  string
+		now   time.Time
+		price float64
+		want  bool
+	}{
+		{name: "呼値に合っていればtrue", now: today, price: 1000.5, want: true},
+		{name: "呼値に合っていなければfalse", now: today, price: 1000.3, want: false},
+		{name: "0はfalse", now: today, price: 0, want: false},
+		{name: "当日は値幅制限を超えたらfalse", now: today, price: 2001, want: false},
+		{name: "翌営業日は値幅制限を確認しない", now: today.AddDate(0, 0, 1), price: 2001, want: true},
+		{name: "呼値グループの範囲外ならfalse", now: today, price: 1_000_000_000, want: false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newTestTickService(test.now).IsValidPrice("1475", ExchangeToushou, test.price)
+			if test.want != got || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, nil, got, err)
+			}
+		})
+	}
+}
+
+// Test_TickService_OnDate - 日付を固定して翌営業日の呼値で計算する
+func Test_TickService_OnDate(t *testing.T) {
+	t.Parallel()
+	s := newTestTickService(time.Date(2022, 7, 26, 16, 0, 0, 0, time.Local))
+	next := s.OnDate(time.Date(2022, 7, 27, 0, 0, 0, 0, time.Local))
+	got1, _ := s.TickSize("1476", ExchangeToushou, 3500)
+	got2, _ := next.TickSize("1476", ExchangeToushou, 3500)
+	if !reflect.DeepEqual([]float64{5, 1}, []float64{got1, got2}) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), []float64{5, 1}, []float64{got1, got2})
+	}
+}
+
+// Test_TickService_PaperTickSize - 模擬売買で呼値に合わない注文を受け付けない
+func Test_TickService_PaperTickSize(t *testing.T) {
+	t.Parallel()
+	s := newTestTickService(time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local))
+	p := newTestPaperClient(&testClient{}, PaperClientConfig{StockWallet: 1_000_000, TickSize: s.PaperTickSize})
+	_, err := p.NewOrder(context.Background(), &Session{}, NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, TradeType: TradeTypeStock, OrderQuantity: 100, OrderPrice: 1000.3})
+	if !errors.Is(err, PaperOrderRejectedErr) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), PaperOrderRejectedErr, err)
+	}
+}
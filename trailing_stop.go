@@ -0,0 +1,329 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTrailingStopMinInterval = 3 * time.Second // 同じ逆指値注文を訂正する間隔の下限
+
+// TrailingStop - 高値(売りの逆指値)、安値(買いの逆指値)に追従させる逆指値注文
+// TrailTicksとTrailPercentのどちらか一方を指定する
+type TrailingStop struct {
+	OrderNumber     string    // 逆指値注文の注文番号
+	ExecutionDate   time.Time // 逆指値注文の営業日
+	IssueCode       string    // 銘柄コード
+	Exchange        Exchange  // 市場
+	Side            Side      // 逆指値注文の売買区分 買い建玉や現物の返済なら売り、売り建玉の返済なら買い
+	TriggerPrice    float64   // 出している逆指値条件 訂正が受け付けられたら更新する
+	TrailTicks      int       // 高値、安値から何呼値離すか
+	TrailPercent    float64   // 高値、安値から何%離すか
+	HighWaterMark   float64   // 売りの逆指値なら高値、買いの逆指値なら安値 0なら最初の現在値から
+	LastCorrectedAt time.Time // 最後に訂正した日時
+}
+
+// TrailingStopConfig - トレーリングストップの設定
+type TrailingStopConfig struct {
+	MinInterval    time.Duration // 同じ逆指値注文を訂正する間隔の下限 0なら3秒
+	SecondPassword string        // 訂正注文に使う第二パスワード
+}
+
+// NewTrailingStopEngine - トレーリングストップを生成する
+func NewTrailingStopEngine(client Client, session *Session, ticks *TickService, config TrailingStopConfig) *TrailingStopEngine {
+	if config.MinInterval <= 0 {
+		config.MinInterval = defaultTrailingStopMinInterval
+	}
+	return &TrailingStopEngine{
+		clock:   newClock(),
+		client:  client,
+		session: session,
+		ticks:   ticks,
+		config:  config,
+		stops:   map[string]*TrailingStop{},
+	}
+}
+
+// TrailingStopEngine - 保有している建玉の逆指値注文を、時価情報の現在値に合わせて訂正注文で動かすトレーリングストップ
+// 逆指値条件は有利な方向にしか動かさない 訂正の間隔はMinIntervalより短くしない
+// ストリームが切れているあいだは動かさず、最後に受け付けられた逆指値注文がそのまま残る
+type TrailingStopEngine struct {
+	clock      iClock
+	client     Client
+	session    *Session
+	ticks      *TickService
+	config     TrailingStopConfig
+	stops      map[string]*TrailingStop
+	suspended  bool
+	connecting bool // 接続を始めたが、まだ時価情報を受け取っていない
+	mtx        sync.Mutex
+}
+
+// Add - 逆指値注文をトレーリングストップにする
+func (e *TrailingStopEngine) Add(stop TrailingStop) error {
+	if stop.OrderNumber == "" || stop.IssueCode == "" {
+		return fmt.Errorf("order number and issue code are required: %w", TrailingStopErr)
+	}
+	if stop.Side != SideBuy && stop.Side != SideSell {
+		return fmt.Errorf("side must be buy or sell: %w", TrailingStopErr)
+	}
+	if (stop.TrailTicks > 0) == (stop.TrailPercent > 0) {
+		return fmt.Errorf("either trail ticks or trail percent is required: %w", TrailingStopErr)
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.stops[stop.OrderNumber] = &stop
+	return nil
+}
+
+// Remove - トレーリングストップをやめる 逆指値注文はそのまま残る
+func (e *TrailingStopEngine) Remove(orderNumber string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	delete(e.stops, orderNumber)
+}
+
+// Stops - トレーリングストップにしている逆指値注文 注文番号順
+func (e *TrailingStopEngine) Stops() []TrailingStop {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	stops := make([]TrailingStop, 0, len(e.stops))
+	for _, s := range e.stops {
+		stops = append(stops, *s)
+	}
+	sort.Slice(stops, func(i, j int) bool { return stops[i].OrderNumber < stops[j].OrderNumber })
+	return stops
+}
+
+// Suspended - ストリームが切れていて逆指値注文を動かしていないか
+func (e *TrailingStopEngine) Suspended() bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.suspended
+}
+
+// Watch - ストリームの状態通知を見て、切れているあいだは逆指値注文を動かさない ctxが終了するかstatusesが閉じられたら戻る
+// 接続を始めただけではつながったかわからないので、そのあと最初に時価情報を受け取ったときに再開する
+func (e *TrailingStopEngine) Watch(ctx context.Context, statuses <-chan StreamStatus) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s, ok := <-statuses:
+			if !ok {
+				e.setSuspended(true)
+				return
+			}
+			switch s.Type {
+			case StreamStatusTypeConnecting:
+				e.setConnecting()
+			case StreamStatusTypeDisconnected, StreamStatusTypeReconnecting, StreamStatusTypeResubscribing, StreamStatusTypeClosed:
+				e.setSuspended(true)
+			}
+		}
+	}
+}
+
+func (e *TrailingStopEngine) setSuspended(suspended bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.suspended, e.connecting = suspended, false
+}
+
+// setConnecting - 止めているなら、次に時価情報を受け取るまで止めたままにする
+func (e *TrailingStopEngine) setConnecting() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.connecting = e.suspended
+}
+
+// Apply - 時価情報の現在値で高値、安値を更新し、逆指値条件を有利な方向に動かせれば訂正注文を送る
+// 時価情報には銘柄コードがないので、行番号から引いた銘柄コードを渡す
+// 訂正が失敗したり受け付けられなかったりしたら、逆指値条件は最後に受け付けられた値段のまま
+// 1つの訂正が失敗しても残りの逆指値注文は動かし、エラーはまとめて返す
+// 訂正が受け付けられず、注文詳細で逆指値注文が終わっていたら、もう動かせないのでトレーリングストップをやめる
+// 訂正注文と注文詳細はロックを外して送るので、通信しているあいだもWatchやSuspendedは待たない
+func (e *TrailingStopEngine) Apply(ctx context.Context, issueCode string, res *MarketPriceStreamResponse) error {
+	if res == nil || res.CurrentPrice <= 0 {
+		return nil
+	}
+
+	e.mtx.Lock()
+	if e.suspended {
+		if !e.connecting {
+			e.mtx.Unlock()
+			return nil
+		}
+		e.suspended, e.connecting = false, false
+	}
+
+	orderNumbers := make([]string, 0, len(e.stops))
+	for orderNumber, s := range e.stops {
+		if s.IssueCode == issueCode {
+			orderNumbers = append(orderNumbers, orderNumber)
+		}
+	}
+	e.mtx.Unlock()
+	sort.Strings(orderNumbers)
+
+	errs := make([]error, 0, len(orderNumbers))
+	for _, orderNumber := range orderNumbers {
+		if err := e.trail(ctx, orderNumber, res.CurrentPrice); err != nil {
+			errs = append(errs, fmt.Errorf("order %s: %w", orderNumber, err))
+		}
+	}
+	return joinErrors(errs...)
+}
+
+// trail - 1つの逆指値注文を動かす 途中で止まったりやめたりしていたら何もしない
+func (e *TrailingStopEngine) trail(ctx context.Context, orderNumber string, price float64) error {
+	e.mtx.Lock()
+	s, ok := e.stops[orderNumber]
+	if !ok || e.suspended {
+		e.mtx.Unlock()
+		return nil
+	}
+	if s.HighWaterMark <= 0 || (s.Side == SideSell && price > s.HighWaterMark) || (s.Side == SideBuy && price < s.HighWaterMark) {
+		s.HighWaterMark = price
+	}
+
+	trigger, err := e.triggerPrice(s)
+	if err != nil {
+		e.mtx.Unlock()
+		return err
+	}
+	if !s.improves(trigger) {
+		e.mtx.Unlock()
+		return nil
+	}
+	if now := e.clock.Now(); !s.LastCorrectedAt.IsZero() && now.Sub(s.LastCorrectedAt) < e.config.MinInterval {
+		e.mtx.Unlock()
+		return nil
+	}
+
+	// 訂正の間隔は送る前に記録するので、返事を待っているあいだに同じ逆指値注文を訂正しない
+	s.LastCorrectedAt = e.clock.Now()
+	req := CorrectOrderRequest{
+		OrderNumber:        s.OrderNumber,
+		ExecutionDate:      s.ExecutionDate,
+		ExecutionTiming:    ExecutionTimingNoChange,
+		OrderPrice:         NoChangeFloat,
+		OrderQuantity:      NoChangeFloat,
+		ExpireDateNoChange: true,
+		TriggerPrice:       trigger,
+		StopOrderPrice:     NoChangeFloat,
+		SecondPassword:     e.config.SecondPassword,
+	}
+	e.mtx.Unlock()
+
+	res, err := e.client.CorrectOrder(ctx, e.session, req)
+	if err != nil {
+		return err
+	}
+	if res.ResultCode != "0" {
+		rejected := fmt.Errorf("%s(%s): %w", res.ResultText, res.ResultCode, OrderRejectedErr)
+		detail, err := e.client.OrderDetail(ctx, e.session, OrderDetailRequest{OrderNumber: req.OrderNumber, ExecutionDate: req.ExecutionDate})
+		if err != nil {
+			return joinErrors(rejected, err)
+		}
+		if detail != nil && snapshotOrderState(detail.OrderStatus, detail.ContractQuantity).Done() {
+			e.mtx.Lock()
+			if e.stops[orderNumber] == s {
+				delete(e.stops, orderNumber)
+			}
+			e.mtx.Unlock()
+			return fmt.Errorf("removed because the order is no longer correctable: %w", rejected)
+		}
+		return rejected
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if s.improves(trigger) {
+		s.TriggerPrice = trigger
+	}
+	return nil
+}
+
+// improves - 逆指値条件を有利な方向に動かせるか 売りなら上げ、買いなら下げる
+func (s *TrailingStop) improves(trigger float64) bool {
+	return s.TriggerPrice <= 0 || (s.Side == SideSell && trigger > s.TriggerPrice) || (s.Side == SideBuy && trigger < s.TriggerPrice)
+}
+
+// triggerPrice - 高値、安値から離した逆指値条件 呼値の単位に合わせ、売りなら切り捨て、買いなら切り上げる
+func (e *TrailingStopEngine) triggerPrice(s *TrailingStop) (float64, error) {
+	if s.TrailPercent > 0 {
+		if s.Side == SideSell {
+			return e.ticks.RoundToTick(s.IssueCode, s.Exchange, s.HighWaterMark*(1-s.TrailPercent/100), TickRoundDown)
+		}
+		return e.ticks.RoundToTick(s.IssueCode, s.Exchange, s.HighWaterMark*(1+s.TrailPercent/100), TickRoundUp)
+	}
+
+	price := s.HighWaterMark
+	for i := 0; i < s.TrailTicks; i++ {
+		var err error
+		if s.Side == SideSell {
+			price, err = e.ticks.PrevTick(s.IssueCode, s.Exchange, price)
+		} else {
+			price, err = e.ticks.NextTick(s.IssueCode, s.Exchange, price)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return price, nil
+}
+
+// joinErrors - nilを除いた複数のエラーを1つにまとめる すべてnilならnil、1つだけならそのまま返す
+func joinErrors(errs ...error) error {
+	joined := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			joined = append(joined, err)
+		}
+	}
+	switch len(joined) {
+	case 0:
+		return nil
+	case 1:
+		return joined[0]
+	}
+	return &joinedError{errs: joined}
+}
+
+// joinedError - まとめたエラー errors.Is、errors.Asはまとめたエラーのどれかに一致すればよい
+type joinedError struct {
+	errs []error
+}
+
+func (e *joinedError) Error() string {
+	messages := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *joinedError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *joinedError) As(target interface{}) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,286 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestTrailingStopEngine - テスト用のトレーリングストップ 営業日は2022/07/26
+func newTestTrailingStopEngine(client Client, clock *testClock) *TrailingStopEngine {
+	e := NewTrailingStopEngine(client, &Session{}, newTestTickService(time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)), TrailingStopConfig{})
+	e.clock = clock
+	return e
+}
+
+func Test_TrailingStopEngine_Add(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  TrailingStop
+		want error
+	}{
+		{name: "呼値で指定できる", arg: TrailingStop{OrderNumber: "1", IssueCode: "1476", Side: SideSell, TrailTicks: 5}, want: nil},
+		{name: "%で指定できる", arg: TrailingStop{OrderNumber: "1", IssueCode: "1476", Side: SideBuy, TrailPercent: 1}, want: nil},
+		{name: "注文番号がなければエラー", arg: TrailingStop{IssueCode: "1476", Side: SideSell, TrailTicks: 5}, want: TrailingStopErr},
+		{name: "売買区分がなければエラー", arg: TrailingStop{OrderNumber: "1", IssueCode: "1476", TrailTicks: 5}, want: TrailingStopErr},
+		{name: "呼値と%の両方を指定したらエラー", arg: TrailingStop{OrderNumber: "1", IssueCode: "1476", Side: SideSell, TrailTicks: 5, TrailPercent: 1}, want: TrailingStopErr},
+		{name: "呼値も%も指定しなければエラー", arg: TrailingStop{OrderNumber: "1", IssueCode: "1476", Side: SideSell}, want: TrailingStopErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := newTestTrailingStopEngine(&testClient{}, &testClock{}).Add(test.arg)
+			if !errors.Is(got, test.want) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_TrailingStopEngine_triggerPrice(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  TrailingStop
+		want float64
+	}{
+		{name: "売りを呼値で指定したら高値から呼値の数だけ下", arg: TrailingStop{IssueCode: "1476", Exchange: ExchangeToushou, Side: SideSell, TrailTicks: 3, HighWaterMark: 2000}, want: 1997},
+		{name: "買いを呼値で指定したら安値から呼値の数だけ上", arg: TrailingStop{IssueCode: "1476", Exchange: ExchangeToushou, Side: SideBuy, TrailTicks: 3, HighWaterMark: 2000}, want: 2003},
+		{name: "呼値の単位が変わる値段をまたげる", arg: TrailingStop{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideSell, TrailTicks: 2, HighWaterMark: 1000.5}, want: 999.9},
+		{name: "売りを%で指定したら切り捨てる", arg: TrailingStop{IssueCode: "1476", Exchange: ExchangeToushou, Side: SideSell, TrailPercent: 1.5, HighWaterMark: 2001}, want: 1970},
+		{name: "買いを%で指定したら切り上げる", arg: TrailingStop{IssueCode: "1476", Exchange: ExchangeToushou, Side: SideBuy, TrailPercent: 1.5, HighWaterMark: 2001}, want: 2032},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newTestTrailingStopEngine(&testClient{}, &testClock{}).triggerPrice(&test.arg)
+			if test.want != got || err != nil {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.want, nil, got, err)
+			}
+		})
+	}
+}
+
+// Test_TrailingStopEngine_Apply - 高値が上がったら逆指値条件を上げ、訂正の間隔を空け、下がっても戻さない
+func Test_TrailingStopEngine_Apply(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)
+	client := &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "0"}}
+	clock := &testClock{Now1: start}
+	e := newTestTrailingStopEngine(client, clock)
+	if err := e.Add(TrailingStop{OrderNumber: "1", IssueCode: "1476", Exchange: ExchangeToushou, Side: SideSell, TriggerPrice: 1990, TrailTicks: 10}); err != nil {
+		t.Fatalf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), nil, err)
+	}
+
+	steps := []struct {
+		issueCode    string
+		price        float64
+		now          time.Time
+		wantTrigger  float64
+		wantHigh     float64
+		wantCorrects int
+	}{
+		{issueCode: "1476", price: 2000, now: start, wantTrigger: 1990, wantHigh: 2000, wantCorrects: 0},
+		{issueCode: "1476", price: 2005, now: start, wantTrigger: 1995, wantHigh: 2005, wantCorrects: 1},
+		{issueCode: "1476", price: 2010, now: start.Add(time.Second), wantTrigger: 1995, wantHigh: 2010, wantCorrects: 1},
+		{issueCode: "1475", price: 2100, now: start.Add(3 * time.Second), wantTrigger: 1995, wantHigh: 2010, wantCorrects: 1},
+		{issueCode: "1476", price: 2008, now: start.Add(3 * time.Second), wantTrigger: 2000, wantHigh: 2010, wantCorrects: 2},
+		{issueCode: "1476", price: 1990, now: start.Add(10 * time.Second), wantTrigger: 2000, wantHigh: 2010, wantCorrects: 2},
+	}
+
+	for i, step := range steps {
+		clock.Now1 = step.now
+		if err := e.Apply(context.Background(), step.issueCode, &MarketPriceStreamResponse{CurrentPrice: step.price}); err != nil {
+			t.Fatalf("%s error step %d\nwant: %+v\ngot: %+v\n", t.Name(), i, nil, err)
+		}
+		got := e.Stops()[0]
+		if step.wantTrigger != got.TriggerPrice || step.wantHigh != got.HighWaterMark || step.wantCorrects != client.correctCount {
+			t.Errorf("%s error step %d\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), i,
+				step.wantTrigger, step.wantHigh, step.wantCorrects, got.TriggerPrice, got.HighWaterMark, client.correctCount)
+		}
+	}
+}
+
+func Test_TrailingStopEngine_Apply_fallback(t *testing.T) {
+	t.Parallel()
+	correctErr := errors.New("correct error")
+	tests := []struct {
+		name         string
+		client       *testClient
+		suspended    bool
+		wantTrigger  float64
+		wantCorrects int
+		wantErr      error
+	}{
+		{name: "ストリームが切れているあいだは動かさない", client: &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "0"}}, suspended: true,
+			wantTrigger: 1990},
+		{name: "訂正が受け付けられなければ最後に受け付けられた逆指値条件のまま", client: &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "11111"}},
+			wantTrigger: 1990, wantCorrects: 1, wantErr: OrderRejectedErr},
+		{name: "訂正のエラーはそのまま返し、逆指値条件は変えない", client: &testClient{correctOrder2: correctErr},
+			wantTrigger: 1990, wantCorrects: 1, wantErr: correctErr},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			e := newTestTrailingStopEngine(test.client, &testClock{Now1: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)})
+			_ = e.Add(TrailingStop{OrderNumber: "1", IssueCode: "1476", Exchange: ExchangeToushou, Side: SideSell, TriggerPrice: 1990, TrailTicks: 10})
+			e.setSuspended(test.suspended)
+
+			err := e.Apply(context.Background(), "1476", &MarketPriceStreamResponse{CurrentPrice: 2050})
+			got := e.Stops()[0].TriggerPrice
+			if test.wantTrigger != got || test.wantCorrects != test.client.correctCount || !errors.Is(err, test.wantErr) {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.wantTrigger, test.wantCorrects, test.wantErr, got, test.client.correctCount, err)
+			}
+		})
+	}
+}
+
+// Test_TrailingStopEngine_Apply_errors - 訂正が失敗しても残りの逆指値注文を動かし、もう動かせない逆指値注文はやめる
+func Test_TrailingStopEngine_Apply_errors(t *testing.T) {
+	t.Parallel()
+	correctErr := errors.New("correct error")
+	detailErr := errors.New("detail error")
+	tests := []struct {
+		name         string
+		client       *testClient
+		wantStops    []string
+		wantCorrects int
+		wantErrs     []error
+	}{
+		{name: "訂正のエラーがあっても残りを訂正し、エラーをまとめて返す", client: &testClient{correctOrder2: correctErr},
+			wantStops: []string{"1", "2"}, wantCorrects: 2, wantErrs: []error{correctErr}},
+		{name: "受け付けられず、注文が終わっていたらやめる",
+			client:    &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "11111"}, orderDetail1: &OrderDetailResponse{OrderQuantity: 100, ContractQuantity: 100, OrderStatus: OrderStatusDone}},
+			wantStops: []string{}, wantCorrects: 2, wantErrs: []error{OrderRejectedErr}},
+		{name: "受け付けられず、注文が終わっていなければ続ける",
+			client:    &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "11111"}, orderDetail1: &OrderDetailResponse{OrderQuantity: 100, OrderStatus: OrderStatusInOrder}},
+			wantStops: []string{"1", "2"}, wantCorrects: 2, wantErrs: []error{OrderRejectedErr}},
+		{name: "注文詳細のエラーもまとめて返す",
+			client:    &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "11111"}, orderDetail2: detailErr},
+			wantStops: []string{"1", "2"}, wantCorrects: 2, wantErrs: []error{OrderRejectedErr, detailErr}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			e := newTestTrailingStopEngine(test.client, &testClock{Now1: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)})
+			_ = e.Add(TrailingStop{OrderNumber: "1", IssueCode: "1476", Exchange: ExchangeToushou, Side: SideSell, TriggerPrice: 1990, TrailTicks: 10})
+			_ = e.Add(TrailingStop{OrderNumber: "2", IssueCode: "1476", Exchange: ExchangeToushou, Side: SideSell, TriggerPrice: 1980, TrailTicks: 10})
+
+			err := e.Apply(context.Background(), "1476", &MarketPriceStreamResponse{CurrentPrice: 2050})
+			got := []string{}
+			for _, s := range e.Stops() {
+				got = append(got, s.OrderNumber)
+			}
+			if !reflect.DeepEqual(test.wantStops, got) || test.wantCorrects != test.client.correctCount {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.wantStops, test.wantCorrects, got, test.client.correctCount)
+			}
+			for _, want := range test.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, err)
+				}
+			}
+		})
+	}
+}
+
+// blockingCorrectOrderClient - 訂正注文を送ったことを知らせ、releaseが閉じられるまで返さないクライアント
+type blockingCorrectOrderClient struct {
+	*testClient
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCorrectOrderClient) CorrectOrder(ctx context.Context, session *Session, req CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	close(c.entered)
+	<-c.release
+	return c.testClient.CorrectOrder(ctx, session, req)
+}
+
+// Test_TrailingStopEngine_Apply_unlocked - 訂正注文の返事を待っているあいだも、止めたり状態を見たりできる
+func Test_TrailingStopEngine_Apply_unlocked(t *testing.T) {
+	t.Parallel()
+	client := &blockingCorrectOrderClient{testClient: &testClient{correctOrder1: &CorrectOrderResponse{ResultCode: "0"}},
+		entered: make(chan struct{}), release: make(chan struct{})}
+	e := newTestTrailingStopEngine(client, &testClock{Now1: time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)})
+	_ = e.Add(TrailingStop{OrderNumber: "1", IssueCode: "1476", Exchange: ExchangeToushou, Side: SideSell, TriggerPrice: 1990, TrailTicks: 10})
+
+	applied := make(chan error, 1)
+	go func() {
+		applied <- e.Apply(context.Background(), "1476", &MarketPriceStreamResponse{CurrentPrice: 2050})
+	}()
+	<-client.entered
+
+	suspended := make(chan bool, 1)
+	go func() {
+		e.setSuspended(true)
+		suspended <- e.Suspended()
+	}()
+	select {
+	case got := <-suspended:
+		if !got {
+			t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), true, got)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("%s error\nSuspended is blocked while correcting", t.Name())
+	}
+	close(client.release)
+
+	// 送った訂正が受け付けられたら、止めたあとでも逆指値条件は受け付けられた値段にする
+	err := <-applied
+	if got := e.Stops()[0].TriggerPrice; got != 2040 || err != nil {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), 2040, nil, got, err)
+	}
+}
+
+func Test_TrailingStopEngine_Watch(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		statuses []StreamStatus
+		apply    bool
+		want     bool
+	}{
+		{name: "切断されたら止める", statuses: []StreamStatus{{Type: StreamStatusTypeDisconnected}}, want: true},
+		{name: "再接続待ちなら止める", statuses: []StreamStatus{{Type: StreamStatusTypeReconnecting}}, want: true},
+		{name: "接続を始めただけでは再開しない", statuses: []StreamStatus{{Type: StreamStatusTypeDisconnected}, {Type: StreamStatusTypeConnecting, Attempt: 1}}, want: true},
+		{name: "接続を始めたあと時価情報を受け取ったら再開する", statuses: []StreamStatus{{Type: StreamStatusTypeDisconnected}, {Type: StreamStatusTypeConnecting, Attempt: 1}},
+			apply: true, want: false},
+		{name: "接続を始めたあと切断されたら、時価情報を受け取っても再開しない",
+			statuses: []StreamStatus{{Type: StreamStatusTypeDisconnected}, {Type: StreamStatusTypeConnecting, Attempt: 1}, {Type: StreamStatusTypeDisconnected, Attempt: 1}},
+			apply:    true, want: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			e := newTestTrailingStopEngine(&testClient{}, &testClock{})
+			statuses := make(chan StreamStatus, len(test.statuses))
+			for _, s := range test.statuses {
+				statuses <- s
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			e.Watch(ctx, statuses)
+			if test.apply {
+				_ = e.Apply(context.Background(), "1476", &MarketPriceStreamResponse{CurrentPrice: 2000})
+			}
+
+			got := e.Suspended()
+			if test.want != got {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package tachibana
+
+import "context"
+
+// Transport - APIとの通信 WithTransportで差し替えると、記録や再生、障害の注入ができる
+// requestはAPIに送るリクエストで、イベントストリームならStreamRequest、それ以外はJSONに変換して送る構造体
+// レスポンスはShift-JISからUTF-8に変換したものを返す
+type Transport interface {
+	Get(ctx context.Context, uri string, request interface{}) ([]byte, error)                  // リクエストを送ってレスポンスを受け取る
+	Stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) // リクエストを送って、chunkedレスポンスを1行ずつ受け取る
+}
+
+// WithTransport - APIとの通信に使うTransportを指定する
+func WithTransport(transport Transport) ClientOption {
+	return func(c *client) {
+		c.requester = &transportRequester{transport: transport}
+	}
+}
+
+// NewTransport - サーバと通信する標準のTransportを生成する
+// 記録や障害の注入で、実際の通信を包むときに使う
+func NewTransport() Transport {
+	return &requesterTransport{requester: &requester{}}
+}
+
+// requesterTransport - requesterをTransportとして公開する
+type requesterTransport struct {
+	requester iRequester
+}
+
+func (t *requesterTransport) Get(ctx context.Context, uri string, request interface{}) ([]byte, error) {
+	return t.requester.get(ctx, uri, request)
+}
+
+func (t *requesterTransport) Stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) {
+	return t.requester.stream(ctx, uri, request)
+}
+
+// transportRequester - Transportをrequesterとして使う
+type transportRequester struct {
+	transport Transport
+}
+
+func (r *transportRequester) get(ctx context.Context, uri string, request interface{}) ([]byte, error) {
+	return r.transport.Get(ctx, uri, request)
+}
+
+func (r *transportRequester) stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) {
+	return r.transport.Stream(ctx, uri, request)
+}
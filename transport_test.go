@@ -0,0 +1,92 @@
+package tachibana
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testTransport struct {
+	get1          []byte
+	get2          error
+	stream1       [][]byte
+	stream2       error
+	getHistory    []interface{}
+	streamHistory []interface{}
+	mtx           sync.Mutex
+}
+
+func (t *testTransport) Get(_ context.Context, uri string, request interface{}) ([]byte, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.getHistory = append(t.getHistory, uri, request)
+	return t.get1, t.get2
+}
+
+func (t *testTransport) Stream(ctx context.Context, uri string, request interface{}) (<-chan []byte, <-chan error) {
+	t.mtx.Lock()
+	t.streamHistory = append(t.streamHistory, uri, request)
+	t.mtx.Unlock()
+
+	ch := make(chan []byte)
+	errCh := make(chan error)
+	go func() {
+		defer close(ch)
+		defer close(errCh)
+		for _, b := range t.stream1 {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- b:
+			}
+		}
+		if t.stream2 != nil {
+			select {
+			case <-ctx.Done():
+			case errCh <- t.stream2:
+			}
+		}
+	}()
+	return ch, errCh
+}
+
+func Test_WithTransport(t *testing.T) {
+	t.Parallel()
+	transport := &testTransport{get1: []byte(`{"p_no":"2","p_errno":"0","sCLMID":"CLMZanKaiKanougaku","sResultCode":"0"}`)}
+	c := NewClient(EnvironmentDemo, ApiVersionLatest, WithTransport(transport)).(*client)
+	c.clock = &testClock{Now1: time.Date(2022, 3, 11, 10, 43, 0, 0, time.Local)}
+
+	got1, got2 := c.StockWallet(context.Background(), &Session{RequestURL: "https://example.com/request/"}, StockWalletRequest{IssueCode: "1475"})
+	if got2 != nil || got1.MessageType != MessageTypeStockWallet || got1.ResultCode != "0" {
+		t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), MessageTypeStockWallet, nil, got1, got2)
+	}
+
+	wantReq := (&StockWalletRequest{IssueCode: "1475"}).request(1, time.Date(2022, 3, 11, 10, 43, 0, 0, time.Local))
+	want := []interface{}{"https://example.com/request/", wantReq}
+	if !reflect.DeepEqual(want, transport.getHistory) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, transport.getHistory)
+	}
+}
+
+func Test_NewTransport(t *testing.T) {
+	t.Parallel()
+	want := &requesterTransport{requester: &requester{}}
+	got := NewTransport()
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), want, got)
+	}
+}
+
+func Test_requesterTransport(t *testing.T) {
+	t.Parallel()
+	requester := &testRequester{get1: []byte("get"), stream1: make(chan []byte), stream2: make(chan error)}
+	transport := &requesterTransport{requester: requester}
+
+	got1, got2 := transport.Get(context.Background(), "https://example.com/", LoginRequest{})
+	got3, got4 := transport.Stream(context.Background(), "https://example.com/", StreamRequest{})
+	if string(got1) != "get" || got2 != nil || got3 != (<-chan []byte)(requester.stream1) || got4 != (<-chan error)(requester.stream2) {
+		t.Errorf("%s error\ngot: %+v, %+v, %+v, %+v\n", t.Name(), got1, got2, got3, got4)
+	}
+}
@@ -0,0 +1,241 @@
+package tachibana
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OrderViolationType - 注文の違反の種類
+type OrderViolationType string
+
+const (
+	OrderViolationTypeUnspecified  OrderViolationType = ""              // 未指定
+	OrderViolationTypeUnknownIssue OrderViolationType = "unknown_issue" // マスタにない銘柄
+	OrderViolationTypeStopTrading  OrderViolationType = "stop_trading"  // 売買停止中
+	OrderViolationTypeTradingUnit  OrderViolationType = "trading_unit"  // 数量が売買単位の倍数でない
+	OrderViolationTypePriceLimit   OrderViolationType = "price_limit"   // 値段が値幅制限の範囲外
+	OrderViolationTypeTickSize     OrderViolationType = "tick_size"     // 値段が呼値の単位に合っていない
+	OrderViolationTypeStopOrder    OrderViolationType = "stop_order"    // 逆指値注文種別と逆指値条件、値段の組み合わせが正しくない
+)
+
+// OrderViolation - 注文の違反
+type OrderViolation struct {
+	Type    OrderViolationType // 種類
+	Field   string             // 違反したリクエストの項目名
+	Message string             // 説明
+}
+
+// validatorIssue - 検証に使う銘柄のマスタ
+type validatorIssue struct {
+	stock    StockMaster
+	exchange StockExchangeMaster
+}
+
+// NewValidator - キャッシュしたマスタから注文の検証を生成する ticksがnilなら呼値の単位は確認しない
+// マスタを取得し直したら作り直す
+func NewValidator(stockMasters []StockMaster, exchangeMasters []StockExchangeMaster, ticks *TickService) *Validator {
+	stocks := map[string]StockMaster{}
+	for _, m := range stockMasters {
+		stocks[m.IssueCode] = m
+	}
+	issues := map[string]map[Exchange]validatorIssue{}
+	for _, m := range exchangeMasters {
+		stock, ok := stocks[m.IssueCode]
+		if !ok {
+			continue
+		}
+		if _, ok := issues[m.IssueCode]; !ok {
+			issues[m.IssueCode] = map[Exchange]validatorIssue{}
+		}
+		issues[m.IssueCode][m.Exchange] = validatorIssue{stock: stock, exchange: m}
+	}
+	return &Validator{stocks: stocks, issues: issues, ticks: ticks}
+}
+
+// Validator - 注文を送る前に、売買単位、値幅制限、呼値の単位、売買停止、逆指値の指定を確認する
+type Validator struct {
+	stocks map[string]StockMaster                 // 銘柄コードごとの株式銘柄マスタ
+	issues map[string]map[Exchange]validatorIssue // 銘柄コードと市場ごとのマスタ
+	ticks  *TickService
+}
+
+// issue - 銘柄のマスタ 市場が未指定なら銘柄の優先市場、優先市場もなければ東証のもの
+func (v *Validator) issue(issueCode string, exchange Exchange) (validatorIssue, bool) {
+	if exchange == ExchangeUnspecified {
+		exchange = v.stocks[issueCode].PrimaryExchange
+	}
+	if exchange == ExchangeUnspecified {
+		exchange = ExchangeToushou
+	}
+	issue, ok := v.issues[issueCode][exchange]
+	return issue, ok
+}
+
+// validateIssue - 銘柄のマスタと売買停止
+func (v *Validator) validateIssue(issueCode string, exchange Exchange) (validatorIssue, []OrderViolation) {
+	issue, ok := v.issue(issueCode, exchange)
+	if !ok {
+		return issue, []OrderViolation{{Type: OrderViolationTypeUnknownIssue, Field: "IssueCode",
+			Message: fmt.Sprintf("issue %s(%s) is not found in masters", issueCode, exchange)}}
+	}
+	if issue.stock.StopTradingType == StopTradingTypeStopping {
+		return issue, []OrderViolation{{Type: OrderViolationTypeStopTrading, Field: "IssueCode",
+			Message: fmt.Sprintf("trading of %s is stopped", issueCode)}}
+	}
+	return issue, nil
+}
+
+// validateQuantity - 数量が売買単位の倍数か
+func (v *Validator) validateQuantity(issue validatorIssue, quantity float64) []OrderViolation {
+	unit := issue.exchange.TradingUnit
+	if unit <= 0 {
+		unit = issue.stock.TradingUnit
+	}
+	if quantity <= 0 || (unit > 0 && !onTick(quantity, unit)) {
+		return []OrderViolation{{Type: OrderViolationTypeTradingUnit, Field: "OrderQuantity",
+			Message: fmt.Sprintf("order quantity %v is not a multiple of trading unit %v", quantity, unit)}}
+	}
+	return nil
+}
+
+// validatePrice - 値段が値幅制限の範囲内で、呼値の単位に合っているか 0以下は成行として確認しない
+func (v *Validator) validatePrice(issue validatorIssue, field string, price float64) []OrderViolation {
+	if price <= 0 || price == NoChangeFloat {
+		return nil
+	}
+
+	var violations []OrderViolation
+	under, upper := issue.exchange.UnderLimitPrice, issue.exchange.UpperLimitPrice
+	if (under > 0 && price < under) || (upper > 0 && price > upper) {
+		violations = append(violations, OrderViolation{Type: OrderViolationTypePriceLimit, Field: field,
+			Message: fmt.Sprintf("%s %v is out of price limit %v-%v", field, price, under, upper)})
+	}
+	if v.ticks != nil {
+		if size, err := v.ticks.TickSize(issue.exchange.IssueCode, issue.exchange.Exchange, price); err == nil && !onTick(price, size) {
+			violations = append(violations, OrderViolation{Type: OrderViolationTypeTickSize, Field: field,
+				Message: fmt.Sprintf("%s %v is not a multiple of tick size %v", field, price, size)})
+		}
+	}
+	return violations
+}
+
+// stopOrderViolation - 逆指値の指定の違反
+func stopOrderViolation(field string, format string, a ...interface{}) OrderViolation {
+	return OrderViolation{Type: OrderViolationTypeStopOrder, Field: field, Message: fmt.Sprintf(format, a...)}
+}
+
+// ValidateNewOrder - 新規注文を検証する 違反がなければnil
+func (v *Validator) ValidateNewOrder(req NewOrderRequest) []OrderViolation {
+	issue, violations := v.validateIssue(req.IssueCode, req.Exchange)
+	if len(violations) > 0 {
+		return violations
+	}
+
+	violations = append(violations, v.validateQuantity(issue, req.OrderQuantity)...)
+	switch req.StopOrderType {
+	case StopOrderTypeStop:
+		if req.TriggerPrice <= 0 {
+			violations = append(violations, stopOrderViolation("TriggerPrice", "stop order requires trigger price"))
+		}
+		violations = append(violations, v.validatePrice(issue, "TriggerPrice", req.TriggerPrice)...)
+		violations = append(violations, v.validatePrice(issue, "StopOrderPrice", req.StopOrderPrice)...)
+	case StopOrderTypeOCO:
+		if req.OrderPrice <= 0 {
+			violations = append(violations, stopOrderViolation("OrderPrice", "oco order requires limit order price"))
+		}
+		if req.TriggerPrice <= 0 {
+			violations = append(violations, stopOrderViolation("TriggerPrice", "oco order requires trigger price"))
+		}
+		// 買いは指値より上、売りは指値より下で逆指値が発火する
+		if req.OrderPrice > 0 && req.TriggerPrice > 0 &&
+			((req.Side == SideBuy && req.TriggerPrice <= req.OrderPrice) || (req.Side == SideSell && req.TriggerPrice >= req.OrderPrice)) {
+			violations = append(violations, stopOrderViolation("TriggerPrice", "trigger price %v of %s oco order is on the wrong side of order price %v", req.TriggerPrice, req.Side, req.OrderPrice))
+		}
+		violations = append(violations, v.validatePrice(issue, "OrderPrice", req.OrderPrice)...)
+		violations = append(violations, v.validatePrice(issue, "TriggerPrice", req.TriggerPrice)...)
+		violations = append(violations, v.validatePrice(issue, "StopOrderPrice", req.StopOrderPrice)...)
+	default:
+		if req.TriggerPrice != 0 || req.StopOrderPrice != 0 {
+			violations = append(violations, stopOrderViolation("StopOrderType", "trigger price and stop order price require stop or oco order"))
+		}
+		violations = append(violations, v.validatePrice(issue, "OrderPrice", req.OrderPrice)...)
+	}
+	return violations
+}
+
+// ValidateCorrectOrder - 訂正注文を、訂正する注文の詳細と合わせて検証する 違反がなければnil
+func (v *Validator) ValidateCorrectOrder(req CorrectOrderRequest, order *OrderDetailResponse) []OrderViolation {
+	if order == nil {
+		return []OrderViolation{{Type: OrderViolationTypeUnknownIssue, Field: "OrderNumber", Message: fmt.Sprintf("order %s is not found", req.OrderNumber)}}
+	}
+	issue, violations := v.validateIssue(order.IssueCode, order.Exchange)
+	if len(violations) > 0 {
+		return violations
+	}
+
+	if req.OrderQuantity != NoChangeFloat {
+		violations = append(violations, v.validateQuantity(issue, req.OrderQuantity)...)
+	}
+	if order.StopOrderType != StopOrderTypeStop && order.StopOrderType != StopOrderTypeOCO &&
+		((req.TriggerPrice != NoChangeFloat && req.TriggerPrice != 0) || (req.StopOrderPrice != NoChangeFloat && req.StopOrderPrice != 0)) {
+		violations = append(violations, stopOrderViolation("TriggerPrice", "order %s is not a stop or oco order", req.OrderNumber))
+	}
+	if order.StopOrderType == StopOrderTypeStop && req.TriggerPrice != NoChangeFloat && req.TriggerPrice <= 0 {
+		violations = append(violations, stopOrderViolation("TriggerPrice", "stop order requires trigger price"))
+	}
+	violations = append(violations, v.validatePrice(issue, "OrderPrice", req.OrderPrice)...)
+	violations = append(violations, v.validatePrice(issue, "TriggerPrice", req.TriggerPrice)...)
+	violations = append(violations, v.validatePrice(issue, "StopOrderPrice", req.StopOrderPrice)...)
+	return violations
+}
+
+// orderViolationMessage - 違反をまとめたメッセージ
+func orderViolationMessage(violations []OrderViolation) string {
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = fmt.Sprintf("%s(%s)", v.Message, v.Type)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// orderViolationError - 違反をまとめたエラー
+func orderViolationError(violations []OrderViolation) error {
+	return fmt.Errorf("%s: %w", orderViolationMessage(violations), OrderViolationErr)
+}
+
+// NewValidatingClient - 新規注文と訂正注文を送る前にvalidatorで検証するクライアントを生成する
+// 違反があれば注文を送らずに、OrderViolationErrを包んだエラーを返す
+func NewValidatingClient(client Client, validator *Validator) Client {
+	return &validatingClient{Client: client, validator: validator}
+}
+
+// validatingClient - 注文を検証するクライアント
+type validatingClient struct {
+	Client
+	validator *Validator
+}
+
+// NewOrder - 検証してから新規注文を送る
+func (c *validatingClient) NewOrder(ctx context.Context, session *Session, req NewOrderRequest) (*NewOrderResponse, error) {
+	if violations := c.validator.ValidateNewOrder(req); len(violations) > 0 {
+		return nil, orderViolationError(violations)
+	}
+	return c.Client.NewOrder(ctx, session, req)
+}
+
+// CorrectOrder - 訂正する注文を注文詳細で取得してから検証する
+func (c *validatingClient) CorrectOrder(ctx context.Context, session *Session, req CorrectOrderRequest) (*CorrectOrderResponse, error) {
+	if session == nil {
+		return nil, NilArgumentErr
+	}
+
+	order, err := c.Client.OrderDetail(ctx, session, OrderDetailRequest{OrderNumber: req.OrderNumber, ExecutionDate: req.ExecutionDate})
+	if err != nil {
+		return nil, err
+	}
+	if violations := c.validator.ValidateCorrectOrder(req, order); len(violations) > 0 {
+		return nil, orderViolationError(violations)
+	}
+	return c.Client.CorrectOrder(ctx, session, req)
+}
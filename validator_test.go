@@ -0,0 +1,216 @@
+package tachibana
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestValidator - 1475は売買単位10で値幅500-2000、呼値は営業日の2022/07/26のもの、1476は売買停止中
+func newTestValidator() *Validator {
+	stocks := []StockMaster{
+		{IssueCode: "1475", TradingUnit: 1, PrimaryExchange: ExchangeToushou},
+		{IssueCode: "1476", TradingUnit: 1, StopTradingType: StopTradingTypeStopping},
+	}
+	exchanges := []StockExchangeMaster{
+		{IssueCode: "1475", Exchange: ExchangeToushou, TradingUnit: 10, UnderLimitPrice: 500, UpperLimitPrice: 2000},
+		{IssueCode: "1476", Exchange: ExchangeToushou, TradingUnit: 1},
+	}
+	return NewValidator(stocks, exchanges, newTestTickService(time.Date(2022, 7, 26, 10, 0, 0, 0, time.Local)))
+}
+
+// violationTypes - 違反の種類の一覧
+func violationTypes(violations []OrderViolation) []OrderViolationType {
+	var types []OrderViolationType
+	for _, v := range violations {
+		types = append(types, v.Type)
+	}
+	return types
+}
+
+func Test_Validator_ValidateNewOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  NewOrderRequest
+		want []OrderViolationType
+	}{
+		{name: "正しい指値注文は違反なし",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 20, OrderPrice: 1000.5},
+			want: nil},
+		{name: "成行は値段を確認しない",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 20, OrderPrice: 0},
+			want: nil},
+		{name: "市場が未指定なら優先市場",
+			arg:  NewOrderRequest{IssueCode: "1475", Side: SideBuy, OrderQuantity: 20, OrderPrice: 1000},
+			want: nil},
+		{name: "マスタにない銘柄",
+			arg:  NewOrderRequest{IssueCode: "9999", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 20, OrderPrice: 1000},
+			want: []OrderViolationType{OrderViolationTypeUnknownIssue}},
+		{name: "マスタにない市場",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeMeishou, Side: SideBuy, OrderQuantity: 20, OrderPrice: 1000},
+			want: []OrderViolationType{OrderViolationTypeUnknownIssue}},
+		{name: "売買停止中",
+			arg:  NewOrderRequest{IssueCode: "1476", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 1, OrderPrice: 1000},
+			want: []OrderViolationType{OrderViolationTypeStopTrading}},
+		{name: "売買単位の倍数でない",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 15, OrderPrice: 1000},
+			want: []OrderViolationType{OrderViolationTypeTradingUnit}},
+		{name: "数量が0",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 0, OrderPrice: 1000},
+			want: []OrderViolationType{OrderViolationTypeTradingUnit}},
+		{name: "値幅上限を超える",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 10, OrderPrice: 2001},
+			want: []OrderViolationType{OrderViolationTypePriceLimit}},
+		{name: "値幅下限を下回り、呼値にも合っていない",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 10, OrderPrice: 499.95},
+			want: []OrderViolationType{OrderViolationTypePriceLimit, OrderViolationTypeTickSize}},
+		{name: "呼値に合っていない",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 10, OrderPrice: 1000.3},
+			want: []OrderViolationType{OrderViolationTypeTickSize}},
+		{name: "通常注文に逆指値条件",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 10, OrderPrice: 1000, StopOrderType: StopOrderTypeNormal, TriggerPrice: 1100},
+			want: []OrderViolationType{OrderViolationTypeStopOrder}},
+		{name: "正しい逆指値注文",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideSell, OrderQuantity: 10, StopOrderType: StopOrderTypeStop, TriggerPrice: 900, StopOrderPrice: 899.9},
+			want: nil},
+		{name: "逆指値注文に逆指値条件がない",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideSell, OrderQuantity: 10, StopOrderType: StopOrderTypeStop, StopOrderPrice: 899.9},
+			want: []OrderViolationType{OrderViolationTypeStopOrder}},
+		{name: "逆指値注文の逆指値値段が呼値に合っていない",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideSell, OrderQuantity: 10, StopOrderType: StopOrderTypeStop, TriggerPrice: 900, StopOrderPrice: 899.95},
+			want: []OrderViolationType{OrderViolationTypeTickSize}},
+		{name: "正しい買いのOCO注文",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 10, OrderPrice: 900, StopOrderType: StopOrderTypeOCO, TriggerPrice: 1100},
+			want: nil},
+		{name: "OCO注文に指値がない",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 10, StopOrderType: StopOrderTypeOCO, TriggerPrice: 1100},
+			want: []OrderViolationType{OrderViolationTypeStopOrder}},
+		{name: "売りのOCO注文の逆指値条件が指値より上",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideSell, OrderQuantity: 10, OrderPrice: 900, StopOrderType: StopOrderTypeOCO, TriggerPrice: 1100},
+			want: []OrderViolationType{OrderViolationTypeStopOrder}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := violationTypes(newTestValidator().ValidateNewOrder(test.arg))
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_Validator_ValidateCorrectOrder(t *testing.T) {
+	t.Parallel()
+	normal := &OrderDetailResponse{IssueCode: "1475", Exchange: ExchangeToushou, StopOrderType: StopOrderTypeNormal}
+	stop := &OrderDetailResponse{IssueCode: "1475", Exchange: ExchangeToushou, StopOrderType: StopOrderTypeStop}
+	noChange := CorrectOrderRequest{OrderPrice: NoChangeFloat, OrderQuantity: NoChangeFloat, TriggerPrice: NoChangeFloat, StopOrderPrice: NoChangeFloat}
+	with := func(f func(r *CorrectOrderRequest)) CorrectOrderRequest {
+		r := noChange
+		f(&r)
+		return r
+	}
+	tests := []struct {
+		name string
+		arg1 CorrectOrderRequest
+		arg2 *OrderDetailResponse
+		want []OrderViolationType
+	}{
+		{name: "変更なしなら違反なし", arg1: noChange, arg2: normal, want: nil},
+		{name: "注文がなければ違反", arg1: noChange, arg2: nil, want: []OrderViolationType{OrderViolationTypeUnknownIssue}},
+		{name: "売買停止中", arg1: noChange, arg2: &OrderDetailResponse{IssueCode: "1476", Exchange: ExchangeToushou}, want: []OrderViolationType{OrderViolationTypeStopTrading}},
+		{name: "値段を呼値に合わない値段に訂正", arg1: with(func(r *CorrectOrderRequest) { r.OrderPrice = 1000.3 }), arg2: normal, want: []OrderViolationType{OrderViolationTypeTickSize}},
+		{name: "値段を値幅制限の外に訂正", arg1: with(func(r *CorrectOrderRequest) { r.OrderPrice = 2001 }), arg2: normal, want: []OrderViolationType{OrderViolationTypePriceLimit}},
+		{name: "値段を成行に訂正", arg1: with(func(r *CorrectOrderRequest) { r.OrderPrice = 0 }), arg2: normal, want: nil},
+		{name: "数量を売買単位の倍数でない数量に訂正", arg1: with(func(r *CorrectOrderRequest) { r.OrderQuantity = 5 }), arg2: normal, want: []OrderViolationType{OrderViolationTypeTradingUnit}},
+		{name: "通常注文の逆指値条件は訂正できない", arg1: with(func(r *CorrectOrderRequest) { r.TriggerPrice = 1100 }), arg2: normal, want: []OrderViolationType{OrderViolationTypeStopOrder}},
+		{name: "逆指値注文の逆指値条件を訂正", arg1: with(func(r *CorrectOrderRequest) { r.TriggerPrice = 1100 }), arg2: stop, want: nil},
+		{name: "逆指値注文の逆指値条件をなくす", arg1: with(func(r *CorrectOrderRequest) { r.TriggerPrice = 0 }), arg2: stop, want: []OrderViolationType{OrderViolationTypeStopOrder}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			got := violationTypes(newTestValidator().ValidateCorrectOrder(test.arg1, test.arg2))
+			if !reflect.DeepEqual(test.want, got) {
+				t.Errorf("%s error\nwant: %+v\ngot: %+v\n", t.Name(), test.want, got)
+			}
+		})
+	}
+}
+
+func Test_validatingClient_NewOrder(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		arg       NewOrderRequest
+		want      *NewOrderResponse
+		wantErr   error
+		wantCount int
+	}{
+		{name: "違反がなければ注文を送る",
+			arg:  NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 10, OrderPrice: 1000},
+			want: &NewOrderResponse{OrderNumber: "1"}, wantCount: 1},
+		{name: "違反があれば注文を送らずにエラー",
+			arg:     NewOrderRequest{IssueCode: "1475", Exchange: ExchangeToushou, Side: SideBuy, OrderQuantity: 15, OrderPrice: 1000},
+			wantErr: OrderViolationErr, wantCount: 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{newOrder1: &NewOrderResponse{OrderNumber: "1"}}
+			got, err := NewValidatingClient(client, newTestValidator()).NewOrder(context.Background(), &Session{}, test.arg)
+			if !reflect.DeepEqual(test.want, got) || !errors.Is(err, test.wantErr) || test.wantCount != client.newOrderCount {
+				t.Errorf("%s error\nwant: %+v, %+v, %+v\ngot: %+v, %+v, %+v\n", t.Name(), test.want, test.wantErr, test.wantCount, got, err, client.newOrderCount)
+			}
+		})
+	}
+}
+
+func Test_validatingClient_CorrectOrder(t *testing.T) {
+	t.Parallel()
+	detailErr := errors.New("detail error")
+	tests := []struct {
+		name      string
+		session   *Session
+		detail1   *OrderDetailResponse
+		detail2   error
+		arg       CorrectOrderRequest
+		wantErr   error
+		wantCount int
+	}{
+		{name: "違反がなければ訂正を送る", session: &Session{},
+			detail1:   &OrderDetailResponse{IssueCode: "1475", Exchange: ExchangeToushou},
+			arg:       CorrectOrderRequest{OrderPrice: 1000.5, OrderQuantity: NoChangeFloat, TriggerPrice: NoChangeFloat, StopOrderPrice: NoChangeFloat},
+			wantCount: 1},
+		{name: "違反があれば訂正を送らずにエラー", session: &Session{},
+			detail1: &OrderDetailResponse{IssueCode: "1475", Exchange: ExchangeToushou},
+			arg:     CorrectOrderRequest{OrderPrice: 1000.3, OrderQuantity: NoChangeFloat, TriggerPrice: NoChangeFloat, StopOrderPrice: NoChangeFloat},
+			wantErr: OrderViolationErr, wantCount: 0},
+		{name: "注文詳細のエラーはそのまま返す", session: &Session{},
+			detail2: detailErr,
+			arg:     CorrectOrderRequest{OrderPrice: 1000.5, OrderQuantity: NoChangeFloat, TriggerPrice: NoChangeFloat, StopOrderPrice: NoChangeFloat},
+			wantErr: detailErr, wantCount: 0},
+		{name: "sessionがnilならエラー", session: nil, wantErr: NilArgumentErr, wantCount: 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			client := &testClient{correctOrder1: &CorrectOrderResponse{}, orderDetail1: test.detail1, orderDetail2: test.detail2}
+			_, err := NewValidatingClient(client, newTestValidator()).CorrectOrder(context.Background(), test.session, test.arg)
+			if !errors.Is(err, test.wantErr) || test.wantCount != client.correctCount {
+				t.Errorf("%s error\nwant: %+v, %+v\ngot: %+v, %+v\n", t.Name(), test.wantErr, test.wantCount, err, client.correctCount)
+			}
+		})
+	}
+}